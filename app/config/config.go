@@ -1,6 +1,7 @@
 package config
 
 import (
+	"CartoonBurgers/models"
 	"log"
 	"time"
 
@@ -14,6 +15,15 @@ type Config struct {
 	Redis       RedisConfig
 	JWT         JWTConfig
 	RateLimit   RateLimitConfig
+	Locale      LocaleConfig
+	Store       StoreConfig
+	Admin       AdminConfig
+	Cart        CartConfig
+	Loyalty     LoyaltyConfig
+	Mail        MailConfig
+	Account     AccountConfig
+	OIDC        OIDCConfig
+	Phone       PhoneConfig
 }
 
 type EnvironmentConfig struct {
@@ -23,6 +33,8 @@ type EnvironmentConfig struct {
 type ServerConfig struct {
 	Port         string
 	CookieSecure bool
+	// PublicURL is where users open the site, links in mail start with it.
+	PublicURL string
 }
 
 type DatabaseConfig struct {
@@ -36,7 +48,48 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
+	// Algorithm is RS256 or EdDSA to sign with generated keys published at
+	// /.well-known/jwks.json, or HS256 to sign with SecretKey.
+	Algorithm string
 	SecretKey string
+	// KeyRotation is how long a generated key signs before a new one
+	// replaces it, KeyCheckInterval is how often that is checked.
+	KeyRotation      time.Duration
+	KeyCheckInterval time.Duration
+	// AccessTokenTTL and RefreshTokenTTL are the lifetimes of the tokens
+	// issued on login and refresh.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// OIDCConfig lists the OpenID Connect providers users can log in with.
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig
+}
+
+type OIDCProviderConfig struct {
+	// Name is used in URLs, DisplayName on the login button.
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// PhoneConfig is phone login with SMS codes.
+type PhoneConfig struct {
+	// SMSDriver is "log" or "memory", the log driver writes messages with
+	// their codes to the log for local development.
+	SMSDriver string
+	// CountryCode and TrunkPrefix read numbers dialled without a country
+	// code, like 8 912 123-45-67 for "7" and "8".
+	CountryCode string
+	TrunkPrefix string
+	// CodeTTL is how long a texted code works, a new one can be asked for
+	// every ResendCooldown.
+	CodeTTL        time.Duration
+	ResendCooldown time.Duration
 }
 
 type RateLimitConfig struct {
@@ -44,6 +97,99 @@ type RateLimitConfig struct {
 	Window      time.Duration
 }
 
+type LocaleConfig struct {
+	Default   string
+	Supported []string
+}
+
+type StoreConfig struct {
+	Timezone string
+	// SuggestionLimit is how many "order again" products the menu suggests.
+	SuggestionLimit int
+}
+
+type AdminConfig struct {
+	// Usernames are granted the admin role on startup while there is no
+	// admin, this is how the first admin is created. Later admins are
+	// granted through the admin API.
+	Usernames []string
+}
+
+type CartConfig struct {
+	// Store is "redis" or "memory".
+	Store string
+	// MergeStrategy is "sum" or "max", see models.CartMergeStrategy.
+	MergeStrategy string
+	// MaxItemQuantity and MaxQuantity limit one product and the whole cart.
+	MaxItemQuantity int
+	MaxQuantity     int
+	// DeliveryFee and FreeDeliveryFrom are in minor units.
+	DeliveryFee      int64
+	FreeDeliveryFrom int64
+	// AbandonAfter is the idle time after which a logged in user's cart is
+	// reminded about, checked every AbandonCheckInterval.
+	AbandonAfter         time.Duration
+	AbandonCheckInterval time.Duration
+}
+
+type LoyaltyConfig struct {
+	EarnPercent float64
+	// CategoryMultipliers are keyed by category slug.
+	CategoryMultipliers map[string]float64
+	PointsLifetime      time.Duration
+	MaxSpendPercent     int64
+	ExpiryInterval      time.Duration
+	// Tiers replace services.DefaultTierRules when set.
+	Tiers []models.TierRule
+	// TierRecalculationAt is the "15:04" store time of the nightly tier job.
+	TierRecalculationAt string
+}
+
+type MailConfig struct {
+	// Driver is "smtp", "file" or "memory". The file driver writes .eml
+	// files to Dir for local development.
+	Driver string
+	From   string
+	Dir    string
+	SMTP   SMTPConfig
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+type AccountConfig struct {
+	// PasswordResetTTL is how long a mailed reset link works, an account
+	// gets one link every PasswordResetCooldown.
+	PasswordResetTTL      time.Duration
+	PasswordResetCooldown time.Duration
+	// EmailVerificationTTL is how long a verification link works, a new
+	// one can be asked for every VerificationResendCooldown.
+	EmailVerificationTTL       time.Duration
+	VerificationResendCooldown time.Duration
+	// RequireVerifiedEmail blocks checkout for unverified accounts,
+	// browsing and the cart still work.
+	RequireVerifiedEmail bool
+	// MFAIssuer names the account in authenticator apps.
+	MFAIssuer string
+	Lockout   LockoutConfig
+}
+
+// LockoutConfig locks out a username after UserFailures failed logins and
+// an IP after IPFailures. The first lockout lasts Lockout, every further
+// failure doubles it up to MaxLockout. Failures are forgotten Window after
+// the last one.
+type LockoutConfig struct {
+	UserFailures int
+	IPFailures   int
+	Lockout      time.Duration
+	MaxLockout   time.Duration
+	Window       time.Duration
+}
+
 func LoadConfig() (config Config, err error) {
 	viper.SetConfigName("app")
 	viper.AddConfigPath("./config")
@@ -59,20 +205,65 @@ func LoadConfig() (config Config, err error) {
 
 	viper.SetDefault("environment.current", "development")
 	viper.SetDefault("server.port", "8080")
+	viper.SetDefault("server.publicurl", "http://localhost:8080")
 	viper.SetDefault("database.path", "./burgers.db")
 	viper.SetDefault("redis.addr", "localhost:6379")
 	viper.SetDefault("redis.password", "")
 	viper.SetDefault("redis.db", 0)
+	viper.SetDefault("jwt.algorithm", "RS256")
 	viper.SetDefault("jwt.secretkey", "your_default_secret_change_in_production")
+	viper.SetDefault("jwt.keyrotation", 30*24*time.Hour)
+	viper.SetDefault("jwt.keycheckinterval", time.Minute)
+	viper.SetDefault("jwt.accesstokenttl", 15*time.Minute)
+	viper.SetDefault("jwt.refreshtokenttl", 30*24*time.Hour)
 	viper.SetDefault("ratelimit.maxrequests", 100)
 	viper.SetDefault("ratelimit.window", time.Minute)
+	viper.SetDefault("locale.default", "ru")
+	viper.SetDefault("locale.supported", []string{"ru", "en"})
+	viper.SetDefault("store.timezone", "Europe/Moscow")
+	viper.SetDefault("store.suggestionlimit", 8)
+	viper.SetDefault("admin.usernames", []string{})
+	viper.SetDefault("cart.store", "redis")
+	viper.SetDefault("cart.mergestrategy", "sum")
+	viper.SetDefault("cart.maxitemquantity", 20)
+	viper.SetDefault("cart.maxquantity", 50)
+	viper.SetDefault("cart.deliveryfee", 19900)
+	viper.SetDefault("cart.freedeliveryfrom", 150000)
+	viper.SetDefault("cart.abandonafter", 24*time.Hour)
+	viper.SetDefault("cart.abandoncheckinterval", 15*time.Minute)
+	viper.SetDefault("loyalty.earnpercent", 5)
+	viper.SetDefault("loyalty.categorymultipliers", map[string]float64{})
+	viper.SetDefault("loyalty.pointslifetime", 365*24*time.Hour)
+	viper.SetDefault("loyalty.maxspendpercent", 50)
+	viper.SetDefault("loyalty.expiryinterval", time.Hour)
+	viper.SetDefault("loyalty.tierrecalculationat", "03:00")
+	viper.SetDefault("mail.driver", "file")
+	viper.SetDefault("mail.from", "Cartoon Burgers <no-reply@cartoonburgers.local>")
+	viper.SetDefault("mail.dir", "./mail")
+	viper.SetDefault("mail.smtp.port", 587)
+	viper.SetDefault("account.passwordresetttl", time.Hour)
+	viper.SetDefault("account.passwordresetcooldown", time.Minute)
+	viper.SetDefault("account.emailverificationttl", 48*time.Hour)
+	viper.SetDefault("account.verificationresendcooldown", time.Minute)
+	viper.SetDefault("account.requireverifiedemail", true)
+	viper.SetDefault("account.mfaissuer", "Cartoon Burgers")
+	viper.SetDefault("account.lockout.userfailures", 5)
+	viper.SetDefault("account.lockout.ipfailures", 20)
+	viper.SetDefault("account.lockout.lockout", 30*time.Second)
+	viper.SetDefault("account.lockout.maxlockout", time.Hour)
+	viper.SetDefault("account.lockout.window", time.Hour)
+	viper.SetDefault("phone.smsdriver", "log")
+	viper.SetDefault("phone.countrycode", "7")
+	viper.SetDefault("phone.trunkprefix", "8")
+	viper.SetDefault("phone.codettl", 5*time.Minute)
+	viper.SetDefault("phone.resendcooldown", time.Minute)
 
 	err = viper.Unmarshal(&config)
 	if err != nil {
 		return config, err
 	}
 
-	if config.JWT.SecretKey == "your_default_secret_change_in_production" {
+	if config.JWT.Algorithm == "HS256" && config.JWT.SecretKey == "your_default_secret_change_in_production" {
 		log.Println("WARNING: Using default JWT secret key. This is insecure for production.")
 	}
 
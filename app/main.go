@@ -3,15 +3,21 @@ package main
 import (
 	"CartoonBurgers/app/config"
 	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
 	"CartoonBurgers/repositories"
+	"CartoonBurgers/services"
 	"context"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis"
@@ -33,6 +39,69 @@ func initRedis(cfg config.RedisConfig) *redis.Client {
 	return rdb
 }
 
+func newCartService(cfg config.CartConfig, rdb *redis.Client, limits services.CartLimits) ports.CartService {
+	if cfg.Store == "memory" {
+		return services.NewInMemoryCartService(limits)
+	}
+	return services.NewRedisCartService(rdb, limits)
+}
+
+func newMailer(cfg config.MailConfig) (ports.Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return services.NewSMTPMailer(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.From)
+	case "memory":
+		return services.NewInMemoryMailer(), nil
+	case "file":
+		return services.NewFileMailer(cfg.Dir, cfg.From), nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+}
+
+func newSMSSender(cfg config.PhoneConfig, logger *slog.Logger) (ports.SMSSender, error) {
+	switch cfg.SMSDriver {
+	case "log":
+		return services.NewLogSMSSender(logger), nil
+	case "memory":
+		return services.NewInMemorySMSSender(), nil
+	}
+	return nil, fmt.Errorf("unknown sms driver %q", cfg.SMSDriver)
+}
+
+// newJWTKeys returns the keys access tokens are signed with. Generated keys
+// are loaded, or created, before the server starts.
+func newJWTKeys(cfg config.JWTConfig, repo *repositories.SigningKeyRepository, logger *slog.Logger) (services.JWTKeys, error) {
+	if cfg.Algorithm == services.AlgorithmHS256 {
+		return services.NewHMACKeys([]byte(cfg.SecretKey)), nil
+	}
+
+	keys, err := services.NewRotatingKeys(repo, cfg.Algorithm, cfg.KeyRotation, cfg.KeyCheckInterval, cfg.AccessTokenTTL, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := keys.Rotate(context.Background()); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// newOIDCProviders returns the configured login providers, they redirect
+// back to the SPA which posts the code to the callback API.
+func newOIDCProviders(cfg config.OIDCConfig, publicURL string) []*services.OIDCProvider {
+	providers := make([]*services.OIDCProvider, 0, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		providers = append(providers, services.NewOIDCProvider(services.OIDCProviderConfig{
+			Name:         p.Name,
+			DisplayName:  p.DisplayName,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			Scopes:       p.Scopes,
+		}, strings.TrimSuffix(publicURL, "/")+"/oidc/"+p.Name+"/callback", nil))
+	}
+	return providers
+}
+
 // @title User API
 // @version 1.0
 // @description API for Cartoon Burgers authentication service
@@ -46,6 +115,16 @@ func main() {
 	if err != nil {
 		log.Fatal("Cannot load config:", err)
 	}
+	if !models.CartMergeStrategy(cfg.Cart.MergeStrategy).Valid() {
+		log.Fatal("Unknown cart merge strategy: ", cfg.Cart.MergeStrategy)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "menu" {
+		os.Exit(runMenuCommand(cfg, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "roles" {
+		os.Exit(runRolesCommand(cfg, os.Args[2:]))
+	}
 
 	var logger *slog.Logger
 	if cfg.Environment.Current == "development" {
@@ -87,28 +166,125 @@ func main() {
 	r.Static("/static", "./static")
 	r.LoadHTMLGlob("static/*.html")
 
-	menuHandler := handlers.NewMenuHandler(appRepo.ProductRerository)
-	authHandler := handlers.NewAuthHandlers(cfg.JWT.SecretKey, appRepo.UserRepository, logger)
-	profileHandler := handlers.NewProfileHandler(appRepo.UserRepository)
-	cartHandler := handlers.NewCartHandler(cfg.Server.CookieSecure)
+	storeLocation, err := time.LoadLocation(cfg.Store.Timezone)
+	if err != nil {
+		log.Fatal("Cannot load store timezone:", err)
+	}
+
+	localizer := services.NewLocalizer(cfg.Locale.Default, cfg.Locale.Supported)
+	menuService := services.NewMenuService(appRepo.ProductRerository, appRepo.CategoryRepository, localizer.Default, storeLocation)
+
+	favoritesService := services.NewFavoritesService(appRepo.FavoriteRepository, appRepo.OrderRepository, menuService, cfg.Store.SuggestionLimit)
+	menuHandler := handlers.NewMenuHandler(menuService, localizer, favoritesService)
+	favoritesHandler := handlers.NewFavoritesHandler(favoritesService, localizer)
+	cartLimits := services.CartLimits{MaxItemQuantity: cfg.Cart.MaxItemQuantity, MaxCartQuantity: cfg.Cart.MaxQuantity}
+	carts := newCartService(cfg.Cart, rdb, cartLimits)
+	cartPricer := services.NewCartPricer(menuService, cartLimits,
+		services.DeliveryPricing{Fee: cfg.Cart.DeliveryFee, FreeFrom: cfg.Cart.FreeDeliveryFrom})
+	tierService := services.NewTierService(appRepo.TierRepository, appRepo.BonusRepository, cfg.Loyalty.Tiers, storeLocation, cfg.Loyalty.PointsLifetime, logger)
+	promoService := services.NewPromoService(appRepo.PromoRepository, appRepo.OrderRepository, tierService)
+	loyaltyService := services.NewLoyaltyService(appRepo.BonusRepository, appRepo.CategoryRepository, tierService, services.LoyaltyRules{
+		EarnPercent:         cfg.Loyalty.EarnPercent,
+		CategoryMultipliers: cfg.Loyalty.CategoryMultipliers,
+		Lifetime:            cfg.Loyalty.PointsLifetime,
+		MaxSpendPercent:     cfg.Loyalty.MaxSpendPercent,
+	}, logger)
+	profileHandler := handlers.NewProfileHandler(appRepo.UserRepository, loyaltyService, tierService, appRepo.NotificationRepository)
+	abandonedCarts := services.NewAbandonedCartService(carts, cartPricer, appRepo.NotificationRepository, services.NewLogNotifier(logger), cfg.Cart.AbandonAfter, logger)
+	orderService := services.NewOrderService(appRepo.OrderRepository, carts, cartPricer, promoService, loyaltyService, logger)
+	orderHandler := handlers.NewOrderHandler(orderService)
+	groupCartHandler := handlers.NewGroupCartHandler(services.NewGroupCartService(appRepo.GroupCartRepository, menuService, cartPricer, orderService))
+
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go services.RunEvery(jobs, cfg.Loyalty.ExpiryInterval, logger, "bonus expiry", loyaltyService.ExpirePoints)
+	go services.RunEvery(jobs, cfg.Cart.AbandonCheckInterval, logger, "abandoned carts", abandonedCarts.Remind)
+	if err := services.RunDaily(jobs, cfg.Loyalty.TierRecalculationAt, storeLocation, logger, "tier recalculation", tierService.Recalculate); err != nil {
+		log.Fatal("Cannot schedule tier recalculation:", err)
+	}
+
+	roleService := services.NewRoleService(appRepo.RoleRepository, appRepo.UserRepository, logger)
+	if err := roleService.Bootstrap(context.Background(), cfg.Admin.Usernames); err != nil {
+		log.Fatal("Cannot grant bootstrap admins:", err)
+	}
+	roleHandler := handlers.NewRoleHandler(roleService)
+	jwtKeys, err := newJWTKeys(cfg.JWT, appRepo.SigningKeyRepository, logger)
+	if err != nil {
+		log.Fatal("Cannot init signing keys:", err)
+	}
+	if rotating, ok := jwtKeys.(*services.RotatingKeys); ok {
+		go services.RunEvery(jobs, cfg.JWT.KeyCheckInterval, logger, "signing key rotation", rotating.Rotate)
+	}
+	jwksHandler := handlers.NewJWKSHandler(jwtKeys)
+	tokenService := services.NewTokenService(jwtKeys, appRepo.RefreshTokenRepository, appRepo.SessionRepository, roleService, cfg.JWT.AccessTokenTTL, cfg.JWT.RefreshTokenTTL, logger)
+	go services.RunEvery(jobs, time.Hour, logger, "refresh token cleanup", tokenService.PurgeExpired)
+	sessionHandler := handlers.NewSessionHandler(tokenService, logger)
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		log.Fatal("Cannot init mailer:", err)
+	}
+	loginThrottle := services.NewLoginThrottle(services.NewRedisAttemptCounter(rdb), services.NewLogSecurityEvents(logger), services.LockoutPolicy{
+		UserFailures: cfg.Account.Lockout.UserFailures,
+		IPFailures:   cfg.Account.Lockout.IPFailures,
+		Lockout:      cfg.Account.Lockout.Lockout,
+		MaxLockout:   cfg.Account.Lockout.MaxLockout,
+		Window:       cfg.Account.Lockout.Window,
+	}, logger)
+	passwordResets := services.NewPasswordResetService(appRepo.UserRepository, appRepo.OneTimeTokenRepository, tokenService, rAdapter, loginThrottle, mailer,
+		strings.TrimSuffix(cfg.Server.PublicURL, "/")+"/reset-password", cfg.Account.PasswordResetTTL, cfg.Account.PasswordResetCooldown, logger)
+	passwordHandler := handlers.NewPasswordHandler(passwordResets)
+	emailVerification := services.NewEmailVerificationService(appRepo.UserRepository, appRepo.OneTimeTokenRepository, mailer,
+		strings.TrimSuffix(cfg.Server.PublicURL, "/")+"/verify-email", cfg.Account.EmailVerificationTTL, cfg.Account.VerificationResendCooldown, logger)
+	emailHandler := handlers.NewEmailHandler(emailVerification, cfg.Account.RequireVerifiedEmail, logger)
+	mfaService := services.NewMFAService(appRepo.MFARepository, appRepo.OneTimeTokenRepository, appRepo.UserRepository, cfg.Account.MFAIssuer, logger)
+	mfaHandler := handlers.NewMFAHandler(mfaService)
+	authHandler := handlers.NewAuthHandlers(jwtKeys, appRepo.UserRepository, logger, carts, models.CartMergeStrategy(cfg.Cart.MergeStrategy), tokenService, emailVerification, mfaService, loginThrottle)
+	oidcService := services.NewOIDCService(newOIDCProviders(cfg.OIDC, cfg.Server.PublicURL), appRepo.OIDCRepository, appRepo.UserRepository, logger)
+	oidcHandler := handlers.NewOIDCHandler(cfg.Server.CookieSecure, oidcService, authHandler, logger)
+	smsSender, err := newSMSSender(cfg.Phone, logger)
+	if err != nil {
+		log.Fatal("Cannot init sms sender:", err)
+	}
+	phoneService := services.NewPhoneService(appRepo.UserRepository, appRepo.PhoneRepository, smsSender,
+		models.PhoneRegion{CountryCode: cfg.Phone.CountryCode, TrunkPrefix: cfg.Phone.TrunkPrefix}, cfg.Phone.CodeTTL, cfg.Phone.ResendCooldown, logger)
+	go services.RunEvery(jobs, time.Hour, logger, "phone code cleanup", phoneService.PurgeExpired)
+	phoneHandler := handlers.NewPhoneHandler(phoneService, authHandler, logger)
+	catalogueHandler := handlers.NewCatalogueHandler(services.NewCatalogueService(appRepo.ProductRerository, appRepo.CategoryRepository, localizer.Default))
+	cartHandler := handlers.NewCartHandler(cfg.Server.CookieSecure, localizer, menuService, carts, cartPricer, promoService)
 
 	api := r.Group("/api")
 	api.Use(RateLimitMiddleware(limiter))
 	{
-		api.GET("/menu", menuHandler.GetMenu)
+		api.GET("/menu", authHandler.OptionalAuth(), menuHandler.GetMenu)
 
 		authGroup := api.Group("/auth")
 		{
 			authGroup.POST("/register", authHandler.GetRegisterHandler)
 			authGroup.POST("/login", authHandler.GetLoginHandler)
+			authGroup.POST("/mfa/verify", authHandler.MFAVerifyHandler)
 			authGroup.POST("/logout", authHandler.GetLogoutHandler)
+			authGroup.POST("/refresh", authHandler.RefreshHandler)
+			authGroup.POST("/password/forgot", passwordHandler.ForgotHandler)
+			authGroup.POST("/password/reset", passwordHandler.ResetHandler)
+			authGroup.POST("/email/verify", emailHandler.VerifyHandler)
+			authGroup.POST("/email/resend", authHandler.AuthRequired(), emailHandler.ResendHandler)
+			authGroup.GET("/oidc/providers", oidcHandler.GetProvidersHandler)
+			authGroup.POST("/oidc/:provider/start", oidcHandler.StartHandler)
+			authGroup.POST("/oidc/:provider/callback", authHandler.OptionalAuth(), oidcHandler.CallbackHandler)
+			authGroup.POST("/phone/code", phoneHandler.SendLoginCodeHandler)
+			authGroup.POST("/phone/login", phoneHandler.LoginHandler)
 		}
 
 		cartGroup := api.Group("/cart")
 		cartGroup.Use(authHandler.OptionalAuth())
 		{
 			cartGroup.GET("", cartHandler.GetCartHandler)
+			cartGroup.PUT("", cartHandler.ReplaceCartHandler)
+			cartGroup.DELETE("", cartHandler.ClearCartHandler)
 			cartGroup.POST("/add", cartHandler.AddToCartHandler)
+			cartGroup.PATCH("/items/:productId", cartHandler.UpdateQuantityHandler)
+			cartGroup.POST("/promo", cartHandler.ApplyPromoHandler)
+			cartGroup.DELETE("/promo", cartHandler.RemovePromoHandler)
 			cartGroup.DELETE("/:productId", cartHandler.RemoveFromCartHandler)
 		}
 
@@ -116,9 +292,52 @@ func main() {
 		protected.Use(authHandler.AuthRequired())
 		{
 			protected.GET("/profile", profileHandler.GetProfileHandler)
+			protected.GET("/profile/bonus", profileHandler.GetBonusHandler)
+			protected.PUT("/profile/birthday", profileHandler.SetBirthdayHandler)
+			protected.GET("/profile/notifications", profileHandler.GetNotificationsHandler)
+			protected.PUT("/profile/notifications/:event", profileHandler.SetNotificationHandler)
+			protected.GET("/profile/favorites", favoritesHandler.GetFavoritesHandler)
+			protected.PUT("/profile/favorites/:productId", favoritesHandler.AddFavoriteHandler)
+			protected.DELETE("/profile/favorites/:productId", favoritesHandler.RemoveFavoriteHandler)
+			protected.GET("/profile/mfa", mfaHandler.GetStatusHandler)
+			protected.POST("/profile/mfa/enroll", mfaHandler.EnrollHandler)
+			protected.POST("/profile/mfa/confirm", mfaHandler.ConfirmHandler)
+			protected.GET("/profile/sessions", sessionHandler.GetSessionsHandler)
+			protected.DELETE("/profile/sessions", sessionHandler.RevokeAllSessionsHandler)
+			protected.DELETE("/profile/sessions/:id", sessionHandler.RevokeSessionHandler)
+			protected.GET("/profile/identities", oidcHandler.GetIdentitiesHandler)
+			protected.POST("/profile/identities/:provider", oidcHandler.LinkHandler)
+			protected.POST("/profile/phone", phoneHandler.SendLinkCodeHandler)
+			protected.POST("/profile/phone/verify", phoneHandler.LinkHandler)
+			protected.DELETE("/profile/phone", phoneHandler.UnlinkHandler)
+			verified := emailHandler.RequireVerified()
+			protected.POST("/orders", verified, orderHandler.PlaceOrderHandler)
+
+			protected.POST("/group-carts", groupCartHandler.CreateHandler)
+			protected.POST("/group-carts/join/:token", groupCartHandler.JoinHandler)
+			protected.GET("/group-carts/:id", groupCartHandler.GetHandler)
+			protected.PUT("/group-carts/:id/items/:productId", groupCartHandler.SetItemHandler)
+			protected.POST("/group-carts/:id/lock", groupCartHandler.LockHandler)
+			protected.POST("/group-carts/:id/unlock", groupCartHandler.UnlockHandler)
+			protected.POST("/group-carts/:id/order", verified, groupCartHandler.PlaceOrderHandler)
+		}
+
+		adminGroup := api.Group("/admin")
+		adminGroup.Use(authHandler.AuthRequired(), authHandler.RequireMFA())
+		{
+			manageMenu := authHandler.RequirePermission(models.PermissionManageMenu)
+			adminGroup.GET("/menu/export", manageMenu, catalogueHandler.ExportHandler)
+			adminGroup.POST("/menu/import", manageMenu, catalogueHandler.ImportHandler)
+
+			manageRoles := authHandler.RequirePermission(models.PermissionManageRoles)
+			adminGroup.GET("/users/:id/roles", manageRoles, roleHandler.GetRolesHandler)
+			adminGroup.PUT("/users/:id/roles/:role", manageRoles, roleHandler.GrantRoleHandler)
+			adminGroup.DELETE("/users/:id/roles/:role", manageRoles, roleHandler.RevokeRoleHandler)
 		}
 	}
 
+	r.GET("/.well-known/jwks.json", jwksHandler.GetJWKSHandler)
+
 	r.NoRoute(func(ctx *gin.Context) {
 		ctx.HTML(http.StatusOK, "index.html", nil)
 	})
@@ -140,6 +359,7 @@ func main() {
 
 	<-quit
 	log.Println("Shutting down server...")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -147,6 +367,7 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	passwordResets.Wait()
 
 	log.Println("Server exiting")
 }
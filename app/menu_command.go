@@ -0,0 +1,133 @@
+package main
+
+import (
+	"CartoonBurgers/app/config"
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"CartoonBurgers/services"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const menuUsage = `usage:
+  menu export [-format csv|json] [-out file]
+  menu import [-format csv|json] [-dry-run] file`
+
+// runMenuCommand implements the "menu" subcommand used to export and import
+// the catalogue without going through the admin API.
+func runMenuCommand(cfg config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, menuUsage)
+		return 2
+	}
+
+	ctx := context.Background()
+
+	appRepo, err := repositories.NewAppRepository(ctx, cfg.Database.Path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot init repositories:", err)
+		return 1
+	}
+	defer appRepo.DB.Close()
+
+	catalogue := services.NewCatalogueService(appRepo.ProductRerository, appRepo.CategoryRepository, services.NewLocalizer(cfg.Locale.Default, cfg.Locale.Supported).Default)
+
+	switch args[0] {
+	case "export":
+		fs := flag.NewFlagSet("menu export", flag.ContinueOnError)
+		format := fs.String("format", "json", "csv or json")
+		out := fs.String("out", "", "output file, stdout when empty")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		data, err := catalogue.Export(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "export failed:", err)
+			return 1
+		}
+
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "export failed:", err)
+				return 1
+			}
+			defer f.Close()
+			w = f
+		}
+
+		switch *format {
+		case "csv":
+			err = services.WriteCatalogueCSV(w, data)
+		case "json":
+			err = services.WriteCatalogueJSON(w, data)
+		default:
+			fmt.Fprintln(os.Stderr, "unknown format", *format)
+			return 2
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "export failed:", err)
+			return 1
+		}
+		return 0
+
+	case "import":
+		fs := flag.NewFlagSet("menu import", flag.ContinueOnError)
+		format := fs.String("format", "json", "csv or json")
+		dryRun := fs.Bool("dry-run", false, "only report changes")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, menuUsage)
+			return 2
+		}
+
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import failed:", err)
+			return 1
+		}
+		defer f.Close()
+
+		var data *models.Catalogue
+		var parseErrors []models.ImportError
+		switch *format {
+		case "csv":
+			data, parseErrors, err = services.ReadCatalogueCSV(f)
+		case "json":
+			data, err = services.ReadCatalogueJSON(f)
+		default:
+			fmt.Fprintln(os.Stderr, "unknown format", *format)
+			return 2
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import failed:", err)
+			return 1
+		}
+
+		report, err := catalogue.Import(ctx, data, parseErrors, *dryRun)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import failed:", err)
+			return 1
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+
+		if len(report.Errors) > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintln(os.Stderr, menuUsage)
+	return 2
+}
@@ -7,11 +7,18 @@ import (
 	"github.com/go-redis/redis"
 )
 
+var (
+	_ services.IRedisClient    = (*RedisAdapter)(nil)
+	_ services.IRedisBlacklist = (*RedisAdapter)(nil)
+	_ services.IRedisSessions  = (*RedisAdapter)(nil)
+)
+
+// RedisAdapter implements the redis interfaces of the services package.
 type RedisAdapter struct {
 	client *redis.Client
 }
 
-func NewRedisAdapter(client *redis.Client) services.IRedisClient {
+func NewRedisAdapter(client *redis.Client) *RedisAdapter {
 	return &RedisAdapter{client: client}
 }
 
@@ -30,3 +37,7 @@ func (r *RedisAdapter) Set(key string, value interface{}, expiration time.Durati
 func (r *RedisAdapter) Del(key string) *redis.IntCmd {
 	return r.client.Del(key)
 }
+
+func (r *RedisAdapter) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	return r.client.SetNX(key, value, expiration)
+}
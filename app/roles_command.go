@@ -0,0 +1,66 @@
+package main
+
+import (
+	"CartoonBurgers/app/config"
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"CartoonBurgers/services"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+const rolesUsage = `usage:
+  roles grant username role
+  roles revoke username role
+  roles list username`
+
+// runRolesCommand implements the "roles" subcommand, it manages roles
+// without a logged in admin, e.g. to create the first one.
+func runRolesCommand(cfg config.Config, args []string) int {
+	if len(args) < 2 || (args[0] != "list" && len(args) < 3) {
+		fmt.Fprintln(os.Stderr, rolesUsage)
+		return 2
+	}
+
+	ctx := context.Background()
+
+	appRepo, err := repositories.NewAppRepository(ctx, cfg.Database.Path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot init repositories:", err)
+		return 1
+	}
+	defer appRepo.DB.Close()
+
+	roles := services.NewRoleService(appRepo.RoleRepository, appRepo.UserRepository, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	userID, err := appRepo.GetUserID(ctx, args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "unknown user", args[1])
+		return 1
+	}
+
+	switch args[0] {
+	case "grant":
+		err = roles.Grant(ctx, userID, models.Role(args[2]), 0)
+	case "revoke":
+		err = roles.Revoke(ctx, userID, models.Role(args[2]), 0)
+	case "list":
+	default:
+		fmt.Fprintln(os.Stderr, rolesUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, args[0], "failed:", err)
+		return 1
+	}
+
+	granted, err := roles.UserRoles(ctx, userID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot load roles:", err)
+		return 1
+	}
+	fmt.Println(args[1], granted)
+	return 0
+}
@@ -2,7 +2,7 @@ class MenuApp {
     constructor() {
         this.cart = [];
         this.menuContainer = document.getElementById('menu-container');
-        this.filters = document.querySelectorAll('.filter-btn');
+        this.filtersContainer = document.querySelector('.filters');
         this.currentCategory = 'all';
         this.init();
         this.updateAuthUI();
@@ -13,9 +13,70 @@ class MenuApp {
 
     init() {
         this.loadMenu();
-        this.setupFilters();
         this.setupAuthModals(); 
         this.setupNavigation();
+        this.setupOIDC();
+    }
+
+    // setupOIDC shows the login provider buttons and finishes a provider
+    // login when the provider redirected back to /oidc/<name>/callback.
+    async setupOIDC() {
+        const match = window.location.pathname.match(/^\/oidc\/([^/]+)\/callback$/);
+        if (match) {
+            await this.finishOIDCLogin(match[1], new URLSearchParams(window.location.search));
+        }
+
+        const container = document.getElementById('oidc-providers');
+        if (!container) return;
+        const response = await fetch('/api/auth/oidc/providers');
+        if (!response.ok) return;
+
+        const providers = await response.json();
+        container.innerHTML = '';
+        providers.forEach(provider => {
+            const button = document.createElement('button');
+            button.type = 'button';
+            button.textContent = `Войти через ${provider.displayName}`;
+            button.addEventListener('click', () => this.startOIDCLogin(provider.name));
+            container.appendChild(button);
+        });
+    }
+
+    async startOIDCLogin(provider) {
+        const response = await fetch(`/api/auth/oidc/${encodeURIComponent(provider)}/start`, { method: 'POST' });
+        if (!response.ok) {
+            alert('Сервис входа недоступен');
+            return;
+        }
+        const { authorizationUrl } = await response.json();
+        window.location.assign(authorizationUrl);
+    }
+
+    async finishOIDCLogin(provider, params) {
+        window.history.replaceState(null, '', '/');
+        if (params.get('error') || !params.get('code')) {
+            alert('Вход отменён');
+            return;
+        }
+
+        const response = await fetch(`/api/auth/oidc/${encodeURIComponent(provider)}/callback`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ code: params.get('code'), state: params.get('state') })
+        });
+        let body = await response.json();
+        if (!response.ok) {
+            alert(`Ошибка входа: ${body.error}`);
+            return;
+        }
+        if (body.mfaRequired) {
+            body = await this.verifyMFA(body.challengeToken);
+            if (!body) return;
+        }
+        localStorage.setItem('token', body.token);
+        localStorage.setItem('refreshToken', body.refreshToken);
+        this.updateAuthUI();
+        this.showNotification('Успешный вход!');
     }
 
     setupOrderForm() {
@@ -291,7 +352,10 @@ class MenuApp {
         const response = await fetch('/api/menu');
         if (!response.ok) throw new Error('Ошибка загрузки меню');
         
-        this.products = await response.json(); 
+        const menu = await response.json();
+        this.categories = menu.categories;
+        this.products = menu.categories.flatMap(category => category.products);
+        this.renderFilters(this.categories);
         this.renderMenu(this.products);
     } catch (error) {
         console.error('Error:', error);
@@ -327,6 +391,8 @@ class MenuApp {
             <h3>${product.name}</h3>
             <div class="price">${product.price} ₽</div>
             <div class="description">Количество: ${product.count} шт.</div>
+            ${product.nutrition ? `<div class="description">${product.nutrition.calories} ккал / ${product.nutrition.servingSize} г</div>` : ''}
+            ${product.allergens && product.allergens.length ? `<div class="description">Аллергены: ${product.allergens.join(', ')}</div>` : ''}
             <button class="add-btn" data-id="${product.id}">
                 Добавить в корзину
             </button>
@@ -346,13 +412,25 @@ class MenuApp {
         });
     }
 
+    renderFilters(categories) {
+        this.filtersContainer.innerHTML = `
+            <button class="filter-btn active" data-category="all">Все</button>
+            ${categories.map(category => `
+                <button class="filter-btn" data-category="${category.id}">${category.icon} ${category.name}</button>
+            `).join('')}
+        `;
+
+        this.setupFilters();
+    }
+
     setupFilters() {
-        this.filters.forEach(btn => {
+        const filters = this.filtersContainer.querySelectorAll('.filter-btn');
+        filters.forEach(btn => {
             btn.addEventListener('click', (e) => {
-                this.filters.forEach(b => b.classList.remove('active'));
+                filters.forEach(b => b.classList.remove('active'));
                 e.target.classList.add('active');
                 
-                this.currentCategory = e.target.textContent.toLowerCase();
+                this.currentCategory = e.target.dataset.category;
                 this.applyFilter();
             });
         });
@@ -362,26 +440,15 @@ class MenuApp {
         const cards = document.querySelectorAll('.product-card');
         
         cards.forEach(card => {
-            if (this.currentCategory === 'все' || this.currentCategory === 'all') {
+            if (this.currentCategory === 'all') {
                 card.style.display = 'block';
             } else {
-                const category = card.dataset.category;
-                const shouldShow = this.getCategoryName(category) === this.currentCategory;
+                const shouldShow = card.dataset.category === this.currentCategory;
                 card.style.display = shouldShow ? 'block' : 'none';
             }
         });
     }
 
-    getCategoryName(categoryId) {
-        const categories = {
-            0: 'бургеры',
-            1: 'закуски', 
-            2: 'напитки',
-            3: 'десерты',
-        };
-        return categories[categoryId] || '';
-    }
-
     addToCart(productId) {
     const btn = document.querySelector(`[data-id="${productId}"]`);
     btn.textContent = '✅ Добавлено!';
@@ -439,7 +506,31 @@ checkAuth() {
     return !!token;
 }
 
-async loadProfileData() {
+// refreshTokens exchanges the stored refresh token for a new pair, the
+// access token lives only a few minutes.
+async refreshTokens() {
+    const refreshToken = localStorage.getItem('refreshToken');
+    if (!refreshToken) {
+        return false;
+    }
+
+    const response = await fetch('/api/auth/refresh', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refreshToken })
+    });
+    if (!response.ok) {
+        localStorage.removeItem('refreshToken');
+        return false;
+    }
+
+    const { token, refreshToken: next } = await response.json();
+    localStorage.setItem('token', token);
+    localStorage.setItem('refreshToken', next);
+    return true;
+}
+
+async loadProfileData(retried = false) {
     const token = localStorage.getItem('token');
     const userInfo = document.getElementById('user-info');
     const authMessage = document.getElementById('auth-required-message');
@@ -463,6 +554,9 @@ async loadProfileData() {
             userInfo.classList.remove('hidden');
             authMessage.classList.add('hidden');
         } else if (response.status === 401) {
+            if (!retried && await this.refreshTokens()) {
+                return this.loadProfileData(true);
+            }
             localStorage.removeItem('token');
             this.updateAuthUI();
             userInfo.classList.add('hidden');
@@ -501,6 +595,21 @@ async loadProfileData() {
             bonusElement.textContent = data.bonuses || 0;
             bonusElement.style.animation = 'countUp 1s ease-out forwards';
         }, 1200);
+
+        const phoneElement = document.getElementById('user-phone');
+        if (phoneElement) {
+            phoneElement.textContent = data.phone || 'Не привязан';
+        }
+        const deliveryPhone = document.getElementById('delivery-phone');
+        if (deliveryPhone && data.phone && !deliveryPhone.value) {
+            deliveryPhone.value = data.phone;
+        }
+
+        const tierElement = document.getElementById('user-tier');
+        if (tierElement && data.tier) {
+            const tierNames = { bronze: 'Бронза', silver: 'Серебро', gold: 'Золото' };
+            tierElement.textContent = tierNames[data.tier.tier] || data.tier.tier;
+        }
     }
 
     setupAuthModals() {
@@ -541,8 +650,14 @@ async loadProfileData() {
         });
         
         if (response.ok) {
-            const { token } = await response.json();
+            let body = await response.json();
+            if (body.mfaRequired) {
+                body = await this.verifyMFA(body.challengeToken);
+                if (!body) return;
+            }
+            const { token, refreshToken } = body;
             localStorage.setItem('token', token);
+            localStorage.setItem('refreshToken', refreshToken);
             this.closeModals();
             this.updateAuthUI();
             this.showNotification('Успешный вход!');
@@ -556,6 +671,93 @@ async loadProfileData() {
 }
 
 
+    async verifyMFA(challengeToken) {
+        const code = prompt('Введите код из приложения-аутентификатора или резервный код');
+        if (!code) return null;
+
+        const response = await fetch('/api/auth/mfa/verify', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ challengeToken, code: code.trim() })
+        });
+        if (!response.ok) {
+            alert('Ошибка входа: неверный код');
+            return null;
+        }
+        return response.json();
+    }
+
+    // requestPhoneCode asks for a texted code and explains a refusal.
+    async requestPhoneCode(url, phone, headers = {}) {
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', ...headers },
+            body: JSON.stringify({ phone })
+        });
+        if (response.ok) return true;
+
+        const body = await response.json();
+        if (response.status === 429) {
+            alert(`Код уже отправлен, повторить можно через ${response.headers.get('Retry-After')} с`);
+        } else {
+            alert(`Ошибка: ${body.error}`);
+        }
+        return false;
+    }
+
+    async loginWithPhone() {
+        const phone = prompt('Номер телефона, привязанный к аккаунту');
+        if (!phone) return;
+        if (!await this.requestPhoneCode('/api/auth/phone/code', phone)) return;
+
+        const code = prompt('Введите код из SMS');
+        if (!code) return;
+        const response = await fetch('/api/auth/phone/login', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ phone, code: code.trim() })
+        });
+        if (!response.ok) {
+            alert('Ошибка входа: неверный или просроченный код');
+            return;
+        }
+
+        let body = await response.json();
+        if (body.mfaRequired) {
+            body = await this.verifyMFA(body.challengeToken);
+            if (!body) return;
+        }
+        localStorage.setItem('token', body.token);
+        localStorage.setItem('refreshToken', body.refreshToken);
+        this.closeModals();
+        this.updateAuthUI();
+        this.showNotification('Успешный вход!');
+    }
+
+    async linkPhone() {
+        const token = localStorage.getItem('token');
+        if (!token) return;
+        const phone = prompt('Номер телефона для входа по SMS', document.getElementById('delivery-phone')?.value || '');
+        if (!phone) return;
+        const headers = { 'Authorization': `Bearer ${token}` };
+        if (!await this.requestPhoneCode('/api/profile/phone', phone, headers)) return;
+
+        const code = prompt('Введите код из SMS');
+        if (!code) return;
+        const response = await fetch('/api/profile/phone/verify', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', ...headers },
+            body: JSON.stringify({ phone, code: code.trim() })
+        });
+        const body = await response.json();
+        if (!response.ok) {
+            alert(`Ошибка: ${body.error}`);
+            return;
+        }
+        this.showNotification('Телефон привязан');
+        this.loadProfileData();
+    }
+
     async handleRegister(event) {
         event.preventDefault();
         const formData = new FormData(event.target);
@@ -601,7 +803,17 @@ async loadProfileData() {
 }
 
 logout() {
+    const token = localStorage.getItem('token');
+    const refreshToken = localStorage.getItem('refreshToken');
+    if (token) {
+        fetch('/api/auth/logout', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', 'Authorization': `Bearer ${token}` },
+            body: JSON.stringify({ refreshToken })
+        }).catch(error => console.error('Logout error:', error));
+    }
     localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
     this.updateAuthUI();
     this.showNotification('Вы вышли из системы');
     this.showSection('menu');
@@ -1,38 +1,53 @@
 package handlers
 
 import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
 	"CartoonBurgers/repositories"
 	"CartoonBurgers/services"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type AuthHandlers struct {
 	Hasher   *services.BcryptHasher
-	JwtKey   []byte
+	Keys     services.JWTKeys
 	userRepo *repositories.UserRepository
 	logger   *slog.Logger
+
+	carts     ports.CartService
+	cartMerge models.CartMergeStrategy
+	tokens    *services.TokenService
+
+	verification *services.EmailVerificationService
+	mfa          *services.MFAService
+	throttle     *services.LoginThrottle
 }
 
-func NewAuthHandlers(jwtKey string, userRepo *repositories.UserRepository, logger *slog.Logger) *AuthHandlers {
+func NewAuthHandlers(keys services.JWTKeys, userRepo *repositories.UserRepository, logger *slog.Logger, carts ports.CartService, cartMerge models.CartMergeStrategy, tokens *services.TokenService, verification *services.EmailVerificationService, mfa *services.MFAService, throttle *services.LoginThrottle) *AuthHandlers {
 	return &AuthHandlers{
-		Hasher:   &services.BcryptHasher{},
-		JwtKey:   []byte(jwtKey),
-		userRepo: userRepo,
-		logger:   logger,
+		Hasher:    &services.BcryptHasher{},
+		Keys:      keys,
+		userRepo:  userRepo,
+		logger:    logger,
+		carts:     carts,
+		cartMerge: cartMerge,
+		tokens:    tokens,
+
+		verification: verification,
+		mfa:          mfa,
+		throttle:     throttle,
 	}
 }
 
 // @Summary Register a new user
-// @Description Create a new user account
+// @Description Create a new user account and mail a link to verify the email
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -42,32 +57,100 @@ func NewAuthHandlers(jwtKey string, userRepo *repositories.UserRepository, logge
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /register [post]
 func (a *AuthHandlers) GetRegisterHandler(c *gin.Context) {
-	registerHandler := services.NewRegisterHandler(a.Hasher, a.userRepo, a.logger)
+	registerHandler := services.NewRegisterHandler(a.Hasher, a.userRepo, a.logger, a.verification)
 	registerHandler.Register(c)
 }
 
 // @Summary User login
-// @Description Authenticate user and return JWT token
+// @Description Authenticate user and return a short lived JWT access token with a refresh token, the cart_session cart is merged into the user cart. Accounts with two factor authentication get an MFA challenge instead, see /auth/mfa/verify
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param credentials body models.User true "Login credentials"
-// @Success 200 {object} map[string]string "JWT token"
+// @Success 200 {object} models.TokenPair "Access and refresh tokens, or models.MFAChallenge"
 // @Failure 400 {object} map[string]string "Invalid input"
 // @Failure 401 {object} map[string]string "Invalid credentials"
+// @Failure 429 {object} map[string]string "Locked out after failed attempts, see Retry-After"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /login [post]
 func (a *AuthHandlers) GetLoginHandler(c *gin.Context) {
-	loginHandler := services.NewLoginHandler(a.Hasher, a.userRepo, a.JwtKey, a.logger)
+	loginHandler := services.NewLoginHandler(a.Hasher, a.userRepo, a.Keys, a.logger, a.carts, a.cartMerge, a.tokens, a.mfa, a.throttle)
 	loginHandler.Login(c)
 }
 
+// @Summary Two factor login step
+// @Description Exchanges the challenge token returned by login and a TOTP or recovery code for tokens. A challenge expires after 5 minutes or 5 wrong codes
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body object{challengeToken=string,code=string} true "Challenge token and code"
+// @Success 200 {object} models.TokenPair "Access and refresh tokens"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Invalid challenge or code"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /auth/mfa/verify [post]
+func (a *AuthHandlers) MFAVerifyHandler(c *gin.Context) {
+	loginHandler := services.NewLoginHandler(a.Hasher, a.userRepo, a.Keys, a.logger, a.carts, a.cartMerge, a.tokens, a.mfa, a.throttle)
+	loginHandler.VerifyMFA(c)
+}
+
+// LoginUser answers the request like a successful login of the user, for
+// users who proved who they are another way than the password.
+func (a *AuthHandlers) LoginUser(c *gin.Context, username string, userID int) {
+	loginHandler := services.NewLoginHandler(a.Hasher, a.userRepo, a.Keys, a.logger, a.carts, a.cartMerge, a.tokens, a.mfa, a.throttle)
+	loginHandler.LoginUser(c, username, userID)
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// @Summary Refresh tokens
+// @Description Exchanges a refresh token for a new access and refresh token. Every refresh token works once, using one again logs out every device of that login
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body refreshRequest true "Refresh token"
+// @Success 200 {object} models.TokenPair "Access and refresh tokens"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Invalid refresh token"
+// @Failure 500 {object} map[string]string "Token generating error"
+// @Router /auth/refresh [post]
+func (a *AuthHandlers) RefreshHandler(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	pair, err := a.tokens.Refresh(c.Request.Context(), c.MustGet("redis").(services.IRedisSessions), req.RefreshToken, services.ClientOf(c))
+	switch {
+	case errors.Is(err, services.ErrRefreshTokenReused):
+		a.logger.Warn("refresh token reuse, token family revoked",
+			"client_ip", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	case errors.Is(err, services.ErrRefreshTokenInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	case err != nil:
+		a.logger.Error("failed to refresh tokens",
+			"error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generating error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pair)
+}
+
 // @Summary User logout
-// @Description Invalidate user's JWT token
+// @Description Invalidate user's JWT token and end its session. A refresh token can be given for tokens issued without a session
 // @Tags auth
+// @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param Authorization header string true "Bearer token"
+// @Param token body refreshRequest false "Refresh token"
 // @Success 200 {object} map[string]string "Success message"
 // @Failure 400 {object} map[string]string "Token missing"
 // @Failure 500 {object} map[string]string "Logout failed"
@@ -81,29 +164,51 @@ func (a *AuthHandlers) GetLogoutHandler(c *gin.Context) {
 
 	tokenStr = strings.TrimPrefix(tokenStr, "Bearer ")
 
-	hash := sha256.Sum256([]byte(tokenStr))
-	tokenHash := hex.EncodeToString(hash[:])
+	var req refreshRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+	}
 
-	redisClient := c.MustGet("redis").(*redis.Client)
-	token, _ := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-		return []byte(a.JwtKey), nil
-	})
+	redisClient := c.MustGet("redis").(services.IRedisBlacklist)
+	token, _ := jwt.Parse(tokenStr, a.Keys.Keyfunc)
 
 	var expiration time.Duration
+	var userID int
+	var sessionID string
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		exp := time.Unix(int64(claims["exp"].(float64)), 0)
 		expiration = time.Until(exp)
+		if id, ok := claims["user_id"].(float64); ok {
+			userID = int(id)
+		}
+		sessionID, _ = claims["sid"].(string)
 	} else {
 		expiration = time.Hour
 	}
 
-	err := redisClient.SetNX("blacklist:"+tokenHash, "1", expiration).Err()
-
-	if err != nil {
+	if err := services.BlacklistAccessToken(redisClient, tokenStr, expiration); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Logout failed"})
 		return
 	}
 
+	if sessionID != "" && userID != 0 && a.tokens != nil {
+		err := a.tokens.RevokeSession(c.Request.Context(), c.MustGet("redis").(services.IRedisSessions), userID, sessionID)
+		if err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Logout failed"})
+			return
+		}
+	}
+
+	if req.RefreshToken != "" && a.tokens != nil {
+		if err := a.tokens.Revoke(c.Request.Context(), req.RefreshToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Logout failed"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
 }
 
@@ -113,7 +218,31 @@ func (a *AuthHandlers) GetLogoutHandler(c *gin.Context) {
 // @Security ApiKeyAuth
 // @Param Authorization header string true "Bearer token"
 func (a *AuthHandlers) AuthRequired() gin.HandlerFunc {
-	return services.AuthMiddleware(string(a.JwtKey), a.logger)
+	return services.AuthMiddleware(a.Keys, a.logger)
+}
+
+// @Summary Role middleware
+// @Description Requires one of the roles, use after AuthRequired
+// @Tags auth
+// @Security ApiKeyAuth
+func (a *AuthHandlers) RequireRole(roles ...models.Role) gin.HandlerFunc {
+	return services.RequireRole(a.logger, roles...)
+}
+
+// @Summary Two factor middleware
+// @Description Requires a two factor login from admin and staff users, use after AuthRequired
+// @Tags auth
+// @Security ApiKeyAuth
+func (a *AuthHandlers) RequireMFA() gin.HandlerFunc {
+	return services.RequireMFA(a.logger)
+}
+
+// @Summary Permission middleware
+// @Description Requires a role granting the permission, use after AuthRequired
+// @Tags auth
+// @Security ApiKeyAuth
+func (a *AuthHandlers) RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return services.RequirePermission(a.logger, permission)
 }
 
 // @Summary Optional authentication middleware
@@ -127,14 +256,19 @@ func (a *AuthHandlers) OptionalAuth() gin.HandlerFunc {
 		if tokenStr != "" {
 			tokenStr = strings.TrimPrefix(tokenStr, "Bearer ")
 
-			token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-				return a.JwtKey, nil
-			})
+			token, err := jwt.Parse(tokenStr, a.Keys.Keyfunc)
 
 			if err == nil && token.Valid {
-				if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				// Revoked tokens are treated like no token, the request goes
+				// on as a guest.
+				redisClient := c.MustGet("redis").(services.IRedisClient)
+				if claims, ok := token.Claims.(jwt.MapClaims); ok && !services.TokenRevoked(redisClient, tokenStr, claims) {
 					c.Set("username", claims["username"])
 					c.Set("token", tokenStr)
+					services.SetUserID(c, claims)
+					services.SetSessionID(c, claims)
+					services.SetRoles(c, claims)
+					services.SetMFA(c, claims)
 				}
 			}
 		}
@@ -2,76 +2,150 @@ package handlers
 
 import (
 	"CartoonBurgers/models"
-	"encoding/json"
+	"CartoonBurgers/ports"
+	"CartoonBurgers/services"
+	"errors"
 	"fmt"
 	"net/http"
-	"time"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis"
 )
 
 type CartHandler struct {
 	cookieSequre bool
+	localizer    *services.Localizer
+	menuService  *services.MenuService
+	carts        ports.CartService
+	pricer       *services.CartPricer
+	promos       *services.PromoService
 }
 
-func NewCartHandler(cookieSequre bool) *CartHandler {
-	return &CartHandler{cookieSequre: cookieSequre}
+func NewCartHandler(cookieSequre bool, localizer *services.Localizer, menuService *services.MenuService, carts ports.CartService, pricer *services.CartPricer, promos *services.PromoService) *CartHandler {
+	return &CartHandler{cookieSequre: cookieSequre, localizer: localizer, menuService: menuService, carts: carts, pricer: pricer, promos: promos}
 }
 
-func (h *CartHandler) getCartKey(c *gin.Context) string {
-	token, exists := c.Get("token")
-	if exists && token != "" {
-		return fmt.Sprintf("cart:user:%s", token)
+func (h *CartHandler) message(c *gin.Context, key string) string {
+	locale := h.localizer.Resolve(c.Query("lang"), c.GetHeader("Accept-Language"))
+	return h.localizer.Message(locale, key)
+}
+
+// getCartID returns the id the cart is stored under, the logged in user's id
+// or the cart_session cookie, which is created when missing. It writes the
+// error response itself when a session id cannot be generated.
+func (h *CartHandler) getCartID(c *gin.Context) (string, bool) {
+	if userID := c.GetInt("user_id"); userID != 0 {
+		return services.UserCartID(userID), true
 	}
 
 	sessionID, err := c.Cookie("cart_session")
 	if err != nil || sessionID == "" {
-		sessionID = generateSessionID()
-		c.SetCookie("cart_session", sessionID, 30*24*3600, "/", "", h.cookieSequre, true)
+		if sessionID, err = services.NewCartSessionID(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart session error"})
+			return "", false
+		}
+		c.SetCookie("cart_session", sessionID, int(services.CartTTL.Seconds()), "/", "", h.cookieSequre, true)
+	}
+	return services.SessionCartID(sessionID), true
+}
+
+// pricedCart loads the cart and prices it with its promo code, writing the
+// error response itself when that fails. A code that no longer applies is
+// reported in PromoError instead of failing.
+func (h *CartHandler) pricedCart(c *gin.Context, cartID string) (*models.PricedCart, bool) {
+	cart, err := h.carts.GetCart(c.Request.Context(), cartID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Getting cart error"})
+		return nil, false
+	}
+
+	priced, err := h.pricer.Price(c.Request.Context(), cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart error"})
+		return nil, false
+	}
+
+	if err := h.promos.ApplyTierPerks(c.Request.Context(), c.GetInt("user_id"), priced); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart error"})
+		return nil, false
+	}
+
+	code, err := h.carts.GetPromoCode(c.Request.Context(), cartID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart error"})
+		return nil, false
+	}
+	if code != "" {
+		if _, err := h.promos.ApplyCode(c.Request.Context(), code, c.GetInt("user_id"), priced); err != nil {
+			if !isPromoError(err) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart error"})
+				return nil, false
+			}
+			priced.PromoCode = code
+			priced.PromoError = err.Error()
+		}
+	}
+
+	return priced, true
+}
+
+// quantityError writes the response for errors of CartPricer checks.
+func quantityError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity"})
+	case errors.Is(err, services.ErrItemQuantityLimit), errors.Is(err, services.ErrCartQuantityLimit):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Quantity limit exceeded"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart error"})
+	}
+}
+
+// savingError answers a failed cart change, the cart services enforce the
+// quantity limits.
+func savingError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrItemQuantityLimit) || errors.Is(err, services.ErrCartQuantityLimit) {
+		quantityError(c, err)
+		return
 	}
-	return fmt.Sprintf("cart:session:%s", sessionID)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Saving Cart error"})
 }
 
-// @Summary Get all products
-// @Description For menu from db
+// @Summary Get cart
+// @Description Priced cart of the logged in user or of the cart_session cookie, amounts in minor units
 // @Tags cart
 // @Produce json
-// @Param Context
-// @Success 200 {object} map[string]string "Success message"
-// @Failure 400 {object} map[string]string "Token missing"
-// @Router [get]
+// @Success 200 {object} models.PricedCart "Priced cart"
+// @Failure 500 {object} gin.H "Getting cart error"
+// @Router /cart [get]
 func (h *CartHandler) GetCartHandler(c *gin.Context) {
-	redisClient := c.MustGet("redis").(*redis.Client)
-	cartKey := h.getCartKey(c)
-
-	cartData, err := redisClient.Get(cartKey).Result()
-
-	if err == redis.Nil {
-		c.JSON(200, gin.H{"items": []models.CartItem{}})
+	cartID, ok := h.getCartID(c)
+	if !ok {
 		return
-	} else if err != nil {
-		c.JSON(500, gin.H{"error": "Getting cart error"})
+	}
+
+	priced, ok := h.pricedCart(c, cartID)
+	if !ok {
 		return
 	}
 
-	var cart []models.CartItem
-	json.Unmarshal([]byte(cartData), &cart)
-	c.JSON(200, gin.H{"items": cart})
+	c.JSON(http.StatusOK, priced)
 }
 
-// @Summary Get all products
-// @Description For menu from db
+// @Summary Add to cart
+// @Description Adds the quantity to the product already in the cart
 // @Tags cart
+// @Accept json
 // @Produce json
-// @Param Context
-// @Success 200 {object} []CartItem "Item added to cart"
+// @Param item body models.CartItem true "Product and quantity"
+// @Success 200 {object} models.PricedCart "Item added to cart"
 // @Failure 400 {object} gin.H "Invalid format"
-// @Failure 400 {object} gin.H "Cart error"
-// @Failure 400 {object} gin.H "Saving Cart error"
-// @Router /add [post]
+// @Failure 404 {object} gin.H "Product not found"
+// @Failure 409 {object} gin.H "Product is not available right now"
+// @Failure 422 {object} gin.H "Quantity limit exceeded"
+// @Failure 500 {object} gin.H "Saving Cart error"
+// @Router /cart/add [post]
 func (h *CartHandler) AddToCartHandler(c *gin.Context) {
-	redisClient := c.MustGet("redis").(*redis.Client)
 	var item models.CartItem
 
 	if err := c.BindJSON(&item); err != nil {
@@ -79,94 +153,302 @@ func (h *CartHandler) AddToCartHandler(c *gin.Context) {
 		return
 	}
 
-	cartKey := h.getCartKey(c)
+	if item.Quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity"})
+		return
+	}
 
-	cartData, err := redisClient.Get(cartKey).Result()
-	var cart []models.CartItem
+	if _, err := h.menuService.CheckAvailable(c.Request.Context(), item.ProductID); err != nil {
+		availabilityError(c, err)
+		return
+	}
 
-	if err != nil && err != redis.Nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart error"})
+	cartID, ok := h.getCartID(c)
+	if !ok {
 		return
 	}
 
-	if err != redis.Nil {
-		json.Unmarshal([]byte(cartData), &cart)
+	if err := h.carts.AddToCart(c.Request.Context(), cartID, item); err != nil {
+		savingError(c, err)
+		return
+	}
+
+	h.respondCart(c, cartID, "cart.added")
+}
+
+// @Summary Remove from cart
+// @Tags cart
+// @Produce json
+// @Param productId path int true "Product ID"
+// @Success 200 {object} models.PricedCart "Item removed from cart"
+// @Failure 400 {object} gin.H "Invalid product id"
+// @Failure 500 {object} gin.H "Removing Cart error"
+// @Router /cart/{productId} [delete]
+func (h *CartHandler) RemoveFromCartHandler(c *gin.Context) {
+	productID, ok := productIDParam(c)
+	if !ok {
+		return
+	}
+
+	cartID, ok := h.getCartID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.carts.RemoveFromCart(c.Request.Context(), cartID, productID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Removing Cart error"})
+		return
+	}
+
+	h.respondCart(c, cartID, "cart.removed")
+}
+
+type quantityRequest struct {
+	Quantity *int `json:"quantity"`
+}
+
+// @Summary Set item quantity
+// @Description Sets the exact quantity of a product in the cart, 0 removes it
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param productId path int true "Product ID"
+// @Param quantity body quantityRequest true "New quantity"
+// @Success 200 {object} models.PricedCart "Quantity updated"
+// @Failure 400 {object} gin.H "Invalid format"
+// @Failure 404 {object} gin.H "Product not found"
+// @Failure 409 {object} gin.H "Product is not available right now"
+// @Failure 422 {object} gin.H "Quantity limit exceeded"
+// @Failure 500 {object} gin.H "Saving Cart error"
+// @Router /cart/items/{productId} [patch]
+func (h *CartHandler) UpdateQuantityHandler(c *gin.Context) {
+	productID, ok := productIDParam(c)
+	if !ok {
+		return
 	}
 
-	found := false
-	for i, cartItem := range cart {
-		if cartItem.ProductID == item.ProductID {
-			cart[i].Quantity += item.Quantity
-			found = true
-			break
+	var req quantityRequest
+	if err := c.BindJSON(&req); err != nil || req.Quantity == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+	quantity := *req.Quantity
+
+	if quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity"})
+		return
+	}
+
+	cartID, ok := h.getCartID(c)
+	if !ok {
+		return
+	}
+
+	if quantity > 0 {
+		if _, err := h.menuService.CheckAvailable(c.Request.Context(), productID); err != nil {
+			availabilityError(c, err)
+			return
 		}
 	}
 
-	if !found {
+	if err := h.carts.SetQuantity(c.Request.Context(), cartID, productID, quantity); err != nil {
+		savingError(c, err)
+		return
+	}
+
+	h.respondCart(c, cartID, "cart.updated")
+}
+
+// @Summary Clear cart
+// @Tags cart
+// @Produce json
+// @Success 200 {object} models.PricedCart "Cart cleared"
+// @Failure 500 {object} gin.H "Removing Cart error"
+// @Router /cart [delete]
+func (h *CartHandler) ClearCartHandler(c *gin.Context) {
+	cartID, ok := h.getCartID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.carts.ClearCart(c.Request.Context(), cartID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Removing Cart error"})
+		return
+	}
+
+	h.respondCart(c, cartID, "cart.cleared")
+}
+
+type replaceCartRequest struct {
+	Items []models.CartItem `json:"items"`
+}
+
+// @Summary Replace cart
+// @Description Replaces the whole cart, every product may appear only once
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param cart body replaceCartRequest true "New cart items"
+// @Success 200 {object} models.PricedCart "Cart saved"
+// @Failure 400 {object} gin.H "Invalid format"
+// @Failure 404 {object} gin.H "Product not found"
+// @Failure 409 {object} gin.H "Product is not available right now"
+// @Failure 422 {object} gin.H "Quantity limit exceeded"
+// @Failure 500 {object} gin.H "Saving Cart error"
+// @Router /cart [put]
+func (h *CartHandler) ReplaceCartHandler(c *gin.Context) {
+	var req replaceCartRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+
+	cart := make([]models.CartItem, 0, len(req.Items))
+	seen := make(map[int]bool, len(req.Items))
+	for _, item := range req.Items {
+		if seen[item.ProductID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Duplicate product %d", item.ProductID)})
+			return
+		}
+		seen[item.ProductID] = true
+
+		if err := h.pricer.CheckQuantity(cart, item.ProductID, item.Quantity); err != nil {
+			quantityError(c, err)
+			return
+		}
+		if _, err := h.menuService.CheckAvailable(c.Request.Context(), item.ProductID); err != nil {
+			availabilityError(c, err)
+			return
+		}
+
 		cart = append(cart, item)
 	}
 
-	cartJSON, _ := json.Marshal(cart)
-	err = redisClient.Set(cartKey, cartJSON, 30*24*time.Hour).Err()
+	cartID, ok := h.getCartID(c)
+	if !ok {
+		return
+	}
 
-	if err != nil {
+	if err := h.carts.ReplaceCart(c.Request.Context(), cartID, cart); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Saving Cart error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Товар добавлен в корзину", "cart": cart})
+	h.respondCart(c, cartID, "cart.saved")
 }
 
-// @Summary Remove from cart
+type promoRequest struct {
+	Code string `json:"code"`
+}
+
+// @Summary Apply promo code
+// @Description Checks the code against the cart and keeps it for checkout
 // @Tags cart
+// @Accept json
 // @Produce json
-// @Param Context
-// @Success 200 {object} []CartItem "Item removed from cart"
+// @Param promo body promoRequest true "Promo code"
+// @Success 200 {object} models.PricedCart "Promo code applied"
 // @Failure 400 {object} gin.H "Invalid format"
-// @Failure 400 {object} gin.H "Cart error"
-// @Failure 400 {object} gin.H "Removing Cart error"
-// @Router /:productId [delete]
-func (h *CartHandler) RemoveFromCartHandler(c *gin.Context) {
-	redisClient := c.MustGet("redis").(*redis.Client)
-	var item models.CartItem
-
-	if err := c.BindJSON(&item); err != nil {
+// @Failure 404 {object} gin.H "Promo code not found"
+// @Failure 422 {object} gin.H "Promo code does not apply"
+// @Failure 500 {object} gin.H "Cart error"
+// @Router /cart/promo [post]
+func (h *CartHandler) ApplyPromoHandler(c *gin.Context) {
+	var req promoRequest
+	if err := c.BindJSON(&req); err != nil || req.Code == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
 		return
 	}
 
-	cartKey := h.getCartKey(c)
+	cartID, ok := h.getCartID(c)
+	if !ok {
+		return
+	}
 
-	cartData, err := redisClient.Get(cartKey).Result()
-	var cart []models.CartItem
+	cart, err := h.carts.GetCart(c.Request.Context(), cartID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart error"})
+		return
+	}
 
-	if err != nil && err != redis.Nil {
+	priced, err := h.pricer.Price(c.Request.Context(), cart)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart error"})
 		return
 	}
 
-	if err != redis.Nil {
-		json.Unmarshal([]byte(cartData), &cart)
+	if err := h.promos.ApplyTierPerks(c.Request.Context(), c.GetInt("user_id"), priced); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart error"})
+		return
 	}
 
-	for i, cartItem := range cart {
-		if cartItem.ProductID == item.ProductID {
-			cart = append(cart[:i], cart[i+1:]...)
-			break
-		}
+	promo, err := h.promos.ApplyCode(c.Request.Context(), req.Code, c.GetInt("user_id"), priced)
+	switch {
+	case errors.Is(err, services.ErrPromoNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promo code not found"})
+		return
+	case isPromoError(err):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart error"})
+		return
 	}
 
-	cartJSON, _ := json.Marshal(cart)
-	err = redisClient.Set(cartKey, cartJSON, 30*24*time.Hour).Err()
+	if err := h.carts.SetPromoCode(c.Request.Context(), cartID, promo.Code); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Saving Cart error"})
+		return
+	}
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Removing Cart error"})
+	h.respondCart(c, cartID, "cart.promoApplied")
+}
+
+// @Summary Remove promo code
+// @Tags cart
+// @Produce json
+// @Success 200 {object} models.PricedCart "Promo code removed"
+// @Failure 500 {object} gin.H "Saving Cart error"
+// @Router /cart/promo [delete]
+func (h *CartHandler) RemovePromoHandler(c *gin.Context) {
+	cartID, ok := h.getCartID(c)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Товар убран из корзины", "cart": cart})
+	if err := h.carts.SetPromoCode(c.Request.Context(), cartID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Saving Cart error"})
+		return
+	}
+
+	h.respondCart(c, cartID, "cart.promoRemoved")
 }
 
-func generateSessionID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+func (h *CartHandler) respondCart(c *gin.Context, cartID, messageKey string) {
+	priced, ok := h.pricedCart(c, cartID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": h.message(c, messageKey), "cart": priced})
+}
+
+// availabilityError writes the response for errors of MenuService.CheckAvailable.
+func availabilityError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	case errors.Is(err, services.ErrProductUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Product is not available right now"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cart error"})
+	}
+}
+
+func productIDParam(c *gin.Context) (int, bool) {
+	productID, err := strconv.Atoi(c.Param("productId"))
+	if err != nil || productID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product id"})
+		return 0, false
+	}
+	return productID, true
 }
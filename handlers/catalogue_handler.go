@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxCatalogueSize = 5 << 20
+
+type CatalogueHandler struct {
+	catalogue *services.CatalogueService
+}
+
+func NewCatalogueHandler(catalogue *services.CatalogueService) *CatalogueHandler {
+	return &CatalogueHandler{catalogue: catalogue}
+}
+
+// @Summary Export the menu catalogue
+// @Tags admin
+// @Produce json
+// @Produce text/csv
+// @Security ApiKeyAuth
+// @Param format query string false "csv or json (default)"
+// @Success 200 {object} models.Catalogue
+// @Failure 400 {object} gin.H "Unknown format"
+// @Failure 500 {object} gin.H "Export failed"
+// @Router /admin/menu/export [get]
+func (h *CatalogueHandler) ExportHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown format"})
+		return
+	}
+
+	catalogue, err := h.catalogue.Export(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Export failed"})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=menu."+format)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		err = services.WriteCatalogueCSV(c.Writer, catalogue)
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		err = services.WriteCatalogueJSON(c.Writer, catalogue)
+	}
+
+	if err != nil {
+		c.Error(err)
+	}
+}
+
+// @Summary Import the menu catalogue
+// @Description Replaces the whole menu. With dryRun only the planned changes and validation errors are reported.
+// @Tags admin
+// @Accept json
+// @Accept text/csv
+// @Produce json
+// @Security ApiKeyAuth
+// @Param format query string false "csv or json, taken from Content-Type when omitted"
+// @Param dryRun query bool false "Only report changes"
+// @Success 200 {object} models.ImportReport
+// @Failure 400 {object} gin.H "Invalid file"
+// @Failure 422 {object} models.ImportReport "Validation errors"
+// @Failure 500 {object} gin.H "Import failed"
+// @Router /admin/menu/import [post]
+func (h *CatalogueHandler) ImportHandler(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = "json"
+		if strings.Contains(c.ContentType(), "csv") {
+			format = "csv"
+		}
+	}
+
+	dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxCatalogueSize)
+
+	var catalogue *models.Catalogue
+	var parseErrors []models.ImportError
+	var err error
+
+	switch format {
+	case "csv":
+		catalogue, parseErrors, err = services.ReadCatalogueCSV(body)
+	case "json":
+		catalogue, err = services.ReadCatalogueJSON(body)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown format"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.catalogue.Import(c.Request.Context(), catalogue, parseErrors, dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Import failed"})
+		return
+	}
+
+	if len(report.Errors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
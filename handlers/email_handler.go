@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"CartoonBurgers/services"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EmailHandler struct {
+	verification *services.EmailVerificationService
+	// required makes RequireVerified block unverified accounts.
+	required bool
+	logger   *slog.Logger
+}
+
+func NewEmailHandler(verification *services.EmailVerificationService, required bool, logger *slog.Logger) *EmailHandler {
+	return &EmailHandler{verification: verification, required: required, logger: logger}
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// @Summary Verify email
+// @Description Confirms the account email with the token from the verification link
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body verifyEmailRequest true "Verification token"
+// @Success 200 {object} gin.H "Email verified"
+// @Failure 400 {object} gin.H "Invalid input or invalid token"
+// @Failure 500 {object} gin.H "Verification error"
+// @Router /auth/email/verify [post]
+func (h *EmailHandler) VerifyHandler(c *gin.Context) {
+	var req verifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := h.verification.Verify(c.Request.Context(), req.Token)
+	switch {
+	case errors.Is(err, services.ErrVerificationTokenInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Verification error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// @Summary Resend verification email
+// @Description Mails a new verification link, at most once per cooldown
+// @Tags auth
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 202 {object} gin.H "Verification link sent"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 409 {object} gin.H "Email already verified"
+// @Failure 429 {object} gin.H "Sent recently, see Retry-After"
+// @Failure 500 {object} gin.H "Verification error"
+// @Router /auth/email/resend [post]
+func (h *EmailHandler) ResendHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	wait, err := h.verification.Resend(c.Request.Context(), userID)
+	switch {
+	case errors.Is(err, services.ErrEmailAlreadyVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already verified"})
+		return
+	case errors.Is(err, services.ErrVerificationThrottled):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Verification email was sent recently"})
+		return
+	case err != nil:
+		h.logger.Error("failed to resend verification mail",
+			"user_id", userID,
+			"error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Verification error"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification link sent"})
+}
+
+// @Summary Verified email middleware
+// @Description Blocks accounts without a verified email when the policy requires it, use after AuthRequired
+// @Tags auth
+// @Security ApiKeyAuth
+func (h *EmailHandler) RequireVerified() gin.HandlerFunc {
+	if !h.required {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return services.RequireVerifiedEmail(h.verification, h.logger)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"CartoonBurgers/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FavoritesHandler struct {
+	favorites *services.FavoritesService
+	localizer *services.Localizer
+}
+
+func NewFavoritesHandler(favorites *services.FavoritesService, localizer *services.Localizer) *FavoritesHandler {
+	return &FavoritesHandler{favorites: favorites, localizer: localizer}
+}
+
+// @Summary Get favourite products
+// @Description Starred products, the last starred first, with whether they can be ordered right now
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Param lang query string false "Locale, overrides Accept-Language"
+// @Success 200 {object} map[string][]models.FavoriteProduct "Favourite products"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 500 {object} gin.H "Failed to get favorites"
+// @Router /profile/favorites [get]
+func (h *FavoritesHandler) GetFavoritesHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	locale := h.localizer.Resolve(c.Query("lang"), c.GetHeader("Accept-Language"))
+	favorites, err := h.favorites.List(c.Request.Context(), userID, locale)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get favorites"})
+		return
+	}
+
+	c.Header("Content-Language", locale)
+	c.JSON(http.StatusOK, gin.H{"products": favorites})
+}
+
+// @Summary Star product
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Param productId path int true "Product ID"
+// @Success 200 {object} gin.H "Added to favorites"
+// @Failure 400 {object} gin.H "Invalid product id"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 404 {object} gin.H "Product not found"
+// @Failure 500 {object} gin.H "Failed to save favorites"
+// @Router /profile/favorites/{productId} [put]
+func (h *FavoritesHandler) AddFavoriteHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	productID, ok := productIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.favorites.Add(c.Request.Context(), userID, productID); err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save favorites"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Added to favorites"})
+}
+
+// @Summary Unstar product
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Param productId path int true "Product ID"
+// @Success 200 {object} gin.H "Removed from favorites"
+// @Failure 400 {object} gin.H "Invalid product id"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 500 {object} gin.H "Failed to save favorites"
+// @Router /profile/favorites/{productId} [delete]
+func (h *FavoritesHandler) RemoveFavoriteHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	productID, ok := productIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.favorites.Remove(c.Request.Context(), userID, productID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save favorites"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Removed from favorites"})
+}
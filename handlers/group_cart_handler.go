@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GroupCartHandler struct {
+	groups *services.GroupCartService
+}
+
+func NewGroupCartHandler(groups *services.GroupCartService) *GroupCartHandler {
+	return &GroupCartHandler{groups: groups}
+}
+
+// @Summary Start group cart
+// @Description Starts a group cart owned by the logged in user, colleagues join it with the invite token
+// @Tags group carts
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 201 {object} models.PricedGroupCart "Group cart"
+// @Failure 401 {object} gin.H "Unauthorized"
+// @Failure 500 {object} gin.H "Group cart error"
+// @Router /group-carts [post]
+func (h *GroupCartHandler) CreateHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Please log in again"})
+		return
+	}
+
+	group, err := h.groups.Create(c.Request.Context(), userID)
+	if err != nil {
+		groupCartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// @Summary Join group cart
+// @Tags group carts
+// @Produce json
+// @Security ApiKeyAuth
+// @Param token path string true "Invite token"
+// @Success 200 {object} models.PricedGroupCart "Group cart"
+// @Failure 401 {object} gin.H "Unauthorized"
+// @Failure 404 {object} gin.H "Group cart not found"
+// @Failure 409 {object} gin.H "Group cart is not open"
+// @Failure 500 {object} gin.H "Group cart error"
+// @Router /group-carts/join/{token} [post]
+func (h *GroupCartHandler) JoinHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Please log in again"})
+		return
+	}
+
+	group, err := h.groups.Join(c.Request.Context(), c.Param("token"), userID)
+	if err != nil {
+		groupCartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// @Summary Get group cart
+// @Description Group cart priced as one order with the items and subtotal of every participant, amounts in minor units
+// @Tags group carts
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Group cart ID"
+// @Success 200 {object} models.PricedGroupCart "Group cart"
+// @Failure 401 {object} gin.H "Unauthorized"
+// @Failure 403 {object} gin.H "Not a participant"
+// @Failure 404 {object} gin.H "Group cart not found"
+// @Failure 500 {object} gin.H "Group cart error"
+// @Router /group-carts/{id} [get]
+func (h *GroupCartHandler) GetHandler(c *gin.Context) {
+	userID, groupID, ok := groupCartParams(c)
+	if !ok {
+		return
+	}
+
+	group, err := h.groups.Get(c.Request.Context(), groupID, userID)
+	if err != nil {
+		groupCartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// @Summary Set own item quantity in group cart
+// @Description Sets the quantity of a product the participant adds to the open group cart, 0 removes it
+// @Tags group carts
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Group cart ID"
+// @Param productId path int true "Product ID"
+// @Param quantity body quantityRequest true "New quantity"
+// @Success 200 {object} models.PricedGroupCart "Group cart"
+// @Failure 400 {object} gin.H "Invalid format"
+// @Failure 401 {object} gin.H "Unauthorized"
+// @Failure 403 {object} gin.H "Not a participant"
+// @Failure 404 {object} gin.H "Group cart or product not found"
+// @Failure 409 {object} gin.H "Group cart is not open or product is not available"
+// @Failure 422 {object} gin.H "Quantity limit exceeded"
+// @Failure 500 {object} gin.H "Group cart error"
+// @Router /group-carts/{id}/items/{productId} [put]
+func (h *GroupCartHandler) SetItemHandler(c *gin.Context) {
+	userID, groupID, ok := groupCartParams(c)
+	if !ok {
+		return
+	}
+
+	productID, ok := productIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req quantityRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Quantity == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+
+	group, err := h.groups.SetItem(c.Request.Context(), groupID, userID, productID, *req.Quantity)
+	if err != nil {
+		groupCartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// @Summary Lock group cart
+// @Description Freezes the group cart before checkout, owner only
+// @Tags group carts
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Group cart ID"
+// @Success 200 {object} models.PricedGroupCart "Group cart"
+// @Failure 401 {object} gin.H "Unauthorized"
+// @Failure 403 {object} gin.H "Not the owner"
+// @Failure 404 {object} gin.H "Group cart not found"
+// @Failure 409 {object} gin.H "Group cart is not open"
+// @Failure 500 {object} gin.H "Group cart error"
+// @Router /group-carts/{id}/lock [post]
+func (h *GroupCartHandler) LockHandler(c *gin.Context) {
+	h.setStatus(c, h.groups.Lock)
+}
+
+// @Summary Unlock group cart
+// @Description Opens a locked group cart for changes again, owner only
+// @Tags group carts
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Group cart ID"
+// @Success 200 {object} models.PricedGroupCart "Group cart"
+// @Failure 401 {object} gin.H "Unauthorized"
+// @Failure 403 {object} gin.H "Not the owner"
+// @Failure 404 {object} gin.H "Group cart not found"
+// @Failure 409 {object} gin.H "Group cart is not locked"
+// @Failure 500 {object} gin.H "Group cart error"
+// @Router /group-carts/{id}/unlock [post]
+func (h *GroupCartHandler) UnlockHandler(c *gin.Context) {
+	h.setStatus(c, h.groups.Unlock)
+}
+
+func (h *GroupCartHandler) setStatus(c *gin.Context, change func(ctx context.Context, groupID, userID int) (*models.PricedGroupCart, error)) {
+	userID, groupID, ok := groupCartParams(c)
+	if !ok {
+		return
+	}
+
+	group, err := change(c.Request.Context(), groupID, userID)
+	if err != nil {
+		groupCartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// @Summary Place group order
+// @Description Places the locked group cart as an order of the owner, the receipt breaks the subtotal down by participant
+// @Tags group carts
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Group cart ID"
+// @Param order body placeOrderRequest false "Bonus points to pay with"
+// @Success 201 {object} models.Order "Placed order"
+// @Failure 400 {object} gin.H "Cart is empty"
+// @Failure 401 {object} gin.H "Unauthorized"
+// @Failure 403 {object} gin.H "Not the owner"
+// @Failure 404 {object} gin.H "Group cart not found"
+// @Failure 409 {object} gin.H "Group cart is not locked or has unavailable products"
+// @Failure 422 {object} gin.H "Bonus points error"
+// @Failure 500 {object} gin.H "Placing order error"
+// @Router /group-carts/{id}/order [post]
+func (h *GroupCartHandler) PlaceOrderHandler(c *gin.Context) {
+	userID, groupID, ok := groupCartParams(c)
+	if !ok {
+		return
+	}
+
+	var req placeOrderRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil || req.BonusPoints < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+			return
+		}
+	}
+
+	order, err := h.groups.PlaceOrder(c.Request.Context(), groupID, userID, req.BonusPoints)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCartEmpty):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		case errors.Is(err, services.ErrCartUnavailable):
+			c.JSON(http.StatusConflict, gin.H{"error": "Cart has products that are not available right now"})
+		case isPromoError(err), errors.Is(err, services.ErrInsufficientBonus), errors.Is(err, services.ErrBonusSpendLimit):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			groupCartError(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+func groupCartParams(c *gin.Context) (userID, groupID int, ok bool) {
+	userID = c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Please log in again"})
+		return 0, 0, false
+	}
+
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || groupID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group cart id"})
+		return 0, 0, false
+	}
+	return userID, groupID, true
+}
+
+func groupCartError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrGroupCartNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group cart not found"})
+	case errors.Is(err, services.ErrGroupCartForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrGroupCartClosed), errors.Is(err, services.ErrGroupCartNotLocked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrProductNotFound), errors.Is(err, services.ErrProductUnavailable):
+		availabilityError(c, err)
+	case errors.Is(err, services.ErrInvalidQuantity), errors.Is(err, services.ErrItemQuantityLimit), errors.Is(err, services.ErrCartQuantityLimit):
+		quantityError(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Group cart error"})
+	}
+}
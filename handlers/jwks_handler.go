@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"CartoonBurgers/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	keys services.JWTKeys
+}
+
+func NewJWKSHandler(keys services.JWTKeys) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// @Summary JSON Web Key Set
+// @Description Public keys access tokens are verified with, matched by the kid header. Empty when tokens are signed with HS256
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.JWKS "Public keys"
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) GetJWKSHandler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(services.JWKSCacheTTL.Seconds())))
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
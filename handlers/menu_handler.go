@@ -1,30 +1,58 @@
 package handlers
 
 import (
-	"CartoonBurgers/repositories"
+	"CartoonBurgers/services"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
 type MenuHandler struct {
-	menuRepo *repositories.ProductRerository
+	menuService *services.MenuService
+	localizer   *services.Localizer
+	favorites   *services.FavoritesService
 }
 
-func NewMenuHandler(repo *repositories.ProductRerository) *MenuHandler {
-	return &MenuHandler{menuRepo: repo}
+func NewMenuHandler(service *services.MenuService, localizer *services.Localizer, favorites *services.FavoritesService) *MenuHandler {
+	return &MenuHandler{menuService: service, localizer: localizer, favorites: favorites}
 }
 
 // @Summary Get restaurant menu
+// @Description For logged in users the menu also has a personalized section built from favourites and past orders
 // @Tags menu
 // @Produce json
-// @Success 200 {object} []models.Products
+// @Param lang query string false "Locale, overrides Accept-Language"
+// @Param Accept-Language header string false "Preferred locales"
+// @Param excludeAllergens query string false "Comma separated allergens to exclude, e.g. gluten,milk"
+// @Success 200 {object} gin.H "Products grouped by category and personalized suggestions"
+// @Failure 400 {object} gin.H "Unknown allergen"
 // @Router /menu [get]
 func (h *MenuHandler) GetMenu(ctx *gin.Context) {
-	products, err := h.menuRepo.GetAll(ctx)
+	var filter services.MenuFilter
+
+	allergens, err := services.ParseAllergens(ctx.Query("excludeAllergens"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.ExcludeAllergens = allergens
+	filter.Locale = h.localizer.Resolve(ctx.Query("lang"), ctx.GetHeader("Accept-Language"))
+
+	sections, err := h.menuService.GetSections(ctx, filter)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	ctx.JSON(http.StatusOK, products)
+	response := gin.H{"categories": sections}
+	if userID := ctx.GetInt("user_id"); userID != 0 {
+		suggestions, err := h.favorites.Suggestions(ctx, userID, filter)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response["personalized"] = suggestions
+	}
+
+	ctx.Header("Content-Language", filter.Locale)
+	ctx.JSON(http.StatusOK, response)
 }
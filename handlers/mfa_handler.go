@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"CartoonBurgers/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MFAHandler struct {
+	mfa *services.MFAService
+}
+
+func NewMFAHandler(mfa *services.MFAService) *MFAHandler {
+	return &MFAHandler{mfa: mfa}
+}
+
+type confirmMFARequest struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// @Summary Two factor status
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.MFAStatus "Two factor state"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 500 {object} gin.H "Two factor error"
+// @Router /profile/mfa [get]
+func (h *MFAHandler) GetStatusHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	status, err := h.mfa.Status(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Two factor error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// @Summary Start two factor enrolment
+// @Description Returns a new TOTP secret with its otpauth:// URI for a QR code, confirm it with a code to enable two factor authentication
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.MFAEnrolment "Secret and otpauth URI"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 409 {object} gin.H "Two factor already enabled"
+// @Failure 500 {object} gin.H "Two factor error"
+// @Router /profile/mfa/enroll [post]
+func (h *MFAHandler) EnrollHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	enrolment, err := h.mfa.Enroll(c.Request.Context(), userID)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrolment)
+}
+
+// @Summary Confirm two factor enrolment
+// @Description Enables two factor authentication with a code from the authenticator app and returns recovery codes, they are shown only once. Logins from now on need a code, log in again to use admin routes
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body confirmMFARequest true "TOTP code"
+// @Success 200 {object} recoveryCodesResponse "Recovery codes"
+// @Failure 400 {object} gin.H "Invalid input, invalid code or enrolment not started"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 409 {object} gin.H "Two factor already enabled"
+// @Failure 500 {object} gin.H "Two factor error"
+// @Router /profile/mfa/confirm [post]
+func (h *MFAHandler) ConfirmHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req confirmMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	codes, err := h.mfa.Confirm(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func mfaError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication already enabled"})
+	case errors.Is(err, services.ErrMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrolment first"})
+	case errors.Is(err, services.ErrMFACodeInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Two factor error"})
+	}
+}
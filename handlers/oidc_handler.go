@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// oidcStateCookie holds the state of the login the browser started,
+	// the callback is only accepted from the same browser.
+	oidcStateCookie = "oidc_state"
+	oidcStatePath   = "/api/auth/oidc"
+)
+
+type OIDCHandler struct {
+	cookieSecure bool
+	oidc         *services.OIDCService
+	auth         *AuthHandlers
+	logger       *slog.Logger
+}
+
+func NewOIDCHandler(cookieSecure bool, oidc *services.OIDCService, auth *AuthHandlers, logger *slog.Logger) *OIDCHandler {
+	return &OIDCHandler{cookieSecure: cookieSecure, oidc: oidc, auth: auth, logger: logger}
+}
+
+type oidcCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// @Summary Login providers
+// @Description Providers users can log in with besides the password
+// @Tags auth
+// @Produce json
+// @Success 200 {array} models.OIDCProvider "Providers"
+// @Router /auth/oidc/providers [get]
+func (h *OIDCHandler) GetProvidersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oidc.Providers())
+}
+
+// @Summary Start a provider login
+// @Description Returns the provider URL to send the browser to, the provider redirects back to /oidc/{provider}/callback with a code and state. The state is also set in a short lived cookie, the callback must come from the same browser
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} models.OIDCAuthorization "Authorization URL"
+// @Failure 404 {object} gin.H "Unknown provider"
+// @Failure 502 {object} gin.H "Provider unavailable"
+// @Router /auth/oidc/{provider}/start [post]
+func (h *OIDCHandler) StartHandler(c *gin.Context) {
+	h.start(c, 0)
+}
+
+// @Summary Finish a provider login
+// @Description Exchanges the code and state the provider redirected back with for tokens. Provider accounts are linked to the account with the same verified email, or a new account is registered. Accounts with two factor authentication get an MFA challenge, see /auth/mfa/verify. Linking a provider from the profile is finished with the access token of the same user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param provider path string true "Provider name"
+// @Param request body oidcCallbackRequest true "Code and state"
+// @Success 200 {object} models.TokenPair "Access and refresh tokens, or models.MFAChallenge"
+// @Failure 400 {object} gin.H "Invalid input, state or missing verified email"
+// @Failure 401 {object} gin.H "Provider did not confirm the login"
+// @Failure 404 {object} gin.H "Unknown provider"
+// @Failure 409 {object} gin.H "Account exists or provider account linked to another user"
+// @Failure 500 {object} gin.H "Login error"
+// @Router /auth/oidc/{provider}/callback [post]
+func (h *OIDCHandler) CallbackHandler(c *gin.Context) {
+	var req oidcCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" || req.State == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	// The state works once, the cookie goes whatever the outcome.
+	browserState, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, oidcStatePath, "", h.cookieSecure, true)
+
+	provider := c.Param("provider")
+	if subtle.ConstantTimeCompare([]byte(browserState), []byte(req.State)) != 1 {
+		h.logger.Warn("provider login state does not match the browser",
+			"provider", provider,
+			"client_ip", c.ClientIP())
+		oidcError(c, services.ErrOIDCStateInvalid)
+		return
+	}
+
+	userID, username, err := h.oidc.Callback(c.Request.Context(), provider, req.Code, req.State, c.GetInt("user_id"))
+	if err != nil {
+		h.logger.Warn("provider login failed",
+			"provider", provider,
+			"error", err.Error(),
+			"client_ip", c.ClientIP())
+		oidcError(c, err)
+		return
+	}
+
+	h.auth.LoginUser(c, username, userID)
+}
+
+// @Summary Linked login providers
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.Identity "Linked provider accounts"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 500 {object} gin.H "Login error"
+// @Router /profile/identities [get]
+func (h *OIDCHandler) GetIdentitiesHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	identities, err := h.oidc.Identities(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// @Summary Link a login provider
+// @Description Like starting a provider login, finishing it links the provider account to the user and logs them in
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Param provider path string true "Provider name"
+// @Success 200 {object} models.OIDCAuthorization "Authorization URL"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 404 {object} gin.H "Unknown provider"
+// @Failure 502 {object} gin.H "Provider unavailable"
+// @Router /profile/identities/{provider} [post]
+func (h *OIDCHandler) LinkHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	h.start(c, userID)
+}
+
+func (h *OIDCHandler) start(c *gin.Context, linkUserID int) {
+	provider := c.Param("provider")
+	authURL, state, err := h.oidc.Start(c.Request.Context(), provider, linkUserID)
+	if errors.Is(err, services.ErrOIDCProviderUnknown) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to start provider login",
+			"provider", provider,
+			"error", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Provider unavailable"})
+		return
+	}
+
+	c.SetCookie(oidcStateCookie, state, int(services.OIDCLoginTTL.Seconds()), oidcStatePath, "", h.cookieSecure, true)
+	c.JSON(http.StatusOK, models.OIDCAuthorization{AuthorizationURL: authURL})
+}
+
+func oidcError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOIDCProviderUnknown):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider"})
+	case errors.Is(err, services.ErrOIDCStateInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login, try again"})
+	case errors.Is(err, services.ErrOIDCEmailRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The provider did not share a verified email"})
+	case errors.Is(err, services.ErrOIDCLoginFailed):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "The provider did not confirm the login"})
+	case errors.Is(err, services.ErrOIDCAccountExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this email exists, log in with the password and link the provider in the profile"})
+	case errors.Is(err, services.ErrIdentityTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "The provider account is linked to another user"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login error"})
+	}
+}
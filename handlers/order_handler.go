@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"CartoonBurgers/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrderHandler struct {
+	orderService *services.OrderService
+}
+
+func NewOrderHandler(orderService *services.OrderService) *OrderHandler {
+	return &OrderHandler{orderService: orderService}
+}
+
+type placeOrderRequest struct {
+	BonusPoints int64 `json:"bonusPoints"`
+}
+
+// @Summary Place order
+// @Description Places the cart of the logged in user as an order, redeems its promo code and books bonus points
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param order body placeOrderRequest false "Bonus points to pay with"
+// @Success 201 {object} models.Order "Placed order"
+// @Failure 400 {object} gin.H "Cart is empty"
+// @Failure 401 {object} gin.H "Unauthorized"
+// @Failure 409 {object} gin.H "Cart has products that are not available right now"
+// @Failure 422 {object} gin.H "Promo code or bonus points error"
+// @Failure 500 {object} gin.H "Placing order error"
+// @Router /orders [post]
+func (h *OrderHandler) PlaceOrderHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Please log in again"})
+		return
+	}
+
+	var req placeOrderRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil || req.BonusPoints < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+			return
+		}
+	}
+
+	order, err := h.orderService.PlaceOrder(c.Request.Context(), userID, req.BonusPoints)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCartEmpty):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		case errors.Is(err, services.ErrCartUnavailable):
+			c.JSON(http.StatusConflict, gin.H{"error": "Cart has products that are not available right now"})
+		case isPromoError(err), errors.Is(err, services.ErrInsufficientBonus), errors.Is(err, services.ErrBonusSpendLimit):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Placing order error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+func isPromoError(err error) bool {
+	for _, target := range []error{
+		services.ErrPromoNotFound,
+		services.ErrPromoInactive,
+		services.ErrPromoNotApplicable,
+		services.ErrPromoLoginRequired,
+		services.ErrPromoUsageLimit,
+		services.ErrPromoUserLimit,
+		services.ErrPromoFirstOrder,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordHandler struct {
+	resets *services.PasswordResetService
+}
+
+func NewPasswordHandler(resets *services.PasswordResetService) *PasswordHandler {
+	return &PasswordHandler{resets: resets}
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// @Summary Forgot password
+// @Description Mails a single use reset link, at most one a minute per account. The response is the same whether or not an account has the email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body forgotPasswordRequest true "Account email"
+// @Success 202 {object} gin.H "Reset link sent if the account exists"
+// @Failure 400 {object} gin.H "Invalid input"
+// @Router /auth/password/forgot [post]
+func (h *PasswordHandler) ForgotHandler(c *gin.Context) {
+	var req forgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	h.resets.Forgot(c.Request.Context(), req.Email)
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account with this email exists, a reset link has been sent"})
+}
+
+// @Summary Reset password
+// @Description Sets a new password with the token from the reset link and logs out every session of the account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body resetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} gin.H "Password changed"
+// @Failure 400 {object} gin.H "Invalid input, weak password or invalid token"
+// @Failure 500 {object} gin.H "Password reset error"
+// @Router /auth/password/reset [post]
+func (h *PasswordHandler) ResetHandler(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := h.resets.Reset(c.Request.Context(), req.Token, req.Password)
+	switch {
+	case errors.Is(err, models.ErrPasswordTooShort):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrResetTokenInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password reset error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
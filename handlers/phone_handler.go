@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"CartoonBurgers/services"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PhoneHandler struct {
+	phones *services.PhoneService
+	auth   *AuthHandlers
+	logger *slog.Logger
+}
+
+func NewPhoneHandler(phones *services.PhoneService, auth *AuthHandlers, logger *slog.Logger) *PhoneHandler {
+	return &PhoneHandler{phones: phones, auth: auth, logger: logger}
+}
+
+type phoneRequest struct {
+	Phone string `json:"phone"`
+}
+
+type phoneCodeRequest struct {
+	Phone string `json:"phone"`
+	Code  string `json:"code"`
+}
+
+// @Summary Send a login code
+// @Description Texts a login code to the phone when it is linked to an account. The response is the same whether or not it is, codes can be asked for once a minute and 5 times an hour
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body phoneRequest true "Phone, +79121234567 or 8 912 123-45-67"
+// @Success 202 {object} gin.H "Code sent if the phone is linked"
+// @Failure 400 {object} gin.H "Invalid phone"
+// @Failure 429 {object} gin.H "Sent recently, see Retry-After"
+// @Failure 500 {object} gin.H "Phone login error"
+// @Router /auth/phone/code [post]
+func (h *PhoneHandler) SendLoginCodeHandler(c *gin.Context) {
+	var req phoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	wait, err := h.phones.SendLoginCode(c.Request.Context(), req.Phone)
+	if err != nil {
+		h.codeError(c, wait, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account has this phone, a code has been sent"})
+}
+
+// @Summary Log in with a phone code
+// @Description Exchanges the texted code for tokens. A code works once and stops working after 5 wrong codes. Accounts with two factor authentication get an MFA challenge, see /auth/mfa/verify
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body phoneCodeRequest true "Phone and code"
+// @Success 200 {object} models.TokenPair "Access and refresh tokens, or models.MFAChallenge"
+// @Failure 400 {object} gin.H "Invalid phone"
+// @Failure 401 {object} gin.H "Invalid or expired code"
+// @Failure 500 {object} gin.H "Phone login error"
+// @Router /auth/phone/login [post]
+func (h *PhoneHandler) LoginHandler(c *gin.Context) {
+	var req phoneCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Phone == "" || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	userID, username, err := h.phones.Login(c.Request.Context(), req.Phone, req.Code)
+	switch {
+	case errors.Is(err, services.ErrInvalidPhone):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrPhoneCodeInvalid):
+		h.logger.Warn("phone login failed", "client_ip", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+		return
+	case err != nil:
+		h.logger.Error("failed to check phone login code", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Phone login error"})
+		return
+	}
+
+	h.auth.LoginUser(c, username, userID)
+}
+
+// @Summary Link a phone
+// @Description Texts a code to confirm the phone with, see /profile/phone/verify
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body phoneRequest true "Phone"
+// @Success 202 {object} gin.H "Code sent"
+// @Failure 400 {object} gin.H "Invalid phone"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 409 {object} gin.H "Phone already linked"
+// @Failure 429 {object} gin.H "Sent recently, see Retry-After"
+// @Failure 500 {object} gin.H "Phone login error"
+// @Router /profile/phone [post]
+func (h *PhoneHandler) SendLinkCodeHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req phoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	wait, err := h.phones.SendLinkCode(c.Request.Context(), userID, req.Phone)
+	if err != nil {
+		h.codeError(c, wait, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Code sent"})
+}
+
+// @Summary Confirm a phone
+// @Description Links the phone to the account with the texted code, replacing the linked one. The phone can then be used to log in
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body phoneCodeRequest true "Phone and code"
+// @Success 200 {object} gin.H "Phone linked"
+// @Failure 400 {object} gin.H "Invalid phone or code"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 409 {object} gin.H "Phone linked to another account"
+// @Failure 500 {object} gin.H "Phone login error"
+// @Router /profile/phone/verify [post]
+func (h *PhoneHandler) LinkHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req phoneCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Phone == "" || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := h.phones.Link(c.Request.Context(), userID, req.Phone, req.Code)
+	switch {
+	case errors.Is(err, services.ErrInvalidPhone):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrPhoneCodeInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+		return
+	case errors.Is(err, services.ErrPhoneTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "The phone is linked to another account"})
+		return
+	case err != nil:
+		h.logger.Error("failed to link phone",
+			"user_id", userID,
+			"error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Phone login error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Phone linked"})
+}
+
+// @Summary Unlink the phone
+// @Tags profile
+// @Security ApiKeyAuth
+// @Success 204 "Phone unlinked"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 500 {object} gin.H "Phone login error"
+// @Router /profile/phone [delete]
+func (h *PhoneHandler) UnlinkHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.phones.Unlink(c.Request.Context(), userID); err != nil {
+		h.logger.Error("failed to unlink phone",
+			"user_id", userID,
+			"error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Phone login error"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *PhoneHandler) codeError(c *gin.Context, wait time.Duration, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidPhone):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPhoneCodeThrottled):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "A code was sent recently"})
+	case errors.Is(err, services.ErrPhoneAlreadyLinked):
+		c.JSON(http.StatusConflict, gin.H{"error": "The phone is already linked"})
+	case errors.Is(err, services.ErrPhoneTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "The phone is linked to another account"})
+	default:
+		h.logger.Error("failed to send phone code", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Phone login error"})
+	}
+}
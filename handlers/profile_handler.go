@@ -1,18 +1,23 @@
 package handlers
 
 import (
+	"CartoonBurgers/models"
 	"CartoonBurgers/repositories"
+	"CartoonBurgers/services"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ProfileHandler struct {
-	userRepo *repositories.UserRepository
+	userRepo      *repositories.UserRepository
+	loyalty       *services.LoyaltyService
+	tiers         *services.TierService
+	notifications *repositories.NotificationRepository
 }
 
-func NewProfileHandler(repo *repositories.UserRepository) *ProfileHandler {
-	return &ProfileHandler{userRepo: repo}
+func NewProfileHandler(repo *repositories.UserRepository, loyalty *services.LoyaltyService, tiers *services.TierService, notifications *repositories.NotificationRepository) *ProfileHandler {
+	return &ProfileHandler{userRepo: repo, loyalty: loyalty, tiers: tiers, notifications: notifications}
 }
 
 // @Summary Get profile info from user
@@ -37,9 +42,168 @@ func (h *ProfileHandler) GetProfileHandler(c *gin.Context) {
 		return
 	}
 
+	tier, err := h.tiers.Info(c.Request.Context(), user.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user profile"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"username": user.Username,
-		"email":    user.Email,
-		"bonuses":  user.Bonus,
+		"username":      user.Username,
+		"email":         user.Email,
+		"emailVerified": user.EmailVerified,
+		"phone":         user.Phone,
+		"bonuses":       user.Bonus,
+		"birthday":      user.Birthday,
+		"tier":          tier,
+		"roles":         services.ContextRoles(c),
 	})
 }
+
+// @Summary Get bonus points history
+// @Description Bonus balance and every change of it, newest first
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} gin.H "Balance and history"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 500 {object} gin.H "Failed to get bonus history"
+// @Router /profile/bonus [get]
+func (h *ProfileHandler) GetBonusHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	balance, err := h.loyalty.Balance(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get bonus history"})
+		return
+	}
+
+	history, err := h.loyalty.History(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get bonus history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"balance": balance, "history": history})
+}
+
+type birthdayRequest struct {
+	Birthday string `json:"birthday"`
+}
+
+// @Summary Set birthday
+// @Description Sets the birthday for the tier birthday reward, only once
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param birthday body birthdayRequest true "Birthday as 2006-01-02"
+// @Success 200 {object} gin.H "Birthday saved"
+// @Failure 400 {object} gin.H "Invalid birthday"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 409 {object} gin.H "Birthday is already set"
+// @Failure 500 {object} gin.H "Failed to save birthday"
+// @Router /profile/birthday [put]
+func (h *ProfileHandler) SetBirthdayHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req birthdayRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Birthday == "" || models.ValidateBirthday(req.Birthday) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid birthday"})
+		return
+	}
+
+	saved, err := h.userRepo.SetBirthday(c.Request.Context(), userID, req.Birthday)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save birthday"})
+		return
+	}
+	if !saved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Birthday is already set"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Birthday saved"})
+}
+
+// @Summary Get notification settings
+// @Description Every notification event and whether it is enabled
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]bool "Enabled by event"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 500 {object} gin.H "Failed to get notification settings"
+// @Router /profile/notifications [get]
+func (h *ProfileHandler) GetNotificationsHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	optOuts, err := h.notifications.GetOptOuts(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notification settings"})
+		return
+	}
+
+	settings := make(map[models.NotificationEvent]bool, len(models.NotificationEvents))
+	for _, event := range models.NotificationEvents {
+		settings[event] = !optOuts[event]
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+type notificationRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// @Summary Enable or disable a notification
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param event path string true "Notification event, e.g. abandoned_cart"
+// @Param setting body notificationRequest true "Whether the event is enabled"
+// @Success 200 {object} gin.H "Notification settings saved"
+// @Failure 400 {object} gin.H "Invalid notification setting"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 404 {object} gin.H "Unknown notification event"
+// @Failure 500 {object} gin.H "Failed to save notification settings"
+// @Router /profile/notifications/{event} [put]
+func (h *ProfileHandler) SetNotificationHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	event := models.NotificationEvent(c.Param("event"))
+	if !event.Valid() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown notification event"})
+		return
+	}
+
+	var req notificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification setting"})
+		return
+	}
+
+	if err := h.notifications.SetOptOut(c.Request.Context(), userID, event, !*req.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification settings saved"})
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleHandler struct {
+	roles *services.RoleService
+}
+
+func NewRoleHandler(roles *services.RoleService) *RoleHandler {
+	return &RoleHandler{roles: roles}
+}
+
+type userRolesResponse struct {
+	UserID      int                 `json:"userId"`
+	Roles       []models.Role       `json:"roles"`
+	Permissions []models.Permission `json:"permissions"`
+}
+
+// @Summary Get user roles
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} userRolesResponse "Roles and the permissions they grant"
+// @Failure 400 {object} gin.H "Invalid user id"
+// @Failure 403 {object} gin.H "Forbidden"
+// @Failure 500 {object} gin.H "Roles error"
+// @Router /admin/users/{id}/roles [get]
+func (h *RoleHandler) GetRolesHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	h.respondRoles(c, userID)
+}
+
+// @Summary Grant role
+// @Description Grants admin, staff or courier, it is in the user's tokens from the next refresh
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param role path string true "Role"
+// @Success 200 {object} userRolesResponse "Roles and the permissions they grant"
+// @Failure 400 {object} gin.H "Invalid user id or role"
+// @Failure 403 {object} gin.H "Forbidden"
+// @Failure 404 {object} gin.H "User not found"
+// @Failure 500 {object} gin.H "Roles error"
+// @Router /admin/users/{id}/roles/{role} [put]
+func (h *RoleHandler) GrantRoleHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.roles.Grant(c.Request.Context(), userID, models.Role(c.Param("role")), c.GetInt("user_id")); err != nil {
+		roleError(c, err)
+		return
+	}
+
+	h.respondRoles(c, userID)
+}
+
+// @Summary Revoke role
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param role path string true "Role"
+// @Success 200 {object} userRolesResponse "Roles and the permissions they grant"
+// @Failure 400 {object} gin.H "Invalid user id or role"
+// @Failure 403 {object} gin.H "Forbidden"
+// @Failure 404 {object} gin.H "User not found"
+// @Failure 409 {object} gin.H "The last admin can not lose the admin role"
+// @Failure 500 {object} gin.H "Roles error"
+// @Router /admin/users/{id}/roles/{role} [delete]
+func (h *RoleHandler) RevokeRoleHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.roles.Revoke(c.Request.Context(), userID, models.Role(c.Param("role")), c.GetInt("user_id")); err != nil {
+		roleError(c, err)
+		return
+	}
+
+	h.respondRoles(c, userID)
+}
+
+func (h *RoleHandler) respondRoles(c *gin.Context, userID int) {
+	roles, err := h.roles.UserRoles(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Roles error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, userRolesResponse{UserID: userID, Roles: roles, Permissions: models.Permissions(roles)})
+}
+
+func userIDParam(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func roleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownRole), errors.Is(err, services.ErrImpliedRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, services.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Roles error"})
+	}
+}
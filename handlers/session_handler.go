@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"CartoonBurgers/services"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionHandler struct {
+	tokens *services.TokenService
+	logger *slog.Logger
+}
+
+func NewSessionHandler(tokens *services.TokenService, logger *slog.Logger) *SessionHandler {
+	return &SessionHandler{tokens: tokens, logger: logger}
+}
+
+// @Summary List active sessions
+// @Description Returns the logins of the user that can still refresh their tokens, the one making the request is marked current
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.Session "Active sessions"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 500 {object} gin.H "Sessions error"
+// @Router /profile/sessions [get]
+func (h *SessionHandler) GetSessionsHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	sessions, err := h.tokens.Sessions(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("failed to list sessions",
+			"user_id", userID,
+			"error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Sessions error"})
+		return
+	}
+
+	current := c.GetString("session_id")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// @Summary End a session
+// @Description Logs out the session on its device, its refresh token and access tokens stop working
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Session ID"
+// @Success 204 "Session ended"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 404 {object} gin.H "Session not found"
+// @Failure 500 {object} gin.H "Sessions error"
+// @Router /profile/sessions/{id} [delete]
+func (h *SessionHandler) RevokeSessionHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	redisClient := c.MustGet("redis").(services.IRedisSessions)
+	err := h.tokens.RevokeSession(c.Request.Context(), redisClient, userID, c.Param("id"))
+	if errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to end session",
+			"user_id", userID,
+			"error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Sessions error"})
+		return
+	}
+
+	h.logger.Info("session ended",
+		"user_id", userID,
+		"client_ip", c.ClientIP())
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Log out everywhere
+// @Description Ends every session of the user, including the one making the request
+// @Tags profile
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 204 "Sessions ended"
+// @Failure 401 {object} gin.H "User not authenticated"
+// @Failure 500 {object} gin.H "Sessions error"
+// @Router /profile/sessions [delete]
+func (h *SessionHandler) RevokeAllSessionsHandler(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	redisClient := c.MustGet("redis").(services.IRedisSessions)
+	if err := h.tokens.RevokeAll(c.Request.Context(), redisClient, userID); err != nil {
+		h.logger.Error("failed to end sessions",
+			"user_id", userID,
+			"error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Sessions error"})
+		return
+	}
+
+	h.logger.Info("logged out everywhere",
+		"user_id", userID,
+		"client_ip", c.ClientIP())
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	TimeOfDayLayout = "15:04"
+	DateLayout      = "2006-01-02"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// AvailabilityWindow limits when a product or a whole category can be
+// ordered. Empty fields are not restricted, a time range where StartTime is
+// after EndTime wraps over midnight. Dates are inclusive.
+type AvailabilityWindow struct {
+	ID         int      `json:"id,omitempty"`
+	ProductID  *int     `json:"productId,omitempty"`
+	CategoryID *int     `json:"category,omitempty"`
+	Days       []string `json:"days,omitempty"`
+	StartTime  string   `json:"startTime,omitempty"`
+	EndTime    string   `json:"endTime,omitempty"`
+	StartDate  string   `json:"startDate,omitempty"`
+	EndDate    string   `json:"endDate,omitempty"`
+}
+
+func (w *AvailabilityWindow) Validate() error {
+	for _, d := range w.Days {
+		if _, ok := weekdays[d]; !ok {
+			return fmt.Errorf("unknown day %q", d)
+		}
+	}
+
+	if (w.StartTime == "") != (w.EndTime == "") {
+		return fmt.Errorf("both startTime and endTime must be set")
+	}
+	for _, v := range []string{w.StartTime, w.EndTime} {
+		if _, err := time.Parse(TimeOfDayLayout, v); v != "" && err != nil {
+			return fmt.Errorf("invalid time %q", v)
+		}
+	}
+
+	for _, v := range []string{w.StartDate, w.EndDate} {
+		if _, err := time.Parse(DateLayout, v); v != "" && err != nil {
+			return fmt.Errorf("invalid date %q", v)
+		}
+	}
+	if w.StartDate != "" && w.EndDate != "" && w.StartDate > w.EndDate {
+		return fmt.Errorf("startDate is after endDate")
+	}
+
+	return nil
+}
+
+// Contains reports whether t, already converted to the store timezone, falls
+// into the window. Hours after midnight of a time range wrapping over it
+// belong to the day before, a "fri 22:00-02:00" window is open early on
+// Saturday.
+func (w *AvailabilityWindow) Contains(t time.Time) bool {
+	day := t
+	if w.StartTime != "" {
+		start, end := minuteOfDay(w.StartTime), minuteOfDay(w.EndTime)
+		clock := t.Hour()*60 + t.Minute()
+		if start <= end {
+			if clock < start || clock >= end {
+				return false
+			}
+		} else {
+			if clock < start && clock >= end {
+				return false
+			}
+			if clock < end {
+				day = t.AddDate(0, 0, -1)
+			}
+		}
+	}
+
+	date := day.Format(DateLayout)
+	if w.StartDate != "" && date < w.StartDate {
+		return false
+	}
+	if w.EndDate != "" && date > w.EndDate {
+		return false
+	}
+
+	if len(w.Days) > 0 {
+		for _, d := range w.Days {
+			if weekdays[d] == day.Weekday() {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// minuteOfDay returns the minutes since midnight of a validated time of
+// day. The times are not compared as strings, time.Parse accepts "7:00".
+func minuteOfDay(v string) int {
+	parsed, err := time.Parse(TimeOfDayLayout, v)
+	if err != nil {
+		return 0
+	}
+	return parsed.Hour()*60 + parsed.Minute()
+}
+
+// ParseDays parses a comma separated day list like "mon,tue,fri".
+func ParseDays(raw string) []string {
+	var days []string
+	for _, d := range strings.Split(raw, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// IsAvailableAt applies product and category windows together: each set that
+// is not empty must have at least one window containing t.
+func IsAvailableAt(t time.Time, productWindows, categoryWindows []AvailabilityWindow) bool {
+	return anyContains(t, productWindows) && anyContains(t, categoryWindows)
+}
+
+func anyContains(t time.Time, windows []AvailabilityWindow) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for i := range windows {
+		if windows[i].Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the window as space separated days, time range and date
+// range, e.g. "mon,tue 07:00-11:00 2025-09-01..2025-09-30". Parse reads it
+// back.
+func (w AvailabilityWindow) String() string {
+	var parts []string
+	if len(w.Days) > 0 {
+		parts = append(parts, strings.Join(w.Days, ","))
+	}
+	if w.StartTime != "" {
+		parts = append(parts, w.StartTime+"-"+w.EndTime)
+	}
+	if w.StartDate != "" || w.EndDate != "" {
+		parts = append(parts, w.StartDate+".."+w.EndDate)
+	}
+	return strings.Join(parts, " ")
+}
+
+func ParseAvailabilityWindow(raw string) (AvailabilityWindow, error) {
+	var w AvailabilityWindow
+	for _, part := range strings.Fields(raw) {
+		switch {
+		case strings.Contains(part, ".."):
+			w.StartDate, w.EndDate, _ = strings.Cut(part, "..")
+		case strings.Contains(part, ":"):
+			var ok bool
+			if w.StartTime, w.EndTime, ok = strings.Cut(part, "-"); !ok {
+				return w, fmt.Errorf("invalid time range %q", part)
+			}
+		default:
+			w.Days = ParseDays(part)
+		}
+	}
+	if err := w.Validate(); err != nil {
+		return w, err
+	}
+
+	// Stored in the zero padded form, "7:00" is kept as "07:00".
+	for _, v := range []*string{&w.StartTime, &w.EndTime} {
+		if *v != "" {
+			parsed, _ := time.Parse(TimeOfDayLayout, *v)
+			*v = parsed.Format(TimeOfDayLayout)
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type BonusKind string
+
+const (
+	// BonusOpening carries over the users.bonus value from before the ledger.
+	BonusOpening BonusKind = "opening"
+	BonusEarn    BonusKind = "earn"
+	BonusSpend   BonusKind = "spend"
+	BonusExpire  BonusKind = "expire"
+	// BonusBirthday is the yearly birthday reward of the user's tier.
+	BonusBirthday BonusKind = "birthday"
+)
+
+// BonusEntry is one change of a user's bonus points. Earned points are spent
+// and expire oldest first, Remaining is what is left of an earning.
+type BonusEntry struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"-"`
+	Kind      BonusKind  `json:"kind"`
+	Amount    int64      `json:"amount"`
+	Remaining int64      `json:"remaining,omitempty"`
+	OrderID   *int       `json:"orderId,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
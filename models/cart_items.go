@@ -4,3 +4,74 @@ type CartItem struct {
 	ProductID int `json:"productId"`
 	Quantity  int `json:"quantity"`
 }
+
+// CartMergeStrategy decides the quantity of a product that is both in the
+// guest cart and in the user cart when they are merged on login.
+type CartMergeStrategy string
+
+const (
+	CartMergeSum CartMergeStrategy = "sum"
+	CartMergeMax CartMergeStrategy = "max"
+)
+
+func (s CartMergeStrategy) Valid() bool {
+	return s == CartMergeSum || s == CartMergeMax
+}
+
+// Merge returns the quantity kept for a product found in both carts.
+func (s CartMergeStrategy) Merge(userQuantity, guestQuantity int) int {
+	if s == CartMergeMax {
+		return max(userQuantity, guestQuantity)
+	}
+	return userQuantity + guestQuantity
+}
+
+// PricedCartLine is a cart item with prices in minor units (kopecks).
+// Unavailable lines stay in the cart but are not counted in the totals.
+type PricedCartLine struct {
+	ProductID   int    `json:"productId"`
+	Name        string `json:"name"`
+	CategoryID  int    `json:"category"`
+	Quantity    int    `json:"quantity"`
+	UnitPrice   int64  `json:"unitPrice"`
+	LineTotal   int64  `json:"lineTotal"`
+	Unavailable bool   `json:"unavailable,omitempty"`
+}
+
+type CartDiscount struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Amount      int64  `json:"amount"`
+	// Delivery is set when the discount waives the delivery fee instead of
+	// taking money off the products.
+	Delivery bool `json:"delivery,omitempty"`
+}
+
+// PricedCart is the cart as computed by the server, every amount is in minor
+// units so totals never suffer from float rounding.
+type PricedCart struct {
+	Items       []PricedCartLine `json:"items"`
+	Subtotal    int64            `json:"subtotal"`
+	DeliveryFee int64            `json:"deliveryFee"`
+	Discounts   []CartDiscount   `json:"discounts"`
+	Discount    int64            `json:"discount"`
+	Total       int64            `json:"total"`
+
+	// PromoCode is the code applied to the cart, PromoError explains why it
+	// gives no discount when it stopped applying.
+	PromoCode  string `json:"promoCode,omitempty"`
+	PromoError string `json:"promoError,omitempty"`
+}
+
+// GoodsTotal is what the products cost after their discounts. The delivery
+// fee and the discounts waiving it are left out, bonus points are spent on
+// and earned for the products only.
+func (c *PricedCart) GoodsTotal() int64 {
+	var discount int64
+	for _, d := range c.Discounts {
+		if !d.Delivery {
+			discount += d.Amount
+		}
+	}
+	return c.Subtotal - min(discount, c.Subtotal)
+}
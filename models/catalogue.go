@@ -0,0 +1,52 @@
+package models
+
+// Catalogue is the full menu as exported for editing outside the app and
+// imported back.
+type Catalogue struct {
+	Categories []Category `json:"categories"`
+	Products   []Product  `json:"products"`
+
+	// ProductRows and CategoryRows keep the source rows of a parsed file so
+	// errors point at the right line. Without them the position in the list
+	// is used.
+	ProductRows  []int `json:"-"`
+	CategoryRows []int `json:"-"`
+}
+
+func (c *Catalogue) ProductRow(i int) int {
+	if i < len(c.ProductRows) {
+		return c.ProductRows[i]
+	}
+	return i + 1
+}
+
+func (c *Catalogue) CategoryRow(i int) int {
+	if i < len(c.CategoryRows) {
+		return c.CategoryRows[i]
+	}
+	return i + 1
+}
+
+// ImportError points at a row of the imported file. Rows are counted from 1,
+// for CSV the header is row 1, for JSON it is the position in the list named
+// by Field or in products.
+type ImportError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	DryRun    bool          `json:"dryRun"`
+	Applied   bool          `json:"applied"`
+	Created   []string      `json:"created"`
+	Updated   []string      `json:"updated"`
+	Deleted   []string      `json:"deleted"`
+	Unchanged int           `json:"unchanged"`
+	Errors    []ImportError `json:"errors"`
+
+	CategoriesCreated   []string `json:"categoriesCreated"`
+	CategoriesUpdated   []string `json:"categoriesUpdated"`
+	CategoriesDeleted   []string `json:"categoriesDeleted"`
+	CategoriesUnchanged int      `json:"categoriesUnchanged"`
+}
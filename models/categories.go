@@ -0,0 +1,40 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type Category struct {
+	ID           int                  `json:"id"`
+	Name         string               `json:"name"`
+	Slug         string               `json:"slug"`
+	SortOrder    int                  `json:"sortOrder"`
+	Icon         string               `json:"icon"`
+	Visible      bool                 `json:"visible"`
+	Availability []AvailabilityWindow `json:"availability,omitempty"`
+}
+
+func (c *Category) Validate() error {
+	if c.Name == "" {
+		return errors.New("name cannot be empty")
+	}
+	if !slugPattern.MatchString(c.Slug) {
+		return fmt.Errorf("invalid slug %q", c.Slug)
+	}
+	for i := range c.Availability {
+		if err := c.Availability[i].Validate(); err != nil {
+			return fmt.Errorf("availability: %w", err)
+		}
+	}
+	return nil
+}
+
+// MenuSection is a visible category with its currently listed products.
+type MenuSection struct {
+	Category
+	Products []Product `json:"products"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// FavoriteProduct is a starred product, Available tells whether it can be
+// ordered right now.
+type FavoriteProduct struct {
+	Product
+	Available bool `json:"available"`
+}
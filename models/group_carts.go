@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+type GroupCartStatus string
+
+const (
+	// GroupCartOpen carts take items from every participant.
+	GroupCartOpen GroupCartStatus = "open"
+	// GroupCartLocked carts are frozen by the owner before checkout.
+	GroupCartLocked GroupCartStatus = "locked"
+	// GroupCartOrdered carts were placed as an order.
+	GroupCartOrdered GroupCartStatus = "ordered"
+)
+
+type GroupCartMember struct {
+	UserID   int    `json:"userId"`
+	Username string `json:"username"`
+}
+
+// GroupCartItem is the quantity of a product added by one participant.
+type GroupCartItem struct {
+	UserID    int `json:"userId"`
+	ProductID int `json:"productId"`
+	Quantity  int `json:"quantity"`
+}
+
+// GroupCart is a cart started by the owner that colleagues join with the
+// invite token. Members include the owner.
+type GroupCart struct {
+	ID          int             `json:"id"`
+	OwnerID     int             `json:"ownerId"`
+	InviteToken string          `json:"inviteToken"`
+	Status      GroupCartStatus `json:"status"`
+	OrderID     *int            `json:"orderId,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+
+	Members []GroupCartMember `json:"-"`
+	Items   []GroupCartItem   `json:"-"`
+}
+
+// Cart returns the items of all participants summed up by product.
+func (g *GroupCart) Cart() []CartItem {
+	var cart []CartItem
+	index := make(map[int]int)
+	for _, item := range g.Items {
+		if i, ok := index[item.ProductID]; ok {
+			cart[i].Quantity += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(cart)
+		cart = append(cart, CartItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+	return cart
+}
+
+func (g *GroupCart) IsMember(userID int) bool {
+	for _, m := range g.Members {
+		if m.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupCartShare is the part of a group cart added by one participant.
+type GroupCartShare struct {
+	UserID   int              `json:"userId"`
+	Username string           `json:"username"`
+	Items    []PricedCartLine `json:"items"`
+	Subtotal int64            `json:"subtotal"`
+}
+
+// PricedGroupCart is the group cart priced as one cart with the per person
+// breakdown, amounts are in minor units.
+type PricedGroupCart struct {
+	GroupCart
+	Cart         *PricedCart      `json:"cart"`
+	Participants []GroupCartShare `json:"participants"`
+}
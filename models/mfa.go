@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// MFA is the TOTP enrolment of a user. It protects logins once confirmed.
+type MFA struct {
+	UserID      int
+	Secret      string
+	CreatedAt   time.Time
+	ConfirmedAt *time.Time
+	// LastStep is the TOTP time step of the last accepted code, codes are
+	// accepted once.
+	LastStep int64
+}
+
+func (m *MFA) Enabled() bool {
+	return m != nil && m.ConfirmedAt != nil
+}
+
+// MFAEnrolment is shown once when enrolment starts, URI is meant for a QR
+// code.
+type MFAEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// MFAStatus is the two factor state of the profile.
+type MFAStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+// MFAChallenge is returned by login instead of tokens when the account has
+// two factor authentication, see POST /api/auth/mfa/verify.
+type MFAChallenge struct {
+	MFARequired    bool   `json:"mfaRequired"`
+	ChallengeToken string `json:"challengeToken"`
+}
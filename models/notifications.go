@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type NotificationEvent string
+
+const (
+	// EventAbandonedCart is sent once for a logged in user's cart that was
+	// left untouched for a while.
+	EventAbandonedCart NotificationEvent = "abandoned_cart"
+)
+
+// NotificationEvents are the events users can opt out of.
+var NotificationEvents = []NotificationEvent{EventAbandonedCart}
+
+func (e NotificationEvent) Valid() bool {
+	for _, known := range NotificationEvents {
+		if e == known {
+			return true
+		}
+	}
+	return false
+}
+
+type Notification struct {
+	Event     NotificationEvent `json:"event"`
+	UserID    int               `json:"userId"`
+	Data      map[string]any    `json:"data,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
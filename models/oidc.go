@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// OIDCProvider is a configured social login shown on the login form.
+type OIDCProvider struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// OIDCAuthorization is where to send the browser to log in at a provider.
+type OIDCAuthorization struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+}
+
+// OIDCLogin is a started login at a provider, kept until the provider
+// redirects back. Only the hash of the state is stored.
+type OIDCLogin struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	// LinkUserID is set when a logged in user links the provider account
+	// instead of logging in with it.
+	LinkUserID int
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+// OIDCClaims are the ID token claims an account is found or created from.
+type OIDCClaims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// Identity links an account at a login provider to a user.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	UserID    int       `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
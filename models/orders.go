@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+type OrderStatus string
+
+const (
+	OrderPlaced    OrderStatus = "placed"
+	OrderCancelled OrderStatus = "cancelled"
+)
+
+type OrderItem struct {
+	ProductID int    `json:"productId"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice int64  `json:"unitPrice"`
+	LineTotal int64  `json:"lineTotal"`
+}
+
+// OrderParticipant is the per person subtotal of a group order.
+type OrderParticipant struct {
+	UserID   int    `json:"userId"`
+	Username string `json:"username"`
+	Subtotal int64  `json:"subtotal"`
+}
+
+// Order is a placed cart, amounts are in minor units like in PricedCart.
+type Order struct {
+	ID          int         `json:"id"`
+	UserID      int         `json:"userId"`
+	Status      OrderStatus `json:"status"`
+	Items       []OrderItem `json:"items"`
+	Subtotal    int64       `json:"subtotal"`
+	DeliveryFee int64       `json:"deliveryFee"`
+	Discount    int64       `json:"discount"`
+	Total       int64       `json:"total"`
+	PromoCode   string      `json:"promoCode,omitempty"`
+	CreatedAt   time.Time   `json:"createdAt"`
+
+	// GroupCartID is set for orders placed from a group cart, Participants
+	// then break the subtotal down by person.
+	GroupCartID  int                `json:"groupCartId,omitempty"`
+	Participants []OrderParticipant `json:"participants,omitempty"`
+
+	// BonusSpent points paid part of Total, BonusEarned points are credited
+	// for the order and expire at BonusExpiresAt, never when nil.
+	BonusSpent     int64      `json:"bonusSpent"`
+	BonusEarned    int64      `json:"bonusEarned"`
+	BonusExpiresAt *time.Time `json:"-"`
+}
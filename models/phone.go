@@ -0,0 +1,82 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// SMS is a plain text message to an E.164 phone number.
+type SMS struct {
+	To   string
+	Body string
+}
+
+// PhoneCodePurpose is what an SMS code can be used for.
+type PhoneCodePurpose string
+
+const (
+	PhoneCodeLogin PhoneCodePurpose = "login"
+	PhoneCodeLink  PhoneCodePurpose = "link"
+)
+
+// PhoneCode is a stored one time code sent by SMS. Only the hash of the
+// code is kept. Login codes belong to the user the phone is linked to, link
+// codes to the user linking the phone.
+type PhoneCode struct {
+	ID        int
+	Phone     string
+	Purpose   PhoneCodePurpose
+	UserID    int
+	CodeHash  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// PhoneRegion is how numbers dialled without a country code are read.
+type PhoneRegion struct {
+	// CountryCode is added to national numbers, like "7".
+	CountryCode string
+	// TrunkPrefix is dropped from national numbers, like "8" in 8 912 ...
+	TrunkPrefix string
+}
+
+var ErrInvalidPhone = errors.New("phone must look like +79121234567")
+
+// NormalizePhone returns the E.164 form of a phone number like
+// "+7 (912) 123-45-67", "007 912 123 45 67" or, in the region, "8 912 123
+// 45 67". Spaces, dashes, dots and parentheses are ignored.
+func NormalizePhone(raw string, region PhoneRegion) (string, error) {
+	raw = strings.TrimSpace(raw)
+	international := strings.HasPrefix(raw, "+")
+	raw = strings.TrimPrefix(raw, "+")
+
+	var digits strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	number := digits.String()
+	switch {
+	case international:
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case region.TrunkPrefix != "" && strings.HasPrefix(number, region.TrunkPrefix):
+		number = region.CountryCode + strings.TrimPrefix(number, region.TrunkPrefix)
+	default:
+		number = region.CountryCode + number
+	}
+
+	// E.164 numbers have at most 15 digits and country codes do not start
+	// with 0, shorter than 8 digits is no subscriber number anywhere.
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return "+" + number, nil
+}
@@ -1,12 +1,8 @@
 package models
 
-type ProductCategory int
-
-const (
-	Burger ProductCategory = iota
-	Snack
-	Drink
-	Dessert
+import (
+	"errors"
+	"fmt"
 )
 
 type ProductType int
@@ -16,11 +12,117 @@ const (
 	Latest
 )
 
+type Allergen string
+
+const (
+	Gluten    Allergen = "gluten"
+	Milk      Allergen = "milk"
+	Eggs      Allergen = "eggs"
+	Nuts      Allergen = "nuts"
+	Peanuts   Allergen = "peanuts"
+	Soy       Allergen = "soy"
+	Fish      Allergen = "fish"
+	Shellfish Allergen = "shellfish"
+	Sesame    Allergen = "sesame"
+	Celery    Allergen = "celery"
+	Mustard   Allergen = "mustard"
+	Sulphites Allergen = "sulphites"
+)
+
+var knownAllergens = map[Allergen]bool{
+	Gluten: true, Milk: true, Eggs: true, Nuts: true, Peanuts: true, Soy: true,
+	Fish: true, Shellfish: true, Sesame: true, Celery: true, Mustard: true, Sulphites: true,
+}
+
+func (a Allergen) Valid() bool {
+	return knownAllergens[a]
+}
+
+type DietaryTag string
+
+const (
+	Vegetarian DietaryTag = "vegetarian"
+	Halal      DietaryTag = "halal"
+	Spicy      DietaryTag = "spicy"
+)
+
+func (t DietaryTag) Valid() bool {
+	return t == Vegetarian || t == Halal || t == Spicy
+}
+
+// Nutrition is given per serving, ServingSize is in grams.
+type Nutrition struct {
+	ServingSize   int     `json:"servingSize"`
+	Calories      int     `json:"calories"`
+	Protein       float64 `json:"protein"`
+	Fat           float64 `json:"fat"`
+	Carbohydrates float64 `json:"carbohydrates"`
+	Sugar         float64 `json:"sugar"`
+	Salt          float64 `json:"salt"`
+}
+
 type Product struct {
-	ID       int             `json:"id"`
-	Name     string          `json:"name"`
-	Price    int             `json:"price"`
-	Count    int             `json:"count"`
-	Type     ProductType     `json:"type"`
-	Category ProductCategory `json:"category"`
+	ID           int                  `json:"id"`
+	Name         string               `json:"name"`
+	Description  string               `json:"description"`
+	Price        int                  `json:"price"`
+	Count        int                  `json:"count"`
+	Type         ProductType          `json:"type"`
+	CategoryID   int                  `json:"category"`
+	Allergens    []Allergen           `json:"allergens"`
+	Nutrition    *Nutrition           `json:"nutrition,omitempty"`
+	Tags         []DietaryTag         `json:"tags"`
+	Availability []AvailabilityWindow `json:"availability,omitempty"`
+}
+
+type ProductTranslation struct {
+	ProductID   int    `json:"productId"`
+	Locale      string `json:"locale"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (p *Product) Validate() error {
+	if p.Name == "" {
+		return errors.New("name cannot be empty")
+	}
+	if p.Price <= 0 {
+		return errors.New("price must be positive")
+	}
+	if p.Count < 1 {
+		return errors.New("count must be at least 1")
+	}
+	if p.Type != Default && p.Type != Latest {
+		return fmt.Errorf("unknown type %d", p.Type)
+	}
+	if p.CategoryID <= 0 {
+		return fmt.Errorf("unknown category %d", p.CategoryID)
+	}
+	for _, a := range p.Allergens {
+		if !a.Valid() {
+			return fmt.Errorf("unknown allergen %q", a)
+		}
+	}
+	for _, t := range p.Tags {
+		if !t.Valid() {
+			return fmt.Errorf("unknown tag %q", t)
+		}
+	}
+	for i := range p.Availability {
+		if err := p.Availability[i].Validate(); err != nil {
+			return fmt.Errorf("availability: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *Product) HasAnyAllergen(allergens []Allergen) bool {
+	for _, own := range p.Allergens {
+		for _, a := range allergens {
+			if own == a {
+				return true
+			}
+		}
+	}
+	return false
 }
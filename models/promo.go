@@ -0,0 +1,105 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+type PromoKind string
+
+const (
+	// PromoPercent takes Value percent off the eligible subtotal.
+	PromoPercent PromoKind = "percent"
+	// PromoFixed takes Value minor units off the eligible subtotal.
+	PromoFixed PromoKind = "fixed"
+	// PromoFreeItem makes every FreeEvery-th unit of ProductID free.
+	PromoFreeItem PromoKind = "free_item"
+	// PromoFreeDelivery waives the delivery fee.
+	PromoFreeDelivery PromoKind = "free_delivery"
+)
+
+func (k PromoKind) Valid() bool {
+	switch k {
+	case PromoPercent, PromoFixed, PromoFreeItem, PromoFreeDelivery:
+		return true
+	}
+	return false
+}
+
+type PromoCode struct {
+	ID          int       `json:"id"`
+	Code        string    `json:"code"`
+	Description string    `json:"description"`
+	Kind        PromoKind `json:"kind"`
+	Value       int64     `json:"value"`
+	ProductID   *int      `json:"productId,omitempty"`
+	FreeEvery   int       `json:"freeEvery,omitempty"`
+
+	// Conditions, zero values mean no restriction.
+	MinSubtotal    int64      `json:"minSubtotal"`
+	CategoryID     *int       `json:"category,omitempty"`
+	FirstOrderOnly bool       `json:"firstOrderOnly"`
+	StartsAt       *time.Time `json:"startsAt,omitempty"`
+	EndsAt         *time.Time `json:"endsAt,omitempty"`
+	PerUserLimit   int        `json:"perUserLimit"`
+	UsageLimit     int        `json:"usageLimit"`
+	UsedCount      int        `json:"usedCount"`
+	Active         bool       `json:"active"`
+	// MinTier limits the code to users of this loyalty tier and above.
+	MinTier Tier `json:"minTier,omitempty"`
+}
+
+// NormalizePromoCode makes codes case and whitespace insensitive.
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func (p *PromoCode) Validate() error {
+	if p.Code == "" || p.Code != NormalizePromoCode(p.Code) {
+		return errors.New("code must be non empty upper case")
+	}
+	if !p.Kind.Valid() {
+		return errors.New("unknown promo kind")
+	}
+
+	switch p.Kind {
+	case PromoPercent:
+		if p.Value <= 0 || p.Value > 100 {
+			return errors.New("percent must be between 1 and 100")
+		}
+	case PromoFixed:
+		if p.Value <= 0 {
+			return errors.New("fixed amount must be positive")
+		}
+	case PromoFreeItem:
+		if p.ProductID == nil || p.FreeEvery < 1 {
+			return errors.New("free item needs a product and freeEvery")
+		}
+	}
+
+	if p.MinTier != "" && !p.MinTier.Valid() {
+		return errors.New("unknown tier")
+	}
+
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return errors.New("endsAt must be after startsAt")
+	}
+
+	return nil
+}
+
+// ActiveAt reports whether the code is enabled and within its validity dates.
+// EndsAt is exclusive.
+func (p *PromoCode) ActiveAt(t time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.StartsAt != nil && t.Before(*p.StartsAt) {
+		return false
+	}
+	if p.EndsAt != nil && !t.Before(*p.EndsAt) {
+		return false
+	}
+	return true
+}
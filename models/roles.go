@@ -0,0 +1,74 @@
+package models
+
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleStaff    Role = "staff"
+	RoleCourier  Role = "courier"
+	RoleCustomer Role = "customer"
+)
+
+// Roles are all known roles. Every user has RoleCustomer, the others are
+// granted.
+var Roles = []Role{RoleAdmin, RoleStaff, RoleCourier, RoleCustomer}
+
+func (r Role) Valid() bool {
+	for _, known := range Roles {
+		if r == known {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresMFA reports whether accounts with the role must sign in with two
+// factors to use it.
+func (r Role) RequiresMFA() bool {
+	return r == RoleAdmin || r == RoleStaff
+}
+
+type Permission string
+
+const (
+	PermissionManageMenu    Permission = "menu:manage"
+	PermissionManageRoles   Permission = "roles:manage"
+	PermissionViewOrders    Permission = "orders:view"
+	PermissionDeliverOrders Permission = "orders:deliver"
+	PermissionPlaceOrders   Permission = "orders:place"
+)
+
+// RolePermissions lists what every role may do.
+var RolePermissions = map[Role][]Permission{
+	RoleAdmin:    {PermissionManageMenu, PermissionManageRoles, PermissionViewOrders, PermissionDeliverOrders, PermissionPlaceOrders},
+	RoleStaff:    {PermissionManageMenu, PermissionViewOrders},
+	RoleCourier:  {PermissionViewOrders, PermissionDeliverOrders},
+	RoleCustomer: {PermissionPlaceOrders},
+}
+
+// HasPermission reports whether any of roles grants p.
+func HasPermission(roles []Role, p Permission) bool {
+	for _, r := range roles {
+		for _, granted := range RolePermissions[r] {
+			if granted == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions granted by roles without repeats.
+func Permissions(roles []Role) []Permission {
+	seen := make(map[Permission]bool)
+	var permissions []Permission
+	for _, r := range roles {
+		for _, p := range RolePermissions[r] {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	return permissions
+}
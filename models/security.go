@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type SecurityEventType string
+
+const (
+	// SecurityLoginLockout is recorded when failed logins lock out a
+	// username or an IP.
+	SecurityLoginLockout SecurityEventType = "login_lockout"
+	// SecurityLoginUnlock is recorded when a password reset lifts a lockout.
+	SecurityLoginUnlock SecurityEventType = "login_unlock"
+)
+
+// SecurityEvent is one security relevant event. Username and IP are set
+// when known.
+type SecurityEvent struct {
+	Type     SecurityEventType
+	Username string
+	IP       string
+	Failures int
+	Until    *time.Time
+	At       time.Time
+}
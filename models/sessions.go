@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Session is one login of a user with the tokens refreshed from it. Its ID
+// is the refresh token family and the sid claim of its access tokens.
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    int       `json:"-"`
+	Device    string    `json:"device"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
+	// LastSeenAt is updated when the session refreshes its tokens.
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	// Current marks the session of the request listing the sessions.
+	Current bool `json:"current"`
+}
+
+// SessionClient describes the client that logs in or refreshes a session.
+type SessionClient struct {
+	IP        string
+	UserAgent string
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// SigningKey is a stored key access tokens are signed with. A key is
+// published before it activates so every verifier knows it in time, and is
+// kept until the tokens it signed expired.
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey string
+	CreatedAt  time.Time
+	// ActivatesAt is when the key starts signing, a newer active key takes
+	// over from it.
+	ActivatesAt time.Time
+	// ExpiresAt is set once a newer key replaces this one, after it the key
+	// no longer verifies tokens.
+	ExpiresAt *time.Time
+}
+
+// JWK is a public key in JSON Web Key format, RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// N and E are set for RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv and X are set for Ed25519 keys, EC keys also have Y.
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+type Tier string
+
+const (
+	TierBronze Tier = "bronze"
+	TierSilver Tier = "silver"
+	TierGold   Tier = "gold"
+)
+
+// Rank orders the tiers, unknown tiers rank below bronze.
+func (t Tier) Rank() int {
+	switch t {
+	case TierBronze:
+		return 1
+	case TierSilver:
+		return 2
+	case TierGold:
+		return 3
+	}
+	return 0
+}
+
+func (t Tier) Valid() bool {
+	return t.Rank() > 0
+}
+
+// TierRule is what it takes to reach a tier and what the tier gives.
+type TierRule struct {
+	Tier Tier `json:"tier"`
+	// MinSpend over the rolling year in minor units.
+	MinSpend       int64   `json:"minSpend"`
+	EarnMultiplier float64 `json:"earnMultiplier"`
+	FreeDelivery   bool    `json:"freeDelivery"`
+	// BirthdayBonus points are credited on the user's birthday.
+	BirthdayBonus int64 `json:"birthdayBonus"`
+}
+
+// UserTier is the tier stored by the last recalculation.
+type UserTier struct {
+	UserID     int       `json:"-"`
+	Tier       Tier      `json:"tier"`
+	Spend      int64     `json:"spend"`
+	ComputedAt time.Time `json:"computedAt"`
+}
+
+// TierInfo is the tier of a user as shown in the profile.
+type TierInfo struct {
+	TierRule
+	Spend         int64      `json:"spend"`
+	ComputedAt    *time.Time `json:"computedAt,omitempty"`
+	NextTier      Tier       `json:"nextTier,omitempty"`
+	NextTierSpend int64      `json:"nextTierSpend,omitempty"`
+}
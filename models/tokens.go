@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// TokenPair is returned on login and refresh. The access token is a short
+// lived JWT, the refresh token is opaque and single use.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+// RefreshToken is a stored refresh token. Only the hash of the token is
+// kept. Tokens rotated from one login share the Family.
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	Username  string
+	Family    string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	// MFA is set for logins that passed two factor authentication, it is
+	// kept when the token is rotated.
+	MFA bool
+}
+
+// TokenPurpose is what a one time token can be used for.
+type TokenPurpose string
+
+const (
+	TokenPasswordReset     TokenPurpose = "password_reset"
+	TokenEmailVerification TokenPurpose = "email_verification"
+	TokenMFAChallenge      TokenPurpose = "mfa_challenge"
+)
+
+// OneTimeToken is a stored single use token sent to the user, like the
+// password reset link. Only the hash of the token is kept.
+type OneTimeToken struct {
+	ID        int
+	UserID    int
+	Purpose   TokenPurpose
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
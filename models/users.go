@@ -1,6 +1,11 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
 
 type User struct {
 	Id       int    `json:"id"`
@@ -8,14 +13,71 @@ type User struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Bonus    int    `json:"bonus"`
+	// Birthday is "2006-01-02", optional.
+	Birthday string `json:"birthday,omitempty"`
+	// EmailVerified is set once the user opens the verification link, it
+	// is never taken from requests.
+	EmailVerified bool `json:"-"`
+	// EmailVerifiedAt is when the email was verified, nil for accounts
+	// that predate verification and count as verified without a check.
+	EmailVerifiedAt *time.Time `json:"-"`
+	// Phone is the E.164 number the user confirmed with an SMS code, "" when
+	// none is linked. It is never taken from requests.
+	Phone string `json:"-"`
 }
 
 func (u *User) Validate() error {
 	if u.Username == "" {
 		return errors.New("username cannot be empty")
 	}
-	if len(u.Password) < 6 {
-		return errors.New("password must be at least 6 characters")
+	if err := ValidatePassword(u.Password); err != nil {
+		return err
+	}
+	if err := ValidateBirthday(u.Birthday); err != nil {
+		return err
+	}
+	return nil
+}
+
+var ErrInvalidEmail = errors.New("email must look like name@example.com")
+
+// ValidateEmail accepts a bare address like name@example.com, without a
+// display name and with a dotted domain.
+func ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return ErrInvalidEmail
+	}
+
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+var ErrPasswordTooShort = errors.New("password must be at least 6 characters")
+
+// ValidatePassword checks the password a user picks.
+func ValidatePassword(password string) error {
+	if len(password) < 6 {
+		return ErrPasswordTooShort
+	}
+	return nil
+}
+
+// ValidateBirthday accepts "" or a past date in "2006-01-02" form.
+func ValidateBirthday(birthday string) error {
+	if birthday == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.DateOnly, birthday)
+	if err != nil {
+		return errors.New("birthday must look like 2006-01-02")
+	}
+	if t.After(time.Now()) {
+		return errors.New("birthday can not be in the future")
 	}
 	return nil
 }
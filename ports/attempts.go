@@ -0,0 +1,21 @@
+package ports
+
+import (
+	"context"
+	"time"
+)
+
+// AttemptCounter counts failed attempts per key and locks keys out, it
+// backs brute force protection.
+type AttemptCounter interface {
+	// Fail counts a failure for key and returns the failures counted
+	// since the count last expired. The count expires keep after the last
+	// failure.
+	Fail(ctx context.Context, key string, keep time.Duration) (int, error)
+	// Lock locks key out for d.
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// LockedFor returns how long key stays locked, 0 when it is not.
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Reset forgets the failures and the lock of key.
+	Reset(ctx context.Context, key string) error
+}
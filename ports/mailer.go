@@ -0,0 +1,11 @@
+package ports
+
+import (
+	"CartoonBurgers/models"
+	"context"
+)
+
+// Mailer delivers account emails like password reset links.
+type Mailer interface {
+	Send(ctx context.Context, mail models.Mail) error
+}
@@ -0,0 +1,12 @@
+package ports
+
+import (
+	"CartoonBurgers/models"
+	"context"
+)
+
+// Notifier delivers events to users, by push, e-mail or whatever the
+// implementation talks to.
+type Notifier interface {
+	Notify(ctx context.Context, notification models.Notification) error
+}
@@ -0,0 +1,12 @@
+package ports
+
+import (
+	"CartoonBurgers/models"
+	"context"
+)
+
+// SecurityEvents records security relevant events like lockouts for
+// monitoring and audit.
+type SecurityEvents interface {
+	Record(ctx context.Context, event models.SecurityEvent) error
+}
@@ -3,6 +3,7 @@ package ports
 import (
 	"CartoonBurgers/models"
 	"context"
+	"time"
 )
 
 type AuthService interface {
@@ -20,4 +21,27 @@ type CartService interface {
 	GetCart(ctx context.Context, userID string) ([]models.CartItem, error)
 	AddToCart(ctx context.Context, userID string, item models.CartItem) error
 	RemoveFromCart(ctx context.Context, userID string, productID int) error
+	// SetQuantity sets the exact quantity of a product, 0 removes it.
+	SetQuantity(ctx context.Context, cartID string, productID, quantity int) error
+	ClearCart(ctx context.Context, cartID string) error
+	// RemoveOrdered takes the ordered quantities of items and the used promo
+	// code out of the cart, items added since the order was read stay.
+	RemoveOrdered(ctx context.Context, cartID string, items []models.CartItem, promoCode string) error
+	// ReplaceCart swaps the whole cart for items in one step.
+	ReplaceCart(ctx context.Context, cartID string, items []models.CartItem) error
+	// MergeCarts moves every item of the from cart into the to cart and
+	// deletes the from cart.
+	MergeCarts(ctx context.Context, fromCartID, toCartID string, strategy models.CartMergeStrategy) error
+	// SetPromoCode attaches a promo code to the cart, "" removes it.
+	SetPromoCode(ctx context.Context, cartID, code string) error
+	GetPromoCode(ctx context.Context, cartID string) (string, error)
+	// IdleCarts returns the logged in users' carts last changed before
+	// before that were not reminded about yet.
+	IdleCarts(ctx context.Context, before time.Time) ([]string, error)
+	// MarkReminded records the reminder for the cart and reports whether it
+	// was the first one. Clearing the cart resets it.
+	MarkReminded(ctx context.Context, cartID string) (bool, error)
+	// ForgetIdleCart stops tracking the cart for reminders unless it was
+	// changed since before. The items are left alone.
+	ForgetIdleCart(ctx context.Context, cartID string, before time.Time) error
 }
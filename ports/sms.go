@@ -0,0 +1,11 @@
+package ports
+
+import (
+	"CartoonBurgers/models"
+	"context"
+)
+
+// SMSSender delivers text messages like login codes.
+type SMSSender interface {
+	Send(ctx context.Context, sms models.SMS) error
+}
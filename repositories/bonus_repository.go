@@ -0,0 +1,205 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrInsufficientBonus = errors.New("not enough bonus points")
+
+type BonusRepository struct {
+	db *sql.DB
+}
+
+func (repo *BonusRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	if err := runMigration(ctx, db, "008_create_bonus_ledger_table_up.sql"); err != nil {
+		return err
+	}
+
+	return repo.carryOverBalances(ctx)
+}
+
+// carryOverBalances books the users.bonus values set before the ledger existed
+// as opening entries, once per user. From then on the balance only comes from
+// the ledger.
+func (repo *BonusRepository) carryOverBalances(ctx context.Context) error {
+	_, err := repo.db.ExecContext(ctx, `INSERT INTO bonus_ledger (user_id, kind, amount, remaining, created_at)
+		SELECT id, ?, bonus, bonus, ? FROM users
+		WHERE bonus > 0 AND NOT EXISTS (SELECT 1 FROM bonus_ledger WHERE bonus_ledger.user_id = users.id AND kind = ?)`,
+		models.BonusOpening, time.Now().UTC().Format(time.RFC3339), models.BonusOpening)
+	return err
+}
+
+// GetBonusBalance returns the points the user can spend at now, the remaining
+// parts of earnings that have not expired.
+func (repo *BonusRepository) GetBonusBalance(ctx context.Context, userID int, now time.Time) (int64, error) {
+	var balance int64
+	err := repo.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(remaining), 0) FROM bonus_ledger
+		WHERE user_id = ? AND remaining > 0 AND (expires_at IS NULL OR expires_at > ?)`,
+		userID, now.UTC().Format(time.RFC3339)).Scan(&balance)
+	return balance, err
+}
+
+// GetBonusHistory returns the ledger of the user, newest first.
+func (repo *BonusRepository) GetBonusHistory(ctx context.Context, userID int) ([]models.BonusEntry, error) {
+	rows, err := repo.db.QueryContext(ctx, `SELECT id, user_id, kind, amount, remaining, order_id, created_at, expires_at
+		FROM bonus_ledger WHERE user_id = ? ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.BonusEntry{}
+	for rows.Next() {
+		var e models.BonusEntry
+		var orderID sql.NullInt64
+		var createdAt string
+		var expiresAt sql.NullString
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Kind, &e.Amount, &e.Remaining, &orderID, &createdAt, &expiresAt); err != nil {
+			return nil, err
+		}
+
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			e.OrderID = &id
+		}
+		if e.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		if e.ExpiresAt, err = parseNullTime(expiresAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// ExpireBonus books an expire entry for every earning that is past its expiry
+// date and still has points left. It returns the number of expired points.
+func (repo *BonusRepository) ExpireBonus(ctx context.Context, now time.Time) (int64, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stamp := now.UTC().Format(time.RFC3339)
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, user_id, remaining FROM bonus_ledger
+		WHERE remaining > 0 AND expires_at IS NOT NULL AND expires_at <= ?`, stamp)
+	if err != nil {
+		return 0, err
+	}
+
+	type expired struct {
+		id, userID int
+		remaining  int64
+	}
+	var entries []expired
+	for rows.Next() {
+		var e expired
+		if err := rows.Scan(&e.id, &e.userID, &e.remaining); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, e := range entries {
+		if _, err := tx.ExecContext(ctx, "UPDATE bonus_ledger SET remaining = 0 WHERE id = ?", e.id); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO bonus_ledger (user_id, kind, amount, created_at) VALUES (?, ?, ?, ?)",
+			e.userID, models.BonusExpire, -e.remaining, stamp); err != nil {
+			return 0, err
+		}
+		total += e.remaining
+	}
+
+	return total, tx.Commit()
+}
+
+// spendBonus takes points from the oldest earnings that have not expired and
+// books one spend entry for them.
+func spendBonus(ctx context.Context, tx *sql.Tx, userID int, points int64, orderID int64, now time.Time) error {
+	stamp := now.UTC().Format(time.RFC3339)
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, remaining FROM bonus_ledger
+		WHERE user_id = ? AND remaining > 0 AND (expires_at IS NULL OR expires_at > ?)
+		ORDER BY id`, userID, stamp)
+	if err != nil {
+		return err
+	}
+
+	type source struct {
+		id        int
+		remaining int64
+	}
+	var sources []source
+	for rows.Next() {
+		var s source
+		if err := rows.Scan(&s.id, &s.remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		sources = append(sources, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	left := points
+	for _, s := range sources {
+		if left == 0 {
+			break
+		}
+
+		take := min(left, s.remaining)
+		if _, err := tx.ExecContext(ctx, "UPDATE bonus_ledger SET remaining = remaining - ? WHERE id = ?", take, s.id); err != nil {
+			return err
+		}
+		left -= take
+	}
+	if left > 0 {
+		return ErrInsufficientBonus
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO bonus_ledger (user_id, kind, amount, order_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		userID, models.BonusSpend, -points, orderID, stamp)
+	return err
+}
+
+func earnBonus(ctx context.Context, tx *sql.Tx, userID int, points int64, orderID int64, now time.Time, expiresAt *time.Time) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO bonus_ledger (user_id, kind, amount, remaining, order_id, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, models.BonusEarn, points, points, orderID, now.UTC().Format(time.RFC3339), formatNullTime(expiresAt))
+	return err
+}
+
+// GrantBirthdayBonus credits the birthday reward unless the user already got
+// one since yearStart. It reports whether points were credited.
+func (repo *BonusRepository) GrantBirthdayBonus(ctx context.Context, userID int, points int64, now, yearStart time.Time, expiresAt *time.Time) (bool, error) {
+	res, err := repo.db.ExecContext(ctx, `INSERT INTO bonus_ledger (user_id, kind, amount, remaining, created_at, expires_at)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM bonus_ledger WHERE user_id = ? AND kind = ? AND created_at >= ?)`,
+		userID, models.BonusBirthday, points, points, now.UTC().Format(time.RFC3339), formatNullTime(expiresAt),
+		userID, models.BonusBirthday, yearStart.UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,260 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type CategoryRepository struct {
+	db *sql.DB
+}
+
+func (repo *CategoryRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	if err := runMigration(ctx, db, "005_create_categories_table_up.sql"); err != nil {
+		return err
+	}
+	if err := runMigration(ctx, db, "021_create_category_translations_table_up.sql"); err != nil {
+		return err
+	}
+
+	if err := repo.fillDB(ctx); err != nil {
+		return err
+	}
+
+	return repo.fillTranslations(ctx)
+}
+
+// fillDB seeds the categories that used to be the ProductCategory enum. The
+// enum values started at 0 while the seeded ids start at 1, so products and
+// availability windows of an existing database are shifted once, in the same
+// transaction that creates the categories.
+func (repo *CategoryRepository) fillDB(ctx context.Context) error {
+	var count int
+	if err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM categories").Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	categories := []models.Category{
+		{ID: 1, Name: "Бургеры", Slug: "burgers", SortOrder: 10, Icon: "🍔", Visible: true},
+		{ID: 2, Name: "Закуски", Slug: "snacks", SortOrder: 20, Icon: "🍟", Visible: true},
+		{ID: 3, Name: "Напитки", Slug: "drinks", SortOrder: 30, Icon: "🥤", Visible: true},
+		{ID: 4, Name: "Десерты", Slug: "desserts", SortOrder: 40, Icon: "🍰", Visible: true},
+	}
+	for _, c := range categories {
+		if err := insertCategory(ctx, tx, c); err != nil {
+			return err
+		}
+	}
+
+	legacy := map[string]string{
+		"products":             "UPDATE products SET pCategory = pCategory + 1",
+		"availability_windows": "UPDATE availability_windows SET category = category + 1 WHERE category IS NOT NULL",
+	}
+	for table, query := range legacy {
+		exists, err := tableExists(ctx, tx, table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// fillTranslations seeds russian and english names for the default
+// categories. It only runs once, while category_translations is still empty.
+func (repo *CategoryRepository) fillTranslations(ctx context.Context) error {
+	var count int
+	if err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM category_translations").Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	translations := map[string]map[string]string{
+		"burgers":  {"ru": "Бургеры", "en": "Burgers"},
+		"snacks":   {"ru": "Закуски", "en": "Snacks"},
+		"drinks":   {"ru": "Напитки", "en": "Drinks"},
+		"desserts": {"ru": "Десерты", "en": "Desserts"},
+	}
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for slug, names := range translations {
+		var id int
+		err := tx.QueryRowContext(ctx, "SELECT id FROM categories WHERE slug = ?", slug).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for locale, name := range names {
+			_, err := tx.ExecContext(ctx, "INSERT INTO category_translations (category_id, locale, name) VALUES (?, ?, ?)",
+				id, locale, name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetTranslations returns the category names stored for the locale keyed by
+// category id.
+func (repo *CategoryRepository) GetTranslations(ctx context.Context, locale string) (map[int]string, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT category_id, name FROM category_translations WHERE locale = ?", locale)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+
+	return names, rows.Err()
+}
+
+// GetCategories returns all categories in display order, with their
+// availability windows.
+func (repo *CategoryRepository) GetCategories(ctx context.Context) ([]models.Category, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT id, name, slug, sort_order, icon, visible FROM categories ORDER BY sort_order, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Slug, &c.SortOrder, &c.Icon, &c.Visible); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	windows, err := queryAvailability(ctx, repo.db, "category IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range windows {
+		for i := range categories {
+			if categories[i].ID == *w.CategoryID {
+				categories[i].Availability = append(categories[i].Availability, w)
+			}
+		}
+	}
+
+	return categories, nil
+}
+
+func insertCategory(ctx context.Context, tx *sql.Tx, c models.Category) error {
+	var id any
+	if c.ID != 0 {
+		id = c.ID
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO categories (id, name, slug, sort_order, icon, visible) VALUES (?, ?, ?, ?, ?, ?)",
+		id, c.Name, c.Slug, c.SortOrder, c.Icon, c.Visible)
+	if err != nil {
+		return err
+	}
+
+	if len(c.Availability) == 0 {
+		return nil
+	}
+
+	categoryID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	return saveCategoryAvailability(ctx, tx, int(categoryID), c.Availability)
+}
+
+func updateCategory(ctx context.Context, tx *sql.Tx, c models.Category, locale string) error {
+	if err := renameCategory(ctx, tx, c, locale); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE categories SET name = ?, slug = ?, sort_order = ?, icon = ?, visible = ? WHERE id = ?",
+		c.Name, c.Slug, c.SortOrder, c.Icon, c.Visible, c.ID)
+	if err != nil {
+		return err
+	}
+
+	return saveCategoryAvailability(ctx, tx, c.ID, c.Availability)
+}
+
+// renameCategory moves the translations along when an update changes the
+// category name, like renameProduct does for products.
+func renameCategory(ctx context.Context, tx *sql.Tx, c models.Category, locale string) error {
+	var current string
+	if err := tx.QueryRowContext(ctx, "SELECT name FROM categories WHERE id = ?", c.ID).Scan(&current); err != nil {
+		return err
+	}
+	if current == c.Name {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE category_translations SET name = ? WHERE category_id = ? AND locale = ?", c.Name, c.ID, locale); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "DELETE FROM category_translations WHERE category_id = ? AND locale != ?", c.ID, locale)
+	return err
+}
+
+func saveCategoryAvailability(ctx context.Context, tx *sql.Tx, categoryID int, windows []models.AvailabilityWindow) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM availability_windows WHERE category = ?", categoryID); err != nil {
+		return err
+	}
+	for _, w := range windows {
+		if err := insertAvailabilityWindow(ctx, tx, nil, &categoryID, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tableExists(ctx context.Context, tx *sql.Tx, table string) (bool, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count)
+	return count > 0, err
+}
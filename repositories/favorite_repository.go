@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type FavoriteRepository struct {
+	db *sql.DB
+}
+
+func (repo *FavoriteRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	return runMigration(ctx, db, "012_create_favorites_table_up.sql")
+}
+
+// AddFavorite stars the product for the user, starring it twice is a no-op.
+func (repo *FavoriteRepository) AddFavorite(ctx context.Context, userID, productID int, createdAt time.Time) error {
+	_, err := repo.db.ExecContext(ctx, "INSERT OR IGNORE INTO favorites (user_id, product_id, created_at) VALUES (?, ?, ?)",
+		userID, productID, createdAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+func (repo *FavoriteRepository) RemoveFavorite(ctx context.Context, userID, productID int) error {
+	_, err := repo.db.ExecContext(ctx, "DELETE FROM favorites WHERE user_id = ? AND product_id = ?", userID, productID)
+	return err
+}
+
+// GetFavorites returns the ids of the user's favourite products, the last
+// starred first.
+func (repo *FavoriteRepository) GetFavorites(ctx context.Context, userID int) ([]int, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT product_id FROM favorites WHERE user_id = ? ORDER BY created_at DESC, product_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,210 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrGroupCartClosed    = errors.New("group cart is not open")
+	ErrGroupCartNotLocked = errors.New("group cart must be locked before checkout")
+)
+
+type GroupCartRepository struct {
+	db *sql.DB
+}
+
+func (repo *GroupCartRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	if err := runMigration(ctx, db, "011_create_group_carts_tables_up.sql"); err != nil {
+		return err
+	}
+	return ensureColumn(ctx, db, "orders", "group_cart_id", "INTEGER NOT NULL DEFAULT 0")
+}
+
+// CreateGroupCart stores an open group cart with the owner as its first
+// member.
+func (repo *GroupCartRepository) CreateGroupCart(ctx context.Context, group *models.GroupCart) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	createdAt := group.CreatedAt.UTC().Format(time.RFC3339)
+	res, err := tx.ExecContext(ctx, "INSERT INTO group_carts (owner_id, invite_token, status, created_at) VALUES (?, ?, ?, ?)",
+		group.OwnerID, group.InviteToken, models.GroupCartOpen, createdAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO group_cart_members (group_id, user_id, joined_at) VALUES (?, ?, ?)", id, group.OwnerID, createdAt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	group.ID = int(id)
+	group.Status = models.GroupCartOpen
+	return nil
+}
+
+// FindGroupCartByToken returns the id of the group cart with the invite
+// token, sql.ErrNoRows when there is none.
+func (repo *GroupCartRepository) FindGroupCartByToken(ctx context.Context, token string) (int, error) {
+	var id int
+	err := repo.db.QueryRowContext(ctx, "SELECT id FROM group_carts WHERE invite_token = ?", token).Scan(&id)
+	return id, err
+}
+
+// GetGroupCart returns the group cart with its members and items,
+// sql.ErrNoRows when there is none.
+func (repo *GroupCartRepository) GetGroupCart(ctx context.Context, id int) (*models.GroupCart, error) {
+	g := models.GroupCart{ID: id}
+	var orderID sql.NullInt64
+	var createdAt string
+	err := repo.db.QueryRowContext(ctx, "SELECT owner_id, invite_token, status, order_id, created_at FROM group_carts WHERE id = ?", id).
+		Scan(&g.OwnerID, &g.InviteToken, &g.Status, &orderID, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if g.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return nil, err
+	}
+	if orderID.Valid {
+		id := int(orderID.Int64)
+		g.OrderID = &id
+	}
+
+	members, err := repo.db.QueryContext(ctx, `SELECT users.id, users.username FROM group_cart_members
+		JOIN users ON users.id = group_cart_members.user_id
+		WHERE group_id = ? ORDER BY joined_at, users.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer members.Close()
+
+	for members.Next() {
+		var m models.GroupCartMember
+		if err := members.Scan(&m.UserID, &m.Username); err != nil {
+			return nil, err
+		}
+		g.Members = append(g.Members, m)
+	}
+	if err := members.Err(); err != nil {
+		return nil, err
+	}
+
+	items, err := repo.db.QueryContext(ctx, "SELECT user_id, product_id, quantity FROM group_cart_items WHERE group_id = ? ORDER BY user_id, product_id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer items.Close()
+
+	for items.Next() {
+		var item models.GroupCartItem
+		if err := items.Scan(&item.UserID, &item.ProductID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		g.Items = append(g.Items, item)
+	}
+
+	return &g, items.Err()
+}
+
+// AddGroupMember adds the user to an open group cart, joining twice is a
+// no-op.
+func (repo *GroupCartRepository) AddGroupMember(ctx context.Context, groupID, userID int, joinedAt time.Time) error {
+	return repo.whileOpen(ctx, groupID, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO group_cart_members (group_id, user_id, joined_at) VALUES (?, ?, ?)",
+			groupID, userID, joinedAt.UTC().Format(time.RFC3339))
+		return err
+	})
+}
+
+// SetGroupCartItem sets the quantity of the product the user added to an
+// open group cart, 0 removes it.
+func (repo *GroupCartRepository) SetGroupCartItem(ctx context.Context, groupID, userID, productID, quantity int) error {
+	return repo.whileOpen(ctx, groupID, func(tx *sql.Tx) error {
+		if quantity == 0 {
+			_, err := tx.ExecContext(ctx, "DELETE FROM group_cart_items WHERE group_id = ? AND user_id = ? AND product_id = ?", groupID, userID, productID)
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO group_cart_items (group_id, user_id, product_id, quantity) VALUES (?, ?, ?, ?)
+			ON CONFLICT (group_id, user_id, product_id) DO UPDATE SET quantity = excluded.quantity`,
+			groupID, userID, productID, quantity)
+		return err
+	})
+}
+
+// SetGroupCartStatus moves the group cart from one status to another and
+// reports whether it was in from.
+func (repo *GroupCartRepository) SetGroupCartStatus(ctx context.Context, groupID int, from, to models.GroupCartStatus) (bool, error) {
+	res, err := repo.db.ExecContext(ctx, "UPDATE group_carts SET status = ? WHERE id = ? AND status = ?", to, groupID, from)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// whileOpen runs fn in a transaction that first takes the write lock with a
+// guarded update, so the cart can not be locked halfway through.
+func (repo *GroupCartRepository) whileOpen(ctx context.Context, groupID int, fn func(tx *sql.Tx) error) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE group_carts SET status = status WHERE id = ? AND status = ?", groupID, models.GroupCartOpen)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrGroupCartClosed
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// closeGroupCart marks the locked group cart as ordered and stores the per
+// person subtotals of the order.
+func closeGroupCart(ctx context.Context, tx *sql.Tx, order *models.Order, orderID int64) error {
+	res, err := tx.ExecContext(ctx, "UPDATE group_carts SET status = ?, order_id = ? WHERE id = ? AND status = ?",
+		models.GroupCartOrdered, orderID, order.GroupCartID, models.GroupCartLocked)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrGroupCartNotLocked
+	}
+
+	for _, p := range order.Participants {
+		_, err := tx.ExecContext(ctx, "INSERT INTO order_participants (order_id, user_id, subtotal) VALUES (?, ?, ?)", orderID, p.UserID, p.Subtotal)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,8 +4,7 @@ import (
 	"CartoonBurgers/models"
 	"context"
 	"database/sql"
-	"os"
-	"path/filepath"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
@@ -15,21 +14,29 @@ type ProductRerository struct {
 }
 
 func (prod *ProductRerository) Init(ctx context.Context, db *sql.DB) error {
-	var path = filepath.Join("..", "repositories", "migrations", "001_create_products_table_up.sql")
-	var req, err = os.ReadFile(path)
-	if err != nil {
+	prod.db = db
+
+	if err := runMigration(ctx, db, "001_create_products_table_up.sql"); err != nil {
+		return err
+	}
+	if err := runMigration(ctx, db, "002_create_product_details_tables_up.sql"); err != nil {
+		return err
+	}
+	if err := runMigration(ctx, db, "003_create_product_translations_table_up.sql"); err != nil {
+		return err
+	}
+	if err := runMigration(ctx, db, "004_create_availability_windows_table_up.sql"); err != nil {
 		return err
 	}
 
-	_, err = db.ExecContext(ctx, string(req))
-
-	prod.db = db
-
-	if err != nil {
+	if err := prod.fillDB(ctx); err != nil {
+		return err
+	}
+	if err := prod.fillDetails(ctx); err != nil {
 		return err
 	}
 
-	return prod.fillDB(ctx)
+	return prod.fillTranslations(ctx)
 }
 
 func (prod *ProductRerository) fillDB(ctx context.Context) error {
@@ -48,18 +55,18 @@ func (prod *ProductRerository) fillDB(ctx context.Context) error {
 		defer tx.Rollback()
 
 		products := []models.Product{
-			{Name: "Cheese Burger", Price: 160, Count: 1, Type: 0, Category: 0},
-			{Name: "Classic Carton", Price: 200, Count: 1, Type: 0, Category: 0},
-			{Name: "Twicer Classic", Price: 270, Count: 1, Type: 0, Category: 0},
-			{Name: "Twicer Double", Price: 330, Count: 1, Type: 0, Category: 0},
-			{Name: "Purple Burger", Price: 390, Count: 1, Type: 1, Category: 0},
-			{Name: "Chiken Nuggets", Price: 129, Count: 12, Type: 0, Category: 1},
-			{Name: "Efilio Cake", Price: 199, Count: 1, Type: 0, Category: 3},
-			{Name: "Purple Cake", Price: 199, Count: 1, Type: 1, Category: 3},
+			{Name: "Cheese Burger", Price: 160, Count: 1, Type: 0, CategoryID: 1},
+			{Name: "Classic Carton", Price: 200, Count: 1, Type: 0, CategoryID: 1},
+			{Name: "Twicer Classic", Price: 270, Count: 1, Type: 0, CategoryID: 1},
+			{Name: "Twicer Double", Price: 330, Count: 1, Type: 0, CategoryID: 1},
+			{Name: "Purple Burger", Price: 390, Count: 1, Type: 1, CategoryID: 1},
+			{Name: "Chiken Nuggets", Price: 129, Count: 12, Type: 0, CategoryID: 2},
+			{Name: "Efilio Cake", Price: 199, Count: 1, Type: 0, CategoryID: 4},
+			{Name: "Purple Cake", Price: 199, Count: 1, Type: 1, CategoryID: 4},
 		}
 		for _, p := range products {
 			_, err = tx.ExecContext(ctx, `INSERT INTO products (pName, pPrice, pCount, pType, pCategory) VALUES (?, ?, ?, ?, ?)`,
-				p.Name, p.Price, p.Count, p.Type, p.Category)
+				p.Name, p.Price, p.Count, p.Type, p.CategoryID)
 
 			if err != nil {
 				return err
@@ -74,6 +81,218 @@ func (prod *ProductRerository) fillDB(ctx context.Context) error {
 	return err
 }
 
+// fillDetails seeds allergens, nutrition and dietary tags for the default
+// products. It only runs once, while product_nutrition is still empty.
+func (prod *ProductRerository) fillDetails(ctx context.Context) error {
+	var count int
+	if err := prod.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM product_nutrition").Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	details := map[string]models.Product{
+		"Cheese Burger": {
+			Allergens: []models.Allergen{models.Gluten, models.Milk, models.Sesame, models.Mustard},
+			Nutrition: &models.Nutrition{ServingSize: 120, Calories: 300, Protein: 15, Fat: 12, Carbohydrates: 32, Sugar: 7, Salt: 1.5},
+			Tags:      []models.DietaryTag{models.Halal},
+		},
+		"Classic Carton": {
+			Allergens: []models.Allergen{models.Gluten, models.Sesame, models.Mustard, models.Eggs},
+			Nutrition: &models.Nutrition{ServingSize: 180, Calories: 450, Protein: 22, Fat: 20, Carbohydrates: 40, Sugar: 8, Salt: 2},
+			Tags:      []models.DietaryTag{models.Halal},
+		},
+		"Twicer Classic": {
+			Allergens: []models.Allergen{models.Gluten, models.Milk, models.Sesame, models.Eggs},
+			Nutrition: &models.Nutrition{ServingSize: 220, Calories: 540, Protein: 28, Fat: 26, Carbohydrates: 44, Sugar: 9, Salt: 2.4},
+		},
+		"Twicer Double": {
+			Allergens: []models.Allergen{models.Gluten, models.Milk, models.Sesame, models.Eggs},
+			Nutrition: &models.Nutrition{ServingSize: 280, Calories: 720, Protein: 40, Fat: 38, Carbohydrates: 46, Sugar: 9, Salt: 3.1},
+			Tags:      []models.DietaryTag{models.Spicy},
+		},
+		"Purple Burger": {
+			Allergens: []models.Allergen{models.Gluten, models.Soy, models.Sesame},
+			Nutrition: &models.Nutrition{ServingSize: 240, Calories: 510, Protein: 19, Fat: 22, Carbohydrates: 58, Sugar: 11, Salt: 2.2},
+			Tags:      []models.DietaryTag{models.Vegetarian},
+		},
+		"Chiken Nuggets": {
+			Allergens: []models.Allergen{models.Gluten, models.Celery},
+			Nutrition: &models.Nutrition{ServingSize: 200, Calories: 520, Protein: 30, Fat: 30, Carbohydrates: 32, Sugar: 1, Salt: 2.1},
+			Tags:      []models.DietaryTag{models.Halal},
+		},
+		"Efilio Cake": {
+			Allergens: []models.Allergen{models.Gluten, models.Milk, models.Eggs, models.Nuts},
+			Nutrition: &models.Nutrition{ServingSize: 110, Calories: 390, Protein: 5, Fat: 19, Carbohydrates: 49, Sugar: 33, Salt: 0.3},
+			Tags:      []models.DietaryTag{models.Vegetarian},
+		},
+		"Purple Cake": {
+			Allergens: []models.Allergen{models.Gluten, models.Milk, models.Eggs},
+			Nutrition: &models.Nutrition{ServingSize: 110, Calories: 370, Protein: 5, Fat: 17, Carbohydrates: 50, Sugar: 35, Salt: 0.3},
+			Tags:      []models.DietaryTag{models.Vegetarian},
+		},
+	}
+
+	tx, err := prod.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids, err := productIDsByName(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for name, d := range details {
+		id, ok := ids[name]
+		if !ok {
+			continue
+		}
+
+		if err := saveDetails(ctx, tx, id, d); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// fillTranslations seeds russian and english names for the default products.
+// It only runs once, while product_translations is still empty.
+func (prod *ProductRerository) fillTranslations(ctx context.Context) error {
+	var count int
+	if err := prod.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM product_translations").Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	translations := map[string][]models.ProductTranslation{
+		"Cheese Burger": {
+			{Locale: "ru", Name: "Чизбургер", Description: "Говяжья котлета, сыр чеддер, маринованный огурец"},
+			{Locale: "en", Name: "Cheese Burger", Description: "Beef patty, cheddar cheese, pickles"},
+		},
+		"Classic Carton": {
+			{Locale: "ru", Name: "Классик Картон", Description: "Большая котлета, свежие овощи и фирменный соус"},
+			{Locale: "en", Name: "Classic Carton", Description: "Big patty, fresh vegetables and house sauce"},
+		},
+		"Twicer Classic": {
+			{Locale: "ru", Name: "Твайсер Классик", Description: "Две котлеты и двойной сыр"},
+			{Locale: "en", Name: "Twicer Classic", Description: "Two patties and double cheese"},
+		},
+		"Twicer Double": {
+			{Locale: "ru", Name: "Твайсер Дабл", Description: "Две большие котлеты, халапеньо и острый соус"},
+			{Locale: "en", Name: "Twicer Double", Description: "Two big patties, jalapeños and hot sauce"},
+		},
+		"Purple Burger": {
+			{Locale: "ru", Name: "Фиолетовый бургер", Description: "Растительная котлета в фиолетовой булочке"},
+			{Locale: "en", Name: "Purple Burger", Description: "Plant based patty in a purple bun"},
+		},
+		"Chiken Nuggets": {
+			{Locale: "ru", Name: "Куриные наггетсы", Description: "Хрустящие наггетсы из куриного филе"},
+			{Locale: "en", Name: "Chicken Nuggets", Description: "Crispy chicken breast nuggets"},
+		},
+		"Efilio Cake": {
+			{Locale: "ru", Name: "Торт Эфилио", Description: "Шоколадный торт с орехами"},
+			{Locale: "en", Name: "Efilio Cake", Description: "Chocolate cake with nuts"},
+		},
+		"Purple Cake": {
+			{Locale: "ru", Name: "Фиолетовый торт", Description: "Черничный чизкейк"},
+			{Locale: "en", Name: "Purple Cake", Description: "Blueberry cheesecake"},
+		},
+	}
+
+	tx, err := prod.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids, err := productIDsByName(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for name, list := range translations {
+		id, ok := ids[name]
+		if !ok {
+			continue
+		}
+
+		for _, t := range list {
+			_, err := tx.ExecContext(ctx, "INSERT INTO product_translations (product_id, locale, name, description) VALUES (?, ?, ?, ?)",
+				id, t.Locale, t.Name, t.Description)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func productIDsByName(ctx context.Context, tx *sql.Tx) (map[string]int, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id, pName FROM products")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]int)
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		ids[name] = id
+	}
+
+	return ids, rows.Err()
+}
+
+// saveDetails replaces allergens, nutrition and tags of the product with the
+// ones set on p.
+func saveDetails(ctx context.Context, tx *sql.Tx, productID int, p models.Product) error {
+	for _, q := range []string{
+		"DELETE FROM product_allergens WHERE product_id = ?",
+		"DELETE FROM product_nutrition WHERE product_id = ?",
+		"DELETE FROM product_tags WHERE product_id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, q, productID); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range p.Allergens {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO product_allergens (product_id, allergen) VALUES (?, ?)", productID, a); err != nil {
+			return err
+		}
+	}
+
+	if n := p.Nutrition; n != nil {
+		_, err := tx.ExecContext(ctx, `INSERT INTO product_nutrition (product_id, servingSize, calories, protein, fat, carbohydrates, sugar, salt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			productID, n.ServingSize, n.Calories, n.Protein, n.Fat, n.Carbohydrates, n.Sugar, n.Salt)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, t := range p.Tags {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO product_tags (product_id, tag) VALUES (?, ?)", productID, t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (prod *ProductRerository) GetAll(ctx context.Context) ([]models.Product, error) {
 	rows, err := prod.db.QueryContext(ctx, "SELECT id, pName, pPrice, pCount, pType, pCategory FROM products")
 
@@ -85,12 +304,316 @@ func (prod *ProductRerository) GetAll(ctx context.Context) ([]models.Product, er
 	var products []models.Product
 	for rows.Next() {
 		var p models.Product
-		err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Count, &p.Type, &p.Category)
+		err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Count, &p.Type, &p.CategoryID)
 		if err != nil {
 			return nil, err
 		}
 		products = append(products, p)
 	}
 
-	return products, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := prod.loadDetails(ctx, products); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func (prod *ProductRerository) FindByID(ctx context.Context, id int) (*models.Product, error) {
+	var p models.Product
+	err := prod.db.QueryRowContext(ctx, "SELECT id, pName, pPrice, pCount, pType, pCategory FROM products WHERE id = ?", id).
+		Scan(&p.ID, &p.Name, &p.Price, &p.Count, &p.Type, &p.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	products := []models.Product{p}
+	if err := prod.loadDetails(ctx, products); err != nil {
+		return nil, err
+	}
+
+	return &products[0], nil
+}
+
+func (prod *ProductRerository) loadDetails(ctx context.Context, products []models.Product) error {
+	byID := make(map[int]*models.Product, len(products))
+	for i := range products {
+		products[i].Allergens = []models.Allergen{}
+		products[i].Tags = []models.DietaryTag{}
+		byID[products[i].ID] = &products[i]
+	}
+
+	rows, err := prod.db.QueryContext(ctx, "SELECT product_id, allergen FROM product_allergens ORDER BY allergen")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var a models.Allergen
+		if err := rows.Scan(&id, &a); err != nil {
+			rows.Close()
+			return err
+		}
+		if p, ok := byID[id]; ok {
+			p.Allergens = append(p.Allergens, a)
+		}
+	}
+	rows.Close()
+
+	rows, err = prod.db.QueryContext(ctx, `SELECT product_id, servingSize, calories, protein, fat, carbohydrates, sugar, salt
+		FROM product_nutrition`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var n models.Nutrition
+		if err := rows.Scan(&id, &n.ServingSize, &n.Calories, &n.Protein, &n.Fat, &n.Carbohydrates, &n.Sugar, &n.Salt); err != nil {
+			rows.Close()
+			return err
+		}
+		if p, ok := byID[id]; ok {
+			p.Nutrition = &n
+		}
+	}
+	rows.Close()
+
+	rows, err = prod.db.QueryContext(ctx, "SELECT product_id, tag FROM product_tags ORDER BY tag")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var t models.DietaryTag
+		if err := rows.Scan(&id, &t); err != nil {
+			rows.Close()
+			return err
+		}
+		if p, ok := byID[id]; ok {
+			p.Tags = append(p.Tags, t)
+		}
+	}
+	rows.Close()
+
+	windows, err := queryAvailability(ctx, prod.db, "product_id IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	for _, w := range windows {
+		if p, ok := byID[*w.ProductID]; ok {
+			p.Availability = append(p.Availability, w)
+		}
+	}
+
+	return nil
+}
+
+func queryAvailability(ctx context.Context, db *sql.DB, where string) ([]models.AvailabilityWindow, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, product_id, category, days, start_time, end_time, start_date, end_date
+		FROM availability_windows WHERE `+where+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var windows []models.AvailabilityWindow
+	for rows.Next() {
+		var w models.AvailabilityWindow
+		var productID, category sql.NullInt64
+		var days string
+		if err := rows.Scan(&w.ID, &productID, &category, &days, &w.StartTime, &w.EndTime, &w.StartDate, &w.EndDate); err != nil {
+			return nil, err
+		}
+
+		if productID.Valid {
+			id := int(productID.Int64)
+			w.ProductID = &id
+		}
+		if category.Valid {
+			id := int(category.Int64)
+			w.CategoryID = &id
+		}
+		w.Days = models.ParseDays(days)
+
+		windows = append(windows, w)
+	}
+
+	return windows, rows.Err()
+}
+
+// SaveAvailabilityWindow stores a new product or category window.
+func (prod *ProductRerository) SaveAvailabilityWindow(ctx context.Context, w *models.AvailabilityWindow) error {
+	res, err := prod.db.ExecContext(ctx, `INSERT INTO availability_windows (product_id, category, days, start_time, end_time, start_date, end_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		w.ProductID, w.CategoryID, strings.Join(w.Days, ","), w.StartTime, w.EndTime, w.StartDate, w.EndDate)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	w.ID = int(id)
+	return err
+}
+
+// GetTranslations returns the translations stored for the locale keyed by
+// product id.
+func (prod *ProductRerository) GetTranslations(ctx context.Context, locale string) (map[int]models.ProductTranslation, error) {
+	rows, err := prod.db.QueryContext(ctx, "SELECT product_id, locale, name, description FROM product_translations WHERE locale = ?", locale)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := make(map[int]models.ProductTranslation)
+	for rows.Next() {
+		var t models.ProductTranslation
+		if err := rows.Scan(&t.ProductID, &t.Locale, &t.Name, &t.Description); err != nil {
+			return nil, err
+		}
+		translations[t.ProductID] = t
+	}
+
+	return translations, rows.Err()
+}
+
+// CatalogueChanges is a planned catalogue import. Products and categories
+// without an id are created, deletes are ids.
+type CatalogueChanges struct {
+	// Locale is the default locale. Renamed products and categories get the
+	// new name as their translation for it and lose the other translations.
+	Locale string
+
+	CreateCategories []models.Category
+	UpdateCategories []models.Category
+	DeleteCategories []int
+
+	CreateProducts []models.Product
+	UpdateProducts []models.Product
+	DeleteProducts []int
+}
+
+// ApplyCatalogue writes a catalogue import in a single transaction.
+// Categories are saved first so products can move into new ones, and deleted
+// last, once no product refers to them any more.
+func (prod *ProductRerository) ApplyCatalogue(ctx context.Context, changes CatalogueChanges) error {
+	tx, err := prod.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range changes.CreateCategories {
+		if err := insertCategory(ctx, tx, c); err != nil {
+			return err
+		}
+	}
+	for _, c := range changes.UpdateCategories {
+		if err := updateCategory(ctx, tx, c, changes.Locale); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range changes.DeleteProducts {
+		for _, q := range []string{
+			"DELETE FROM product_allergens WHERE product_id = ?",
+			"DELETE FROM product_nutrition WHERE product_id = ?",
+			"DELETE FROM product_tags WHERE product_id = ?",
+			"DELETE FROM product_translations WHERE product_id = ?",
+			"DELETE FROM availability_windows WHERE product_id = ?",
+			"DELETE FROM products WHERE id = ?",
+		} {
+			if _, err := tx.ExecContext(ctx, q, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, p := range changes.UpdateProducts {
+		if err := renameProduct(ctx, tx, p, changes.Locale); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE products SET pName = ?, pPrice = ?, pCount = ?, pType = ?, pCategory = ? WHERE id = ?",
+			p.Name, p.Price, p.Count, p.Type, p.CategoryID, p.ID)
+		if err != nil {
+			return err
+		}
+		if err := saveProductExtras(ctx, tx, p.ID, p); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range changes.CreateProducts {
+		res, err := tx.ExecContext(ctx, "INSERT INTO products (pName, pPrice, pCount, pType, pCategory) VALUES (?, ?, ?, ?, ?)",
+			p.Name, p.Price, p.Count, p.Type, p.CategoryID)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if err := saveProductExtras(ctx, tx, int(id), p); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range changes.DeleteCategories {
+		for _, q := range []string{
+			"DELETE FROM availability_windows WHERE category = ?",
+			"DELETE FROM category_translations WHERE category_id = ?",
+			"DELETE FROM categories WHERE id = ?",
+		} {
+			if _, err := tx.ExecContext(ctx, q, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// renameProduct moves the translations along when an update changes the
+// product name. The new name is in the default locale, so that translation
+// takes it and the others are dropped instead of showing the old name.
+func renameProduct(ctx context.Context, tx *sql.Tx, p models.Product, locale string) error {
+	var current string
+	if err := tx.QueryRowContext(ctx, "SELECT pName FROM products WHERE id = ?", p.ID).Scan(&current); err != nil {
+		return err
+	}
+	if current == p.Name {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE product_translations SET name = ? WHERE product_id = ? AND locale = ?", p.Name, p.ID, locale); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "DELETE FROM product_translations WHERE product_id = ? AND locale != ?", p.ID, locale)
+	return err
+}
+
+func saveProductExtras(ctx context.Context, tx *sql.Tx, productID int, p models.Product) error {
+	if err := saveDetails(ctx, tx, productID, p); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM availability_windows WHERE product_id = ?", productID); err != nil {
+		return err
+	}
+	for _, w := range p.Availability {
+		if err := insertAvailabilityWindow(ctx, tx, &productID, nil, w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func insertAvailabilityWindow(ctx context.Context, tx *sql.Tx, productID *int, categoryID *int, w models.AvailabilityWindow) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO availability_windows (product_id, category, days, start_time, end_time, start_date, end_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		productID, categoryID, strings.Join(w.Days, ","), w.StartTime, w.EndTime, w.StartDate, w.EndDate)
+	return err
 }
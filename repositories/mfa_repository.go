@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrMFANotEnrolled    = errors.New("two factor authentication is not enrolled")
+	ErrMFAAlreadyEnabled = errors.New("two factor authentication is already enabled")
+)
+
+type MFARepository struct {
+	db *sql.DB
+}
+
+func (repo *MFARepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	return runMigration(ctx, db, "016_create_mfa_tables_up.sql")
+}
+
+// GetMFA returns the enrolment of the user or ErrMFANotEnrolled.
+func (repo *MFARepository) GetMFA(ctx context.Context, userID int) (*models.MFA, error) {
+	m := models.MFA{UserID: userID}
+	var createdAt string
+	var confirmedAt sql.NullString
+	err := repo.db.QueryRowContext(ctx, "SELECT secret, created_at, confirmed_at, last_step FROM user_mfa WHERE user_id = ?", userID).
+		Scan(&m.Secret, &createdAt, &confirmedAt, &m.LastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return nil, err
+	}
+	if m.ConfirmedAt, err = parseNullTime(confirmedAt); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// StartMFAEnrolment stores a new unconfirmed secret, replacing an earlier
+// unconfirmed one. It fails with ErrMFAAlreadyEnabled once confirmed.
+func (repo *MFARepository) StartMFAEnrolment(ctx context.Context, userID int, secret string, now time.Time) error {
+	res, err := repo.db.ExecContext(ctx, `INSERT INTO user_mfa (user_id, secret, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at, last_step = 0
+		WHERE user_mfa.confirmed_at IS NULL`,
+		userID, secret, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+// ConfirmMFA enables the enrolment, step is the TOTP step of the code that
+// confirmed it. The recovery codes replace any earlier ones.
+func (repo *MFARepository) ConfirmMFA(ctx context.Context, userID int, step int64, recoveryCodeHashes []string, now time.Time) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE user_mfa SET confirmed_at = ?, last_step = ? WHERE user_id = ? AND confirmed_at IS NULL",
+		now.UTC().Format(time.RFC3339), step, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that a code of step was accepted. It reports false
+// when that step or a later one was used already, so a code works once.
+func (repo *MFARepository) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	res, err := repo.db.ExecContext(ctx, "UPDATE user_mfa SET last_step = ? WHERE user_id = ? AND confirmed_at IS NOT NULL AND last_step < ?",
+		step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UseRecoveryCode marks the unused recovery code with hash as used and
+// reports whether there was one.
+func (repo *MFARepository) UseRecoveryCode(ctx context.Context, userID int, hash string, now time.Time) (bool, error) {
+	res, err := repo.db.ExecContext(ctx, "UPDATE mfa_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		now.UTC().Format(time.RFC3339), userID, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (repo *MFARepository) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS product_tags;
+DROP TABLE IF EXISTS product_nutrition;
+DROP TABLE IF EXISTS product_allergens;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS product_allergens(
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    allergen TEXT NOT NULL,
+    PRIMARY KEY (product_id, allergen)
+);
+
+CREATE TABLE IF NOT EXISTS product_nutrition(
+    product_id INTEGER PRIMARY KEY REFERENCES products(id) ON DELETE CASCADE,
+    servingSize INTEGER NOT NULL,
+    calories INTEGER NOT NULL,
+    protein REAL DEFAULT 0,
+    fat REAL DEFAULT 0,
+    carbohydrates REAL DEFAULT 0,
+    sugar REAL DEFAULT 0,
+    salt REAL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS product_tags(
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (product_id, tag)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS product_translations(
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    locale TEXT NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT DEFAULT '',
+    PRIMARY KEY (product_id, locale)
+);
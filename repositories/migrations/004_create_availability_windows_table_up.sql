@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS availability_windows(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER REFERENCES products(id) ON DELETE CASCADE,
+    category INTEGER,
+    days TEXT DEFAULT '',
+    start_time TEXT DEFAULT '',
+    end_time TEXT DEFAULT '',
+    start_date TEXT DEFAULT '',
+    end_date TEXT DEFAULT '',
+    CHECK ((product_id IS NULL) <> (category IS NULL))
+);
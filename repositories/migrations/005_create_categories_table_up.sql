@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS categories(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL UNIQUE,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    icon TEXT DEFAULT '',
+    visible INTEGER NOT NULL DEFAULT 1
+);
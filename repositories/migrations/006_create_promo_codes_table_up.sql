@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS promo_codes(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL,
+    value INTEGER NOT NULL DEFAULT 0,
+    product_id INTEGER REFERENCES products(id) ON DELETE CASCADE,
+    free_every INTEGER NOT NULL DEFAULT 0,
+    min_subtotal INTEGER NOT NULL DEFAULT 0,
+    category INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+    first_order_only INTEGER NOT NULL DEFAULT 0,
+    starts_at TEXT,
+    ends_at TEXT,
+    per_user_limit INTEGER NOT NULL DEFAULT 0,
+    usage_limit INTEGER NOT NULL DEFAULT 0,
+    used_count INTEGER NOT NULL DEFAULT 0,
+    active INTEGER NOT NULL DEFAULT 1
+);
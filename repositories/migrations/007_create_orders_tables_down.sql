@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS promo_redemptions;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS bonus_ledger(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    remaining INTEGER NOT NULL DEFAULT 0,
+    order_id INTEGER REFERENCES orders(id),
+    created_at TEXT NOT NULL,
+    expires_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS bonus_ledger_user ON bonus_ledger(user_id, id);
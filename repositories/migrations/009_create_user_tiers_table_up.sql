@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS user_tiers(
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    tier TEXT NOT NULL,
+    spend INTEGER NOT NULL DEFAULT 0,
+    computed_at TEXT NOT NULL
+);
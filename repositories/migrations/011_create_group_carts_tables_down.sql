@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS order_participants;
+DROP TABLE IF EXISTS group_cart_items;
+DROP TABLE IF EXISTS group_cart_members;
+DROP TABLE IF EXISTS group_carts;
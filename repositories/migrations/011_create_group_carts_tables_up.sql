@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS group_carts(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL REFERENCES users(id),
+    invite_token TEXT NOT NULL UNIQUE,
+    status TEXT NOT NULL,
+    order_id INTEGER REFERENCES orders(id),
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS group_cart_members(
+    group_id INTEGER NOT NULL REFERENCES group_carts(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    joined_at TEXT NOT NULL,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS group_cart_items(
+    group_id INTEGER NOT NULL REFERENCES group_carts(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    product_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    PRIMARY KEY (group_id, user_id, product_id)
+);
+
+CREATE TABLE IF NOT EXISTS order_participants(
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    subtotal INTEGER NOT NULL,
+    PRIMARY KEY (order_id, user_id)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS user_roles(
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    granted_at TEXT NOT NULL,
+    granted_by INTEGER REFERENCES users(id),
+    PRIMARY KEY (user_id, role)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS signing_keys(
+    id TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    activates_at TEXT NOT NULL,
+    expires_at TEXT
+);
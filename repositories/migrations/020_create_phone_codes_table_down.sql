@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_phone;
+DROP TABLE IF EXISTS phone_codes;
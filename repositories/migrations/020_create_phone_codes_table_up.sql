@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS phone_codes(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    phone TEXT NOT NULL,
+    purpose TEXT NOT NULL,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    code_hash TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    used_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS phone_codes_phone ON phone_codes(phone, created_at);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_phone ON users(phone) WHERE phone != '';
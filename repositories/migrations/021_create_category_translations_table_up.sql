@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS category_translations(
+    category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    locale TEXT NOT NULL,
+    name TEXT NOT NULL,
+    PRIMARY KEY (category_id, locale)
+);
@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+)
+
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+func (repo *NotificationRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	return runMigration(ctx, db, "010_create_notification_opt_outs_table_up.sql")
+}
+
+func (repo *NotificationRepository) IsOptedOut(ctx context.Context, userID int, event models.NotificationEvent) (bool, error) {
+	var count int
+	err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notification_opt_outs WHERE user_id = ? AND event = ?", userID, event).Scan(&count)
+	return count > 0, err
+}
+
+func (repo *NotificationRepository) SetOptOut(ctx context.Context, userID int, event models.NotificationEvent, optOut bool) error {
+	query := "DELETE FROM notification_opt_outs WHERE user_id = ? AND event = ?"
+	if optOut {
+		query = "INSERT OR IGNORE INTO notification_opt_outs (user_id, event) VALUES (?, ?)"
+	}
+
+	_, err := repo.db.ExecContext(ctx, query, userID, event)
+	return err
+}
+
+// GetOptOuts returns the events the user opted out of.
+func (repo *NotificationRepository) GetOptOuts(ctx context.Context, userID int) (map[models.NotificationEvent]bool, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT event FROM notification_opt_outs WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	optOuts := make(map[models.NotificationEvent]bool)
+	for rows.Next() {
+		var event models.NotificationEvent
+		if err := rows.Scan(&event); err != nil {
+			return nil, err
+		}
+		optOuts[event] = true
+	}
+
+	return optOuts, rows.Err()
+}
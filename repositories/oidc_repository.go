@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrOIDCLoginInvalid = errors.New("login state is invalid, expired or already used")
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrIdentityTaken    = errors.New("identity is already linked")
+)
+
+type OIDCRepository struct {
+	db *sql.DB
+}
+
+func (repo *OIDCRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	return runMigration(ctx, db, "019_create_oidc_tables_up.sql")
+}
+
+func (repo *OIDCRepository) CreateOIDCLogin(ctx context.Context, login *models.OIDCLogin) error {
+	var linkUserID sql.NullInt64
+	if login.LinkUserID != 0 {
+		linkUserID = sql.NullInt64{Int64: int64(login.LinkUserID), Valid: true}
+	}
+	_, err := repo.db.ExecContext(ctx, "INSERT INTO oidc_logins (state_hash, provider, nonce, code_verifier, link_user_id, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		login.StateHash, login.Provider, login.Nonce, login.CodeVerifier, linkUserID,
+		login.CreatedAt.UTC().Format(time.RFC3339), login.ExpiresAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+// UseOIDCLogin deletes the login with the state hash and returns it, so a
+// state works once. It fails with ErrOIDCLoginInvalid for unknown and
+// expired logins.
+func (repo *OIDCRepository) UseOIDCLogin(ctx context.Context, hash string, now time.Time) (*models.OIDCLogin, error) {
+	login := models.OIDCLogin{StateHash: hash}
+	var linkUserID sql.NullInt64
+	var createdAt, expiresAt string
+	err := repo.db.QueryRowContext(ctx, `DELETE FROM oidc_logins WHERE state_hash = ?
+		RETURNING provider, nonce, code_verifier, link_user_id, created_at, expires_at`, hash).
+		Scan(&login.Provider, &login.Nonce, &login.CodeVerifier, &linkUserID, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOIDCLoginInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	login.LinkUserID = int(linkUserID.Int64)
+	if login.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return nil, err
+	}
+	if login.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt); err != nil {
+		return nil, err
+	}
+	if !now.Before(login.ExpiresAt) {
+		return nil, ErrOIDCLoginInvalid
+	}
+	return &login, nil
+}
+
+// DeleteExpiredOIDCLogins removes the logins the provider never redirected
+// back from.
+func (repo *OIDCRepository) DeleteExpiredOIDCLogins(ctx context.Context, now time.Time) (int64, error) {
+	res, err := repo.db.ExecContext(ctx, "DELETE FROM oidc_logins WHERE expires_at < ?", now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// FindIdentity returns the user the provider account is linked to or
+// ErrIdentityNotFound.
+func (repo *OIDCRepository) FindIdentity(ctx context.Context, provider, subject string) (int, error) {
+	var userID int
+	err := repo.db.QueryRowContext(ctx, "SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?", provider, subject).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrIdentityNotFound
+	}
+	return userID, err
+}
+
+// CreateIdentity links the provider account to the user. It fails with
+// ErrIdentityTaken when the provider account is linked already or the user
+// has another account at the provider.
+func (repo *OIDCRepository) CreateIdentity(ctx context.Context, identity *models.Identity) error {
+	res, err := repo.db.ExecContext(ctx, `INSERT INTO user_identities (provider, subject, user_id, email, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`,
+		identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrIdentityTaken
+	}
+	return nil
+}
+
+// ListIdentities returns the provider accounts linked to the user.
+func (repo *OIDCRepository) ListIdentities(ctx context.Context, userID int) ([]models.Identity, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT provider, subject, email, created_at FROM user_identities WHERE user_id = ? ORDER BY created_at, provider", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []models.Identity{}
+	for rows.Next() {
+		identity := models.Identity{UserID: userID}
+		var createdAt string
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.Email, &createdAt); err != nil {
+			return nil, err
+		}
+		if identity.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrOneTimeTokenInvalid = errors.New("token is invalid, expired or already used")
+
+type OneTimeTokenRepository struct {
+	db *sql.DB
+}
+
+func (repo *OneTimeTokenRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	if err := runMigration(ctx, db, "015_create_one_time_tokens_table_up.sql"); err != nil {
+		return err
+	}
+	return ensureColumn(ctx, db, "one_time_tokens", "attempts", "INTEGER NOT NULL DEFAULT 0")
+}
+
+// CreateOneTimeToken stores the token. Unused tokens the user has for the
+// same purpose stop working, only the latest link sent is valid.
+func (repo *OneTimeTokenRepository) CreateOneTimeToken(ctx context.Context, token *models.OneTimeToken) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE one_time_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		token.CreatedAt.UTC().Format(time.RFC3339), token.UserID, token.Purpose); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO one_time_tokens (user_id, purpose, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		token.UserID, token.Purpose, token.TokenHash, token.CreatedAt.UTC().Format(time.RFC3339), token.ExpiresAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	token.ID = int(id)
+
+	return tx.Commit()
+}
+
+// UseOneTimeToken marks the token with hash as used and returns the user it
+// was issued to. The guarded update lets only one of concurrent requests
+// use the token.
+func (repo *OneTimeTokenRepository) UseOneTimeToken(ctx context.Context, purpose models.TokenPurpose, hash string, now time.Time) (int, error) {
+	var userID int
+	at := now.UTC().Format(time.RFC3339)
+	err := repo.db.QueryRowContext(ctx, `UPDATE one_time_tokens SET used_at = ?
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING user_id`, at, hash, purpose, at).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrOneTimeTokenInvalid
+	}
+	return userID, err
+}
+
+// FindOneTimeToken returns the usable token with hash without using it, for
+// tokens that are only used once a second factor is checked.
+func (repo *OneTimeTokenRepository) FindOneTimeToken(ctx context.Context, purpose models.TokenPurpose, hash string, now time.Time) (*models.OneTimeToken, error) {
+	t := models.OneTimeToken{Purpose: purpose, TokenHash: hash}
+	var createdAt, expiresAt string
+	err := repo.db.QueryRowContext(ctx, `SELECT id, user_id, created_at, expires_at FROM one_time_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?`,
+		hash, purpose, now.UTC().Format(time.RFC3339)).
+		Scan(&t.ID, &t.UserID, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOneTimeTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if t.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return nil, err
+	}
+	if t.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// FailOneTimeToken counts a failed attempt at the token, the token stops
+// working after maxAttempts.
+func (repo *OneTimeTokenRepository) FailOneTimeToken(ctx context.Context, id int, maxAttempts int, now time.Time) error {
+	_, err := repo.db.ExecContext(ctx, `UPDATE one_time_tokens SET attempts = attempts + 1,
+		used_at = CASE WHEN attempts + 1 >= ? THEN ? ELSE used_at END
+		WHERE id = ? AND used_at IS NULL`, maxAttempts, now.UTC().Format(time.RFC3339), id)
+	return err
+}
+
+// LastOneTimeTokenAt returns when the latest token for the purpose was
+// created for the user, ok is false when there is none.
+func (repo *OneTimeTokenRepository) LastOneTimeTokenAt(ctx context.Context, userID int, purpose models.TokenPurpose) (at time.Time, ok bool, err error) {
+	var createdAt sql.NullString
+	err = repo.db.QueryRowContext(ctx, "SELECT MAX(created_at) FROM one_time_tokens WHERE user_id = ? AND purpose = ?", userID, purpose).
+		Scan(&createdAt)
+	if err != nil || !createdAt.Valid {
+		return time.Time{}, false, err
+	}
+
+	at, err = time.Parse(time.RFC3339, createdAt.String)
+	return at, err == nil, err
+}
+
+// DeleteExpiredOneTimeTokens removes the tokens that expired before now and
+// returns how many there were.
+func (repo *OneTimeTokenRepository) DeleteExpiredOneTimeTokens(ctx context.Context, now time.Time) (int64, error) {
+	res, err := repo.db.ExecContext(ctx, "DELETE FROM one_time_tokens WHERE expires_at < ?", now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,228 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPromoUsageLimit = errors.New("promo code usage limit reached")
+	ErrPromoUserLimit  = errors.New("promo code already used")
+	ErrPromoFirstOrder = errors.New("promo code is for the first order only")
+)
+
+type OrderRepository struct {
+	db *sql.DB
+}
+
+func (repo *OrderRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	if err := runMigration(ctx, db, "007_create_orders_tables_up.sql"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, db, "orders", "bonus_spent", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return ensureColumn(ctx, db, "orders", "bonus_earned", "INTEGER NOT NULL DEFAULT 0")
+}
+
+// CountUserOrders returns the number of orders of the user that were not
+// cancelled.
+func (repo *OrderRepository) CountUserOrders(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders WHERE user_id = ? AND status <> ?", userID, models.OrderCancelled).Scan(&count)
+	return count, err
+}
+
+// CreateOrder stores the order with its items, redeems promo and books the
+// spent and earned bonus points in the same transaction. An order of a group
+// cart closes the cart in it as well. The usage limits are
+// checked by the statements that record the redemption, so two orders can
+// never both take the last use of a code.
+func (repo *OrderRepository) CreateOrder(ctx context.Context, order *models.Order, promo *models.PromoCode) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if promo != nil && promo.FirstOrderOnly {
+		var count int
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders WHERE user_id = ? AND status <> ?", order.UserID, models.OrderCancelled).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrPromoFirstOrder
+		}
+	}
+
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = time.Now()
+	}
+	if order.Status == "" {
+		order.Status = models.OrderPlaced
+	}
+	createdAt := order.CreatedAt.UTC().Format(time.RFC3339)
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO orders (user_id, status, subtotal, delivery_fee, discount, total, promo_code, created_at, bonus_spent, bonus_earned, group_cart_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		order.UserID, order.Status, order.Subtotal, order.DeliveryFee, order.Discount, order.Total, order.PromoCode, createdAt, order.BonusSpent, order.BonusEarned, order.GroupCartID)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range order.Items {
+		_, err := tx.ExecContext(ctx, "INSERT INTO order_items (order_id, product_id, name, quantity, unit_price, line_total) VALUES (?, ?, ?, ?, ?, ?)",
+			id, item.ProductID, item.Name, item.Quantity, item.UnitPrice, item.LineTotal)
+		if err != nil {
+			return err
+		}
+	}
+
+	if order.GroupCartID != 0 {
+		if err := closeGroupCart(ctx, tx, order, id); err != nil {
+			return err
+		}
+	}
+
+	if promo != nil {
+		if err := redeemPromo(ctx, tx, promo, order.UserID, id, createdAt); err != nil {
+			return err
+		}
+	}
+
+	if order.BonusSpent > 0 {
+		if err := spendBonus(ctx, tx, order.UserID, order.BonusSpent, id, order.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if order.BonusEarned > 0 {
+		if err := earnBonus(ctx, tx, order.UserID, order.BonusEarned, id, order.CreatedAt, order.BonusExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	order.ID = int(id)
+	return nil
+}
+
+func redeemPromo(ctx context.Context, tx *sql.Tx, promo *models.PromoCode, userID int, orderID int64, redeemedAt string) error {
+	res, err := tx.ExecContext(ctx, `UPDATE promo_codes SET used_count = used_count + 1
+		WHERE id = ? AND (usage_limit = 0 OR used_count < usage_limit)`, promo.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrPromoUsageLimit
+	}
+
+	res, err = tx.ExecContext(ctx, `INSERT INTO promo_redemptions (promo_id, user_id, order_id, redeemed_at)
+		SELECT ?, ?, ?, ?
+		WHERE ? = 0 OR (SELECT COUNT(*) FROM promo_redemptions WHERE promo_id = ? AND user_id = ?) < ?`,
+		promo.ID, userID, orderID, redeemedAt, promo.PerUserLimit, promo.ID, userID, promo.PerUserLimit)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrPromoUserLimit
+	}
+
+	return nil
+}
+
+// GetOrder returns the order with its items.
+func (repo *OrderRepository) GetOrder(ctx context.Context, id int) (*models.Order, error) {
+	var o models.Order
+	var createdAt string
+	err := repo.db.QueryRowContext(ctx, `SELECT id, user_id, status, subtotal, delivery_fee, discount, total, promo_code, created_at, bonus_spent, bonus_earned, group_cart_id
+		FROM orders WHERE id = ?`, id).
+		Scan(&o.ID, &o.UserID, &o.Status, &o.Subtotal, &o.DeliveryFee, &o.Discount, &o.Total, &o.PromoCode, &createdAt, &o.BonusSpent, &o.BonusEarned, &o.GroupCartID)
+	if err != nil {
+		return nil, err
+	}
+	if o.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return nil, err
+	}
+
+	rows, err := repo.db.QueryContext(ctx, "SELECT product_id, name, quantity, unit_price, line_total FROM order_items WHERE order_id = ? ORDER BY product_id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	o.Items = []models.OrderItem{}
+	for rows.Next() {
+		var item models.OrderItem
+		if err := rows.Scan(&item.ProductID, &item.Name, &item.Quantity, &item.UnitPrice, &item.LineTotal); err != nil {
+			return nil, err
+		}
+		o.Items = append(o.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if o.GroupCartID == 0 {
+		return &o, nil
+	}
+
+	participants, err := repo.db.QueryContext(ctx, `SELECT users.id, users.username, order_participants.subtotal FROM order_participants
+		JOIN users ON users.id = order_participants.user_id
+		WHERE order_id = ? ORDER BY users.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer participants.Close()
+
+	for participants.Next() {
+		var p models.OrderParticipant
+		if err := participants.Scan(&p.UserID, &p.Username, &p.Subtotal); err != nil {
+			return nil, err
+		}
+		o.Participants = append(o.Participants, p)
+	}
+
+	return &o, participants.Err()
+}
+
+// GetProductOrderCounts returns in how many of the user's orders that were
+// not cancelled every product was.
+func (repo *OrderRepository) GetProductOrderCounts(ctx context.Context, userID int) (map[int]int, error) {
+	rows, err := repo.db.QueryContext(ctx, `SELECT order_items.product_id, COUNT(*) FROM order_items
+		JOIN orders ON orders.id = order_items.order_id
+		WHERE orders.user_id = ? AND orders.status <> ?
+		GROUP BY order_items.product_id`, userID, models.OrderCancelled)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var productID, count int
+		if err := rows.Scan(&productID, &count); err != nil {
+			return nil, err
+		}
+		counts[productID] = count
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPhoneCodeInvalid = errors.New("code is invalid, expired or already used")
+	ErrPhoneTaken       = errors.New("phone is linked to another user")
+)
+
+type PhoneRepository struct {
+	db *sql.DB
+}
+
+func (repo *PhoneRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	return runMigration(ctx, db, "020_create_phone_codes_table_up.sql")
+}
+
+// CreatePhoneCode stores the code. Unused codes for the same phone and
+// purpose stop working, only the latest SMS sent is valid.
+func (repo *PhoneRepository) CreatePhoneCode(ctx context.Context, code *models.PhoneCode) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE phone_codes SET used_at = ? WHERE phone = ? AND purpose = ? AND used_at IS NULL",
+		code.CreatedAt.UTC().Format(time.RFC3339), code.Phone, code.Purpose); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO phone_codes (phone, purpose, user_id, code_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		code.Phone, code.Purpose, code.UserID, code.CodeHash, code.CreatedAt.UTC().Format(time.RFC3339), code.ExpiresAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	code.ID = int(id)
+
+	return tx.Commit()
+}
+
+// FindPhoneCode returns the usable code for the phone and purpose without
+// using it, the caller compares the hash.
+func (repo *PhoneRepository) FindPhoneCode(ctx context.Context, purpose models.PhoneCodePurpose, phone string, now time.Time) (*models.PhoneCode, error) {
+	c := models.PhoneCode{Phone: phone, Purpose: purpose}
+	var createdAt, expiresAt string
+	err := repo.db.QueryRowContext(ctx, `SELECT id, user_id, code_hash, created_at, expires_at FROM phone_codes
+		WHERE phone = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		ORDER BY id DESC LIMIT 1`,
+		phone, purpose, now.UTC().Format(time.RFC3339)).
+		Scan(&c.ID, &c.UserID, &c.CodeHash, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPhoneCodeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return nil, err
+	}
+	if c.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UsePhoneCode marks the code as used. The guarded update lets only one of
+// concurrent requests use the code.
+func (repo *PhoneRepository) UsePhoneCode(ctx context.Context, id int, now time.Time) error {
+	at := now.UTC().Format(time.RFC3339)
+	res, err := repo.db.ExecContext(ctx, "UPDATE phone_codes SET used_at = ? WHERE id = ? AND used_at IS NULL AND expires_at > ?", at, id, at)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		return ErrPhoneCodeInvalid
+	}
+	return err
+}
+
+// FailPhoneCode counts a wrong code, the code stops working after
+// maxAttempts.
+func (repo *PhoneRepository) FailPhoneCode(ctx context.Context, id int, maxAttempts int, now time.Time) error {
+	_, err := repo.db.ExecContext(ctx, `UPDATE phone_codes SET attempts = attempts + 1,
+		used_at = CASE WHEN attempts + 1 >= ? THEN ? ELSE used_at END
+		WHERE id = ? AND used_at IS NULL`, maxAttempts, now.UTC().Format(time.RFC3339), id)
+	return err
+}
+
+// PhoneCodesSince returns when codes were created for the phone since the
+// time, for any purpose, the latest first.
+func (repo *PhoneRepository) PhoneCodesSince(ctx context.Context, phone string, since time.Time) ([]time.Time, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT created_at FROM phone_codes WHERE phone = ? AND created_at >= ? ORDER BY created_at DESC",
+		phone, since.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var createdAt string
+		if err := rows.Scan(&createdAt); err != nil {
+			return nil, err
+		}
+		at, err := time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, at)
+	}
+	return times, rows.Err()
+}
+
+// DeleteExpiredPhoneCodes removes the codes that expired before now and
+// returns how many there were.
+func (repo *PhoneRepository) DeleteExpiredPhoneCodes(ctx context.Context, now time.Time) (int64, error) {
+	res, err := repo.db.ExecContext(ctx, "DELETE FROM phone_codes WHERE expires_at < ?", now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,154 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type PromoRepository struct {
+	db *sql.DB
+}
+
+func (repo *PromoRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	if err := runMigration(ctx, db, "006_create_promo_codes_table_up.sql"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, db, "promo_codes", "min_tier", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	return repo.fillDB(ctx)
+}
+
+// fillDB seeds the launch campaign codes.
+func (repo *PromoRepository) fillDB(ctx context.Context) error {
+	var count int
+	if err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM promo_codes").Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids, err := productIDsByName(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	promos := []models.PromoCode{
+		{Code: "BURGER20", Description: "20% off", Kind: models.PromoPercent, Value: 20, Active: true},
+		{Code: "FREEDELIVERY", Description: "Free delivery", Kind: models.PromoFreeDelivery, Active: true},
+	}
+	if nuggets, ok := ids["Chiken Nuggets"]; ok {
+		promos = append(promos, models.PromoCode{
+			Code: "2FOR1NUGGETS", Description: "Second nuggets for free", Kind: models.PromoFreeItem,
+			ProductID: &nuggets, FreeEvery: 2, Active: true,
+		})
+	}
+
+	for _, p := range promos {
+		if err := insertPromo(ctx, tx, p); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertPromo(ctx context.Context, tx *sql.Tx, p models.PromoCode) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO promo_codes
+		(code, description, kind, value, product_id, free_every, min_subtotal, category, first_order_only,
+		 starts_at, ends_at, per_user_limit, usage_limit, active, min_tier)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.Code, p.Description, p.Kind, p.Value, p.ProductID, p.FreeEvery, p.MinSubtotal, p.CategoryID, p.FirstOrderOnly,
+		formatNullTime(p.StartsAt), formatNullTime(p.EndsAt), p.PerUserLimit, p.UsageLimit, p.Active, p.MinTier)
+	return err
+}
+
+// CreatePromo checks and stores a new code, used by tests and back office
+// tooling.
+func (repo *PromoRepository) CreatePromo(ctx context.Context, p models.PromoCode) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertPromo(ctx, tx, p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (repo *PromoRepository) FindPromoByCode(ctx context.Context, code string) (*models.PromoCode, error) {
+	var p models.PromoCode
+	var productID, categoryID sql.NullInt64
+	var startsAt, endsAt sql.NullString
+
+	err := repo.db.QueryRowContext(ctx, `SELECT id, code, description, kind, value, product_id, free_every,
+		min_subtotal, category, first_order_only, starts_at, ends_at, per_user_limit, usage_limit, used_count, active, min_tier
+		FROM promo_codes WHERE code = ?`, code).
+		Scan(&p.ID, &p.Code, &p.Description, &p.Kind, &p.Value, &productID, &p.FreeEvery,
+			&p.MinSubtotal, &categoryID, &p.FirstOrderOnly, &startsAt, &endsAt, &p.PerUserLimit, &p.UsageLimit, &p.UsedCount, &p.Active, &p.MinTier)
+	if err != nil {
+		return nil, err
+	}
+
+	if productID.Valid {
+		id := int(productID.Int64)
+		p.ProductID = &id
+	}
+	if categoryID.Valid {
+		id := int(categoryID.Int64)
+		p.CategoryID = &id
+	}
+	if p.StartsAt, err = parseNullTime(startsAt); err != nil {
+		return nil, err
+	}
+	if p.EndsAt, err = parseNullTime(endsAt); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// CountPromoRedemptions returns how many times the user redeemed the code.
+func (repo *PromoRepository) CountPromoRedemptions(ctx context.Context, promoID, userID int) (int, error) {
+	var count int
+	err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM promo_redemptions WHERE promo_id = ? AND user_id = ?", promoID, userID).Scan(&count)
+	return count, err
+}
+
+func formatNullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseNullTime(s sql.NullString) (*time.Time, error) {
+	if !s.Valid || s.String == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
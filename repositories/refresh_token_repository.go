@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+type RefreshTokenRepository struct {
+	db *sql.DB
+}
+
+func (repo *RefreshTokenRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	if err := runMigration(ctx, db, "013_create_refresh_tokens_table_up.sql"); err != nil {
+		return err
+	}
+	return ensureColumn(ctx, db, "refresh_tokens", "mfa", "INTEGER NOT NULL DEFAULT 0")
+}
+
+func (repo *RefreshTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return insertRefreshToken(ctx, repo.db, token)
+}
+
+// RotateRefreshToken marks the token with hash as used and stores next in
+// its family. Presenting a token that was used before revokes the whole
+// family and fails with ErrRefreshTokenReused, so a stolen token stops
+// working for both the thief and the user. The reused token is returned
+// with the error, its family names the session to end.
+func (repo *RefreshTokenRepository) RotateRefreshToken(ctx context.Context, hash string, next *models.RefreshToken, now time.Time) (*models.RefreshToken, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var t models.RefreshToken
+	var createdAt, expiresAt string
+	var usedAt, revokedAt sql.NullString
+	err = tx.QueryRowContext(ctx, `SELECT refresh_tokens.id, user_id, users.username, family, created_at, expires_at, used_at, revoked_at, mfa
+		FROM refresh_tokens JOIN users ON users.id = refresh_tokens.user_id
+		WHERE token_hash = ?`, hash).
+		Scan(&t.ID, &t.UserID, &t.Username, &t.Family, &createdAt, &expiresAt, &usedAt, &revokedAt, &t.MFA)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.TokenHash = hash
+	if t.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return nil, err
+	}
+	if t.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt); err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid || !now.Before(t.ExpiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	used := usedAt.Valid
+	if !used {
+		res, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL",
+			now.UTC().Format(time.RFC3339), t.ID)
+		if err != nil {
+			return nil, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		used = n == 0
+	}
+
+	if used {
+		if err := revokeFamily(ctx, tx, t.Family, now); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return &t, ErrRefreshTokenReused
+	}
+
+	next.UserID = t.UserID
+	next.Username = t.Username
+	next.Family = t.Family
+	next.MFA = t.MFA
+	if err := insertRefreshToken(ctx, tx, next); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// RevokeRefreshTokenFamily revokes the family of the token with hash, it is
+// a no-op for unknown tokens.
+func (repo *RefreshTokenRepository) RevokeRefreshTokenFamily(ctx context.Context, hash string, now time.Time) error {
+	_, err := repo.db.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = ?
+		WHERE revoked_at IS NULL AND family = (SELECT family FROM refresh_tokens WHERE token_hash = ?)`,
+		now.UTC().Format(time.RFC3339), hash)
+	return err
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of the user, which
+// ends all of their logins.
+func (repo *RefreshTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID int, now time.Time) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		now.UTC().Format(time.RFC3339), userID)
+	return err
+}
+
+// DeleteExpiredRefreshTokens removes the tokens that expired before now and
+// returns how many there were.
+func (repo *RefreshTokenRepository) DeleteExpiredRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	res, err := repo.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at < ?", now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertRefreshToken(ctx context.Context, db execer, token *models.RefreshToken) error {
+	res, err := db.ExecContext(ctx, "INSERT INTO refresh_tokens (user_id, family, token_hash, created_at, expires_at, mfa) VALUES (?, ?, ?, ?, ?, ?)",
+		token.UserID, token.Family, token.TokenHash, token.CreatedAt.UTC().Format(time.RFC3339), token.ExpiresAt.UTC().Format(time.RFC3339), token.MFA)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	token.ID = int(id)
+	return nil
+}
+
+func revokeFamily(ctx context.Context, tx *sql.Tx, family string, now time.Time) error {
+	_, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE family = ? AND revoked_at IS NULL",
+		now.UTC().Format(time.RFC3339), family)
+	return err
+}
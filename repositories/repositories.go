@@ -3,6 +3,8 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"os"
+	"path/filepath"
 
 	_ "modernc.org/sqlite"
 )
@@ -12,6 +14,22 @@ type AppRepository struct {
 
 	*UserRepository
 	*ProductRerository
+	*CategoryRepository
+	*PromoRepository
+	*OrderRepository
+	*BonusRepository
+	*TierRepository
+	*NotificationRepository
+	*GroupCartRepository
+	*FavoriteRepository
+	*RefreshTokenRepository
+	*RoleRepository
+	*OneTimeTokenRepository
+	*MFARepository
+	*SessionRepository
+	*SigningKeyRepository
+	*OIDCRepository
+	*PhoneRepository
 }
 
 func NewAppRepository(ctx context.Context, dbPath string) (*AppRepository, error) {
@@ -28,13 +46,77 @@ func NewAppRepository(ctx context.Context, dbPath string) (*AppRepository, error
 
 	repo.UserRepository = &UserRepository{db: db}
 	repo.ProductRerository = &ProductRerository{db: db}
+	repo.CategoryRepository = &CategoryRepository{db: db}
+	repo.PromoRepository = &PromoRepository{db: db}
+	repo.OrderRepository = &OrderRepository{db: db}
+	repo.BonusRepository = &BonusRepository{db: db}
+	repo.TierRepository = &TierRepository{db: db}
+	repo.NotificationRepository = &NotificationRepository{db: db}
+	repo.GroupCartRepository = &GroupCartRepository{db: db}
+	repo.FavoriteRepository = &FavoriteRepository{db: db}
+	repo.RefreshTokenRepository = &RefreshTokenRepository{db: db}
+	repo.RoleRepository = &RoleRepository{db: db}
+	repo.OneTimeTokenRepository = &OneTimeTokenRepository{db: db}
+	repo.MFARepository = &MFARepository{db: db}
+	repo.SessionRepository = &SessionRepository{db: db}
+	repo.SigningKeyRepository = &SigningKeyRepository{db: db}
+	repo.OIDCRepository = &OIDCRepository{db: db}
+	repo.PhoneRepository = &PhoneRepository{db: db}
 
 	if err := repo.initUsersTable(ctx); err != nil {
 		return nil, err
 	}
+	if err := repo.initCategoriesTable(ctx); err != nil {
+		return nil, err
+	}
 	if err := repo.initProductsTable(ctx); err != nil {
 		return nil, err
 	}
+	if err := repo.initPromoCodesTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initOrdersTables(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initBonusLedgerTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initUserTiersTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initNotificationOptOutsTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initGroupCartsTables(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initFavoritesTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initRefreshTokensTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initUserRolesTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initOneTimeTokensTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initMFATables(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initSessionsTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initSigningKeysTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initOIDCTables(ctx); err != nil {
+		return nil, err
+	}
+	if err := repo.initPhoneCodesTable(ctx); err != nil {
+		return nil, err
+	}
 
 	return repo, nil
 }
@@ -43,6 +125,108 @@ func (r *AppRepository) initUsersTable(ctx context.Context) error {
 	return r.UserRepository.Init(ctx, r.DB)
 }
 
+func (r *AppRepository) initCategoriesTable(ctx context.Context) error {
+	return r.CategoryRepository.Init(ctx, r.DB)
+}
+
 func (r *AppRepository) initProductsTable(ctx context.Context) error {
 	return r.ProductRerository.Init(ctx, r.DB)
 }
+
+func (r *AppRepository) initPromoCodesTable(ctx context.Context) error {
+	return r.PromoRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initOrdersTables(ctx context.Context) error {
+	return r.OrderRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initBonusLedgerTable(ctx context.Context) error {
+	return r.BonusRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initUserTiersTable(ctx context.Context) error {
+	return r.TierRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initNotificationOptOutsTable(ctx context.Context) error {
+	return r.NotificationRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initGroupCartsTables(ctx context.Context) error {
+	return r.GroupCartRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initFavoritesTable(ctx context.Context) error {
+	return r.FavoriteRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initRefreshTokensTable(ctx context.Context) error {
+	return r.RefreshTokenRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initUserRolesTable(ctx context.Context) error {
+	return r.RoleRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initOneTimeTokensTable(ctx context.Context) error {
+	return r.OneTimeTokenRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initMFATables(ctx context.Context) error {
+	return r.MFARepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initSessionsTable(ctx context.Context) error {
+	return r.SessionRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initSigningKeysTable(ctx context.Context) error {
+	return r.SigningKeyRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initOIDCTables(ctx context.Context) error {
+	return r.OIDCRepository.Init(ctx, r.DB)
+}
+
+func (r *AppRepository) initPhoneCodesTable(ctx context.Context) error {
+	return r.PhoneRepository.Init(ctx, r.DB)
+}
+
+func runMigration(ctx context.Context, db *sql.DB, name string) error {
+	var path = filepath.Join("..", "repositories", "migrations", name)
+	var req, err = os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, string(req))
+	return err
+}
+
+// ensureColumn adds the column to an existing table unless it is already
+// there, SQLite has no ADD COLUMN IF NOT EXISTS.
+func ensureColumn(ctx context.Context, db *sql.DB, table, column, definition string) error {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.ExecContext(ctx, "ALTER TABLE "+table+" ADD COLUMN "+column+" "+definition)
+	return err
+}
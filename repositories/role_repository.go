@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrLastAdmin = errors.New("the last admin can not lose the admin role")
+
+type RoleRepository struct {
+	db *sql.DB
+}
+
+func (repo *RoleRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	return runMigration(ctx, db, "014_create_user_roles_table_up.sql")
+}
+
+// GetUserRoles returns the roles granted to the user, RoleCustomer is
+// implied and not stored.
+func (repo *RoleRepository) GetUserRoles(ctx context.Context, userID int) ([]models.Role, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT role FROM user_roles WHERE user_id = ? ORDER BY role", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GrantRole grants the role, granting it twice is a no-op. grantedBy is 0
+// for grants made outside of the admin API.
+func (repo *RoleRepository) GrantRole(ctx context.Context, userID int, role models.Role, grantedBy int, grantedAt time.Time) error {
+	var by any
+	if grantedBy != 0 {
+		by = grantedBy
+	}
+
+	_, err := repo.db.ExecContext(ctx, "INSERT OR IGNORE INTO user_roles (user_id, role, granted_at, granted_by) VALUES (?, ?, ?, ?)",
+		userID, role, grantedAt.UTC().Format(time.RFC3339), by)
+	return err
+}
+
+// CountRole returns how many users have the role.
+func (repo *RoleRepository) CountRole(ctx context.Context, role models.Role) (int, error) {
+	var count int
+	err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_roles WHERE role = ?", role).Scan(&count)
+	return count, err
+}
+
+// RevokeRole revokes the role and reports whether the user had it. The admin
+// role of the only admin is kept and ErrLastAdmin returned.
+func (repo *RoleRepository) RevokeRole(ctx context.Context, userID int, role models.Role) (bool, error) {
+	res, err := repo.db.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = ? AND role = ?
+		AND (role <> ? OR (SELECT COUNT(*) FROM user_roles WHERE role = ?) > 1)`,
+		userID, role, models.RoleAdmin, models.RoleAdmin)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return n > 0, err
+	}
+
+	if role == models.RoleAdmin {
+		var count int
+		err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_roles WHERE user_id = ? AND role = ?", userID, role).Scan(&count)
+		if err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return false, ErrLastAdmin
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionRepository keeps the client details of logins. A session is active
+// while its refresh token family has a usable token, revoking the family
+// ends the session.
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func (repo *SessionRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	return runMigration(ctx, db, "017_create_sessions_table_up.sql")
+}
+
+func (repo *SessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	_, err := repo.db.ExecContext(ctx, "INSERT INTO sessions (id, user_id, device, ip, user_agent, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		session.ID, session.UserID, session.Device, session.IP, session.UserAgent,
+		session.CreatedAt.UTC().Format(time.RFC3339), session.LastSeenAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+// TouchSession records that the session was used by the client at now.
+func (repo *SessionRepository) TouchSession(ctx context.Context, id string, device string, client models.SessionClient, now time.Time) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE sessions SET device = ?, ip = ?, user_agent = ?, last_seen_at = ? WHERE id = ?",
+		device, client.IP, client.UserAgent, now.UTC().Format(time.RFC3339), id)
+	return err
+}
+
+// ListSessions returns the active sessions of the user, the most recently
+// seen first.
+func (repo *SessionRepository) ListSessions(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	rows, err := repo.db.QueryContext(ctx, `SELECT id, device, ip, user_agent, created_at, last_seen_at FROM sessions
+		WHERE user_id = ? AND EXISTS (SELECT 1 FROM refresh_tokens
+			WHERE family = sessions.id AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?)
+		ORDER BY last_seen_at DESC, created_at DESC`,
+		userID, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		s := models.Session{UserID: userID}
+		var createdAt, lastSeenAt string
+		if err := rows.Scan(&s.ID, &s.Device, &s.IP, &s.UserAgent, &createdAt, &lastSeenAt); err != nil {
+			return nil, err
+		}
+		if s.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		if s.LastSeenAt, err = time.Parse(time.RFC3339, lastSeenAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes the refresh tokens of the session. It fails with
+// ErrSessionNotFound when the user has no such session or it already ended.
+func (repo *SessionRepository) RevokeSession(ctx context.Context, userID int, id string, now time.Time) error {
+	res, err := repo.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE family = ? AND user_id = ? AND revoked_at IS NULL",
+		now.UTC().Format(time.RFC3339), id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// DeleteOrphanSessions removes the sessions whose refresh tokens were all
+// deleted and returns how many there were.
+func (repo *SessionRepository) DeleteOrphanSessions(ctx context.Context) (int64, error) {
+	res, err := repo.db.ExecContext(ctx, "DELETE FROM sessions WHERE NOT EXISTS (SELECT 1 FROM refresh_tokens WHERE family = sessions.id)")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
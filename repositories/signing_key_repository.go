@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrSigningKeyNotFound = errors.New("signing key not found")
+
+type SigningKeyRepository struct {
+	db *sql.DB
+}
+
+func (repo *SigningKeyRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	return runMigration(ctx, db, "018_create_signing_keys_table_up.sql")
+}
+
+func (repo *SigningKeyRepository) CreateSigningKey(ctx context.Context, key *models.SigningKey) error {
+	_, err := repo.db.ExecContext(ctx, "INSERT INTO signing_keys (id, algorithm, private_key, created_at, activates_at) VALUES (?, ?, ?, ?, ?)",
+		key.ID, key.Algorithm, key.PrivateKey, key.CreatedAt.UTC().Format(time.RFC3339), key.ActivatesAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+// LatestSigningKey returns the key that activates last or
+// ErrSigningKeyNotFound.
+func (repo *SigningKeyRepository) LatestSigningKey(ctx context.Context) (*models.SigningKey, error) {
+	row := repo.db.QueryRowContext(ctx, `SELECT id, algorithm, private_key, created_at, activates_at, expires_at FROM signing_keys
+		ORDER BY activates_at DESC, created_at DESC LIMIT 1`)
+	key, err := scanSigningKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSigningKeyNotFound
+	}
+	return key, err
+}
+
+// ListSigningKeys returns the keys that did not expire by now, in the order
+// they activate.
+func (repo *SigningKeyRepository) ListSigningKeys(ctx context.Context, now time.Time) ([]models.SigningKey, error) {
+	rows, err := repo.db.QueryContext(ctx, `SELECT id, algorithm, private_key, created_at, activates_at, expires_at FROM signing_keys
+		WHERE expires_at IS NULL OR expires_at > ?
+		ORDER BY activates_at, created_at`, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.SigningKey{}
+	for rows.Next() {
+		key, err := scanSigningKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// ExpireSigningKeys sets the expiry of every key other than keepID that
+// has none yet.
+func (repo *SigningKeyRepository) ExpireSigningKeys(ctx context.Context, keepID string, at time.Time) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE signing_keys SET expires_at = ? WHERE id <> ? AND expires_at IS NULL",
+		at.UTC().Format(time.RFC3339), keepID)
+	return err
+}
+
+// DeleteExpiredSigningKeys removes the keys that expired before now.
+func (repo *SigningKeyRepository) DeleteExpiredSigningKeys(ctx context.Context, now time.Time) (int64, error) {
+	res, err := repo.db.ExecContext(ctx, "DELETE FROM signing_keys WHERE expires_at < ?", now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSigningKey(row rowScanner) (*models.SigningKey, error) {
+	var key models.SigningKey
+	var createdAt, activatesAt string
+	var expiresAt sql.NullString
+	if err := row.Scan(&key.ID, &key.Algorithm, &key.PrivateKey, &createdAt, &activatesAt, &expiresAt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if key.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return nil, err
+	}
+	if key.ActivatesAt, err = time.Parse(time.RFC3339, activatesAt); err != nil {
+		return nil, err
+	}
+	if key.ExpiresAt, err = parseNullTime(expiresAt); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type TierRepository struct {
+	db *sql.DB
+}
+
+func (repo *TierRepository) Init(ctx context.Context, db *sql.DB) error {
+	repo.db = db
+
+	return runMigration(ctx, db, "009_create_user_tiers_table_up.sql")
+}
+
+// GetUserTier returns the stored tier, sql.ErrNoRows before the first
+// recalculation for the user.
+func (repo *TierRepository) GetUserTier(ctx context.Context, userID int) (*models.UserTier, error) {
+	t := models.UserTier{UserID: userID}
+	var computedAt string
+	err := repo.db.QueryRowContext(ctx, "SELECT tier, spend, computed_at FROM user_tiers WHERE user_id = ?", userID).
+		Scan(&t.Tier, &t.Spend, &computedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.ComputedAt, err = time.Parse(time.RFC3339, computedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetSpendSince returns the total of the orders placed since since by every
+// user, users without orders included.
+func (repo *TierRepository) GetSpendSince(ctx context.Context, since time.Time) (map[int]int64, error) {
+	rows, err := repo.db.QueryContext(ctx, `SELECT users.id, COALESCE(SUM(orders.total), 0) FROM users
+		LEFT JOIN orders ON orders.user_id = users.id AND orders.status <> ? AND orders.created_at >= ?
+		GROUP BY users.id`, models.OrderCancelled, since.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spend := make(map[int]int64)
+	for rows.Next() {
+		var id int
+		var total int64
+		if err := rows.Scan(&id, &total); err != nil {
+			return nil, err
+		}
+		spend[id] = total
+	}
+
+	return spend, rows.Err()
+}
+
+func (repo *TierRepository) SaveUserTiers(ctx context.Context, tiers []models.UserTier) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, t := range tiers {
+		_, err := tx.ExecContext(ctx, `INSERT INTO user_tiers (user_id, tier, spend, computed_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(user_id) DO UPDATE SET tier = excluded.tier, spend = excluded.spend, computed_at = excluded.computed_at`,
+			t.UserID, t.Tier, t.Spend, t.ComputedAt.UTC().Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetBirthdayUsers returns the ids of users born on one of monthDays, given
+// in "01-02" form.
+func (repo *TierRepository) GetBirthdayUsers(ctx context.Context, monthDays ...string) ([]int, error) {
+	var ids []int
+	for _, monthDay := range monthDays {
+		rows, err := repo.db.QueryContext(ctx, "SELECT id FROM users WHERE birthday <> '' AND substr(birthday, 6, 5) = ?", monthDay)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
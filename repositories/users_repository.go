@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type UserRepository struct {
@@ -28,17 +29,37 @@ func (repo *UserRepository) Init(ctx context.Context, db *sql.DB) error {
 		return err
 	}
 
-	return nil
+	if err := ensureColumn(ctx, db, "users", "birthday", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// Accounts created before email verification existed count as
+	// verified, CreateUser inserts new accounts unverified. Only
+	// SetEmailVerified sets email_verified_at, it stays NULL for the
+	// grandfathered accounts whose email was never checked.
+	if err := ensureColumn(ctx, db, "users", "email_verified", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, db, "users", "email_verified_at", "TEXT"); err != nil {
+		return err
+	}
+	return ensureColumn(ctx, db, "users", "phone", "TEXT NOT NULL DEFAULT ''")
 }
 
 func (r *UserRepository) GetUserProfile(ctx context.Context, username string) (*models.User, error) {
 	var user models.User
 
+	// The bonus balance is derived from the ledger, see GetBonusBalance.
 	username = strings.Replace(username, " ", "", -1)
-	query := `SELECT username, email, bonus FROM users WHERE username = $1`
-	err := r.db.QueryRowContext(ctx, query, username).Scan(
+	query := `SELECT id, username, email, email_verified, phone, birthday, (SELECT COALESCE(SUM(remaining), 0) FROM bonus_ledger
+		WHERE bonus_ledger.user_id = users.id AND remaining > 0 AND (expires_at IS NULL OR expires_at > ?2))
+		FROM users WHERE username = ?1`
+	err := r.db.QueryRowContext(ctx, query, username, time.Now().UTC().Format(time.RFC3339)).Scan(
+		&user.Id,
 		&user.Username,
 		&user.Email,
+		&user.EmailVerified,
+		&user.Phone,
+		&user.Birthday,
 		&user.Bonus,
 	)
 
@@ -56,7 +77,96 @@ func (repo *UserRepository) GetUserByUsername(ctx context.Context, name string)
 	return password, err
 }
 
+func (repo *UserRepository) GetUserID(ctx context.Context, name string) (int, error) {
+	var id int
+	var row = repo.db.QueryRowContext(ctx, "SELECT id FROM users WHERE username = ?", name)
+	err := row.Scan(&id)
+	return id, err
+}
+
+func (repo *UserRepository) GetUsername(ctx context.Context, userID int) (string, error) {
+	var username string
+	err := repo.db.QueryRowContext(ctx, "SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+	return username, err
+}
+
+// GetUser returns the id, username, email, phone and verification state of
+// the user.
+func (repo *UserRepository) GetUser(ctx context.Context, userID int) (*models.User, error) {
+	var user models.User
+	err := repo.db.QueryRowContext(ctx, "SELECT id, username, email, email_verified, phone FROM users WHERE id = ?", userID).
+		Scan(&user.Id, &user.Username, &user.Email, &user.EmailVerified, &user.Phone)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindUserByEmail is GetUser by email, emails are compared case
+// insensitively. It also reads when the email was verified.
+func (repo *UserRepository) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	var verifiedAt sql.NullString
+	err := repo.db.QueryRowContext(ctx, "SELECT id, username, email, email_verified, email_verified_at FROM users WHERE email = ? COLLATE NOCASE", email).
+		Scan(&user.Id, &user.Username, &user.Email, &user.EmailVerified, &verifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	if user.EmailVerifiedAt, err = parseNullTime(verifiedAt); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindUserByPhone is GetUser by the linked E.164 phone.
+func (repo *UserRepository) FindUserByPhone(ctx context.Context, phone string) (*models.User, error) {
+	var user models.User
+	err := repo.db.QueryRowContext(ctx, "SELECT id, username, email, email_verified, phone FROM users WHERE phone = ? AND phone != ''", phone).
+		Scan(&user.Id, &user.Username, &user.Email, &user.EmailVerified, &user.Phone)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetPhone links the phone to the user, replacing the one they had, "" unlinks
+// it. A phone links to one user, ErrPhoneTaken when another user has it.
+func (repo *UserRepository) SetPhone(ctx context.Context, userID int, phone string) error {
+	// OR IGNORE skips the update instead of failing on the unique index.
+	res, err := repo.db.ExecContext(ctx, "UPDATE OR IGNORE users SET phone = ? WHERE id = ?", phone, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		return ErrPhoneTaken
+	}
+	return err
+}
+
+// SetEmailVerified marks the email of the user as verified at the time.
+func (repo *UserRepository) SetEmailVerified(ctx context.Context, userID int, at time.Time) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE users SET email_verified = 1, email_verified_at = ? WHERE id = ?", at.UTC().Format(time.RFC3339), userID)
+	return err
+}
+
+func (repo *UserRepository) SetPassword(ctx context.Context, userID int, hashedPassword string) error {
+	_, err := repo.db.ExecContext(ctx, "UPDATE users SET passwordHash = ? WHERE id = ?", hashedPassword, userID)
+	return err
+}
+
 func (repo *UserRepository) CreateUser(ctx context.Context, user models.User, hashedPassword string) error {
-	_, err := repo.db.ExecContext(ctx, "INSERT INTO users (username, passwordHash, email) VALUES (?, ?, ?)", user.Username, hashedPassword, user.Email)
+	_, err := repo.db.ExecContext(ctx, "INSERT INTO users (username, passwordHash, email, birthday, email_verified) VALUES (?, ?, ?, ?, 0)", user.Username, hashedPassword, user.Email, user.Birthday)
 	return err
 }
+
+// SetBirthday stores the birthday unless the user already has one, it can not
+// be changed to collect the birthday reward twice.
+func (repo *UserRepository) SetBirthday(ctx context.Context, userID int, birthday string) (bool, error) {
+	res, err := repo.db.ExecContext(ctx, "UPDATE users SET birthday = ? WHERE id = ? AND birthday = ''", birthday, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
+	"CartoonBurgers/repositories"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// AbandonedCartService reminds logged in users about carts they left
+// untouched for AbandonAfter. Every cart gets at most one reminder until it
+// is cleared or ordered.
+type AbandonedCartService struct {
+	carts        ports.CartService
+	pricer       *CartPricer
+	optOuts      *repositories.NotificationRepository
+	notifier     ports.Notifier
+	abandonAfter time.Duration
+	logger       *slog.Logger
+
+	// Now is used to find idle carts, time.Now by default.
+	Now func() time.Time
+}
+
+func NewAbandonedCartService(carts ports.CartService, pricer *CartPricer, optOuts *repositories.NotificationRepository, notifier ports.Notifier, abandonAfter time.Duration, logger *slog.Logger) *AbandonedCartService {
+	return &AbandonedCartService{carts: carts, pricer: pricer, optOuts: optOuts, notifier: notifier, abandonAfter: abandonAfter, logger: logger, Now: time.Now}
+}
+
+// Remind sends the abandoned cart event for every idle cart. A failure with
+// one cart is logged and does not stop the others.
+func (s *AbandonedCartService) Remind(ctx context.Context) error {
+	now := s.Now()
+	before := now.Add(-s.abandonAfter)
+	cartIDs, err := s.carts.IdleCarts(ctx, before)
+	if err != nil {
+		return err
+	}
+
+	for _, cartID := range cartIDs {
+		if err := s.remind(ctx, cartID, before, now); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.logger.Error("abandoned cart reminder failed",
+				"cart_id", cartID,
+				"error", err.Error())
+		}
+	}
+	return nil
+}
+
+func (s *AbandonedCartService) remind(ctx context.Context, cartID string, before, now time.Time) error {
+	userID, ok := ParseUserCartID(cartID)
+	if !ok {
+		return nil
+	}
+
+	items, err := s.carts.GetCart(ctx, cartID)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		// Nothing to remind about, the cart expired or was emptied. It is
+		// tracked again with the next change, items added since it was
+		// read are kept.
+		return s.carts.ForgetIdleCart(ctx, cartID, before)
+	}
+
+	optedOut, err := s.optOuts.IsOptedOut(ctx, userID, models.EventAbandonedCart)
+	if err != nil {
+		return err
+	}
+	if optedOut {
+		_, err := s.carts.MarkReminded(ctx, cartID)
+		return err
+	}
+
+	first, err := s.carts.MarkReminded(ctx, cartID)
+	if err != nil || !first {
+		return err
+	}
+
+	priced, err := s.pricer.Price(ctx, items)
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.Notify(ctx, models.Notification{
+		Event:  models.EventAbandonedCart,
+		UserID: userID,
+		Data: map[string]any{
+			"items": priced.Items,
+			"total": priced.Total,
+		},
+		CreatedAt: now,
+	})
+}
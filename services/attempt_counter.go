@@ -0,0 +1,133 @@
+package services
+
+import (
+	"CartoonBurgers/ports"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RedisAttemptCounter keeps failures and locks in redis so every instance
+// of the app sees them.
+type RedisAttemptCounter struct {
+	client redis.Cmdable
+}
+
+var _ ports.AttemptCounter = (*RedisAttemptCounter)(nil)
+
+func NewRedisAttemptCounter(client redis.Cmdable) *RedisAttemptCounter {
+	return &RedisAttemptCounter{client: client}
+}
+
+func (s *RedisAttemptCounter) failuresKey(key string) string {
+	return "attempts:failures:" + key
+}
+
+func (s *RedisAttemptCounter) lockKey(key string) string {
+	return "attempts:lock:" + key
+}
+
+func (s *RedisAttemptCounter) Fail(ctx context.Context, key string, keep time.Duration) (int, error) {
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(s.failuresKey(key))
+		pipe.Expire(s.failuresKey(key), keep)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+func (s *RedisAttemptCounter) Lock(ctx context.Context, key string, d time.Duration) error {
+	return s.client.Set(s.lockKey(key), "1", d).Err()
+}
+
+func (s *RedisAttemptCounter) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(s.lockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// Missing keys have a negative TTL.
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *RedisAttemptCounter) Reset(ctx context.Context, key string) error {
+	return s.client.Del(s.failuresKey(key), s.lockKey(key)).Err()
+}
+
+// InMemoryAttemptCounter is an AttemptCounter for a single instance and
+// tests.
+type InMemoryAttemptCounter struct {
+	mu       sync.Mutex
+	failures map[string]attemptCount
+	locks    map[string]time.Time
+
+	// Now is used for expiry, time.Now by default.
+	Now func() time.Time
+}
+
+type attemptCount struct {
+	count     int
+	expiresAt time.Time
+}
+
+var _ ports.AttemptCounter = (*InMemoryAttemptCounter)(nil)
+
+func NewInMemoryAttemptCounter() *InMemoryAttemptCounter {
+	return &InMemoryAttemptCounter{
+		failures: make(map[string]attemptCount),
+		locks:    make(map[string]time.Time),
+		Now:      time.Now,
+	}
+}
+
+func (s *InMemoryAttemptCounter) Fail(ctx context.Context, key string, keep time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	failures := s.failures[key]
+	if !now.Before(failures.expiresAt) {
+		failures.count = 0
+	}
+	failures.count++
+	failures.expiresAt = now.Add(keep)
+	s.failures[key] = failures
+	return failures.count, nil
+}
+
+func (s *InMemoryAttemptCounter) Lock(ctx context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = s.Now().Add(d)
+	return nil
+}
+
+func (s *InMemoryAttemptCounter) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	left := s.locks[key].Sub(s.Now())
+	if left <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+	return left, nil
+}
+
+func (s *InMemoryAttemptCounter) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	delete(s.locks, key)
+	return nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
 	"CartoonBurgers/repositories"
 	"context"
 	"log/slog"
@@ -16,6 +17,7 @@ type IPasswordHasher interface {
 
 type IRepository interface {
 	GetUserByUsername(context.Context, string) (string, error)
+	GetUserID(context.Context, string) (int, error)
 	CreateUser(context.Context, models.User, string) error
 }
 
@@ -23,25 +25,47 @@ type RegisterHandler struct {
 	Hasher     IPasswordHasher
 	Repository IRepository
 	Logger     *slog.Logger
+
+	// Verification is optional, when set a verification link is mailed to
+	// the new account.
+	Verification *EmailVerificationService
 }
 
 type LoginHandler struct {
 	Hasher     IPasswordHasher
 	Repository IRepository
-	JwtKey     []byte
+	Keys       JWTKeys
 	Logger     *slog.Logger
+
+	// Carts is optional, when set the cart_session cart is merged into the
+	// user cart after a successful login.
+	Carts     ports.CartService
+	CartMerge models.CartMergeStrategy
+
+	// Tokens is optional, when set the login also gets a refresh token.
+	// Without it a single access token valid for DefaultAccessTokenTTL is
+	// issued.
+	Tokens *TokenService
+
+	// MFA is optional, when set users with two factor authentication get
+	// a challenge from Login and their tokens from VerifyMFA.
+	MFA *MFAService
+
+	// Throttle is optional, when set failed logins lock out the username
+	// and the client IP.
+	Throttle *LoginThrottle
 }
 
 type BcryptHasher struct {
 }
 
-func NewRegisterHandler(hasher IPasswordHasher, repo *repositories.UserRepository, loger *slog.Logger) RegisterHandler {
-	var register = RegisterHandler{Hasher: hasher, Repository: repo, Logger: loger}
+func NewRegisterHandler(hasher IPasswordHasher, repo *repositories.UserRepository, loger *slog.Logger, verification *EmailVerificationService) RegisterHandler {
+	var register = RegisterHandler{Hasher: hasher, Repository: repo, Logger: loger, Verification: verification}
 	return register
 }
 
-func NewLoginHandler(hasher IPasswordHasher, repo *repositories.UserRepository, jwtKey []byte, loger *slog.Logger) LoginHandler {
-	var login = LoginHandler{Hasher: hasher, Repository: repo, JwtKey: jwtKey, Logger: loger}
+func NewLoginHandler(hasher IPasswordHasher, repo *repositories.UserRepository, keys JWTKeys, loger *slog.Logger, carts ports.CartService, cartMerge models.CartMergeStrategy, tokens *TokenService, mfa *MFAService, throttle *LoginThrottle) LoginHandler {
+	var login = LoginHandler{Hasher: hasher, Repository: repo, Keys: keys, Logger: loger, Carts: carts, CartMerge: cartMerge, Tokens: tokens, MFA: mfa, Throttle: throttle}
 	return login
 }
 
@@ -2,11 +2,11 @@ package services
 
 import (
 	"CartoonBurgers/models"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,6 +21,81 @@ type IRedisClient interface {
 	Exists(key string) *redis.IntCmd
 }
 
+// IRedisBlacklist is the part of the redis client logout needs to revoke
+// access tokens.
+type IRedisBlacklist interface {
+	SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+}
+
+// BlacklistAccessToken revokes the access token until it expires.
+func BlacklistAccessToken(client IRedisBlacklist, tokenStr string, expiration time.Duration) error {
+	return client.SetNX("blacklist:"+hashToken(tokenStr), "1", expiration).Err()
+}
+
+// IRedisSessions is the part of the redis client needed to revoke every
+// access token of a user.
+type IRedisSessions interface {
+	Set(key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+}
+
+// RevokeSessions makes the access tokens of the user issued before at stop
+// working. The mark is kept for ttl, the lifetime of an access token.
+func RevokeSessions(client IRedisSessions, userID int, at time.Time, ttl time.Duration) error {
+	return client.Set(sessionsRevokedKey(userID), at.Unix(), ttl).Err()
+}
+
+// RevokeSessionTokens makes the access tokens of the session stop working.
+// The mark is kept for ttl, the lifetime of an access token.
+func RevokeSessionTokens(client IRedisSessions, sessionID string, ttl time.Duration) error {
+	return client.Set(sessionRevokedKey(sessionID), 1, ttl).Err()
+}
+
+// TokenRevoked reports whether the access token was logged out or its
+// session was ended.
+func TokenRevoked(client IRedisClient, tokenStr string, claims jwt.MapClaims) bool {
+	if n, err := client.Exists("blacklist:" + hashToken(tokenStr)).Result(); err == nil && n > 0 {
+		return true
+	}
+	return sessionRevoked(client, claims)
+}
+
+// sessionRevoked reports whether RevokeSessions or RevokeSessionTokens
+// covers the token. Tokens without a user_id claim can not be revoked this
+// way.
+func sessionRevoked(client IRedisClient, claims jwt.MapClaims) bool {
+	if sessionID, ok := claims["sid"].(string); ok {
+		if n, err := client.Exists(sessionRevokedKey(sessionID)).Result(); err == nil && n > 0 {
+			return true
+		}
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return false
+	}
+
+	before, err := client.Get(sessionsRevokedKey(int(userID))).Int64()
+	if err != nil {
+		return false
+	}
+
+	issuedAt, ok := claims["iat"].(float64)
+	return !ok || int64(issuedAt) < before
+}
+
+func sessionsRevokedKey(userID int) string {
+	return "sessions_revoked:" + strconv.Itoa(userID)
+}
+
+func sessionRevokedKey(sessionID string) string {
+	return "session_revoked:" + sessionID
+}
+
+// ClientOf describes the client of the request for its session.
+func ClientOf(c *gin.Context) models.SessionClient {
+	return models.SessionClient{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
 // @Summary User login implementation
 // @Description Internal login handler service
 func (l *LoginHandler) Login(c *gin.Context) {
@@ -44,12 +119,17 @@ func (l *LoginHandler) Login(c *gin.Context) {
 		"username", user.Username,
 		"client_ip", c.ClientIP())
 
+	if !l.checkThrottle(c, user.Username) {
+		return
+	}
+
 	storedPassword, err := l.Repository.GetUserByUsername(c.Request.Context(), user.Username)
 	if err != nil {
 		l.Logger.Warn("user not found or database error",
 			"username", user.Username,
 			"error", err.Error(),
 			"client_ip", c.ClientIP())
+		l.loginFailed(c, user.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credits"})
 		return
 	}
@@ -59,28 +139,196 @@ func (l *LoginHandler) Login(c *gin.Context) {
 		l.Logger.Warn("invalid password attempt",
 			"username", user.Username,
 			"client_ip", c.ClientIP())
+		l.loginFailed(c, user.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credits"})
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour).Unix(),
-	})
+	userID, err := l.Repository.GetUserID(c.Request.Context(), user.Username)
+	if err != nil {
+		l.Logger.Error("failed to load user id",
+			"username", user.Username,
+			"error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generating error"})
+		return
+	}
+
+	l.LoginUser(c, user.Username, userID)
+}
+
+// LoginUser finishes the login of a user who passed the first factor, the
+// password or a login provider. Users with two factor authentication get
+// a challenge, the others their tokens.
+func (l *LoginHandler) LoginUser(c *gin.Context, username string, userID int) {
+	if l.MFA != nil {
+		enabled, err := l.MFA.Enabled(c.Request.Context(), userID)
+		if err == nil && enabled {
+			var challenge string
+			if challenge, err = l.MFA.Challenge(c.Request.Context(), userID); err == nil {
+				l.Logger.Info("first factor accepted, two factor code required",
+					"username", username,
+					"client_ip", c.ClientIP())
+				c.JSON(http.StatusOK, models.MFAChallenge{MFARequired: true, ChallengeToken: challenge})
+				return
+			}
+		}
+		if err != nil {
+			l.Logger.Error("failed to start two factor login",
+				"username", username,
+				"error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generating error"})
+			return
+		}
+	}
 
-	tokenString, err := token.SignedString(l.JwtKey)
+	l.completeLogin(c, username, userID, false)
+}
+
+type mfaVerifyRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+// @Summary Two factor login step implementation
+// @Description Internal handler exchanging an MFA challenge and code for tokens
+func (l *LoginHandler) VerifyMFA(c *gin.Context) {
+	var req mfaVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	userID, username, err := l.MFA.Verify(c.Request.Context(), req.ChallengeToken, req.Code)
+	switch {
+	case errors.Is(err, ErrMFAChallengeInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	case errors.Is(err, ErrMFACodeInvalid):
+		l.Logger.Warn("invalid two factor code",
+			"username", username,
+			"client_ip", c.ClientIP())
+		l.loginFailed(c, username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	case err != nil:
+		l.Logger.Error("failed to verify two factor code",
+			"error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generating error"})
+		return
+	}
+
+	l.completeLogin(c, username, userID, true)
+}
+
+// completeLogin issues the tokens of a login that passed every factor.
+func (l *LoginHandler) completeLogin(c *gin.Context, username string, userID int, mfa bool) {
+	pair, err := l.issueTokens(c, username, userID, mfa)
 	if err != nil {
 		l.Logger.Error("failed to generate JWT token",
-			"username", user.Username,
+			"username", username,
 			"error", err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generating error"})
 		return
 	}
 
+	if l.Throttle != nil {
+		if err := l.Throttle.Succeeded(c.Request.Context(), username); err != nil {
+			l.Logger.Error("failed to reset login failures",
+				"username", username,
+				"error", err.Error())
+		}
+	}
+
+	l.mergeGuestCart(c, userID)
+
 	l.Logger.Info("user logged in successfully",
-		"username", user.Username,
+		"username", username,
+		"mfa", mfa,
 		"client_ip", c.ClientIP())
-	c.JSON(http.StatusOK, gin.H{"token": tokenString})
+	c.JSON(http.StatusOK, pair)
+}
+
+// checkThrottle answers 429 when the username or the client IP is locked
+// out. Lockouts are not enforced while the attempt store is down.
+func (l *LoginHandler) checkThrottle(c *gin.Context, username string) bool {
+	if l.Throttle == nil {
+		return true
+	}
+
+	wait, err := l.Throttle.Check(c.Request.Context(), username, c.ClientIP())
+	if errors.Is(err, ErrLoginLocked) {
+		l.Logger.Warn("login locked out",
+			"username", username,
+			"client_ip", c.ClientIP(),
+			"retry_after", wait)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+		return false
+	}
+	if err != nil {
+		l.Logger.Error("failed to check login lockout",
+			"username", username,
+			"error", err.Error())
+	}
+	return true
+}
+
+func (l *LoginHandler) loginFailed(c *gin.Context, username string) {
+	if l.Throttle == nil {
+		return
+	}
+
+	if err := l.Throttle.Failed(c.Request.Context(), username, c.ClientIP()); err != nil {
+		l.Logger.Error("failed to count failed login",
+			"username", username,
+			"error", err.Error())
+	}
+}
+
+func (l *LoginHandler) issueTokens(c *gin.Context, username string, userID int, mfa bool) (*models.TokenPair, error) {
+	if l.Tokens != nil {
+		if mfa {
+			return l.Tokens.IssueMFA(c.Request.Context(), username, userID, ClientOf(c))
+		}
+		return l.Tokens.Issue(c.Request.Context(), username, userID, ClientOf(c))
+	}
+
+	now := time.Now()
+	accessToken, err := NewAccessToken(l.Keys, AccessClaims{
+		Username:  username,
+		UserID:    userID,
+		MFA:       mfa,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(DefaultAccessTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{AccessToken: accessToken}, nil
+}
+
+// mergeGuestCart moves the cart_session cart into the user cart. A failed
+// merge is logged and does not fail the login.
+func (l *LoginHandler) mergeGuestCart(c *gin.Context, userID int) {
+	if l.Carts == nil {
+		return
+	}
+
+	sessionID, err := c.Cookie("cart_session")
+	if err != nil || sessionID == "" {
+		return
+	}
+
+	strategy := l.CartMerge
+	if !strategy.Valid() {
+		strategy = models.CartMergeSum
+	}
+
+	if err := l.Carts.MergeCarts(c.Request.Context(), SessionCartID(sessionID), UserCartID(userID), strategy); err != nil {
+		l.Logger.Error("failed to merge guest cart",
+			"user_id", userID,
+			"error", err.Error())
+	}
 }
 
 // @Summary User registration implementation
@@ -105,6 +353,21 @@ func (h *RegisterHandler) Register(c *gin.Context) {
 		return
 	}
 
+	if err := models.ValidateEmail(user.Email); err != nil {
+		h.Logger.Warn("invalid email in registration",
+			"client_ip", c.ClientIP())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email"})
+		return
+	}
+
+	if err := models.ValidateBirthday(user.Birthday); err != nil {
+		h.Logger.Warn("invalid birthday in registration",
+			"client_ip", c.ClientIP(),
+			"error", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid birthday"})
+		return
+	}
+
 	h.Logger.Debug("attempting user registration",
 		"username", user.Username,
 		"email", user.Email,
@@ -134,12 +397,32 @@ func (h *RegisterHandler) Register(c *gin.Context) {
 		"email", user.Email,
 		"client_ip", c.ClientIP())
 
+	h.sendVerification(c, user.Username)
+
 	c.JSON(http.StatusOK, gin.H{"massage": "User registered successfully"})
 }
 
+// sendVerification mails the verification link to the new account. A
+// failure is logged, the user can ask for the link again.
+func (h *RegisterHandler) sendVerification(c *gin.Context, username string) {
+	if h.Verification == nil {
+		return
+	}
+
+	userID, err := h.Repository.GetUserID(c.Request.Context(), username)
+	if err == nil {
+		err = h.Verification.Send(c.Request.Context(), userID)
+	}
+	if err != nil {
+		h.Logger.Error("failed to send verification mail",
+			"username", username,
+			"error", err.Error())
+	}
+}
+
 // @Summary JWT authentication middleware
 // @Description Middleware for validating JWT tokens and checking blacklist
-func AuthMiddleware(jwtKey string, logger *slog.Logger) gin.HandlerFunc {
+func AuthMiddleware(keys JWTKeys, logger *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenStr := c.GetHeader("Authorization")
 
@@ -155,10 +438,10 @@ func AuthMiddleware(jwtKey string, logger *slog.Logger) gin.HandlerFunc {
 			return
 		}
 
+		tokenStr = strings.TrimPrefix(tokenStr, "Bearer ")
+
 		redisClient := c.MustGet("redis").(IRedisClient)
-		hash := sha256.Sum256([]byte(tokenStr))
-		tokenHash := hex.EncodeToString(hash[:])
-		exists, err := redisClient.Exists("blacklist:" + tokenHash).Result()
+		exists, err := redisClient.Exists("blacklist:" + hashToken(tokenStr)).Result()
 
 		if exists == 1 {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
@@ -166,14 +449,7 @@ func AuthMiddleware(jwtKey string, logger *slog.Logger) gin.HandlerFunc {
 			return
 		}
 
-		tokenStr = strings.TrimPrefix(tokenStr, "Bearer ")
-
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signed method")
-			}
-			return []byte(jwtKey), nil
-		})
+		token, err := jwt.Parse(tokenStr, keys.Keyfunc)
 
 		if err != nil {
 			logger.Error("redis check failed",
@@ -193,8 +469,18 @@ func AuthMiddleware(jwtKey string, logger *slog.Logger) gin.HandlerFunc {
 		}
 
 		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			if sessionRevoked(redisClient, claims) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+				c.Abort()
+				return
+			}
+
 			if username, exists := claims["username"]; exists {
 				c.Set("username", username)
+				SetUserID(c, claims)
+				SetSessionID(c, claims)
+				SetRoles(c, claims)
+				SetMFA(c, claims)
 				logger.Debug("token validated successfully",
 					"username", username.(string),
 					"client_ip", c.ClientIP())
@@ -210,3 +496,137 @@ func AuthMiddleware(jwtKey string, logger *slog.Logger) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// SetUserID stores the user_id claim in the context. Tokens issued before the
+// claim was added simply do not have it.
+func SetUserID(c *gin.Context, claims jwt.MapClaims) {
+	if id, ok := claims["user_id"].(float64); ok {
+		c.Set("user_id", int(id))
+	}
+}
+
+// SetSessionID stores the sid claim in the context, tokens issued without
+// a session do not have it.
+func SetSessionID(c *gin.Context, claims jwt.MapClaims) {
+	if sid, ok := claims["sid"].(string); ok {
+		c.Set("session_id", sid)
+	}
+}
+
+// SetRoles stores the roles claim in the context, tokens without it only
+// have RoleCustomer.
+func SetRoles(c *gin.Context, claims jwt.MapClaims) {
+	roles := []models.Role{}
+	if raw, ok := claims["roles"].([]interface{}); ok {
+		for _, r := range raw {
+			if role, ok := r.(string); ok && models.Role(role).Valid() {
+				roles = append(roles, models.Role(role))
+			}
+		}
+	}
+	if len(roles) == 0 {
+		roles = append(roles, models.RoleCustomer)
+	}
+	c.Set("roles", roles)
+}
+
+// SetMFA stores whether the login passed two factor authentication.
+func SetMFA(c *gin.Context, claims jwt.MapClaims) {
+	mfa, _ := claims["mfa"].(bool)
+	c.Set("mfa", mfa)
+}
+
+// ContextRoles returns the roles SetRoles stored.
+func ContextRoles(c *gin.Context) []models.Role {
+	roles, _ := c.Get("roles")
+	r, _ := roles.([]models.Role)
+	return r
+}
+
+// @Summary Role middleware
+// @Description Lets through users with any of the roles, must run after AuthMiddleware
+func RequireRole(logger *slog.Logger, roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, have := range ContextRoles(c) {
+			for _, want := range roles {
+				if have == want {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		forbid(c, logger, "roles", roles)
+	}
+}
+
+// @Summary Permission middleware
+// @Description Lets through users whose roles grant the permission, must run after AuthMiddleware
+func RequirePermission(logger *slog.Logger, permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if models.HasPermission(ContextRoles(c), permission) {
+			c.Next()
+			return
+		}
+
+		forbid(c, logger, "permission", permission)
+	}
+}
+
+// @Summary Verified email middleware
+// @Description Lets through users who verified their email, must run after AuthMiddleware
+func RequireVerifiedEmail(verification *EmailVerificationService, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		verified, err := verification.IsVerified(c.Request.Context(), c.GetInt("user_id"))
+		if err != nil {
+			logger.Error("failed to check email verification",
+				"error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Verification check failed"})
+			c.Abort()
+			return
+		}
+		if !verified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email not verified"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// @Summary Two factor middleware
+// @Description Requires a two factor login from users whose roles need it, must run after AuthMiddleware
+func RequireMFA(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("mfa") {
+			c.Next()
+			return
+		}
+
+		for _, role := range ContextRoles(c) {
+			if role.RequiresMFA() {
+				username, _ := c.Get("username")
+				logger.Warn("two factor login required",
+					"username", username,
+					"role", role,
+					"client_ip", c.ClientIP())
+				c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication required"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func forbid(c *gin.Context, logger *slog.Logger, requirement string, value any) {
+	username, _ := c.Get("username")
+	logger.Warn("access denied",
+		"username", username,
+		requirement, value,
+		"client_ip", c.ClientIP())
+	c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+	c.Abort()
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"errors"
+)
+
+// MinorUnits is the number of minor units in one unit of the menu price.
+const MinorUnits = 100
+
+var (
+	ErrItemQuantityLimit = errors.New("too many items of one product")
+	ErrCartQuantityLimit = errors.New("too many items in the cart")
+)
+
+// CartLimits limits the quantities a cart may hold.
+type CartLimits struct {
+	// MaxItemQuantity limits the quantity of a single product, 0 means no limit.
+	MaxItemQuantity int
+	// MaxCartQuantity limits the quantity of all products together, 0 means
+	// no limit.
+	MaxCartQuantity int
+}
+
+type DeliveryPricing struct {
+	// Fee is charged for every order in minor units.
+	Fee int64
+	// FreeFrom waives the fee once the subtotal reaches it, 0 disables it.
+	FreeFrom int64
+}
+
+// CartPricer checks cart limits and prices carts from the current menu.
+type CartPricer struct {
+	menu     *MenuService
+	limits   CartLimits
+	delivery DeliveryPricing
+}
+
+func NewCartPricer(menu *MenuService, limits CartLimits, delivery DeliveryPricing) *CartPricer {
+	return &CartPricer{menu: menu, limits: limits, delivery: delivery}
+}
+
+// CheckQuantity reports whether the cart may hold quantity of productID,
+// replacing the quantity already there.
+func (l CartLimits) CheckQuantity(cart []models.CartItem, productID, quantity int) error {
+	if quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+	if l.MaxItemQuantity > 0 && quantity > l.MaxItemQuantity {
+		return ErrItemQuantityLimit
+	}
+
+	total := quantity
+	for _, item := range cart {
+		if item.ProductID != productID {
+			total += item.Quantity
+		}
+	}
+	if l.MaxCartQuantity > 0 && total > l.MaxCartQuantity {
+		return ErrCartQuantityLimit
+	}
+
+	return nil
+}
+
+// Clamp returns the most of productID, up to quantity, the cart may hold
+// replacing the quantity already there. It is 0 when the cart is full.
+func (l CartLimits) Clamp(cart []models.CartItem, productID, quantity int) int {
+	if l.MaxItemQuantity > 0 {
+		quantity = min(quantity, l.MaxItemQuantity)
+	}
+	if l.MaxCartQuantity > 0 {
+		others := 0
+		for _, item := range cart {
+			if item.ProductID != productID {
+				others += item.Quantity
+			}
+		}
+		quantity = max(min(quantity, l.MaxCartQuantity-others), 0)
+	}
+	return quantity
+}
+
+// CheckAdd is CheckQuantity for adding quantity on top of what is in the cart.
+func (l CartLimits) CheckAdd(cart []models.CartItem, item models.CartItem) error {
+	if item.Quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+
+	quantity := item.Quantity
+	for _, existing := range cart {
+		if existing.ProductID == item.ProductID {
+			quantity += existing.Quantity
+		}
+	}
+	return l.CheckQuantity(cart, item.ProductID, quantity)
+}
+
+// CheckQuantity checks the cart against the limits of the pricer, see
+// CartLimits.CheckQuantity. The cart services check adds and quantity
+// changes themselves.
+func (p *CartPricer) CheckQuantity(cart []models.CartItem, productID, quantity int) error {
+	return p.limits.CheckQuantity(cart, productID, quantity)
+}
+
+// CheckAdd is CartLimits.CheckAdd with the limits of the pricer.
+func (p *CartPricer) CheckAdd(cart []models.CartItem, item models.CartItem) error {
+	return p.limits.CheckAdd(cart, item)
+}
+
+// Price looks every item up in the menu and computes the totals. Products that
+// were removed or are not available right now are marked unavailable.
+func (p *CartPricer) Price(ctx context.Context, cart []models.CartItem) (*models.PricedCart, error) {
+	priced := &models.PricedCart{
+		Items:     make([]models.PricedCartLine, 0, len(cart)),
+		Discounts: []models.CartDiscount{},
+	}
+
+	// The menu is loaded once for the whole cart.
+	products, categories, err := p.menu.productsByID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := p.menu.Now().In(p.menu.location)
+
+	for _, item := range cart {
+		line := models.PricedCartLine{ProductID: item.ProductID, Quantity: item.Quantity}
+
+		product, ok := products[item.ProductID]
+		if !ok || !isOrderable(now, product, categories) {
+			line.Unavailable = true
+		}
+
+		if ok {
+			line.Name = product.Name
+			line.CategoryID = product.CategoryID
+			line.UnitPrice = int64(product.Price) * MinorUnits
+			line.LineTotal = line.UnitPrice * int64(item.Quantity)
+		}
+		if !line.Unavailable {
+			priced.Subtotal += line.LineTotal
+		}
+
+		priced.Items = append(priced.Items, line)
+	}
+
+	if priced.Subtotal > 0 {
+		priced.DeliveryFee = p.delivery.Fee
+		if p.delivery.FreeFrom > 0 && priced.Subtotal >= p.delivery.FreeFrom {
+			priced.DeliveryFee = 0
+		}
+	}
+
+	totalCart(priced)
+	return priced, nil
+}
+
+// totalCart sums the discounts and computes the grand total. Discounts never
+// take the total below zero.
+func totalCart(priced *models.PricedCart) {
+	priced.Discount = 0
+	for _, d := range priced.Discounts {
+		priced.Discount += d.Amount
+	}
+	if limit := priced.Subtotal + priced.DeliveryFee; priced.Discount > limit {
+		priced.Discount = limit
+	}
+
+	priced.Total = priced.Subtotal - priced.Discount + priced.DeliveryFee
+}
@@ -0,0 +1,648 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const CartTTL = 30 * 24 * time.Hour
+
+var ErrInvalidQuantity = errors.New("quantity must be positive")
+
+// cartLimitsLua defines the limit helpers for the cart scripts, the item
+// limit is ARGV[1] and the cart limit ARGV[2], 0 disables a limit.
+// clampQuantity returns the most of product, up to quantity, the cart hash
+// key may hold. checkLimits returns -1 when quantity breaks the item limit
+// and -2 when it breaks the cart limit.
+const cartLimitsLua = `
+local maxItem, maxCart = tonumber(ARGV[1]), tonumber(ARGV[2])
+local function clampQuantity(key, product, quantity)
+	if maxItem > 0 and quantity > maxItem then
+		quantity = maxItem
+	end
+	if maxCart > 0 then
+		local others = 0
+		local items = redis.call('HGETALL', key)
+		for i = 1, #items, 2 do
+			if items[i] ~= product then
+				others = others + tonumber(items[i + 1])
+			end
+		end
+		if others + quantity > maxCart then
+			quantity = math.max(maxCart - others, 0)
+		end
+	end
+	return quantity
+end
+local function checkLimits(key, product, quantity)
+	if maxItem > 0 and quantity > maxItem then
+		return -1
+	end
+	if clampQuantity(key, product, quantity) < quantity then
+		return -2
+	end
+	return 0
+end
+`
+
+// addToCartScript increments product ARGV[3] of the cart hash by ARGV[4]
+// within the limits and refreshes the cart TTL ARGV[5] in one step, so
+// concurrent adds never overwrite each other or add up past a limit.
+var addToCartScript = redis.NewScript(cartLimitsLua + `
+local quantity = tonumber(redis.call('HGET', KEYS[1], ARGV[3]) or '0') + tonumber(ARGV[4])
+local limited = checkLimits(KEYS[1], ARGV[3], quantity)
+if limited ~= 0 then
+	return limited
+end
+redis.call('HSET', KEYS[1], ARGV[3], quantity)
+redis.call('EXPIRE', KEYS[1], ARGV[5])
+return quantity
+`)
+
+// setQuantityScript is addToCartScript setting the exact quantity.
+var setQuantityScript = redis.NewScript(cartLimitsLua + `
+local limited = checkLimits(KEYS[1], ARGV[3], tonumber(ARGV[4]))
+if limited ~= 0 then
+	return limited
+end
+redis.call('HSET', KEYS[1], ARGV[3], ARGV[4])
+redis.call('EXPIRE', KEYS[1], ARGV[5])
+return tonumber(ARGV[4])
+`)
+
+// mergeCartsScript copies the guest cart hash KEYS[1] into the user cart hash
+// KEYS[2] using the strategy from ARGV[3], then deletes the guest cart.
+// Merged quantities are cut down to the limits, the user's own quantities
+// are kept. The guest promo code moves over unless the user cart already has
+// one.
+var mergeCartsScript = redis.NewScript(cartLimitsLua + `
+local guest = redis.call('HGETALL', KEYS[1])
+for i = 1, #guest, 2 do
+	local current = tonumber(redis.call('HGET', KEYS[2], guest[i]) or '0')
+	local quantity = tonumber(guest[i + 1])
+	if ARGV[3] == 'max' then
+		quantity = math.max(quantity, current)
+	else
+		quantity = quantity + current
+	end
+	quantity = clampQuantity(KEYS[2], guest[i], quantity)
+	if quantity > current then
+		redis.call('HSET', KEYS[2], guest[i], quantity)
+	end
+end
+redis.call('DEL', KEYS[1])
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	redis.call('EXPIRE', KEYS[2], ARGV[4])
+end
+local promo = redis.call('GET', KEYS[3])
+if promo and redis.call('EXISTS', KEYS[4]) == 0 then
+	redis.call('SET', KEYS[4], promo, 'EX', ARGV[4])
+end
+redis.call('DEL', KEYS[3])
+return #guest / 2
+`)
+
+// removeOrderedScript takes the quantities in ARGV[2..] product, quantity
+// pairs out of the cart hash and deletes the promo code when it is still
+// ARGV[1]. It returns how many products are left.
+var removeOrderedScript = redis.NewScript(`
+for i = 2, #ARGV, 2 do
+	local left = redis.call('HINCRBY', KEYS[1], ARGV[i], -tonumber(ARGV[i + 1]))
+	if left <= 0 then
+		redis.call('HDEL', KEYS[1], ARGV[i])
+	end
+end
+if ARGV[1] ~= '' and redis.call('GET', KEYS[2]) == ARGV[1] then
+	redis.call('DEL', KEYS[2])
+end
+return redis.call('HLEN', KEYS[1])
+`)
+
+// forgetIdleCartScript removes the cart from cart:modified, and its
+// reminder with it, unless the cart was changed after ARGV[2].
+var forgetIdleCartScript = redis.NewScript(`
+local modified = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not modified or tonumber(modified) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('DEL', KEYS[2])
+return 1
+`)
+
+// RedisCartService keeps every cart as a Redis hash of product id to
+// quantity under cart:items:<cartID>. Change times of user carts are kept in
+// the cart:modified sorted set for abandoned cart reminders, a reminded cart
+// has a cart:reminded:<cartID> key that lives as long as the cart.
+type RedisCartService struct {
+	client redis.Cmdable
+	limits CartLimits
+	ttl    time.Duration
+}
+
+var _ ports.CartService = (*RedisCartService)(nil)
+
+// NewRedisCartService returns the service. Adds and quantity changes that
+// break the limits fail with ErrItemQuantityLimit or ErrCartQuantityLimit.
+func NewRedisCartService(client redis.Cmdable, limits CartLimits) *RedisCartService {
+	return &RedisCartService{client: client, limits: limits, ttl: CartTTL}
+}
+
+func (s *RedisCartService) key(cartID string) string {
+	return "cart:items:" + cartID
+}
+
+func (s *RedisCartService) promoKey(cartID string) string {
+	return "cart:promo:" + cartID
+}
+
+func (s *RedisCartService) remindedKey(cartID string) string {
+	return "cart:reminded:" + cartID
+}
+
+const cartModifiedKey = "cart:modified"
+
+// touch records the change time of a user cart, guest carts are not tracked.
+// The reminder is kept as long as the cart, so it expires with it.
+func (s *RedisCartService) touch(cartID string, err error) error {
+	if err != nil || !isUserCart(cartID) {
+		return err
+	}
+	_, err = s.client.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(cartModifiedKey, redis.Z{Score: float64(time.Now().Unix()), Member: cartID})
+		pipe.Expire(s.remindedKey(cartID), s.ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisCartService) GetCart(ctx context.Context, cartID string) ([]models.CartItem, error) {
+	fields, err := s.client.HGetAll(s.key(cartID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cart := make([]models.CartItem, 0, len(fields))
+	for field, value := range fields {
+		productID, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		quantity, err := strconv.Atoi(value)
+		if err != nil || quantity <= 0 {
+			continue
+		}
+		cart = append(cart, models.CartItem{ProductID: productID, Quantity: quantity})
+	}
+
+	sortCart(cart)
+	return cart, nil
+}
+
+func (s *RedisCartService) AddToCart(ctx context.Context, cartID string, item models.CartItem) error {
+	if item.Quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+
+	return s.touch(cartID, s.runLimited(addToCartScript, cartID, item.ProductID, item.Quantity))
+}
+
+// runLimited runs a cart script taking the limits and turns its limit codes
+// into errors.
+func (s *RedisCartService) runLimited(script *redis.Script, cartID string, productID, quantity int) error {
+	result, err := script.Run(s.client, []string{s.key(cartID)},
+		s.limits.MaxItemQuantity, s.limits.MaxCartQuantity, strconv.Itoa(productID), quantity, int(s.ttl.Seconds())).Int64()
+	switch {
+	case err != nil:
+		return err
+	case result == -1:
+		return ErrItemQuantityLimit
+	case result == -2:
+		return ErrCartQuantityLimit
+	}
+	return nil
+}
+
+func (s *RedisCartService) RemoveFromCart(ctx context.Context, cartID string, productID int) error {
+	return s.touch(cartID, s.client.HDel(s.key(cartID), strconv.Itoa(productID)).Err())
+}
+
+func (s *RedisCartService) SetQuantity(ctx context.Context, cartID string, productID, quantity int) error {
+	if quantity < 0 {
+		return ErrInvalidQuantity
+	}
+	if quantity == 0 {
+		return s.RemoveFromCart(ctx, cartID, productID)
+	}
+
+	return s.touch(cartID, s.runLimited(setQuantityScript, cartID, productID, quantity))
+}
+
+func (s *RedisCartService) ClearCart(ctx context.Context, cartID string) error {
+	_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(s.key(cartID), s.promoKey(cartID), s.remindedKey(cartID))
+		pipe.ZRem(cartModifiedKey, cartID)
+		return nil
+	})
+	return err
+}
+
+// RemoveOrdered clears the cart like ClearCart when nothing else is left in
+// it, items left over count as a new change for reminders.
+func (s *RedisCartService) RemoveOrdered(ctx context.Context, cartID string, items []models.CartItem, promoCode string) error {
+	args := make([]interface{}, 0, 1+2*len(items))
+	args = append(args, promoCode)
+	for _, item := range items {
+		args = append(args, strconv.Itoa(item.ProductID), item.Quantity)
+	}
+
+	left, err := removeOrderedScript.Run(s.client, []string{s.key(cartID), s.promoKey(cartID)}, args...).Int64()
+	if err != nil {
+		return err
+	}
+	if left == 0 {
+		_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.ZRem(cartModifiedKey, cartID)
+			pipe.Del(s.remindedKey(cartID))
+			return nil
+		})
+		return err
+	}
+	return s.touch(cartID, s.client.Del(s.remindedKey(cartID)).Err())
+}
+
+func (s *RedisCartService) SetPromoCode(ctx context.Context, cartID, code string) error {
+	if code == "" {
+		return s.touch(cartID, s.client.Del(s.promoKey(cartID)).Err())
+	}
+	return s.touch(cartID, s.client.Set(s.promoKey(cartID), code, s.ttl).Err())
+}
+
+func (s *RedisCartService) GetPromoCode(ctx context.Context, cartID string) (string, error) {
+	code, err := s.client.Get(s.promoKey(cartID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return code, err
+}
+
+func (s *RedisCartService) ReplaceCart(ctx context.Context, cartID string, items []models.CartItem) error {
+	fields := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return ErrInvalidQuantity
+		}
+		fields[strconv.Itoa(item.ProductID)] = item.Quantity
+	}
+
+	_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(s.key(cartID))
+		if len(fields) > 0 {
+			pipe.HMSet(s.key(cartID), fields)
+			pipe.Expire(s.key(cartID), s.ttl)
+		}
+		return nil
+	})
+	return s.touch(cartID, err)
+}
+
+func (s *RedisCartService) MergeCarts(ctx context.Context, fromCartID, toCartID string, strategy models.CartMergeStrategy) error {
+	if fromCartID == toCartID {
+		return nil
+	}
+
+	return s.touch(toCartID, mergeCartsScript.Run(s.client, []string{s.key(fromCartID), s.key(toCartID), s.promoKey(fromCartID), s.promoKey(toCartID)},
+		s.limits.MaxItemQuantity, s.limits.MaxCartQuantity, string(strategy), int(s.ttl.Seconds())).Err())
+}
+
+func (s *RedisCartService) IdleCarts(ctx context.Context, before time.Time) ([]string, error) {
+	cartIDs, err := s.client.ZRangeByScore(cartModifiedKey, redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(before.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	idle := make([]string, 0, len(cartIDs))
+	for _, cartID := range cartIDs {
+		reminded, err := s.client.Exists(s.remindedKey(cartID)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if reminded == 0 {
+			idle = append(idle, cartID)
+		}
+	}
+	return idle, nil
+}
+
+func (s *RedisCartService) MarkReminded(ctx context.Context, cartID string) (bool, error) {
+	return s.client.SetNX(s.remindedKey(cartID), 1, s.ttl).Result()
+}
+
+func (s *RedisCartService) ForgetIdleCart(ctx context.Context, cartID string, before time.Time) error {
+	return forgetIdleCartScript.Run(s.client, []string{cartModifiedKey, s.remindedKey(cartID)},
+		cartID, before.Unix()).Err()
+}
+
+// InMemoryCartService keeps carts in process memory. It is meant for tests
+// and local runs without Redis, carts do not expire.
+type InMemoryCartService struct {
+	mu       sync.Mutex
+	carts    map[string]map[int]int
+	promos   map[string]string
+	modified map[string]time.Time
+	reminded map[string]bool
+	limits   CartLimits
+
+	// Now stamps cart changes, time.Now by default.
+	Now func() time.Time
+}
+
+var _ ports.CartService = (*InMemoryCartService)(nil)
+
+// NewInMemoryCartService returns the service, adds and quantity changes are
+// checked against limits like in NewRedisCartService.
+func NewInMemoryCartService(limits CartLimits) *InMemoryCartService {
+	return &InMemoryCartService{
+		limits:   limits,
+		carts:    make(map[string]map[int]int),
+		promos:   make(map[string]string),
+		modified: make(map[string]time.Time),
+		reminded: make(map[string]bool),
+		Now:      time.Now,
+	}
+}
+
+// touch records the change time of a user cart, the caller holds mu.
+func (s *InMemoryCartService) touch(cartID string) {
+	if isUserCart(cartID) {
+		s.modified[cartID] = s.Now()
+	}
+}
+
+func (s *InMemoryCartService) GetCart(ctx context.Context, cartID string) ([]models.CartItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.items(cartID), nil
+}
+
+// items returns the items of the cart, the caller holds mu.
+func (s *InMemoryCartService) items(cartID string) []models.CartItem {
+	cart := make([]models.CartItem, 0, len(s.carts[cartID]))
+	for productID, quantity := range s.carts[cartID] {
+		cart = append(cart, models.CartItem{ProductID: productID, Quantity: quantity})
+	}
+
+	sortCart(cart)
+	return cart
+}
+
+func (s *InMemoryCartService) AddToCart(ctx context.Context, cartID string, item models.CartItem) error {
+	if item.Quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.limits.CheckAdd(s.items(cartID), item); err != nil {
+		return err
+	}
+
+	if s.carts[cartID] == nil {
+		s.carts[cartID] = make(map[int]int)
+	}
+	s.carts[cartID][item.ProductID] += item.Quantity
+	s.touch(cartID)
+
+	return nil
+}
+
+func (s *InMemoryCartService) RemoveFromCart(ctx context.Context, cartID string, productID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.carts[cartID], productID)
+	s.touch(cartID)
+	return nil
+}
+
+func (s *InMemoryCartService) SetQuantity(ctx context.Context, cartID string, productID, quantity int) error {
+	if quantity < 0 {
+		return ErrInvalidQuantity
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if quantity == 0 {
+		delete(s.carts[cartID], productID)
+		s.touch(cartID)
+		return nil
+	}
+
+	if err := s.limits.CheckQuantity(s.items(cartID), productID, quantity); err != nil {
+		return err
+	}
+
+	if s.carts[cartID] == nil {
+		s.carts[cartID] = make(map[int]int)
+	}
+	s.carts[cartID][productID] = quantity
+	s.touch(cartID)
+
+	return nil
+}
+
+func (s *InMemoryCartService) ClearCart(ctx context.Context, cartID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.carts, cartID)
+	delete(s.promos, cartID)
+	delete(s.modified, cartID)
+	delete(s.reminded, cartID)
+	return nil
+}
+
+func (s *InMemoryCartService) RemoveOrdered(ctx context.Context, cartID string, items []models.CartItem, promoCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, item := range items {
+		if left := s.carts[cartID][item.ProductID] - item.Quantity; left > 0 {
+			s.carts[cartID][item.ProductID] = left
+		} else {
+			delete(s.carts[cartID], item.ProductID)
+		}
+	}
+	if promoCode != "" && s.promos[cartID] == promoCode {
+		delete(s.promos, cartID)
+	}
+
+	delete(s.reminded, cartID)
+	if len(s.carts[cartID]) == 0 {
+		delete(s.carts, cartID)
+		delete(s.modified, cartID)
+		return nil
+	}
+	s.touch(cartID)
+	return nil
+}
+
+func (s *InMemoryCartService) SetPromoCode(ctx context.Context, cartID, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if code == "" {
+		delete(s.promos, cartID)
+	} else {
+		s.promos[cartID] = code
+	}
+	s.touch(cartID)
+	return nil
+}
+
+func (s *InMemoryCartService) GetPromoCode(ctx context.Context, cartID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.promos[cartID], nil
+}
+
+func (s *InMemoryCartService) ReplaceCart(ctx context.Context, cartID string, items []models.CartItem) error {
+	cart := make(map[int]int, len(items))
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return ErrInvalidQuantity
+		}
+		cart[item.ProductID] = item.Quantity
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.carts[cartID] = cart
+	s.touch(cartID)
+	return nil
+}
+
+func (s *InMemoryCartService) MergeCarts(ctx context.Context, fromCartID, toCartID string, strategy models.CartMergeStrategy) error {
+	if fromCartID == toCartID {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if promo, ok := s.promos[fromCartID]; ok {
+		if _, exists := s.promos[toCartID]; !exists {
+			s.promos[toCartID] = promo
+		}
+		delete(s.promos, fromCartID)
+	}
+
+	guest := s.carts[fromCartID]
+	if len(guest) == 0 {
+		return nil
+	}
+
+	if s.carts[toCartID] == nil {
+		s.carts[toCartID] = make(map[int]int)
+	}
+	for _, item := range s.items(fromCartID) {
+		current := s.carts[toCartID][item.ProductID]
+		merged := s.limits.Clamp(s.items(toCartID), item.ProductID, strategy.Merge(current, item.Quantity))
+		if merged > current {
+			s.carts[toCartID][item.ProductID] = merged
+		}
+	}
+	delete(s.carts, fromCartID)
+	s.touch(toCartID)
+
+	return nil
+}
+
+func (s *InMemoryCartService) IdleCarts(ctx context.Context, before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var idle []string
+	for cartID, modified := range s.modified {
+		if modified.Before(before) && !s.reminded[cartID] {
+			idle = append(idle, cartID)
+		}
+	}
+	sort.Strings(idle)
+	return idle, nil
+}
+
+func (s *InMemoryCartService) MarkReminded(ctx context.Context, cartID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reminded[cartID] {
+		return false, nil
+	}
+	s.reminded[cartID] = true
+	return true, nil
+}
+
+func (s *InMemoryCartService) ForgetIdleCart(ctx context.Context, cartID string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if modified, ok := s.modified[cartID]; ok && modified.Before(before) {
+		delete(s.modified, cartID)
+		delete(s.reminded, cartID)
+	}
+	return nil
+}
+
+// UserCartID and SessionCartID build the ids carts are stored under.
+func UserCartID(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// NewCartSessionID returns a random id for the cart_session cookie of a
+// guest. Guessing it gives access to the guest's cart, and it is merged into
+// the user cart on login.
+func NewCartSessionID() (string, error) {
+	return newRandomToken(32)
+}
+
+func SessionCartID(sessionID string) string {
+	return "session:" + sessionID
+}
+
+// ParseUserCartID returns the user id of a UserCartID.
+func ParseUserCartID(cartID string) (int, bool) {
+	id, err := strconv.Atoi(strings.TrimPrefix(cartID, "user:"))
+	if err != nil || !isUserCart(cartID) {
+		return 0, false
+	}
+	return id, true
+}
+
+func isUserCart(cartID string) bool {
+	return strings.HasPrefix(cartID, "user:")
+}
+
+func sortCart(cart []models.CartItem) {
+	sort.Slice(cart, func(i, j int) bool {
+		return cart[i].ProductID < cart[j].ProductID
+	})
+}
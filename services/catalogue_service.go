@@ -0,0 +1,551 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var csvHeader = []string{
+	"kind", "id", "name", "slug", "sortOrder", "icon", "visible",
+	"price", "count", "type", "category", "allergens", "tags",
+	"servingSize", "calories", "protein", "fat", "carbohydrates", "sugar", "salt", "availability",
+}
+
+const (
+	csvKindProduct  = "product"
+	csvKindCategory = "category"
+)
+
+// CatalogueService exports the whole menu and imports it back, e.g. from the
+// spreadsheet the marketing team keeps. Names in the catalogue are in the
+// default locale.
+type CatalogueService struct {
+	repo          *repositories.ProductRerository
+	categories    *repositories.CategoryRepository
+	defaultLocale string
+}
+
+func NewCatalogueService(repo *repositories.ProductRerository, categories *repositories.CategoryRepository, defaultLocale string) *CatalogueService {
+	return &CatalogueService{repo: repo, categories: categories, defaultLocale: defaultLocale}
+}
+
+func (s *CatalogueService) Export(ctx context.Context) (*models.Catalogue, error) {
+	products, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.categories.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Catalogue{Categories: categories, Products: products}, nil
+}
+
+// Import validates the catalogue and compares it with the current menu.
+// Products missing from the catalogue are deleted, and so are categories
+// unless the catalogue has no categories at all, which leaves them as they
+// are. Nothing is written when dryRun is set or any row is invalid, including
+// the parseErrors found while reading the file, otherwise all changes are
+// applied in one transaction.
+func (s *CatalogueService) Import(ctx context.Context, catalogue *models.Catalogue, parseErrors []models.ImportError, dryRun bool) (*models.ImportReport, error) {
+	report := &models.ImportReport{
+		DryRun:            dryRun,
+		Created:           []string{},
+		Updated:           []string{},
+		Deleted:           []string{},
+		Errors:            append([]models.ImportError{}, parseErrors...),
+		CategoriesCreated: []string{},
+		CategoriesUpdated: []string{},
+		CategoriesDeleted: []string{},
+	}
+
+	currentCategories, err := s.categories.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := repositories.CatalogueChanges{Locale: s.defaultLocale}
+
+	categoryIDs := make(map[int]bool)
+	if catalogue.Categories == nil {
+		for _, c := range currentCategories {
+			categoryIDs[c.ID] = true
+		}
+	} else {
+		s.planCategories(catalogue, currentCategories, len(parseErrors) == 0, report, &changes, categoryIDs)
+	}
+
+	current, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[int]models.Product, len(current))
+	for _, p := range current {
+		existing[p.ID] = p
+	}
+
+	seen := make(map[int]int)
+	for i, p := range catalogue.Products {
+		row := catalogue.ProductRow(i)
+		// The id is recorded before the row is checked, a product in an
+		// invalid row is reported as an error and not as deleted.
+		if p.ID != 0 {
+			if first, ok := seen[p.ID]; ok {
+				report.Errors = append(report.Errors, models.ImportError{Row: row, Field: "id",
+					Message: fmt.Sprintf("duplicate id %d, first used in row %d", p.ID, first)})
+				continue
+			}
+			seen[p.ID] = row
+		}
+
+		if err := p.Validate(); err != nil {
+			report.Errors = append(report.Errors, models.ImportError{Row: row, Message: err.Error()})
+			continue
+		}
+
+		if !categoryIDs[p.CategoryID] {
+			report.Errors = append(report.Errors, models.ImportError{Row: row, Field: "category",
+				Message: fmt.Sprintf("unknown category %d", p.CategoryID)})
+			continue
+		}
+
+		if p.ID == 0 {
+			changes.CreateProducts = append(changes.CreateProducts, p)
+			report.Created = append(report.Created, p.Name)
+			continue
+		}
+
+		old, ok := existing[p.ID]
+		if !ok {
+			report.Errors = append(report.Errors, models.ImportError{Row: row, Field: "id",
+				Message: fmt.Sprintf("unknown product id %d", p.ID)})
+			continue
+		}
+
+		if sameProduct(old, p) {
+			report.Unchanged++
+			continue
+		}
+		changes.UpdateProducts = append(changes.UpdateProducts, p)
+		report.Updated = append(report.Updated, p.Name)
+	}
+
+	// Rows that failed to parse are missing from the catalogue, what they
+	// would delete is unknown until they are fixed.
+	if len(parseErrors) == 0 {
+		for _, p := range current {
+			if _, ok := seen[p.ID]; !ok {
+				changes.DeleteProducts = append(changes.DeleteProducts, p.ID)
+				report.Deleted = append(report.Deleted, p.Name)
+			}
+		}
+	}
+
+	if dryRun || len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	if err := s.repo.ApplyCatalogue(ctx, changes); err != nil {
+		return nil, err
+	}
+	report.Applied = true
+
+	return report, nil
+}
+
+// planCategories compares the imported categories with the current ones and
+// fills ids with the category ids products may refer to after the import.
+// A category given with an id that does not exist yet is created with it.
+// Missing categories are deleted only when deleteMissing is set.
+func (s *CatalogueService) planCategories(catalogue *models.Catalogue, current []models.Category, deleteMissing bool,
+	report *models.ImportReport, changes *repositories.CatalogueChanges, ids map[int]bool) {
+	existing := make(map[int]models.Category, len(current))
+	for _, c := range current {
+		existing[c.ID] = c
+	}
+
+	seenIDs := make(map[int]int)
+	seenSlugs := make(map[string]int)
+	for i, c := range catalogue.Categories {
+		row := catalogue.CategoryRow(i)
+		// Like products, the id is recorded before the row is checked so
+		// an invalid row is not reported as deleted.
+		if c.ID != 0 {
+			if first, ok := seenIDs[c.ID]; ok {
+				report.Errors = append(report.Errors, models.ImportError{Row: row, Field: "id",
+					Message: fmt.Sprintf("duplicate category id %d, first used in row %d", c.ID, first)})
+				continue
+			}
+			seenIDs[c.ID] = row
+		}
+
+		if err := c.Validate(); err != nil {
+			report.Errors = append(report.Errors, models.ImportError{Row: row, Field: "categories", Message: err.Error()})
+			continue
+		}
+
+		if first, ok := seenSlugs[c.Slug]; ok {
+			report.Errors = append(report.Errors, models.ImportError{Row: row, Field: "slug",
+				Message: fmt.Sprintf("duplicate slug %q, first used in row %d", c.Slug, first)})
+			continue
+		}
+		seenSlugs[c.Slug] = row
+
+		if c.ID == 0 {
+			changes.CreateCategories = append(changes.CreateCategories, c)
+			report.CategoriesCreated = append(report.CategoriesCreated, c.Name)
+			continue
+		}
+		ids[c.ID] = true
+
+		old, ok := existing[c.ID]
+		switch {
+		case !ok:
+			changes.CreateCategories = append(changes.CreateCategories, c)
+			report.CategoriesCreated = append(report.CategoriesCreated, c.Name)
+		case sameCategory(old, c):
+			report.CategoriesUnchanged++
+		default:
+			changes.UpdateCategories = append(changes.UpdateCategories, c)
+			report.CategoriesUpdated = append(report.CategoriesUpdated, c.Name)
+		}
+	}
+
+	if !deleteMissing {
+		return
+	}
+	for _, c := range current {
+		if _, ok := seenIDs[c.ID]; !ok {
+			changes.DeleteCategories = append(changes.DeleteCategories, c.ID)
+			report.CategoriesDeleted = append(report.CategoriesDeleted, c.Name)
+		}
+	}
+}
+
+func sameCategory(a, b models.Category) bool {
+	return a.Name == b.Name && a.Slug == b.Slug && a.SortOrder == b.SortOrder && a.Icon == b.Icon &&
+		a.Visible == b.Visible && formatWindows(a.Availability) == formatWindows(b.Availability)
+}
+
+func sameProduct(a, b models.Product) bool {
+	return reflect.DeepEqual(canonicalProduct(a), canonicalProduct(b)) &&
+		formatWindows(a.Availability) == formatWindows(b.Availability)
+}
+
+// canonicalProduct drops the fields an import does not carry and sorts the
+// lists so two products can be compared with reflect.DeepEqual.
+func canonicalProduct(p models.Product) models.Product {
+	p.Description = ""
+	p.Availability = nil
+
+	p.Allergens = append([]models.Allergen(nil), p.Allergens...)
+	sort.Slice(p.Allergens, func(i, j int) bool { return p.Allergens[i] < p.Allergens[j] })
+	p.Tags = append([]models.DietaryTag(nil), p.Tags...)
+	sort.Slice(p.Tags, func(i, j int) bool { return p.Tags[i] < p.Tags[j] })
+
+	if len(p.Allergens) == 0 {
+		p.Allergens = nil
+	}
+	if len(p.Tags) == 0 {
+		p.Tags = nil
+	}
+	if p.Nutrition != nil && *p.Nutrition == (models.Nutrition{}) {
+		p.Nutrition = nil
+	}
+
+	return p
+}
+
+func WriteCatalogueJSON(w io.Writer, catalogue *models.Catalogue) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(catalogue)
+}
+
+func ReadCatalogueJSON(r io.Reader) (*models.Catalogue, error) {
+	var catalogue models.Catalogue
+	if err := json.NewDecoder(r).Decode(&catalogue); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return &catalogue, nil
+}
+
+// WriteCatalogueCSV writes one row per category followed by one row per
+// product. Lists are comma separated, several availability windows are
+// separated with ";".
+func WriteCatalogueCSV(w io.Writer, catalogue *models.Catalogue) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, c := range catalogue.Categories {
+		record := csvRecord(map[string]string{
+			"kind":         csvKindCategory,
+			"id":           strconv.Itoa(c.ID),
+			"name":         c.Name,
+			"slug":         c.Slug,
+			"sortOrder":    strconv.Itoa(c.SortOrder),
+			"icon":         c.Icon,
+			"visible":      strconv.FormatBool(c.Visible),
+			"availability": formatWindows(c.Availability),
+		})
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range catalogue.Products {
+		fields := map[string]string{
+			"kind":         csvKindProduct,
+			"id":           strconv.Itoa(p.ID),
+			"name":         p.Name,
+			"price":        strconv.Itoa(p.Price),
+			"count":        strconv.Itoa(p.Count),
+			"type":         strconv.Itoa(int(p.Type)),
+			"category":     strconv.Itoa(p.CategoryID),
+			"allergens":    joinStrings(p.Allergens),
+			"tags":         joinStrings(p.Tags),
+			"availability": formatWindows(p.Availability),
+		}
+
+		if n := p.Nutrition; n != nil {
+			fields["servingSize"] = strconv.Itoa(n.ServingSize)
+			fields["calories"] = strconv.Itoa(n.Calories)
+			fields["protein"] = formatFloat(n.Protein)
+			fields["fat"] = formatFloat(n.Fat)
+			fields["carbohydrates"] = formatFloat(n.Carbohydrates)
+			fields["sugar"] = formatFloat(n.Sugar)
+			fields["salt"] = formatFloat(n.Salt)
+		}
+
+		if err := writer.Write(csvRecord(fields)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvRecord(fields map[string]string) []string {
+	record := make([]string, len(csvHeader))
+	for i, name := range csvHeader {
+		record[i] = fields[name]
+	}
+	return record
+}
+
+// ReadCatalogueCSV parses the format written by WriteCatalogueCSV. Row level
+// problems are returned as import errors so they can be reported together.
+func ReadCatalogueCSV(r io.Reader) (*models.Catalogue, []models.ImportError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(csvHeader)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+	for i := range csvHeader {
+		if strings.TrimSpace(header[i]) != csvHeader[i] {
+			return nil, nil, fmt.Errorf("invalid CSV header: column %d must be %q", i+1, csvHeader[i])
+		}
+	}
+
+	catalogue := &models.Catalogue{}
+	var rowErrors []models.ImportError
+	row := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			rowErrors = append(rowErrors, models.ImportError{Row: row, Message: err.Error()})
+			continue
+		}
+
+		field := func(name string) string {
+			for i, h := range csvHeader {
+				if h == name {
+					return strings.TrimSpace(record[i])
+				}
+			}
+			return ""
+		}
+		fail := func(name string, err error) {
+			rowErrors = append(rowErrors, models.ImportError{Row: row, Field: name, Message: err.Error()})
+		}
+		// parseInts fills the targets from the named columns, optional ones
+		// may be left empty.
+		parseInts := func(targets map[string]*int, optional ...string) bool {
+			for _, name := range csvHeader {
+				target, ok := targets[name]
+				if !ok {
+					continue
+				}
+				if field(name) == "" && slices.Contains(optional, name) {
+					continue
+				}
+				v, err := strconv.Atoi(field(name))
+				if err != nil {
+					fail(name, fmt.Errorf("must be an integer"))
+					return false
+				}
+				*target = v
+			}
+			return true
+		}
+
+		windows, err := parseWindows(field("availability"))
+		if err != nil {
+			fail("availability", err)
+			continue
+		}
+
+		switch field("kind") {
+		case csvKindCategory:
+			c := models.Category{Name: field("name"), Slug: field("slug"), Icon: field("icon"), Availability: windows}
+			if !parseInts(map[string]*int{"id": &c.ID, "sortOrder": &c.SortOrder}, "id", "sortOrder") {
+				continue
+			}
+
+			c.Visible = true
+			if field("visible") != "" {
+				if c.Visible, err = strconv.ParseBool(field("visible")); err != nil {
+					fail("visible", fmt.Errorf("must be true or false"))
+					continue
+				}
+			}
+
+			catalogue.Categories = append(catalogue.Categories, c)
+			catalogue.CategoryRows = append(catalogue.CategoryRows, row)
+
+		case csvKindProduct:
+			p := models.Product{Name: field("name"), Availability: windows}
+			ints := map[string]*int{
+				"id":       &p.ID,
+				"price":    &p.Price,
+				"count":    &p.Count,
+				"type":     (*int)(&p.Type),
+				"category": &p.CategoryID,
+			}
+			if !parseInts(ints, "id") {
+				continue
+			}
+
+			for _, a := range splitList(field("allergens")) {
+				p.Allergens = append(p.Allergens, models.Allergen(a))
+			}
+			for _, t := range splitList(field("tags")) {
+				p.Tags = append(p.Tags, models.DietaryTag(t))
+			}
+
+			if field("calories") != "" {
+				n, err := parseNutrition(field)
+				if err != nil {
+					fail("nutrition", err)
+					continue
+				}
+				p.Nutrition = n
+			}
+
+			catalogue.Products = append(catalogue.Products, p)
+			catalogue.ProductRows = append(catalogue.ProductRows, row)
+
+		default:
+			fail("kind", fmt.Errorf("must be %q or %q", csvKindProduct, csvKindCategory))
+		}
+	}
+
+	return catalogue, rowErrors, nil
+}
+
+func parseNutrition(field func(string) string) (*models.Nutrition, error) {
+	var n models.Nutrition
+	var err error
+
+	if n.ServingSize, err = strconv.Atoi(field("servingSize")); err != nil {
+		return nil, fmt.Errorf("servingSize must be an integer")
+	}
+	if n.Calories, err = strconv.Atoi(field("calories")); err != nil {
+		return nil, fmt.Errorf("calories must be an integer")
+	}
+
+	floats := map[string]*float64{
+		"protein":       &n.Protein,
+		"fat":           &n.Fat,
+		"carbohydrates": &n.Carbohydrates,
+		"sugar":         &n.Sugar,
+		"salt":          &n.Salt,
+	}
+	for name, target := range floats {
+		if field(name) == "" {
+			continue
+		}
+		if *target, err = strconv.ParseFloat(field(name), 64); err != nil {
+			return nil, fmt.Errorf("%s must be a number", name)
+		}
+	}
+
+	return &n, nil
+}
+
+func parseWindows(raw string) ([]models.AvailabilityWindow, error) {
+	var windows []models.AvailabilityWindow
+	for _, part := range strings.Split(raw, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		w, err := models.ParseAvailabilityWindow(part)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func formatWindows(windows []models.AvailabilityWindow) string {
+	parts := make([]string, 0, len(windows))
+	for _, w := range windows {
+		parts = append(parts, w.String())
+	}
+	return strings.Join(parts, ";")
+}
+
+func joinStrings[T ~string](values []T) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, string(v))
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitList(raw string) []string {
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
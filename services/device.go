@@ -0,0 +1,53 @@
+package services
+
+import "strings"
+
+var (
+	deviceBrowsers = []struct{ token, name string }{
+		{"YaBrowser/", "Yandex Browser"},
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	deviceSystems = []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// DescribeDevice names the browser and system of a User-Agent for the
+// session list, like "Chrome on Windows". It is a hint for the user, not
+// a reliable fingerprint.
+func DescribeDevice(userAgent string) string {
+	var browser, system string
+	for _, b := range deviceBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range deviceSystems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
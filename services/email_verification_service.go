@@ -0,0 +1,161 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
+	"CartoonBurgers/repositories"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultEmailVerificationTTL = 48 * time.Hour
+	DefaultVerificationCooldown = time.Minute
+)
+
+var (
+	ErrVerificationTokenInvalid = repositories.ErrOneTimeTokenInvalid
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+	ErrVerificationThrottled    = errors.New("verification mail was sent recently")
+)
+
+// EmailVerificationService mails verification links to new accounts and
+// marks the email verified when a link is used.
+type EmailVerificationService struct {
+	users     *repositories.UserRepository
+	tokens    *repositories.OneTimeTokenRepository
+	mailer    ports.Mailer
+	verifyURL string
+	ttl       time.Duration
+	cooldown  time.Duration
+	logger    *slog.Logger
+
+	// Now is used for token lifetimes and throttling, time.Now by default.
+	Now func() time.Time
+}
+
+// NewEmailVerificationService returns the service. The token is appended
+// to verifyURL as the token query parameter. Resend waits cooldown between
+// mails, zero durations fall back to the defaults.
+func NewEmailVerificationService(users *repositories.UserRepository, tokens *repositories.OneTimeTokenRepository, mailer ports.Mailer, verifyURL string, ttl, cooldown time.Duration, logger *slog.Logger) *EmailVerificationService {
+	if ttl <= 0 {
+		ttl = DefaultEmailVerificationTTL
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultVerificationCooldown
+	}
+	return &EmailVerificationService{
+		users:     users,
+		tokens:    tokens,
+		mailer:    mailer,
+		verifyURL: verifyURL,
+		ttl:       ttl,
+		cooldown:  cooldown,
+		logger:    logger,
+		Now:       time.Now,
+	}
+}
+
+// Send mails a new verification link to the user, earlier links stop
+// working.
+func (s *EmailVerificationService) Send(ctx context.Context, userID int) error {
+	user, err := s.users.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	return s.send(ctx, user)
+}
+
+// Resend is Send limited to one mail per cooldown. When throttled it
+// returns ErrVerificationThrottled and how long to wait.
+func (s *EmailVerificationService) Resend(ctx context.Context, userID int) (time.Duration, error) {
+	user, err := s.users.GetUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if user.EmailVerified {
+		return 0, ErrEmailAlreadyVerified
+	}
+
+	last, ok, err := s.tokens.LastOneTimeTokenAt(ctx, userID, models.TokenEmailVerification)
+	if err != nil {
+		return 0, err
+	}
+	if wait := last.Add(s.cooldown).Sub(s.Now()); ok && wait > 0 {
+		return wait, ErrVerificationThrottled
+	}
+
+	return 0, s.send(ctx, user)
+}
+
+// Verify marks the email of the user the token was mailed to as verified.
+func (s *EmailVerificationService) Verify(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrVerificationTokenInvalid
+	}
+
+	userID, err := s.tokens.UseOneTimeToken(ctx, models.TokenEmailVerification, hashToken(token), s.Now())
+	if err != nil {
+		return err
+	}
+	if err := s.users.SetEmailVerified(ctx, userID, s.Now()); err != nil {
+		return err
+	}
+
+	s.logger.Info("email verified", "user_id", userID)
+	return nil
+}
+
+// IsVerified reports whether the user verified their email, unknown users
+// are not.
+func (s *EmailVerificationService) IsVerified(ctx context.Context, userID int) (bool, error) {
+	user, err := s.users.GetUser(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerified, nil
+}
+
+func (s *EmailVerificationService) send(ctx context.Context, user *models.User) error {
+	token, err := newRandomToken(32)
+	if err != nil {
+		return err
+	}
+	now := s.Now()
+	if err := s.tokens.CreateOneTimeToken(ctx, &models.OneTimeToken{
+		UserID:    user.Id,
+		Purpose:   models.TokenEmailVerification,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}); err != nil {
+		return err
+	}
+
+	link := s.verifyURL + "?token=" + url.QueryEscape(token)
+	if err := s.mailer.Send(ctx, models.Mail{
+		To:      user.Email,
+		Subject: "Confirm your Cartoon Burgers email",
+		Body: fmt.Sprintf("Hello, %s!\n\n"+
+			"Follow the link to confirm your email:\n%s\n\n"+
+			"The link expires in %s. You can browse the menu meanwhile, ordering needs a confirmed email.\n",
+			user.Username, link, s.ttl),
+	}); err != nil {
+		return err
+	}
+
+	s.logger.Info("verification mail sent", "user_id", user.Id)
+	return nil
+}
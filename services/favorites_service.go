@@ -0,0 +1,117 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"context"
+	"sort"
+	"time"
+)
+
+// FavoriteWeight is how many orders of a product a star is worth when
+// ranking suggestions.
+const FavoriteWeight = 3
+
+// FavoritesService keeps the starred products of users and builds the
+// personalized "order again" suggestions from stars and order history.
+type FavoritesService struct {
+	favorites *repositories.FavoriteRepository
+	orders    *repositories.OrderRepository
+	menu      *MenuService
+	limit     int
+
+	// Now stamps starred products, time.Now by default.
+	Now func() time.Time
+}
+
+// NewFavoritesService returns the service suggesting at most limit products.
+func NewFavoritesService(favorites *repositories.FavoriteRepository, orders *repositories.OrderRepository, menu *MenuService, limit int) *FavoritesService {
+	return &FavoritesService{favorites: favorites, orders: orders, menu: menu, limit: limit, Now: time.Now}
+}
+
+// List returns the user's favourites, the last starred first. Products that
+// were removed from the menu are left out.
+func (s *FavoritesService) List(ctx context.Context, userID int, locale string) ([]models.FavoriteProduct, error) {
+	ids, err := s.favorites.GetFavorites(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := s.menu.GetMenu(ctx, MenuFilter{Locale: locale, IncludeUnavailable: true})
+	if err != nil {
+		return nil, err
+	}
+	available, err := s.menu.GetMenu(ctx, MenuFilter{Locale: locale})
+	if err != nil {
+		return nil, err
+	}
+
+	products := make(map[int]models.Product, len(all))
+	for _, p := range all {
+		products[p.ID] = p
+	}
+	orderable := make(map[int]bool, len(available))
+	for _, p := range available {
+		orderable[p.ID] = true
+	}
+
+	favorites := make([]models.FavoriteProduct, 0, len(ids))
+	for _, id := range ids {
+		if p, ok := products[id]; ok {
+			favorites = append(favorites, models.FavoriteProduct{Product: p, Available: orderable[id]})
+		}
+	}
+	return favorites, nil
+}
+
+// Add stars the product, unavailable products can be starred as well.
+func (s *FavoritesService) Add(ctx context.Context, userID, productID int) error {
+	if _, err := s.menu.FindProduct(ctx, productID); err != nil {
+		return err
+	}
+
+	return s.favorites.AddFavorite(ctx, userID, productID, s.Now())
+}
+
+func (s *FavoritesService) Remove(ctx context.Context, userID, productID int) error {
+	return s.favorites.RemoveFavorite(ctx, userID, productID)
+}
+
+// Suggestions ranks the products the user starred or ordered before by
+// FavoriteWeight per star plus one per order. Only products that pass filter
+// and can be ordered right now are suggested.
+func (s *FavoritesService) Suggestions(ctx context.Context, userID int, filter MenuFilter) ([]models.Product, error) {
+	filter.IncludeUnavailable = false
+	products, err := s.menu.GetMenu(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	scores, err := s.orders.GetProductOrderCounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	favorites, err := s.favorites.GetFavorites(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range favorites {
+		scores[id] += FavoriteWeight
+	}
+
+	suggestions := make([]models.Product, 0, len(scores))
+	for _, p := range products {
+		if scores[p.ID] > 0 {
+			suggestions = append(suggestions, p)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return scores[suggestions[i].ID] > scores[suggestions[j].ID]
+	})
+
+	if s.limit > 0 && len(suggestions) > s.limit {
+		suggestions = suggestions[:s.limit]
+	}
+	return suggestions, nil
+}
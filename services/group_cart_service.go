@@ -0,0 +1,206 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrGroupCartNotFound  = errors.New("group cart not found")
+	ErrGroupCartForbidden = errors.New("group cart belongs to someone else")
+	ErrGroupCartClosed    = repositories.ErrGroupCartClosed
+	ErrGroupCartNotLocked = repositories.ErrGroupCartNotLocked
+)
+
+// GroupCartService runs group orders: the owner starts a cart and shares its
+// invite token, participants add their own items while it is open, the owner
+// locks it and places it as one order with a per person breakdown.
+type GroupCartService struct {
+	groups *repositories.GroupCartRepository
+	menu   *MenuService
+	pricer *CartPricer
+	orders *OrderService
+
+	// Now stamps created carts and joins, time.Now by default.
+	Now func() time.Time
+}
+
+func NewGroupCartService(groups *repositories.GroupCartRepository, menu *MenuService, pricer *CartPricer, orders *OrderService) *GroupCartService {
+	return &GroupCartService{groups: groups, menu: menu, pricer: pricer, orders: orders, Now: time.Now}
+}
+
+func (s *GroupCartService) Create(ctx context.Context, ownerID int) (*models.PricedGroupCart, error) {
+	token, err := newRandomToken(18)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &models.GroupCart{OwnerID: ownerID, InviteToken: token, CreatedAt: s.Now()}
+	if err := s.groups.CreateGroupCart(ctx, group); err != nil {
+		return nil, err
+	}
+
+	return s.Get(ctx, group.ID, ownerID)
+}
+
+// Join adds the user to the open group cart with the invite token.
+func (s *GroupCartService) Join(ctx context.Context, token string, userID int) (*models.PricedGroupCart, error) {
+	groupID, err := s.groups.FindGroupCartByToken(ctx, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrGroupCartNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.groups.AddGroupMember(ctx, groupID, userID, s.Now()); err != nil {
+		return nil, err
+	}
+
+	return s.Get(ctx, groupID, userID)
+}
+
+// Get returns the priced group cart to one of its members.
+func (s *GroupCartService) Get(ctx context.Context, groupID, userID int) (*models.PricedGroupCart, error) {
+	group, err := s.load(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	priced, err := s.pricer.Price(ctx, group.Cart())
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PricedGroupCart{GroupCart: *group, Cart: priced, Participants: groupShares(group, priced)}, nil
+}
+
+// SetItem sets the quantity of the product added by the member, 0 removes
+// it. Quantity limits apply to every participant's own items.
+func (s *GroupCartService) SetItem(ctx context.Context, groupID, userID, productID, quantity int) (*models.PricedGroupCart, error) {
+	if quantity < 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	group, err := s.load(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if quantity > 0 {
+		if _, err := s.menu.CheckAvailable(ctx, productID); err != nil {
+			return nil, err
+		}
+
+		var own []models.CartItem
+		for _, item := range group.Items {
+			if item.UserID == userID {
+				own = append(own, models.CartItem{ProductID: item.ProductID, Quantity: item.Quantity})
+			}
+		}
+		if err := s.pricer.CheckQuantity(own, productID, quantity); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.groups.SetGroupCartItem(ctx, groupID, userID, productID, quantity); err != nil {
+		return nil, err
+	}
+
+	return s.Get(ctx, groupID, userID)
+}
+
+// Lock freezes the group cart before checkout, only the owner can do it.
+func (s *GroupCartService) Lock(ctx context.Context, groupID, userID int) (*models.PricedGroupCart, error) {
+	return s.setStatus(ctx, groupID, userID, models.GroupCartOpen, models.GroupCartLocked, ErrGroupCartClosed)
+}
+
+// Unlock opens a locked group cart again for changes.
+func (s *GroupCartService) Unlock(ctx context.Context, groupID, userID int) (*models.PricedGroupCart, error) {
+	return s.setStatus(ctx, groupID, userID, models.GroupCartLocked, models.GroupCartOpen, ErrGroupCartNotLocked)
+}
+
+// PlaceOrder places the locked group cart as an order of the owner, who
+// may pay bonusPoints of it with points.
+func (s *GroupCartService) PlaceOrder(ctx context.Context, groupID, userID int, bonusPoints int64) (*models.Order, error) {
+	group, err := s.load(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if group.OwnerID != userID {
+		return nil, ErrGroupCartForbidden
+	}
+	if group.Status != models.GroupCartLocked {
+		return nil, ErrGroupCartNotLocked
+	}
+
+	return s.orders.place(ctx, userID, group.Cart(), "", bonusPoints, group)
+}
+
+func (s *GroupCartService) setStatus(ctx context.Context, groupID, userID int, from, to models.GroupCartStatus, wrongStatus error) (*models.PricedGroupCart, error) {
+	group, err := s.load(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if group.OwnerID != userID {
+		return nil, ErrGroupCartForbidden
+	}
+
+	changed, err := s.groups.SetGroupCartStatus(ctx, groupID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return nil, wrongStatus
+	}
+
+	return s.Get(ctx, groupID, userID)
+}
+
+// load returns the group cart if the user is one of its members.
+func (s *GroupCartService) load(ctx context.Context, groupID, userID int) (*models.GroupCart, error) {
+	group, err := s.groups.GetGroupCart(ctx, groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrGroupCartNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !group.IsMember(userID) {
+		return nil, ErrGroupCartForbidden
+	}
+	return group, nil
+}
+
+// groupShares splits the priced group cart by participant. Unavailable
+// products do not count towards the subtotals, like in the cart itself.
+func groupShares(group *models.GroupCart, priced *models.PricedCart) []models.GroupCartShare {
+	lines := make(map[int]models.PricedCartLine, len(priced.Items))
+	for _, line := range priced.Items {
+		lines[line.ProductID] = line
+	}
+
+	shares := make([]models.GroupCartShare, 0, len(group.Members))
+	for _, m := range group.Members {
+		share := models.GroupCartShare{UserID: m.UserID, Username: m.Username, Items: []models.PricedCartLine{}}
+		for _, item := range group.Items {
+			if item.UserID != m.UserID {
+				continue
+			}
+
+			line := lines[item.ProductID]
+			line.Quantity = item.Quantity
+			line.LineTotal = line.UnitPrice * int64(item.Quantity)
+			if !line.Unavailable {
+				share.Subtotal += line.LineTotal
+			}
+			share.Items = append(share.Items, line)
+		}
+		shares = append(shares, share)
+	}
+	return shares
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RunEvery runs job right away and then every interval until ctx is done.
+// Errors are logged and the job keeps its schedule.
+func RunEvery(ctx context.Context, interval time.Duration, logger *slog.Logger, name string, job func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		started := time.Now()
+		if err := job(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("background job failed",
+				"job", name,
+				"error", err.Error())
+		} else {
+			logger.Debug("background job finished",
+				"job", name,
+				"duration", time.Since(started))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDaily starts a goroutine that runs job every day at the "15:04" clock
+// time in location until ctx is done. It only fails for a malformed at.
+func RunDaily(ctx context.Context, at string, location *time.Location, logger *slog.Logger, name string, job func(context.Context) error) error {
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			now := time.Now().In(location)
+			next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, location)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if err := job(ctx); err != nil && ctx.Err() == nil {
+				logger.Error("background job failed",
+					"job", name,
+					"error", err.Error())
+			}
+		}
+	}()
+
+	return nil
+}
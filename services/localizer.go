@@ -0,0 +1,121 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Localizer picks a response locale out of the supported ones and holds the
+// translated user facing handler messages.
+type Localizer struct {
+	Default   string
+	Supported []string
+}
+
+var messages = map[string]map[string]string{
+	"ru": {
+		"cart.added":   "Товар добавлен в корзину",
+		"cart.removed": "Товар убран из корзины",
+		"cart.updated": "Количество изменено",
+		"cart.cleared": "Корзина очищена",
+		"cart.saved":   "Корзина сохранена",
+
+		"cart.promoApplied": "Промокод применён",
+		"cart.promoRemoved": "Промокод удалён",
+	},
+	"en": {
+		"cart.added":   "Item added to cart",
+		"cart.removed": "Item removed from cart",
+		"cart.updated": "Quantity updated",
+		"cart.cleared": "Cart cleared",
+		"cart.saved":   "Cart saved",
+
+		"cart.promoApplied": "Promo code applied",
+		"cart.promoRemoved": "Promo code removed",
+	},
+}
+
+func NewLocalizer(defaultLocale string, supported []string) *Localizer {
+	l := &Localizer{Default: normalizeLocale(defaultLocale)}
+	for _, s := range supported {
+		l.Supported = append(l.Supported, normalizeLocale(s))
+	}
+	if !l.isSupported(l.Default) {
+		l.Supported = append(l.Supported, l.Default)
+	}
+	return l
+}
+
+// Resolve returns the locale requested with ?lang= if it is supported,
+// otherwise the best match from the Accept-Language header, otherwise the
+// default locale.
+func (l *Localizer) Resolve(lang, acceptLanguage string) string {
+	if lang = normalizeLocale(lang); l.isSupported(lang) {
+		return lang
+	}
+
+	type candidate struct {
+		locale string
+		q      float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		locale := normalizeLocale(fields[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, f := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(f), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		candidates = append(candidates, candidate{locale: locale, q: q})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+
+	for _, c := range candidates {
+		if c.q > 0 && l.isSupported(c.locale) {
+			return c.locale
+		}
+	}
+
+	return l.Default
+}
+
+func (l *Localizer) Message(locale, key string) string {
+	if msg, ok := messages[locale][key]; ok {
+		return msg
+	}
+	if msg, ok := messages[l.Default][key]; ok {
+		return msg
+	}
+	return key
+}
+
+func (l *Localizer) isSupported(locale string) bool {
+	for _, s := range l.Supported {
+		if s == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeLocale reduces tags like "en-US" or "ru_RU" to the language part.
+func normalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
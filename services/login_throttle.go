@@ -0,0 +1,166 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var ErrLoginLocked = errors.New("too many failed logins")
+
+// LockoutPolicy says when failed logins lock out a username or an IP.
+// Reaching the failure limit locks for Lockout, every further failure
+// doubles the lockout up to MaxLockout.
+type LockoutPolicy struct {
+	UserFailures int
+	IPFailures   int
+	Lockout      time.Duration
+	MaxLockout   time.Duration
+	// Window is how long failures are remembered after the last one, it is
+	// at least MaxLockout so the lockouts keep growing.
+	Window time.Duration
+}
+
+// DefaultLockoutPolicy is used for zero fields of the configured policy.
+var DefaultLockoutPolicy = LockoutPolicy{
+	UserFailures: 5,
+	IPFailures:   20,
+	Lockout:      30 * time.Second,
+	MaxLockout:   time.Hour,
+	Window:       time.Hour,
+}
+
+// LoginThrottle protects logins from password guessing, per username and
+// per client IP.
+type LoginThrottle struct {
+	attempts ports.AttemptCounter
+	events   ports.SecurityEvents
+	policy   LockoutPolicy
+	logger   *slog.Logger
+
+	// Now is used for event times, time.Now by default.
+	Now func() time.Time
+}
+
+func NewLoginThrottle(attempts ports.AttemptCounter, events ports.SecurityEvents, policy LockoutPolicy, logger *slog.Logger) *LoginThrottle {
+	if policy.UserFailures <= 0 {
+		policy.UserFailures = DefaultLockoutPolicy.UserFailures
+	}
+	if policy.IPFailures <= 0 {
+		policy.IPFailures = DefaultLockoutPolicy.IPFailures
+	}
+	if policy.Lockout <= 0 {
+		policy.Lockout = DefaultLockoutPolicy.Lockout
+	}
+	if policy.MaxLockout < policy.Lockout {
+		policy.MaxLockout = max(DefaultLockoutPolicy.MaxLockout, policy.Lockout)
+	}
+	if policy.Window <= 0 {
+		policy.Window = DefaultLockoutPolicy.Window
+	}
+	policy.Window = max(policy.Window, policy.MaxLockout)
+	return &LoginThrottle{attempts: attempts, events: events, policy: policy, logger: logger, Now: time.Now}
+}
+
+func userAttemptKey(username string) string {
+	return "login:user:" + strings.ToLower(username)
+}
+
+func ipAttemptKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+// Check returns ErrLoginLocked and how long to wait when the username or
+// the IP is locked out.
+func (t *LoginThrottle) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range []string{userAttemptKey(username), ipAttemptKey(ip)} {
+		left, err := t.attempts.LockedFor(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, left)
+	}
+
+	if wait > 0 {
+		return wait, ErrLoginLocked
+	}
+	return 0, nil
+}
+
+// Failed counts a failed login for the username and the IP and locks out
+// the ones over their limit.
+func (t *LoginThrottle) Failed(ctx context.Context, username, ip string) error {
+	if err := t.fail(ctx, userAttemptKey(username), t.policy.UserFailures, models.SecurityEvent{Username: username}); err != nil {
+		return err
+	}
+	return t.fail(ctx, ipAttemptKey(ip), t.policy.IPFailures, models.SecurityEvent{IP: ip})
+}
+
+// Succeeded forgets the failures of the username. The IP keeps its count,
+// logging into an own account must not hide guessing at others.
+func (t *LoginThrottle) Succeeded(ctx context.Context, username string) error {
+	return t.attempts.Reset(ctx, userAttemptKey(username))
+}
+
+// Unlock lifts the lockout of the username, a password reset proves the
+// user owns the account.
+func (t *LoginThrottle) Unlock(ctx context.Context, username string) error {
+	left, err := t.attempts.LockedFor(ctx, userAttemptKey(username))
+	if err != nil {
+		return err
+	}
+	if err := t.attempts.Reset(ctx, userAttemptKey(username)); err != nil {
+		return err
+	}
+
+	if left > 0 {
+		t.record(ctx, models.SecurityEvent{Type: models.SecurityLoginUnlock, Username: username})
+	}
+	return nil
+}
+
+func (t *LoginThrottle) fail(ctx context.Context, key string, limit int, event models.SecurityEvent) error {
+	failures, err := t.attempts.Fail(ctx, key, t.policy.Window)
+	if err != nil {
+		return err
+	}
+	if failures < limit {
+		return nil
+	}
+
+	lockout := t.lockout(failures - limit)
+	if err := t.attempts.Lock(ctx, key, lockout); err != nil {
+		return err
+	}
+
+	until := t.Now().Add(lockout)
+	event.Type = models.SecurityLoginLockout
+	event.Failures = failures
+	event.Until = &until
+	t.record(ctx, event)
+	return nil
+}
+
+// lockout doubles the lockout for every failure over the limit.
+func (t *LoginThrottle) lockout(over int) time.Duration {
+	d := t.policy.Lockout
+	for i := 0; i < over && d < t.policy.MaxLockout; i++ {
+		d *= 2
+	}
+	return min(d, t.policy.MaxLockout)
+}
+
+// record sends the event, a failure is logged and does not fail the login.
+func (t *LoginThrottle) record(ctx context.Context, event models.SecurityEvent) {
+	event.At = t.Now()
+	if err := t.events.Record(ctx, event); err != nil {
+		t.logger.Error("failed to record security event",
+			"type", event.Type,
+			"error", err.Error())
+	}
+}
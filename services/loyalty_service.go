@@ -0,0 +1,157 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrInsufficientBonus = repositories.ErrInsufficientBonus
+	ErrBonusSpendLimit   = errors.New("bonus points can not pay that much of the order")
+)
+
+// LoyaltyRules configure earning and spending of bonus points. One point is
+// worth one unit of the menu price, MinorUnits minor units.
+type LoyaltyRules struct {
+	// EarnPercent of the money paid for products is credited as points.
+	EarnPercent float64
+	// CategoryMultipliers multiply the points of products by category slug.
+	CategoryMultipliers map[string]float64
+	// Lifetime of earned points, 0 means they never expire.
+	Lifetime time.Duration
+	// MaxSpendPercent limits the part of the products total paid with points.
+	MaxSpendPercent int64
+}
+
+type LoyaltyService struct {
+	bonus      *repositories.BonusRepository
+	categories *repositories.CategoryRepository
+	tiers      *TierService
+	rules      LoyaltyRules
+	logger     *slog.Logger
+
+	// Now is used for expiry dates, time.Now by default.
+	Now func() time.Time
+}
+
+func NewLoyaltyService(bonus *repositories.BonusRepository, categories *repositories.CategoryRepository, tiers *TierService, rules LoyaltyRules, logger *slog.Logger) *LoyaltyService {
+	return &LoyaltyService{bonus: bonus, categories: categories, tiers: tiers, rules: rules, logger: logger, Now: time.Now}
+}
+
+func (s *LoyaltyService) Balance(ctx context.Context, userID int) (int64, error) {
+	return s.bonus.GetBonusBalance(ctx, userID, s.Now())
+}
+
+func (s *LoyaltyService) History(ctx context.Context, userID int) ([]models.BonusEntry, error) {
+	return s.bonus.GetBonusHistory(ctx, userID)
+}
+
+// ApplySpend pays part of the cart with points. It checks the balance and the
+// spend limit, the ledger is only written when the order is stored.
+func (s *LoyaltyService) ApplySpend(ctx context.Context, userID int, points int64, cart *models.PricedCart) error {
+	if points <= 0 {
+		return nil
+	}
+
+	goods := cart.GoodsTotal()
+	if points*MinorUnits > goods*s.rules.MaxSpendPercent/100 {
+		return ErrBonusSpendLimit
+	}
+
+	balance, err := s.Balance(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if points > balance {
+		return ErrInsufficientBonus
+	}
+
+	cart.Total -= points * MinorUnits
+	return nil
+}
+
+// Earn returns the points the user gets for the cart when paid puts money, in
+// minor units, towards its products. paid is spread over the lines in
+// proportion to their totals so category multipliers apply to the right part,
+// the user's tier multiplies the result.
+func (s *LoyaltyService) Earn(ctx context.Context, userID int, cart *models.PricedCart, paid int64) (int64, error) {
+	if paid <= 0 || cart.Subtotal <= 0 || s.rules.EarnPercent <= 0 {
+		return 0, nil
+	}
+
+	multipliers, err := s.multipliersByCategory(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tier, err := s.tiers.UserTier(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	tierMultiplier := tier.EarnMultiplier
+	if tierMultiplier <= 0 {
+		tierMultiplier = 1
+	}
+
+	var points float64
+	for _, line := range cart.Items {
+		if line.Unavailable {
+			continue
+		}
+
+		multiplier, ok := multipliers[line.CategoryID]
+		if !ok {
+			multiplier = 1
+		}
+
+		share := float64(paid) * float64(line.LineTotal) / float64(cart.Subtotal)
+		points += share * s.rules.EarnPercent / 100 * multiplier * tierMultiplier / MinorUnits
+	}
+
+	return int64(points), nil
+}
+
+// ExpiresAt returns when points earned at now expire, nil when they never do.
+func (s *LoyaltyService) ExpiresAt(now time.Time) *time.Time {
+	if s.rules.Lifetime <= 0 {
+		return nil
+	}
+	t := now.Add(s.rules.Lifetime)
+	return &t
+}
+
+// ExpirePoints is the background job that writes off expired points.
+func (s *LoyaltyService) ExpirePoints(ctx context.Context) error {
+	expired, err := s.bonus.ExpireBonus(ctx, s.Now())
+	if err != nil {
+		return err
+	}
+
+	if expired > 0 {
+		s.logger.Info("bonus points expired", "points", expired)
+	}
+	return nil
+}
+
+func (s *LoyaltyService) multipliersByCategory(ctx context.Context) (map[int]float64, error) {
+	if len(s.rules.CategoryMultipliers) == 0 {
+		return nil, nil
+	}
+
+	categories, err := s.categories.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	multipliers := make(map[int]float64, len(s.rules.CategoryMultipliers))
+	for _, c := range categories {
+		if m, ok := s.rules.CategoryMultipliers[c.Slug]; ok {
+			multipliers[c.ID] = m
+		}
+	}
+	return multipliers, nil
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMTPMailer sends mail through an SMTP server. Authentication is used when
+// a username is set.
+type SMTPMailer struct {
+	addr     string
+	from     string
+	envelope string
+	auth     smtp.Auth
+}
+
+var _ ports.Mailer = (*SMTPMailer)(nil)
+
+// NewSMTPMailer returns the mailer, from may have a display name like
+// "Cartoon Burgers <no-reply@example.com>".
+func NewSMTPMailer(host string, port int, username, password, from string) (*SMTPMailer, error) {
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &SMTPMailer{addr: net.JoinHostPort(host, strconv.Itoa(port)), from: from, envelope: address.Address}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message models.Mail) error {
+	return smtp.SendMail(m.addr, m.auth, m.envelope, []string{message.To}, formatMail(m.from, message))
+}
+
+// FileMailer writes every mail as an .eml file into a directory, for local
+// development without a mail server.
+type FileMailer struct {
+	dir  string
+	from string
+
+	// Now names the files, time.Now by default.
+	Now func() time.Time
+}
+
+var _ ports.Mailer = (*FileMailer)(nil)
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from, Now: time.Now}
+}
+
+func (m *FileMailer) Send(ctx context.Context, mail models.Mail) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(m.dir, m.Now().UTC().Format("20060102T150405")+"-*.eml")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(formatMail(m.from, mail))
+	return err
+}
+
+// InMemoryMailer keeps sent mail in memory, tests read it from Sent.
+type InMemoryMailer struct {
+	mu   sync.Mutex
+	sent []models.Mail
+}
+
+var _ ports.Mailer = (*InMemoryMailer)(nil)
+
+func NewInMemoryMailer() *InMemoryMailer {
+	return &InMemoryMailer{}
+}
+
+func (m *InMemoryMailer) Send(ctx context.Context, mail models.Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, mail)
+	return nil
+}
+
+// Sent returns a copy of the mail sent so far.
+func (m *InMemoryMailer) Sent() []models.Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.Mail(nil), m.sent...)
+}
+
+// formatMail builds a plain text RFC 5322 message. Header values come from
+// our own templates and addresses, newlines are dropped so a crafted
+// address can not add headers.
+func formatMail(from string, mail models.Mail) []byte {
+	header := strings.NewReplacer("\r", "", "\n", "")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", header.Replace(mail.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", header.Replace(mail.Subject)))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(mail.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -4,22 +4,265 @@ import (
 	"CartoonBurgers/models"
 	"CartoonBurgers/repositories"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrProductNotFound    = errors.New("product not found")
+	ErrProductUnavailable = errors.New("product is not available right now")
 )
 
 type MenuService struct {
-	repo *repositories.ProductRerository
+	repo          *repositories.ProductRerository
+	categories    *repositories.CategoryRepository
+	defaultLocale string
+	location      *time.Location
+
+	// Now is used to evaluate availability windows, time.Now by default.
+	Now func() time.Time
 }
 
-func NewMenuService(repo *repositories.ProductRerository) *MenuService {
-	return &MenuService{repo: repo}
+type MenuFilter struct {
+	ExcludeAllergens   []models.Allergen
+	Locale             string
+	IncludeUnavailable bool
+}
+
+func NewMenuService(repo *repositories.ProductRerository, categories *repositories.CategoryRepository, defaultLocale string, location *time.Location) *MenuService {
+	if location == nil {
+		location = time.Local
+	}
+	return &MenuService{repo: repo, categories: categories, defaultLocale: defaultLocale, location: location, Now: time.Now}
 }
 
-func (s *MenuService) GetMenu(ctx context.Context) ([]models.Product, error) {
+func (s *MenuService) GetMenu(ctx context.Context, filter MenuFilter) ([]models.Product, error) {
 	products, err := s.repo.GetAll(ctx)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return products, err
+	if err := s.translate(ctx, products, filter.Locale); err != nil {
+		return nil, err
+	}
+
+	categories, err := s.categoriesByID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := s.Now().In(s.location)
+
+	filtered := make([]models.Product, 0, len(products))
+	for _, p := range products {
+		if p.HasAnyAllergen(filter.ExcludeAllergens) {
+			continue
+		}
+		if !filter.IncludeUnavailable && !isOrderable(now, p, categories) {
+			continue
+		}
+		filtered = append(filtered, p)
+	}
+
+	return filtered, nil
+}
+
+// GetSections returns the menu grouped into visible categories in display
+// order. Categories without listed products are left out.
+func (s *MenuService) GetSections(ctx context.Context, filter MenuFilter) ([]models.MenuSection, error) {
+	products, err := s.GetMenu(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.categories.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.translateCategories(ctx, categories, filter.Locale); err != nil {
+		return nil, err
+	}
+
+	sections := make([]models.MenuSection, 0, len(categories))
+	for _, c := range categories {
+		if !c.Visible {
+			continue
+		}
+
+		section := models.MenuSection{Category: c, Products: []models.Product{}}
+		for _, p := range products {
+			if p.CategoryID == c.ID {
+				section.Products = append(section.Products, p)
+			}
+		}
+
+		if len(section.Products) > 0 {
+			sections = append(sections, section)
+		}
+	}
+
+	return sections, nil
+}
+
+// FindProduct returns the product whether or not it can be ordered right now.
+func (s *MenuService) FindProduct(ctx context.Context, productID int) (*models.Product, error) {
+	product, err := s.repo.FindByID(ctx, productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	return product, err
+}
+
+// CheckAvailable returns the product if it exists and can be ordered right
+// now in the store timezone.
+func (s *MenuService) CheckAvailable(ctx context.Context, productID int) (*models.Product, error) {
+	product, err := s.FindProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.categoriesByID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isOrderable(s.Now().In(s.location), *product, categories) {
+		return nil, ErrProductUnavailable
+	}
+
+	return product, nil
+}
+
+// productsByID returns every product by id and the categories to check them
+// with isOrderable, for looking up many products at once.
+func (s *MenuService) productsByID(ctx context.Context) (map[int]models.Product, map[int]models.Category, error) {
+	products, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	categories, err := s.categoriesByID(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byID := make(map[int]models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	return byID, categories, nil
+}
+
+func (s *MenuService) categoriesByID(ctx context.Context) (map[int]models.Category, error) {
+	categories, err := s.categories.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]models.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+	return byID, nil
+}
+
+// isOrderable reports whether the product sits in a visible category and both
+// its own and its category availability windows allow ordering at now.
+func isOrderable(now time.Time, p models.Product, categories map[int]models.Category) bool {
+	category, ok := categories[p.CategoryID]
+	if !ok || !category.Visible {
+		return false
+	}
+	return models.IsAvailableAt(now, p.Availability, category.Availability)
+}
+
+// translate replaces names and descriptions with the ones for locale. Products
+// without a translation fall back to the default locale and then to the
+// values stored on the product itself.
+func (s *MenuService) translate(ctx context.Context, products []models.Product, locale string) error {
+	if locale == "" {
+		locale = s.defaultLocale
+	}
+
+	requested, err := s.repo.GetTranslations(ctx, locale)
+	if err != nil {
+		return err
+	}
+
+	fallback := requested
+	if locale != s.defaultLocale {
+		if fallback, err = s.repo.GetTranslations(ctx, s.defaultLocale); err != nil {
+			return err
+		}
+	}
+
+	for i := range products {
+		t, ok := requested[products[i].ID]
+		if !ok {
+			t, ok = fallback[products[i].ID]
+		}
+		if !ok {
+			continue
+		}
+
+		products[i].Name = t.Name
+		products[i].Description = t.Description
+	}
+
+	return nil
+}
+
+// translateCategories replaces category names with the ones for locale, with
+// the same fallback as translate.
+func (s *MenuService) translateCategories(ctx context.Context, categories []models.Category, locale string) error {
+	if locale == "" {
+		locale = s.defaultLocale
+	}
+
+	requested, err := s.categories.GetTranslations(ctx, locale)
+	if err != nil {
+		return err
+	}
+
+	fallback := requested
+	if locale != s.defaultLocale {
+		if fallback, err = s.categories.GetTranslations(ctx, s.defaultLocale); err != nil {
+			return err
+		}
+	}
+
+	for i := range categories {
+		name, ok := requested[categories[i].ID]
+		if !ok {
+			name, ok = fallback[categories[i].ID]
+		}
+		if ok {
+			categories[i].Name = name
+		}
+	}
+
+	return nil
+}
+
+// ParseAllergens parses a comma separated allergen list like "gluten,milk".
+func ParseAllergens(raw string) ([]models.Allergen, error) {
+	var allergens []models.Allergen
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+
+		a := models.Allergen(part)
+		if !a.Valid() {
+			return nil, fmt.Errorf("unknown allergen %q", part)
+		}
+		allergens = append(allergens, a)
+	}
+
+	return allergens, nil
 }
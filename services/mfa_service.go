@@ -0,0 +1,234 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// MFAChallengeTTL is how long the second login step may take.
+	MFAChallengeTTL = 5 * time.Minute
+	// MFAChallengeAttempts is how many wrong codes a challenge takes.
+	MFAChallengeAttempts = 5
+	RecoveryCodeCount    = 10
+)
+
+var (
+	ErrMFANotEnrolled      = repositories.ErrMFANotEnrolled
+	ErrMFAAlreadyEnabled   = repositories.ErrMFAAlreadyEnabled
+	ErrMFAChallengeInvalid = repositories.ErrOneTimeTokenInvalid
+	ErrMFACodeInvalid      = errors.New("two factor code is invalid")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFAService enrols users in TOTP two factor authentication and runs the
+// second step of their logins.
+type MFAService struct {
+	mfa    *repositories.MFARepository
+	tokens *repositories.OneTimeTokenRepository
+	users  *repositories.UserRepository
+	issuer string
+	logger *slog.Logger
+
+	// Now is used for TOTP codes and challenge lifetimes, time.Now by
+	// default.
+	Now func() time.Time
+}
+
+// NewMFAService returns the service, issuer names the account in
+// authenticator apps.
+func NewMFAService(mfa *repositories.MFARepository, tokens *repositories.OneTimeTokenRepository, users *repositories.UserRepository, issuer string, logger *slog.Logger) *MFAService {
+	return &MFAService{mfa: mfa, tokens: tokens, users: users, issuer: issuer, logger: logger, Now: time.Now}
+}
+
+// Enabled reports whether logins of the user need a second factor.
+func (s *MFAService) Enabled(ctx context.Context, userID int) (bool, error) {
+	m, err := s.mfa.GetMFA(ctx, userID)
+	if errors.Is(err, ErrMFANotEnrolled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return m.Enabled(), nil
+}
+
+func (s *MFAService) Status(ctx context.Context, userID int) (*models.MFAStatus, error) {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := s.mfa.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MFAStatus{Enabled: enabled, RecoveryCodesLeft: codes}, nil
+}
+
+// Enroll starts enrolment with a new secret. Starting again before Confirm
+// replaces the secret.
+func (s *MFAService) Enroll(ctx context.Context, userID int) (*models.MFAEnrolment, error) {
+	username, err := s.users.GetUsername(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfa.StartMFAEnrolment(ctx, userID, secret, s.Now()); err != nil {
+		return nil, err
+	}
+
+	return &models.MFAEnrolment{Secret: secret, URI: TOTPURI(s.issuer, username, secret)}, nil
+}
+
+// Confirm enables two factor authentication with a code from the
+// authenticator app and returns the recovery codes. They are stored hashed
+// and can not be shown again.
+func (s *MFAService) Confirm(ctx context.Context, userID int, code string) ([]string, error) {
+	m, err := s.mfa.GetMFA(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if m.Enabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := MatchTOTP(m.Secret, code, s.Now())
+	if !ok {
+		return nil, ErrMFACodeInvalid
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	if err := s.mfa.ConfirmMFA(ctx, userID, step, hashes, s.Now()); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("two factor authentication enabled", "user_id", userID)
+	return codes, nil
+}
+
+// Challenge starts the second login step for the user and returns the
+// token POST /api/auth/mfa/verify takes.
+func (s *MFAService) Challenge(ctx context.Context, userID int) (string, error) {
+	token, err := newRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := s.Now()
+	if err := s.tokens.CreateOneTimeToken(ctx, &models.OneTimeToken{
+		UserID:    userID,
+		Purpose:   models.TokenMFAChallenge,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(MFAChallengeTTL),
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Verify completes the login the challenge was issued for with a TOTP or a
+// recovery code and returns the user. The challenge works once and stops
+// working after MFAChallengeAttempts wrong codes. With ErrMFACodeInvalid
+// the username is returned too, so the failure counts against the account.
+func (s *MFAService) Verify(ctx context.Context, challenge, code string) (int, string, error) {
+	if challenge == "" {
+		return 0, "", ErrMFAChallengeInvalid
+	}
+
+	now := s.Now()
+	hash := hashToken(challenge)
+	token, err := s.tokens.FindOneTimeToken(ctx, models.TokenMFAChallenge, hash, now)
+	if err != nil {
+		return 0, "", err
+	}
+
+	ok, err := s.checkCode(ctx, token.UserID, code, now)
+	if err != nil {
+		return 0, "", err
+	}
+	if !ok {
+		if err := s.tokens.FailOneTimeToken(ctx, token.ID, MFAChallengeAttempts, now); err != nil {
+			return 0, "", err
+		}
+		username, err := s.users.GetUsername(ctx, token.UserID)
+		if err != nil {
+			return 0, "", err
+		}
+		return 0, username, ErrMFACodeInvalid
+	}
+
+	userID, err := s.tokens.UseOneTimeToken(ctx, models.TokenMFAChallenge, hash, now)
+	if err != nil {
+		return 0, "", err
+	}
+	username, err := s.users.GetUsername(ctx, userID)
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, username, nil
+}
+
+// checkCode accepts a TOTP code that was not used before or an unused
+// recovery code.
+func (s *MFAService) checkCode(ctx context.Context, userID int, code string, now time.Time) (bool, error) {
+	m, err := s.mfa.GetMFA(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if !m.Enabled() {
+		return false, ErrMFANotEnrolled
+	}
+
+	if step, ok := MatchTOTP(m.Secret, code, now); ok {
+		return s.mfa.UseTOTPStep(ctx, userID, step)
+	}
+
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return false, nil
+	}
+	used, err := s.mfa.UseRecoveryCode(ctx, userID, hashToken(code), now)
+	if used {
+		s.logger.Info("recovery code used", "user_id", userID)
+	}
+	return used, err
+}
+
+// newRecoveryCode returns a code like "ABCD-EFGH-IJKL-MNOP", 80 random
+// bits, enough for an unsalted hash.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := recoveryCodeEncoding.EncodeToString(b)
+	return code[:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:], nil
+}
+
+// normalizeRecoveryCode lets users type recovery codes in any case and
+// with or without the dashes.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
+	"context"
+	"log/slog"
+)
+
+// LogNotifier writes notifications to the log. It stands in until a real
+// delivery channel is connected.
+type LogNotifier struct {
+	logger *slog.Logger
+}
+
+var _ ports.Notifier = (*LogNotifier)(nil)
+
+func NewLogNotifier(logger *slog.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, notification models.Notification) error {
+	n.logger.Info("notification",
+		"event", notification.Event,
+		"user_id", notification.UserID,
+		"data", notification.Data)
+	return nil
+}
+
+// LogSecurityEvents writes security events to the log at warning level,
+// for log based alerting.
+type LogSecurityEvents struct {
+	logger *slog.Logger
+}
+
+var _ ports.SecurityEvents = (*LogSecurityEvents)(nil)
+
+func NewLogSecurityEvents(logger *slog.Logger) *LogSecurityEvents {
+	return &LogSecurityEvents{logger: logger}
+}
+
+func (e *LogSecurityEvents) Record(ctx context.Context, event models.SecurityEvent) error {
+	attrs := []any{"type", event.Type, "at", event.At}
+	if event.Username != "" {
+		attrs = append(attrs, "username", event.Username)
+	}
+	if event.IP != "" {
+		attrs = append(attrs, "client_ip", event.IP)
+	}
+	if event.Failures > 0 {
+		attrs = append(attrs, "failures", event.Failures)
+	}
+	if event.Until != nil {
+		attrs = append(attrs, "until", *event.Until)
+	}
+	e.logger.Warn("security event", attrs...)
+	return nil
+}
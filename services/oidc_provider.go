@@ -0,0 +1,358 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcKeysRefetch limits how often an unknown kid makes the provider keys
+// be fetched again.
+const oidcKeysRefetch = time.Minute
+
+// OIDCProviderConfig is an OpenID Connect provider logins can use, like
+// Google or Yandex. The endpoints are read from the discovery document of
+// the issuer.
+type OIDCProviderConfig struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Scopes are requested besides openid, email and profile by default.
+	Scopes []string
+}
+
+// OIDCProvider talks to one provider: it builds the authorization URL,
+// exchanges the code and validates the ID token against the provider JWKS.
+type OIDCProvider struct {
+	config      OIDCProviderConfig
+	redirectURL string
+	client      *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+
+	// Now is used to validate ID tokens, time.Now by default.
+	Now func() time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCProvider returns the provider, the browser comes back to
+// redirectURL. A nil client falls back to one with a 10 second timeout.
+func NewOIDCProvider(config OIDCProviderConfig, redirectURL string, client *http.Client) *OIDCProvider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"email", "profile"}
+	}
+	if config.DisplayName == "" {
+		config.DisplayName = config.Name
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OIDCProvider{config: config, redirectURL: redirectURL, client: client, Now: time.Now}
+}
+
+// AuthorizationURL returns where to send the browser, with the S256 PKCE
+// challenge of verifier.
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the authorization code for the ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.config.ClientID},
+		"client_secret": {p.config.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(req, &body)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token endpoint: status %d %s %s", status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token endpoint: no id_token")
+	}
+	return body.IDToken, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, lifetime and nonce
+// of the ID token and returns its claims.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (*models.OIDCClaims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, discovery, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+		jwt.WithTimeFunc(p.Now))
+	if err != nil {
+		return nil, err
+	}
+
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+	// With several audiences the token must be issued to this client.
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.config.ClientID {
+			return nil, errors.New("id token azp does not match")
+		}
+	}
+
+	result := &models.OIDCClaims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+	// Some providers send email_verified as a string.
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+	if result.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return result, nil
+}
+
+// Info returns the provider for the login form.
+func (p *OIDCProvider) Info() models.OIDCProvider {
+	return models.OIDCProvider{Name: p.config.Name, DisplayName: p.config.DisplayName}
+}
+
+// discover reads the discovery document once. A failed read is tried again
+// on the next call.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var discovery oidcDiscovery
+	status, err := p.do(req, &discovery)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery: status %d", status)
+	}
+	if discovery.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", discovery.Issuer, p.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery: missing endpoints")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// key returns the provider key with the kid. Unknown kids fetch the JWKS
+// again, providers rotate their keys.
+func (p *OIDCProvider) key(ctx context.Context, discovery *oidcDiscovery, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if !p.keysFetchedAt.IsZero() && p.Now().Sub(p.keysFetchedAt) < oidcKeysRefetch {
+		return nil, fmt.Errorf("unknown provider key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set models.JWKS
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("jwks: status %d", status)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped, a provider may publish
+		// more than this client understands.
+		if key, err := ParseJWK(jwk); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetchedAt = p.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown provider key %q", kid)
+}
+
+func (p *OIDCProvider) do(req *http.Request, out any) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, out); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, err
+	}
+	return resp.StatusCode, nil
+}
+
+// ParseJWK returns the public key of an RSA, P-256/P-384 EC or Ed25519 JWK.
+func ParseJWK(jwk models.JWK) (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC key")
+		}
+		// Uncompressed point encoding, validated by ecdsa.ParseUncompressedPublicKey.
+		point := append([]byte{4}, append(x, y...)...)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const OIDCLoginTTL = 10 * time.Minute
+
+var (
+	ErrOIDCProviderUnknown = errors.New("unknown login provider")
+	ErrOIDCStateInvalid    = repositories.ErrOIDCLoginInvalid
+	ErrOIDCLoginFailed     = errors.New("login provider did not confirm the login")
+	ErrOIDCEmailRequired   = errors.New("login provider did not share a verified email")
+	ErrOIDCAccountExists   = errors.New("an account with the email exists, log in with the password to link it")
+	ErrIdentityTaken       = repositories.ErrIdentityTaken
+)
+
+// OIDCService logs users in with OpenID Connect providers. Provider
+// accounts are linked to users: by the user on their profile, by a
+// verified email matching a verified account, or to a new account.
+type OIDCService struct {
+	providers []*OIDCProvider
+	repo      *repositories.OIDCRepository
+	users     *repositories.UserRepository
+	hasher    IPasswordHasher
+	logger    *slog.Logger
+
+	// Now is used for login lifetimes, time.Now by default.
+	Now func() time.Time
+}
+
+func NewOIDCService(providers []*OIDCProvider, repo *repositories.OIDCRepository, users *repositories.UserRepository, logger *slog.Logger) *OIDCService {
+	return &OIDCService{providers: providers, repo: repo, users: users, hasher: &BcryptHasher{}, logger: logger, Now: time.Now}
+}
+
+// Providers returns the configured providers in configuration order.
+func (s *OIDCService) Providers() []models.OIDCProvider {
+	providers := make([]models.OIDCProvider, 0, len(s.providers))
+	for _, p := range s.providers {
+		providers = append(providers, p.Info())
+	}
+	return providers
+}
+
+// Start begins a login at the provider and returns the URL to send the
+// browser to and the state of the login. The caller binds the state to the
+// browser, the provider redirect carrying it may be opened in another one.
+// With a linkUserID the provider account is linked to that user instead.
+func (s *OIDCService) Start(ctx context.Context, provider string, linkUserID int) (string, string, error) {
+	p := s.provider(provider)
+	if p == nil {
+		return "", "", ErrOIDCProviderUnknown
+	}
+
+	var state, nonce, verifier string
+	for _, token := range []*string{&state, &nonce, &verifier} {
+		var err error
+		if *token, err = newRandomToken(32); err != nil {
+			return "", "", err
+		}
+	}
+
+	authURL, err := p.AuthorizationURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := s.Now()
+	if _, err := s.repo.DeleteExpiredOIDCLogins(ctx, now); err != nil {
+		return "", "", err
+	}
+	if err := s.repo.CreateOIDCLogin(ctx, &models.OIDCLogin{
+		StateHash:    hashToken(state),
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(OIDCLoginTTL),
+	}); err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// Callback finishes the login the state belongs to with the code the
+// provider redirected back with and returns the user to log in. userID is
+// the user making the request, 0 for guests, a link is only finished by the
+// user who started it.
+func (s *OIDCService) Callback(ctx context.Context, provider, code, state string, userID int) (int, string, error) {
+	p := s.provider(provider)
+	if p == nil {
+		return 0, "", ErrOIDCProviderUnknown
+	}
+
+	login, err := s.repo.UseOIDCLogin(ctx, hashToken(state), s.Now())
+	if err != nil {
+		return 0, "", err
+	}
+	if login.Provider != provider {
+		return 0, "", ErrOIDCStateInvalid
+	}
+	// Otherwise a link started by one user could attach the provider
+	// account of whoever opens the authorization URL.
+	if login.LinkUserID != 0 && login.LinkUserID != userID {
+		return 0, "", ErrOIDCStateInvalid
+	}
+
+	idToken, err := p.Exchange(ctx, code, login.CodeVerifier)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+	claims, err := p.VerifyIDToken(ctx, idToken, login.Nonce)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+
+	if login.LinkUserID != 0 {
+		userID, err = s.link(ctx, provider, claims, login.LinkUserID)
+	} else {
+		userID, err = s.resolve(ctx, provider, claims)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	username, err := s.users.GetUsername(ctx, userID)
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, username, nil
+}
+
+// Identities returns the provider accounts linked to the user.
+func (s *OIDCService) Identities(ctx context.Context, userID int) ([]models.Identity, error) {
+	return s.repo.ListIdentities(ctx, userID)
+}
+
+func (s *OIDCService) provider(name string) *OIDCProvider {
+	for _, p := range s.providers {
+		if p.config.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// link links the provider account to the user who started the login, an
+// already linked account is fine.
+func (s *OIDCService) link(ctx context.Context, provider string, claims *models.OIDCClaims, userID int) (int, error) {
+	linked, err := s.repo.FindIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		if linked != userID {
+			return 0, ErrIdentityTaken
+		}
+		return userID, nil
+	}
+	if !errors.Is(err, repositories.ErrIdentityNotFound) {
+		return 0, err
+	}
+
+	if err := s.createIdentity(ctx, provider, claims, userID); err != nil {
+		return 0, err
+	}
+	s.logger.Info("login provider linked",
+		"provider", provider,
+		"user_id", userID)
+	return userID, nil
+}
+
+// resolve finds the user of the provider account: the linked one, the one
+// with the same verified email, or a new one.
+func (s *OIDCService) resolve(ctx context.Context, provider string, claims *models.OIDCClaims) (int, error) {
+	userID, err := s.repo.FindIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, repositories.ErrIdentityNotFound) {
+		return 0, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified || models.ValidateEmail(claims.Email) != nil {
+		return 0, ErrOIDCEmailRequired
+	}
+
+	user, err := s.users.FindUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// An unverified email may have been registered by someone else
+		// to take over the account once its owner logs in. Accounts
+		// older than email verification count as verified but were
+		// never checked, they have no EmailVerifiedAt.
+		if !user.EmailVerified || user.EmailVerifiedAt == nil {
+			return 0, ErrOIDCAccountExists
+		}
+		if err := s.createIdentity(ctx, provider, claims, user.Id); err != nil {
+			return 0, err
+		}
+		s.logger.Info("login provider linked by verified email",
+			"provider", provider,
+			"user_id", user.Id)
+		return user.Id, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return 0, err
+	}
+
+	userID, err = s.createUser(ctx, claims)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.createIdentity(ctx, provider, claims, userID); err != nil {
+		return 0, err
+	}
+	s.logger.Info("user registered with login provider",
+		"provider", provider,
+		"user_id", userID)
+	return userID, nil
+}
+
+func (s *OIDCService) createIdentity(ctx context.Context, provider string, claims *models.OIDCClaims, userID int) error {
+	return s.repo.CreateIdentity(ctx, &models.Identity{
+		Provider:  provider,
+		Subject:   claims.Subject,
+		UserID:    userID,
+		Email:     claims.Email,
+		CreatedAt: s.Now(),
+	})
+}
+
+// createUser registers an account with a verified email and a random
+// password, the user can set one with a password reset.
+func (s *OIDCService) createUser(ctx context.Context, claims *models.OIDCClaims) (int, error) {
+	password, err := newRandomToken(32)
+	if err != nil {
+		return 0, err
+	}
+	hashed, err := s.hasher.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	base := usernameFrom(claims)
+	for attempt := 0; ; attempt++ {
+		username := base
+		if attempt > 0 {
+			n, err := rand.Int(rand.Reader, big.NewInt(10000))
+			if err != nil {
+				return 0, err
+			}
+			username = fmt.Sprintf("%s_%04d", base, n.Int64())
+		}
+
+		err := s.users.CreateUser(ctx, models.User{Username: username, Email: claims.Email}, string(hashed))
+		if err == nil {
+			userID, err := s.users.GetUserID(ctx, username)
+			if err != nil {
+				return 0, err
+			}
+			return userID, s.users.SetEmailVerified(ctx, userID, s.Now())
+		}
+		// The username is taken, the email was checked before.
+		if attempt == 5 {
+			return 0, err
+		}
+	}
+}
+
+// usernameFrom picks a username from the preferred username, the email or
+// the name in the claims.
+func usernameFrom(claims *models.OIDCClaims) string {
+	local, _, _ := strings.Cut(claims.Email, "@")
+	for _, candidate := range []string{claims.PreferredUsername, local, claims.Name} {
+		var b strings.Builder
+		for _, r := range candidate {
+			if b.Len() >= 20 {
+				break
+			}
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-' {
+				b.WriteRune(r)
+			}
+		}
+		if b.Len() > 0 {
+			return b.String()
+		}
+	}
+	return "user"
+}
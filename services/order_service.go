@@ -0,0 +1,144 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
+	"CartoonBurgers/repositories"
+	"context"
+	"errors"
+	"log/slog"
+)
+
+var (
+	ErrCartEmpty       = errors.New("cart is empty")
+	ErrCartUnavailable = errors.New("cart has products that are not available right now")
+)
+
+// OrderService turns the user cart into an order, re-pricing it and
+// re-checking its promo code at the moment of placement.
+type OrderService struct {
+	orders  *repositories.OrderRepository
+	carts   ports.CartService
+	pricer  *CartPricer
+	promos  *PromoService
+	loyalty *LoyaltyService
+	logger  *slog.Logger
+}
+
+func NewOrderService(orders *repositories.OrderRepository, carts ports.CartService, pricer *CartPricer, promos *PromoService, loyalty *LoyaltyService, logger *slog.Logger) *OrderService {
+	return &OrderService{orders: orders, carts: carts, pricer: pricer, promos: promos, loyalty: loyalty, logger: logger}
+}
+
+// PlaceOrder places the user cart, paying bonusPoints of it with points.
+func (s *OrderService) PlaceOrder(ctx context.Context, userID int, bonusPoints int64) (*models.Order, error) {
+	cartID := UserCartID(userID)
+
+	cart, err := s.carts.GetCart(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := s.carts.GetPromoCode(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := s.place(ctx, userID, cart, code, bonusPoints, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only what was ordered leaves the cart, items added meanwhile stay.
+	if err := s.carts.RemoveOrdered(ctx, cartID, cart, code); err != nil {
+		s.logger.Error("failed to clear cart after order",
+			"order_id", order.ID,
+			"error", err.Error())
+	}
+
+	return order, nil
+}
+
+// place prices cart and stores it as an order of userID. For a group cart
+// the order also gets the per person subtotals and closes the cart.
+func (s *OrderService) place(ctx context.Context, userID int, cart []models.CartItem, code string, bonusPoints int64, group *models.GroupCart) (*models.Order, error) {
+	if len(cart) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	priced, err := s.pricer.Price(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range priced.Items {
+		if line.Unavailable {
+			return nil, ErrCartUnavailable
+		}
+	}
+
+	if err := s.promos.ApplyTierPerks(ctx, userID, priced); err != nil {
+		return nil, err
+	}
+
+	var promo *models.PromoCode
+	if code != "" {
+		if promo, err = s.promos.ApplyCode(ctx, code, userID, priced); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.loyalty.ApplySpend(ctx, userID, bonusPoints, priced); err != nil {
+		return nil, err
+	}
+
+	paid := priced.GoodsTotal() - bonusPoints*MinorUnits
+	earned, err := s.loyalty.Earn(ctx, userID, priced, paid)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.loyalty.Now()
+	order := &models.Order{
+		UserID:      userID,
+		Status:      models.OrderPlaced,
+		Items:       make([]models.OrderItem, 0, len(priced.Items)),
+		Subtotal:    priced.Subtotal,
+		DeliveryFee: priced.DeliveryFee,
+		Discount:    priced.Discount,
+		Total:       priced.Total,
+		PromoCode:   priced.PromoCode,
+		CreatedAt:   now,
+
+		BonusSpent:     max(bonusPoints, 0),
+		BonusEarned:    earned,
+		BonusExpiresAt: s.loyalty.ExpiresAt(now),
+	}
+	for _, line := range priced.Items {
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID: line.ProductID,
+			Name:      line.Name,
+			Quantity:  line.Quantity,
+			UnitPrice: line.UnitPrice,
+			LineTotal: line.LineTotal,
+		})
+	}
+
+	if group != nil {
+		order.GroupCartID = group.ID
+		for _, share := range groupShares(group, priced) {
+			if len(share.Items) == 0 {
+				continue
+			}
+			order.Participants = append(order.Participants, models.OrderParticipant{
+				UserID:   share.UserID,
+				Username: share.Username,
+				Subtotal: share.Subtotal,
+			})
+		}
+	}
+
+	if err := s.orders.CreateOrder(ctx, order, promo); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
+	"CartoonBurgers/repositories"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	DefaultPasswordResetTTL      = time.Hour
+	DefaultPasswordResetCooldown = time.Minute
+)
+
+var ErrResetTokenInvalid = repositories.ErrOneTimeTokenInvalid
+
+// PasswordResetService mails single use reset links and sets the new
+// password. A reset logs the user out everywhere.
+type PasswordResetService struct {
+	users    *repositories.UserRepository
+	tokens   *repositories.OneTimeTokenRepository
+	logins   *TokenService
+	sessions IRedisSessions
+	throttle *LoginThrottle
+	mailer   ports.Mailer
+	hasher   IPasswordHasher
+	resetURL string
+	ttl      time.Duration
+	cooldown time.Duration
+	logger   *slog.Logger
+	pending  sync.WaitGroup
+
+	// Now is used for token lifetimes, time.Now by default.
+	Now func() time.Time
+}
+
+// NewPasswordResetService returns the service. The token is appended to
+// resetURL as the token query parameter, an account gets one link per
+// cooldown. Zero durations fall back to the defaults. The throttle is
+// optional, a reset lifts the login lockout of the account.
+func NewPasswordResetService(users *repositories.UserRepository, tokens *repositories.OneTimeTokenRepository, logins *TokenService, sessions IRedisSessions, throttle *LoginThrottle, mailer ports.Mailer, resetURL string, ttl, cooldown time.Duration, logger *slog.Logger) *PasswordResetService {
+	if ttl <= 0 {
+		ttl = DefaultPasswordResetTTL
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultPasswordResetCooldown
+	}
+	return &PasswordResetService{
+		users:    users,
+		tokens:   tokens,
+		logins:   logins,
+		sessions: sessions,
+		throttle: throttle,
+		mailer:   mailer,
+		hasher:   &BcryptHasher{},
+		resetURL: resetURL,
+		ttl:      ttl,
+		cooldown: cooldown,
+		logger:   logger,
+		Now:      time.Now,
+	}
+}
+
+// Forgot mails a reset link to the user with the email in the background
+// and returns right away, callers must not be able to tell from the answer
+// or its timing whether an account exists. Failures are only logged, see
+// Wait.
+func (s *PasswordResetService) Forgot(ctx context.Context, email string) {
+	ctx = context.WithoutCancel(ctx)
+
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+
+		if err := s.forgot(ctx, email); err != nil {
+			s.logger.Error("failed to issue password reset", "error", err.Error())
+		}
+	}()
+}
+
+// Wait waits for the reset mails Forgot is sending.
+func (s *PasswordResetService) Wait() {
+	s.pending.Wait()
+}
+
+func (s *PasswordResetService) forgot(ctx context.Context, email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil
+	}
+
+	user, err := s.users.FindUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.logger.Info("password reset requested for unknown email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	last, ok, err := s.tokens.LastOneTimeTokenAt(ctx, user.Id, models.TokenPasswordReset)
+	if err != nil {
+		return err
+	}
+	if ok && last.Add(s.cooldown).After(s.Now()) {
+		s.logger.Info("password reset throttled", "user_id", user.Id)
+		return nil
+	}
+
+	token, err := newRandomToken(32)
+	if err != nil {
+		return err
+	}
+	now := s.Now()
+	if err := s.tokens.CreateOneTimeToken(ctx, &models.OneTimeToken{
+		UserID:    user.Id,
+		Purpose:   models.TokenPasswordReset,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}); err != nil {
+		return err
+	}
+
+	if err := s.mailer.Send(ctx, s.resetMail(user, token)); err != nil {
+		s.logger.Error("failed to send password reset mail",
+			"user_id", user.Id,
+			"error", err.Error())
+		return nil
+	}
+
+	s.logger.Info("password reset mail sent", "user_id", user.Id)
+	return nil
+}
+
+// Reset sets the password of the user the token was mailed to, revokes all
+// of their logins and lifts their login lockout. The token works once.
+func (s *PasswordResetService) Reset(ctx context.Context, token, password string) error {
+	if err := models.ValidatePassword(password); err != nil {
+		return err
+	}
+	if token == "" {
+		return ErrResetTokenInvalid
+	}
+
+	hashed, err := s.hasher.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	userID, err := s.tokens.UseOneTimeToken(ctx, models.TokenPasswordReset, hashToken(token), s.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := s.users.SetPassword(ctx, userID, string(hashed)); err != nil {
+		return err
+	}
+	if err := s.logins.RevokeAll(ctx, s.sessions, userID); err != nil {
+		return err
+	}
+	if s.throttle != nil {
+		username, err := s.users.GetUsername(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.throttle.Unlock(ctx, username); err != nil {
+			return err
+		}
+	}
+
+	s.logger.Info("password reset", "user_id", userID)
+	return nil
+}
+
+func (s *PasswordResetService) resetMail(user *models.User, token string) models.Mail {
+	link := s.resetURL + "?token=" + url.QueryEscape(token)
+	return models.Mail{
+		To:      user.Email,
+		Subject: "Cartoon Burgers password reset",
+		Body: fmt.Sprintf("Hello, %s!\n\n"+
+			"Follow the link to pick a new password:\n%s\n\n"+
+			"The link works once and expires in %s. If you did not ask for a reset, ignore this mail.\n",
+			user.Username, link, s.ttl),
+	}
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
+	"CartoonBurgers/repositories"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+)
+
+const (
+	DefaultPhoneCodeTTL      = 5 * time.Minute
+	DefaultPhoneCodeCooldown = time.Minute
+	// PhoneCodeAttempts is how many wrong guesses a code takes.
+	PhoneCodeAttempts = 5
+	// PhoneCodesPerHour limits the SMS sent to one phone, every code costs
+	// money and a stream of them annoys the owner.
+	PhoneCodesPerHour = 5
+	phoneCodeWindow   = time.Hour
+)
+
+var (
+	ErrInvalidPhone       = models.ErrInvalidPhone
+	ErrPhoneCodeInvalid   = repositories.ErrPhoneCodeInvalid
+	ErrPhoneTaken         = repositories.ErrPhoneTaken
+	ErrPhoneAlreadyLinked = errors.New("phone is already linked")
+	ErrPhoneCodeThrottled = errors.New("code was sent recently")
+)
+
+// PhoneService logs users in with codes sent by SMS to the phone linked to
+// their account, and links phones after the user confirms a code.
+type PhoneService struct {
+	users    *repositories.UserRepository
+	codes    *repositories.PhoneRepository
+	sender   ports.SMSSender
+	region   models.PhoneRegion
+	ttl      time.Duration
+	cooldown time.Duration
+	logger   *slog.Logger
+
+	// Now is used for code lifetimes and throttling, time.Now by default.
+	Now func() time.Time
+}
+
+// NewPhoneService returns the service. Numbers without a country code are
+// read in region. A new code can be sent every cooldown, zero durations
+// fall back to the defaults.
+func NewPhoneService(users *repositories.UserRepository, codes *repositories.PhoneRepository, sender ports.SMSSender, region models.PhoneRegion, ttl, cooldown time.Duration, logger *slog.Logger) *PhoneService {
+	if ttl <= 0 {
+		ttl = DefaultPhoneCodeTTL
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultPhoneCodeCooldown
+	}
+	return &PhoneService{
+		users:    users,
+		codes:    codes,
+		sender:   sender,
+		region:   region,
+		ttl:      ttl,
+		cooldown: cooldown,
+		logger:   logger,
+		Now:      time.Now,
+	}
+}
+
+// SendLoginCode texts a login code to the phone when it is linked to an
+// account. Unlinked phones get no SMS but are throttled the same, callers
+// must not be able to tell whether a phone is linked. When throttled it
+// returns ErrPhoneCodeThrottled and how long to wait.
+func (s *PhoneService) SendLoginCode(ctx context.Context, raw string) (time.Duration, error) {
+	phone, err := models.NormalizePhone(raw, s.region)
+	if err != nil {
+		return 0, err
+	}
+	if wait, err := s.throttle(ctx, phone); err != nil {
+		return wait, err
+	}
+
+	user, err := s.users.FindUserByPhone(ctx, phone)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.logger.Info("login code requested for unlinked phone")
+		// The code is stored for throttling, it belongs to no user and
+		// never logs anyone in.
+		_, err := s.issue(ctx, phone, models.PhoneCodeLogin, 0)
+		return 0, err
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	code, err := s.issue(ctx, phone, models.PhoneCodeLogin, user.Id)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.send(ctx, phone, code); err != nil {
+		return 0, err
+	}
+
+	s.logger.Info("login code sent", "user_id", user.Id)
+	return 0, nil
+}
+
+// Login checks the login code sent to the phone and returns the user the
+// phone is linked to. A code works once and stops working after
+// PhoneCodeAttempts wrong guesses.
+func (s *PhoneService) Login(ctx context.Context, raw, code string) (int, string, error) {
+	phone, err := models.NormalizePhone(raw, s.region)
+	if err != nil {
+		return 0, "", err
+	}
+
+	issued, err := s.check(ctx, models.PhoneCodeLogin, phone, code, 0)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// The phone may have been unlinked or moved to another account since
+	// the code was sent.
+	user, err := s.users.FindUserByPhone(ctx, phone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", ErrPhoneCodeInvalid
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if issued.UserID == 0 || user.Id != issued.UserID {
+		return 0, "", ErrPhoneCodeInvalid
+	}
+	return user.Id, user.Username, nil
+}
+
+// SendLinkCode texts a code the user confirms the phone with, see Link.
+// When throttled it returns ErrPhoneCodeThrottled and how long to wait.
+func (s *PhoneService) SendLinkCode(ctx context.Context, userID int, raw string) (time.Duration, error) {
+	phone, err := models.NormalizePhone(raw, s.region)
+	if err != nil {
+		return 0, err
+	}
+
+	owner, err := s.users.FindUserByPhone(ctx, phone)
+	switch {
+	case err == nil && owner.Id == userID:
+		return 0, ErrPhoneAlreadyLinked
+	case err == nil:
+		return 0, ErrPhoneTaken
+	case !errors.Is(err, sql.ErrNoRows):
+		return 0, err
+	}
+
+	if wait, err := s.throttle(ctx, phone); err != nil {
+		return wait, err
+	}
+	code, err := s.issue(ctx, phone, models.PhoneCodeLink, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.send(ctx, phone, code); err != nil {
+		return 0, err
+	}
+
+	s.logger.Info("phone confirmation code sent", "user_id", userID)
+	return 0, nil
+}
+
+// Link links the phone to the user once they enter the code sent to it,
+// replacing the phone they had.
+func (s *PhoneService) Link(ctx context.Context, userID int, raw, code string) error {
+	phone, err := models.NormalizePhone(raw, s.region)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.check(ctx, models.PhoneCodeLink, phone, code, userID); err != nil {
+		return err
+	}
+	if err := s.users.SetPhone(ctx, userID, phone); err != nil {
+		return err
+	}
+
+	s.logger.Info("phone linked", "user_id", userID)
+	return nil
+}
+
+// Unlink removes the phone of the user, phone login stops working for them.
+func (s *PhoneService) Unlink(ctx context.Context, userID int) error {
+	if err := s.users.SetPhone(ctx, userID, ""); err != nil {
+		return err
+	}
+
+	s.logger.Info("phone unlinked", "user_id", userID)
+	return nil
+}
+
+// PurgeExpired deletes the codes that can neither be used nor count for
+// throttling any more.
+func (s *PhoneService) PurgeExpired(ctx context.Context) error {
+	_, err := s.codes.DeleteExpiredPhoneCodes(ctx, s.Now().Add(-phoneCodeWindow))
+	return err
+}
+
+// throttle allows one code per cooldown and PhoneCodesPerHour codes per
+// hour to a phone.
+func (s *PhoneService) throttle(ctx context.Context, phone string) (time.Duration, error) {
+	now := s.Now()
+	sent, err := s.codes.PhoneCodesSince(ctx, phone, now.Add(-phoneCodeWindow))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(sent) > 0 {
+		if wait := sent[0].Add(s.cooldown).Sub(now); wait > 0 {
+			return wait, ErrPhoneCodeThrottled
+		}
+	}
+	if len(sent) >= PhoneCodesPerHour {
+		// Wait until the oldest code that counts leaves the window.
+		if wait := sent[PhoneCodesPerHour-1].Add(phoneCodeWindow).Sub(now); wait > 0 {
+			return wait, ErrPhoneCodeThrottled
+		}
+	}
+	return 0, nil
+}
+
+// issue stores a new code for the phone, earlier codes stop working.
+func (s *PhoneService) issue(ctx context.Context, phone string, purpose models.PhoneCodePurpose, userID int) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	now := s.Now()
+	if err := s.codes.CreatePhoneCode(ctx, &models.PhoneCode{
+		Phone:     phone,
+		Purpose:   purpose,
+		UserID:    userID,
+		CodeHash:  hashToken(code),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// check uses the code when it matches the latest one sent to the phone and
+// counts a failed attempt when it does not. A userID other than 0 only
+// accepts codes sent for that user.
+func (s *PhoneService) check(ctx context.Context, purpose models.PhoneCodePurpose, phone, code string, userID int) (*models.PhoneCode, error) {
+	now := s.Now()
+	issued, err := s.codes.FindPhoneCode(ctx, purpose, phone, now)
+	if err != nil {
+		return nil, err
+	}
+
+	match := subtle.ConstantTimeCompare([]byte(hashToken(code)), []byte(issued.CodeHash)) == 1
+	if !match || (userID != 0 && issued.UserID != userID) {
+		if err := s.codes.FailPhoneCode(ctx, issued.ID, PhoneCodeAttempts, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrPhoneCodeInvalid
+	}
+	if err := s.codes.UsePhoneCode(ctx, issued.ID, now); err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+func (s *PhoneService) send(ctx context.Context, phone, code string) error {
+	return s.sender.Send(ctx, models.SMS{
+		To:   phone,
+		Body: fmt.Sprintf("Cartoon Burgers code: %s. It expires in %s, do not share it with anyone.", code, s.ttl),
+	})
+}
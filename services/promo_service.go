@@ -0,0 +1,183 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrPromoNotFound      = errors.New("promo code not found")
+	ErrPromoInactive      = errors.New("promo code is not active")
+	ErrPromoNotApplicable = errors.New("promo code does not apply to this cart")
+	ErrPromoLoginRequired = errors.New("log in to use this promo code")
+	ErrPromoUsageLimit    = repositories.ErrPromoUsageLimit
+	ErrPromoUserLimit     = repositories.ErrPromoUserLimit
+	ErrPromoFirstOrder    = repositories.ErrPromoFirstOrder
+)
+
+// PromoService checks promo code conditions and turns codes into cart
+// discounts. Redemption happens in OrderRepository.CreateOrder.
+type PromoService struct {
+	promos *repositories.PromoRepository
+	orders *repositories.OrderRepository
+	tiers  *TierService
+
+	// Now is used to check validity dates, time.Now by default.
+	Now func() time.Time
+}
+
+func NewPromoService(promos *repositories.PromoRepository, orders *repositories.OrderRepository, tiers *TierService) *PromoService {
+	return &PromoService{promos: promos, orders: orders, tiers: tiers, Now: time.Now}
+}
+
+// ApplyTierPerks applies the perks of the user's loyalty tier to the cart.
+// Free delivery removes the fee itself, so a free delivery code on top of it
+// reports that delivery is already free.
+func (s *PromoService) ApplyTierPerks(ctx context.Context, userID int, cart *models.PricedCart) error {
+	if userID == 0 {
+		return nil
+	}
+
+	tier, err := s.tiers.UserTier(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if tier.FreeDelivery && cart.DeliveryFee > 0 {
+		cart.DeliveryFee = 0
+		totalCart(cart)
+	}
+	return nil
+}
+
+func (s *PromoService) Find(ctx context.Context, code string) (*models.PromoCode, error) {
+	promo, err := s.promos.FindPromoByCode(ctx, models.NormalizePromoCode(code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPromoNotFound
+	}
+	return promo, err
+}
+
+// ApplyCode finds the code and applies it to the cart, see Apply.
+func (s *PromoService) ApplyCode(ctx context.Context, code string, userID int, cart *models.PricedCart) (*models.PromoCode, error) {
+	promo, err := s.Find(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	return promo, s.Apply(ctx, promo, userID, cart)
+}
+
+// Apply checks every condition of the code for the user, 0 for guests, and
+// adds its discount to the cart. The cart is left untouched on error.
+func (s *PromoService) Apply(ctx context.Context, promo *models.PromoCode, userID int, cart *models.PricedCart) error {
+	if !promo.ActiveAt(s.Now()) {
+		return ErrPromoInactive
+	}
+	if promo.UsageLimit > 0 && promo.UsedCount >= promo.UsageLimit {
+		return ErrPromoUsageLimit
+	}
+	if cart.Subtotal < promo.MinSubtotal {
+		return fmt.Errorf("%w: minimum order is %d.%02d", ErrPromoNotApplicable, promo.MinSubtotal/MinorUnits, promo.MinSubtotal%MinorUnits)
+	}
+
+	if promo.FirstOrderOnly || promo.PerUserLimit > 0 || promo.MinTier != "" {
+		if userID == 0 {
+			return ErrPromoLoginRequired
+		}
+	}
+	if promo.MinTier != "" {
+		tier, err := s.tiers.UserTier(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if tier.Tier.Rank() < promo.MinTier.Rank() {
+			return fmt.Errorf("%w: for %s tier and above", ErrPromoNotApplicable, promo.MinTier)
+		}
+	}
+	if promo.FirstOrderOnly {
+		count, err := s.orders.CountUserOrders(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrPromoFirstOrder
+		}
+	}
+	if promo.PerUserLimit > 0 {
+		count, err := s.promos.CountPromoRedemptions(ctx, promo.ID, userID)
+		if err != nil {
+			return err
+		}
+		if count >= promo.PerUserLimit {
+			return ErrPromoUserLimit
+		}
+	}
+
+	amount, err := promoDiscount(promo, cart)
+	if err != nil {
+		return err
+	}
+
+	cart.Discounts = append(cart.Discounts, models.CartDiscount{Code: promo.Code, Description: promo.Description, Amount: amount,
+		Delivery: promo.Kind == models.PromoFreeDelivery})
+	cart.PromoCode = promo.Code
+	totalCart(cart)
+
+	return nil
+}
+
+// promoDiscount computes the discount of the code in minor units. Percent and
+// fixed discounts only count lines of the code's category when it has one.
+func promoDiscount(promo *models.PromoCode, cart *models.PricedCart) (int64, error) {
+	var eligible int64
+	for _, line := range cart.Items {
+		if line.Unavailable {
+			continue
+		}
+		if promo.CategoryID != nil && line.CategoryID != *promo.CategoryID {
+			continue
+		}
+		eligible += line.LineTotal
+	}
+
+	if eligible == 0 {
+		return 0, ErrPromoNotApplicable
+	}
+
+	switch promo.Kind {
+	case models.PromoPercent:
+		return eligible * promo.Value / 100, nil
+
+	case models.PromoFixed:
+		return min(promo.Value, eligible), nil
+
+	case models.PromoFreeItem:
+		// Codes are validated when stored, rows written before that may
+		// still have no FreeEvery.
+		if promo.FreeEvery <= 0 {
+			return 0, ErrPromoNotApplicable
+		}
+		for _, line := range cart.Items {
+			if line.Unavailable || promo.ProductID == nil || line.ProductID != *promo.ProductID {
+				continue
+			}
+			if free := line.Quantity / promo.FreeEvery; free > 0 {
+				return int64(free) * line.UnitPrice, nil
+			}
+		}
+		return 0, fmt.Errorf("%w: add %d of the product", ErrPromoNotApplicable, promo.FreeEvery)
+
+	case models.PromoFreeDelivery:
+		if cart.DeliveryFee == 0 {
+			return 0, fmt.Errorf("%w: delivery is already free", ErrPromoNotApplicable)
+		}
+		return cart.DeliveryFee, nil
+	}
+
+	return 0, ErrPromoNotApplicable
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrUnknownRole  = errors.New("unknown role")
+	ErrImpliedRole  = errors.New("every user has the customer role")
+	ErrUserNotFound = errors.New("user not found")
+	ErrLastAdmin    = repositories.ErrLastAdmin
+)
+
+// RoleService grants and revokes roles. Tokens carry the roles of the user
+// at the time they were issued, so a change takes effect with the next
+// token refresh.
+type RoleService struct {
+	roles  *repositories.RoleRepository
+	users  *repositories.UserRepository
+	logger *slog.Logger
+
+	// Now stamps grants, time.Now by default.
+	Now func() time.Time
+}
+
+func NewRoleService(roles *repositories.RoleRepository, users *repositories.UserRepository, logger *slog.Logger) *RoleService {
+	return &RoleService{roles: roles, users: users, logger: logger, Now: time.Now}
+}
+
+// UserRoles returns the granted roles of the user followed by RoleCustomer.
+func (s *RoleService) UserRoles(ctx context.Context, userID int) ([]models.Role, error) {
+	roles, err := s.roles.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return append(roles, models.RoleCustomer), nil
+}
+
+// Grant grants role to the user, grantedBy is the admin doing it.
+func (s *RoleService) Grant(ctx context.Context, userID int, role models.Role, grantedBy int) error {
+	if err := s.checkRole(ctx, userID, role); err != nil {
+		return err
+	}
+
+	if err := s.roles.GrantRole(ctx, userID, role, grantedBy, s.Now()); err != nil {
+		return err
+	}
+
+	s.logger.Info("role granted",
+		"user_id", userID,
+		"role", role,
+		"granted_by", grantedBy)
+	return nil
+}
+
+// Revoke revokes role from the user, the last admin keeps the admin role.
+func (s *RoleService) Revoke(ctx context.Context, userID int, role models.Role, revokedBy int) error {
+	if err := s.checkRole(ctx, userID, role); err != nil {
+		return err
+	}
+
+	revoked, err := s.roles.RevokeRole(ctx, userID, role)
+	if err != nil {
+		return err
+	}
+
+	if revoked {
+		s.logger.Info("role revoked",
+			"user_id", userID,
+			"role", role,
+			"revoked_by", revokedBy)
+	}
+	return nil
+}
+
+// Bootstrap grants the admin role to the existing users among usernames
+// while there is no admin yet. It runs on startup so the first admin can be
+// set in the config, after that admins are managed through the admin API and
+// a revoked admin is not granted the role again.
+func (s *RoleService) Bootstrap(ctx context.Context, usernames []string) error {
+	admins, err := s.roles.CountRole(ctx, models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	for _, username := range usernames {
+		userID, err := s.users.GetUserID(ctx, username)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warn("bootstrap admin is not registered",
+				"username", username)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.roles.GrantRole(ctx, userID, models.RoleAdmin, 0, s.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RoleService) checkRole(ctx context.Context, userID int, role models.Role) error {
+	if !role.Valid() {
+		return ErrUnknownRole
+	}
+	if role == models.RoleCustomer {
+		return ErrImpliedRole
+	}
+
+	if _, err := s.users.GetUsername(ctx, userID); errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	DefaultKeyRotation      = 30 * 24 * time.Hour
+	DefaultKeyCheckInterval = time.Minute
+
+	// JWKSCacheTTL is how long clients may cache /.well-known/jwks.json.
+	JWKSCacheTTL = 5 * time.Minute
+)
+
+var ErrNoSigningKey = errors.New("no active signing key")
+
+// JWTKeys signs access tokens and finds the key to verify one with.
+type JWTKeys interface {
+	Sign(claims jwt.MapClaims) (string, error)
+	// Keyfunc is passed to jwt.Parse, it rejects tokens signed with another
+	// algorithm than their key.
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	// JWKS returns the public keys other services verify tokens with.
+	JWKS() models.JWKS
+}
+
+// HMACKeys signs HS256 tokens with a shared secret. Anyone who can verify
+// the tokens can also mint them, it is kept for existing deployments.
+type HMACKeys struct {
+	secret []byte
+}
+
+var _ JWTKeys = (*HMACKeys)(nil)
+
+func NewHMACKeys(secret []byte) *HMACKeys {
+	return &HMACKeys{secret: secret}
+}
+
+func (k *HMACKeys) Sign(claims jwt.MapClaims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+}
+
+func (k *HMACKeys) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, errors.New("unexpected signed method")
+	}
+	return k.secret, nil
+}
+
+// JWKS is empty, a shared secret must not be published.
+func (k *HMACKeys) JWKS() models.JWKS {
+	return models.JWKS{Keys: []models.JWK{}}
+}
+
+// RotatingKeys signs RS256 or EdDSA tokens with generated keys stored in
+// the database, so every instance of the app uses the same ones. Rotate
+// replaces the signing key every rotation period; tokens carry the key id
+// in the kid header and replaced keys keep verifying until the tokens
+// they signed expired.
+type RotatingKeys struct {
+	repo      *repositories.SigningKeyRepository
+	algorithm string
+	rotation  time.Duration
+	// prepublish is how long a new key is published before it signs, every
+	// instance reloads the keys and JWKS caches expire in the meantime.
+	prepublish time.Duration
+	// verifyFor is how long a replaced key keeps verifying, the lifetime of
+	// an access token.
+	verifyFor time.Duration
+	logger    *slog.Logger
+
+	mu   sync.RWMutex
+	keys []signingKey
+
+	// Now is used for key lifetimes, time.Now by default.
+	Now func() time.Time
+}
+
+var _ JWTKeys = (*RotatingKeys)(nil)
+
+type signingKey struct {
+	models.SigningKey
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// NewRotatingKeys returns the keys for RS256 or EdDSA. checkInterval is how
+// often Rotate runs, zero durations fall back to the defaults. Call Rotate
+// before signing the first token.
+func NewRotatingKeys(repo *repositories.SigningKeyRepository, algorithm string, rotation, checkInterval, accessTTL time.Duration, logger *slog.Logger) (*RotatingKeys, error) {
+	if jwtMethod(algorithm) == nil {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if rotation <= 0 {
+		rotation = DefaultKeyRotation
+	}
+	if checkInterval <= 0 {
+		checkInterval = DefaultKeyCheckInterval
+	}
+	if accessTTL <= 0 {
+		accessTTL = DefaultAccessTokenTTL
+	}
+	return &RotatingKeys{
+		repo:       repo,
+		algorithm:  algorithm,
+		rotation:   rotation,
+		prepublish: 2*checkInterval + JWKSCacheTTL,
+		verifyFor:  accessTTL,
+		logger:     logger,
+		Now:        time.Now,
+	}, nil
+}
+
+// Rotate creates a new key when the latest one is older than the rotation
+// period or uses another algorithm, drops expired keys and reloads the
+// keys. It runs as a background job on every instance.
+func (k *RotatingKeys) Rotate(ctx context.Context) error {
+	now := k.Now()
+	latest, err := k.repo.LatestSigningKey(ctx)
+	if err != nil && !errors.Is(err, repositories.ErrSigningKeyNotFound) {
+		return err
+	}
+
+	if latest == nil || latest.Algorithm != k.algorithm || now.Sub(latest.ActivatesAt) >= k.rotation {
+		// Without a usable key nothing can be signed, the first key and a
+		// key for a new algorithm activate at once.
+		activatesAt := now.Add(k.prepublish)
+		if latest == nil || latest.Algorithm != k.algorithm {
+			activatesAt = now
+		}
+
+		key, err := newSigningKey(k.algorithm, now, activatesAt)
+		if err != nil {
+			return err
+		}
+		if err := k.repo.CreateSigningKey(ctx, key); err != nil {
+			return err
+		}
+		if err := k.repo.ExpireSigningKeys(ctx, key.ID, activatesAt.Add(k.verifyFor)); err != nil {
+			return err
+		}
+
+		k.logger.Info("signing key rotated",
+			"kid", key.ID,
+			"algorithm", key.Algorithm,
+			"activates_at", key.ActivatesAt)
+	}
+
+	if _, err := k.repo.DeleteExpiredSigningKeys(ctx, now); err != nil {
+		return err
+	}
+	return k.Reload(ctx)
+}
+
+// Reload reads the keys that did not expire from the database.
+func (k *RotatingKeys) Reload(ctx context.Context) error {
+	stored, err := k.repo.ListSigningKeys(ctx, k.Now())
+	if err != nil {
+		return err
+	}
+
+	keys := make([]signingKey, 0, len(stored))
+	for _, s := range stored {
+		key, err := parseSigningKey(s)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", s.ID, err)
+		}
+		keys = append(keys, key)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Sign signs the claims with the newest active key.
+func (k *RotatingKeys) Sign(claims jwt.MapClaims) (string, error) {
+	now := k.Now()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		key := k.keys[i]
+		if key.ActivatesAt.After(now) || key.Algorithm != k.algorithm {
+			continue
+		}
+
+		token := jwt.NewWithClaims(key.method, claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.private)
+	}
+	return "", ErrNoSigningKey
+}
+
+func (k *RotatingKeys) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	now := k.Now()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.ID != kid {
+			continue
+		}
+		if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+			break
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New("unexpected signed method")
+		}
+		return key.public, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// JWKS returns the keys that did not expire, including the ones waiting to
+// activate.
+func (k *RotatingKeys) JWKS() models.JWKS {
+	now := k.Now()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := models.JWKS{Keys: []models.JWK{}}
+	for _, key := range k.keys {
+		if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+			continue
+		}
+		if jwk, ok := publicJWK(key); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func jwtMethod(algorithm string) jwt.SigningMethod {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA
+	default:
+		return nil
+	}
+}
+
+func newSigningKey(algorithm string, now, activatesAt time.Time) (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newRandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SigningKey{
+		ID:          id,
+		Algorithm:   algorithm,
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:   now,
+		ActivatesAt: activatesAt,
+	}, nil
+}
+
+func parseSigningKey(stored models.SigningKey) (signingKey, error) {
+	key := signingKey{SigningKey: stored, method: jwtMethod(stored.Algorithm)}
+	if key.method == nil {
+		return key, fmt.Errorf("unsupported signing algorithm %q", stored.Algorithm)
+	}
+
+	block, _ := pem.Decode([]byte(stored.PrivateKey))
+	if block == nil {
+		return key, errors.New("invalid PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return key, err
+	}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.private, key.public = private, &private.PublicKey
+	case ed25519.PrivateKey:
+		key.private, key.public = private, private.Public()
+	default:
+		return key, fmt.Errorf("unsupported private key %T", parsed)
+	}
+	if publicAlgorithm(key.public) != stored.Algorithm {
+		return key, errors.New("private key does not match the algorithm")
+	}
+	return key, nil
+}
+
+func publicAlgorithm(public crypto.PublicKey) string {
+	switch public.(type) {
+	case *rsa.PublicKey:
+		return AlgorithmRS256
+	case ed25519.PublicKey:
+		return AlgorithmEdDSA
+	default:
+		return ""
+	}
+}
+
+func publicJWK(key signingKey) (models.JWK, bool) {
+	jwk := models.JWK{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	default:
+		return jwk, false
+	}
+	return jwk, true
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// LogSMSSender writes messages to the log instead of sending them, for
+// local development until an SMS gateway is connected. Messages carry
+// login codes, it must not be used in production.
+type LogSMSSender struct {
+	logger *slog.Logger
+}
+
+var _ ports.SMSSender = (*LogSMSSender)(nil)
+
+func NewLogSMSSender(logger *slog.Logger) *LogSMSSender {
+	return &LogSMSSender{logger: logger}
+}
+
+func (s *LogSMSSender) Send(ctx context.Context, sms models.SMS) error {
+	s.logger.Info("sms", "to", sms.To, "body", sms.Body)
+	return nil
+}
+
+// InMemorySMSSender keeps sent messages in memory, tests read them from
+// Sent.
+type InMemorySMSSender struct {
+	mu   sync.Mutex
+	sent []models.SMS
+}
+
+var _ ports.SMSSender = (*InMemorySMSSender)(nil)
+
+func NewInMemorySMSSender() *InMemorySMSSender {
+	return &InMemorySMSSender{}
+}
+
+func (s *InMemorySMSSender) Send(ctx context.Context, sms models.SMS) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, sms)
+	return nil
+}
+
+// Sent returns a copy of the messages sent so far.
+func (s *InMemorySMSSender) Sent() []models.SMS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.SMS(nil), s.sent...)
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// TierWindow is the rolling period spend is summed over.
+const TierWindow = 365 * 24 * time.Hour
+
+// DefaultTierRules are used when the config has no tiers.
+var DefaultTierRules = []models.TierRule{
+	{Tier: models.TierBronze, MinSpend: 0, EarnMultiplier: 1, BirthdayBonus: 50},
+	{Tier: models.TierSilver, MinSpend: 1500000, EarnMultiplier: 1.5, BirthdayBonus: 100},
+	{Tier: models.TierGold, MinSpend: 5000000, EarnMultiplier: 2, FreeDelivery: true, BirthdayBonus: 200},
+}
+
+// TierService computes loyalty tiers from the spend of the last TierWindow.
+// Tiers are stored by the nightly Recalculate, users without a stored tier
+// get the lowest one.
+type TierService struct {
+	tiers    *repositories.TierRepository
+	bonus    *repositories.BonusRepository
+	rules    []models.TierRule
+	location *time.Location
+	// bonusLifetime is how long birthday points stay valid, 0 for ever.
+	bonusLifetime time.Duration
+	logger        *slog.Logger
+
+	// Now is used for the spend window and birthdays, time.Now by default.
+	Now func() time.Time
+}
+
+func NewTierService(tiers *repositories.TierRepository, bonus *repositories.BonusRepository, rules []models.TierRule, location *time.Location, bonusLifetime time.Duration, logger *slog.Logger) *TierService {
+	if len(rules) == 0 {
+		rules = DefaultTierRules
+	}
+	rules = append([]models.TierRule(nil), rules...)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].MinSpend < rules[j].MinSpend })
+
+	if location == nil {
+		location = time.Local
+	}
+
+	return &TierService{tiers: tiers, bonus: bonus, rules: rules, location: location, bonusLifetime: bonusLifetime, logger: logger, Now: time.Now}
+}
+
+// ruleFor returns the highest tier the spend reaches.
+func (s *TierService) ruleFor(spend int64) models.TierRule {
+	rule := s.rules[0]
+	for _, r := range s.rules {
+		if spend >= r.MinSpend {
+			rule = r
+		}
+	}
+	return rule
+}
+
+func (s *TierService) rule(tier models.Tier) models.TierRule {
+	for _, r := range s.rules {
+		if r.Tier == tier {
+			return r
+		}
+	}
+	return s.rules[0]
+}
+
+// UserTier returns the rule of the user's stored tier, the lowest tier for
+// guests and users that were not recalculated yet.
+func (s *TierService) UserTier(ctx context.Context, userID int) (models.TierRule, error) {
+	if userID == 0 {
+		return s.rules[0], nil
+	}
+
+	stored, err := s.tiers.GetUserTier(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s.rules[0], nil
+	}
+	if err != nil {
+		return models.TierRule{}, err
+	}
+
+	return s.rule(stored.Tier), nil
+}
+
+// Info describes the user's tier and how far the next one is.
+func (s *TierService) Info(ctx context.Context, userID int) (*models.TierInfo, error) {
+	info := &models.TierInfo{TierRule: s.rules[0]}
+
+	stored, err := s.tiers.GetUserTier(ctx, userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, err
+	default:
+		info.TierRule = s.rule(stored.Tier)
+		info.Spend = stored.Spend
+		info.ComputedAt = &stored.ComputedAt
+	}
+
+	for _, r := range s.rules {
+		if r.MinSpend > info.MinSpend {
+			info.NextTier = r.Tier
+			info.NextTierSpend = r.MinSpend
+			break
+		}
+	}
+
+	return info, nil
+}
+
+// Recalculate is the nightly job. It stores the tier of every user and
+// credits birthday rewards.
+func (s *TierService) Recalculate(ctx context.Context) error {
+	now := s.Now()
+
+	spend, err := s.tiers.GetSpendSince(ctx, now.Add(-TierWindow))
+	if err != nil {
+		return err
+	}
+
+	tiers := make([]models.UserTier, 0, len(spend))
+	for userID, total := range spend {
+		tiers = append(tiers, models.UserTier{UserID: userID, Tier: s.ruleFor(total).Tier, Spend: total, ComputedAt: now})
+	}
+	if err := s.tiers.SaveUserTiers(ctx, tiers); err != nil {
+		return err
+	}
+
+	return s.grantBirthdayBonuses(ctx, now)
+}
+
+func (s *TierService) grantBirthdayBonuses(ctx context.Context, now time.Time) error {
+	local := now.In(s.location)
+	monthDays := []string{local.Format("01-02")}
+
+	// People born on February 29 celebrate on the 28th in other years.
+	if monthDays[0] == "02-28" && local.AddDate(0, 0, 1).Day() == 1 {
+		monthDays = append(monthDays, "02-29")
+	}
+
+	users, err := s.tiers.GetBirthdayUsers(ctx, monthDays...)
+	if err != nil {
+		return err
+	}
+
+	yearStart := time.Date(local.Year(), 1, 1, 0, 0, 0, 0, s.location)
+	var expiresAt *time.Time
+	if s.bonusLifetime > 0 {
+		t := now.Add(s.bonusLifetime)
+		expiresAt = &t
+	}
+
+	for _, userID := range users {
+		rule, err := s.UserTier(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if rule.BirthdayBonus <= 0 {
+			continue
+		}
+
+		granted, err := s.bonus.GrantBirthdayBonus(ctx, userID, rule.BirthdayBonus, now, yearStart, expiresAt)
+		if err != nil {
+			return err
+		}
+		if granted {
+			s.logger.Info("birthday bonus granted",
+				"user_id", userID,
+				"tier", rule.Tier,
+				"points", rule.BirthdayBonus)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrRefreshTokenInvalid = repositories.ErrRefreshTokenInvalid
+	ErrRefreshTokenReused  = repositories.ErrRefreshTokenReused
+	ErrSessionNotFound     = repositories.ErrSessionNotFound
+)
+
+// TokenService issues short lived access tokens together with opaque
+// refresh tokens. Refresh tokens are single use: every refresh rotates the
+// token, and presenting a rotated one revokes all tokens of that login.
+// Every login is a session the user can list and end.
+type TokenService struct {
+	keys       JWTKeys
+	refresh    *repositories.RefreshTokenRepository
+	sessions   *repositories.SessionRepository
+	roles      *RoleService
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	logger     *slog.Logger
+
+	// Now is used for token lifetimes, time.Now by default.
+	Now func() time.Time
+}
+
+// NewTokenService returns the service, zero TTLs fall back to the defaults.
+func NewTokenService(keys JWTKeys, refresh *repositories.RefreshTokenRepository, sessions *repositories.SessionRepository, roles *RoleService, accessTTL, refreshTTL time.Duration, logger *slog.Logger) *TokenService {
+	if accessTTL <= 0 {
+		accessTTL = DefaultAccessTokenTTL
+	}
+	if refreshTTL <= 0 {
+		refreshTTL = DefaultRefreshTokenTTL
+	}
+	return &TokenService{keys: keys, refresh: refresh, sessions: sessions, roles: roles, accessTTL: accessTTL, refreshTTL: refreshTTL, logger: logger, Now: time.Now}
+}
+
+// Issue starts a new session for a login from the client.
+func (s *TokenService) Issue(ctx context.Context, username string, userID int, client models.SessionClient) (*models.TokenPair, error) {
+	return s.issue(ctx, username, userID, client, false)
+}
+
+// IssueMFA is Issue for a login that passed two factor authentication, the
+// tokens carry the mfa claim RequireMFA checks.
+func (s *TokenService) IssueMFA(ctx context.Context, username string, userID int, client models.SessionClient) (*models.TokenPair, error) {
+	return s.issue(ctx, username, userID, client, true)
+}
+
+func (s *TokenService) issue(ctx context.Context, username string, userID int, client models.SessionClient, mfa bool) (*models.TokenPair, error) {
+	family, err := newRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.Now()
+	if err := s.sessions.CreateSession(ctx, &models.Session{
+		ID:         family,
+		UserID:     userID,
+		Device:     DescribeDevice(client.UserAgent),
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}); err != nil {
+		return nil, err
+	}
+
+	refreshToken, stored, err := s.newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	stored.UserID = userID
+	stored.Family = family
+	stored.MFA = mfa
+	if err := s.refresh.CreateRefreshToken(ctx, stored); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.accessToken(ctx, username, userID, family, mfa)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// Refresh exchanges the refresh token for a new pair and marks the session
+// as seen from the client. A reused token ends its session, the access
+// tokens issued to it stop working through marks.
+func (s *TokenService) Refresh(ctx context.Context, marks IRedisSessions, refreshToken string, client models.SessionClient) (*models.TokenPair, error) {
+	next, stored, err := s.newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := s.refresh.RotateRefreshToken(ctx, hashToken(refreshToken), stored, s.Now())
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if err := RevokeSessionTokens(marks, old.Family, s.accessTTL); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessions.TouchSession(ctx, old.Family, DescribeDevice(client.UserAgent), client, s.Now()); err != nil {
+		s.logger.Error("failed to update session",
+			"user_id", old.UserID,
+			"error", err.Error())
+	}
+
+	accessToken, err := s.accessToken(ctx, old.Username, old.UserID, old.Family, old.MFA)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{AccessToken: accessToken, RefreshToken: next}, nil
+}
+
+// Revoke ends the login the refresh token belongs to.
+func (s *TokenService) Revoke(ctx context.Context, refreshToken string) error {
+	return s.refresh.RevokeRefreshTokenFamily(ctx, hashToken(refreshToken), s.Now())
+}
+
+// Sessions returns the active sessions of the user.
+func (s *TokenService) Sessions(ctx context.Context, userID int) ([]models.Session, error) {
+	return s.sessions.ListSessions(ctx, userID, s.Now())
+}
+
+// RevokeSession ends a session of the user: its refresh tokens are revoked
+// and its access tokens stop working. It fails with ErrSessionNotFound for
+// sessions of other users and ended ones.
+func (s *TokenService) RevokeSession(ctx context.Context, client IRedisSessions, userID int, sessionID string) error {
+	if err := s.sessions.RevokeSession(ctx, userID, sessionID, s.Now()); err != nil {
+		return err
+	}
+	return RevokeSessionTokens(client, sessionID, s.accessTTL)
+}
+
+// RevokeAll ends every login of the user: the refresh tokens are revoked and
+// access tokens issued until now stop working.
+func (s *TokenService) RevokeAll(ctx context.Context, client IRedisSessions, userID int) error {
+	now := s.Now()
+	if err := s.refresh.RevokeUserRefreshTokens(ctx, userID, now); err != nil {
+		return err
+	}
+	return RevokeSessions(client, userID, now, s.accessTTL)
+}
+
+// PurgeExpired deletes expired refresh tokens and the sessions left without
+// tokens, it runs as a background job.
+func (s *TokenService) PurgeExpired(ctx context.Context) error {
+	deleted, err := s.refresh.DeleteExpiredRefreshTokens(ctx, s.Now())
+	if err != nil {
+		return err
+	}
+	sessions, err := s.sessions.DeleteOrphanSessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	if deleted > 0 || sessions > 0 {
+		s.logger.Info("expired refresh tokens deleted", "tokens", deleted, "sessions", sessions)
+	}
+	return nil
+}
+
+// accessToken signs an access token with the current roles of the user.
+func (s *TokenService) accessToken(ctx context.Context, username string, userID int, sessionID string, mfa bool) (string, error) {
+	roles, err := s.roles.UserRoles(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	now := s.Now()
+	return NewAccessToken(s.keys, AccessClaims{
+		Username:  username,
+		UserID:    userID,
+		SessionID: sessionID,
+		Roles:     roles,
+		MFA:       mfa,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(s.accessTTL),
+	})
+}
+
+func (s *TokenService) newRefreshToken() (string, *models.RefreshToken, error) {
+	token, err := newRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := s.Now()
+	return token, &models.RefreshToken{TokenHash: hashToken(token), CreatedAt: now, ExpiresAt: now.Add(s.refreshTTL)}, nil
+}
+
+// AccessClaims are the claims of an access token.
+type AccessClaims struct {
+	Username string
+	UserID   int
+	// SessionID is the sid claim, tokens issued without a session can not
+	// be revoked one session at a time.
+	SessionID string
+	// Roles can be empty, the token then only grants RoleCustomer.
+	Roles []models.Role
+	// MFA is set when the login passed two factor authentication.
+	MFA       bool
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// NewAccessToken signs an access token with the keys.
+func NewAccessToken(keys JWTKeys, access AccessClaims) (string, error) {
+	claims := jwt.MapClaims{
+		"username": access.Username,
+		"user_id":  access.UserID,
+		"iat":      access.IssuedAt.Unix(),
+		"exp":      access.ExpiresAt.Unix(),
+	}
+	if access.SessionID != "" {
+		claims["sid"] = access.SessionID
+	}
+	if len(access.Roles) > 0 {
+		claims["roles"] = access.Roles
+	}
+	if access.MFA {
+		claims["mfa"] = true
+	}
+
+	return keys.Sign(claims)
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// newRandomToken returns size random bytes encoded for use in URLs.
+func newRandomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
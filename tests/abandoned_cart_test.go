@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	sent []models.Notification
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notification models.Notification) error {
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+func TestInMemoryCartService_IdleCarts(t *testing.T) {
+	ctx := context.Background()
+	carts := services.NewInMemoryCartService(services.CartLimits{})
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	carts.Now = func() time.Time { return now }
+
+	require.NoError(t, carts.AddToCart(ctx, services.UserCartID(1), models.CartItem{ProductID: 1, Quantity: 1}))
+	require.NoError(t, carts.AddToCart(ctx, services.SessionCartID("guest"), models.CartItem{ProductID: 1, Quantity: 1}))
+	now = now.Add(time.Hour)
+	require.NoError(t, carts.AddToCart(ctx, services.UserCartID(2), models.CartItem{ProductID: 1, Quantity: 1}))
+
+	idle, err := carts.IdleCarts(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{services.UserCartID(1)}, idle, "guest carts and fresh carts are not idle")
+
+	first, err := carts.MarkReminded(ctx, services.UserCartID(1))
+	require.NoError(t, err)
+	assert.True(t, first)
+	again, err := carts.MarkReminded(ctx, services.UserCartID(1))
+	require.NoError(t, err)
+	assert.False(t, again)
+
+	idle, err = carts.IdleCarts(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{services.UserCartID(2)}, idle)
+
+	require.NoError(t, carts.ClearCart(ctx, services.UserCartID(1)))
+	require.NoError(t, carts.AddToCart(ctx, services.UserCartID(1), models.CartItem{ProductID: 1, Quantity: 1}))
+	idle, err = carts.IdleCarts(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{services.UserCartID(1), services.UserCartID(2)}, idle, "clearing the cart resets the reminder")
+
+	require.NoError(t, carts.ForgetIdleCart(ctx, services.UserCartID(2), now.Add(-time.Hour)))
+	idle, err = carts.IdleCarts(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Contains(t, idle, services.UserCartID(2), "carts changed since are still tracked")
+	require.NoError(t, carts.ForgetIdleCart(ctx, services.UserCartID(2), now.Add(time.Hour)))
+	idle, err = carts.IdleCarts(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{services.UserCartID(1)}, idle)
+	items, err := carts.GetCart(ctx, services.UserCartID(2))
+	require.NoError(t, err)
+	assert.Len(t, items, 1, "forgetting a cart keeps its items")
+}
+
+func TestAbandonedCartService_Remind(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	alice := createTestUser(t, repo, "alice")
+	bob := createTestUser(t, repo, "bob")
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	carts := services.NewInMemoryCartService(services.CartLimits{})
+	carts.Now = func() time.Time { return now }
+	require.NoError(t, carts.AddToCart(ctx, services.UserCartID(alice), models.CartItem{ProductID: 1, Quantity: 2}))
+	require.NoError(t, carts.AddToCart(ctx, services.UserCartID(bob), models.CartItem{ProductID: 1, Quantity: 1}))
+	require.NoError(t, repo.SetOptOut(ctx, bob, models.EventAbandonedCart, true))
+
+	menu := services.NewMenuService(repo.ProductRerository, repo.CategoryRepository, "ru", time.UTC)
+	pricer := services.NewCartPricer(menu, services.CartLimits{}, services.DeliveryPricing{Fee: 19900})
+	notifier := &recordingNotifier{}
+	abandoned := services.NewAbandonedCartService(carts, pricer, repo.NotificationRepository, notifier, 24*time.Hour, slog.Default())
+
+	abandoned.Now = func() time.Time { return now.Add(time.Hour) }
+	require.NoError(t, abandoned.Remind(ctx))
+	assert.Empty(t, notifier.sent, "carts are not abandoned yet")
+
+	abandoned.Now = func() time.Time { return now.Add(25 * time.Hour) }
+	require.NoError(t, abandoned.Remind(ctx))
+	require.Len(t, notifier.sent, 1, "opted out users are skipped")
+	assert.Equal(t, models.EventAbandonedCart, notifier.sent[0].Event)
+	assert.Equal(t, alice, notifier.sent[0].UserID)
+	assert.Equal(t, int64(32000+19900), notifier.sent[0].Data["total"])
+
+	abandoned.Now = func() time.Time { return now.Add(72 * time.Hour) }
+	require.NoError(t, abandoned.Remind(ctx))
+	assert.Len(t, notifier.sent, 1, "one reminder per cart")
+
+	carol := createTestUser(t, repo, "carol")
+	require.NoError(t, carts.SetPromoCode(ctx, services.UserCartID(carol), "WELCOME"))
+	abandoned.Now = func() time.Time { return now.Add(96 * time.Hour) }
+	require.NoError(t, abandoned.Remind(ctx))
+	assert.Len(t, notifier.sent, 1, "empty carts get no reminder")
+	promo, err := carts.GetPromoCode(ctx, services.UserCartID(carol))
+	require.NoError(t, err)
+	assert.Equal(t, "WELCOME", promo, "empty carts are not cleared")
+	idle, err := carts.IdleCarts(ctx, now.Add(96*time.Hour))
+	require.NoError(t, err)
+	assert.NotContains(t, idle, services.UserCartID(carol))
+}
+
+func TestRedisCartService_IdleCarts(t *testing.T) {
+	ctx := context.Background()
+	carts, server := newTestRedisCartService(t, services.CartLimits{})
+	later := time.Now().Add(time.Hour)
+
+	require.NoError(t, carts.AddToCart(ctx, services.UserCartID(1), models.CartItem{ProductID: 1, Quantity: 1}))
+	require.NoError(t, carts.AddToCart(ctx, services.SessionCartID("guest"), models.CartItem{ProductID: 1, Quantity: 1}))
+	idle, err := carts.IdleCarts(ctx, later)
+	require.NoError(t, err)
+	assert.Equal(t, []string{services.UserCartID(1)}, idle)
+
+	first, err := carts.MarkReminded(ctx, services.UserCartID(1))
+	require.NoError(t, err)
+	assert.True(t, first)
+	again, err := carts.MarkReminded(ctx, services.UserCartID(1))
+	require.NoError(t, err)
+	assert.False(t, again)
+	idle, err = carts.IdleCarts(ctx, later)
+	require.NoError(t, err)
+	assert.Empty(t, idle)
+
+	server.FastForward(services.CartTTL)
+	assert.False(t, server.Exists("cart:reminded:"+services.UserCartID(1)), "the reminder expires with the cart")
+	idle, err = carts.IdleCarts(ctx, later)
+	require.NoError(t, err)
+	assert.Equal(t, []string{services.UserCartID(1)}, idle)
+
+	require.NoError(t, carts.ForgetIdleCart(ctx, services.UserCartID(1), time.Now().Add(-time.Hour)))
+	idle, err = carts.IdleCarts(ctx, later)
+	require.NoError(t, err)
+	assert.Equal(t, []string{services.UserCartID(1)}, idle, "carts changed since are still tracked")
+	require.NoError(t, carts.ForgetIdleCart(ctx, services.UserCartID(1), later))
+	idle, err = carts.IdleCarts(ctx, later)
+	require.NoError(t, err)
+	assert.Empty(t, idle)
+}
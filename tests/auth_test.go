@@ -140,6 +140,7 @@ func TestLoginHandler_TableDriven(t *testing.T) {
 			setupMocks: func(mur *MockUserRepository, mph *MockPasswordHasher) {
 				hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("correctpassword"), bcrypt.DefaultCost)
 				mur.On("GetUserByUsername", mock.Anything, "validuser").Return(string(hashedPassword), nil)
+				mur.On("GetUserID", mock.Anything, "validuser").Return(7, nil)
 				mph.On("CompareHashAndPassword", mock.Anything, mock.Anything).Return(nil)
 			},
 			expectedCode: http.StatusOK,
@@ -204,7 +205,7 @@ func TestLoginHandler_TableDriven(t *testing.T) {
 			handler := services.LoginHandler{
 				Repository: mockRepository,
 				Hasher:     mockHasher,
-				JwtKey:     []byte("test-secret-key"),
+				Keys:       services.NewHMACKeys([]byte("test-secret-key")),
 				Logger:     slog.Default(),
 			}
 
@@ -238,6 +239,7 @@ func TestLoginHandler_TableDriven(t *testing.T) {
 
 				if claims, ok := token.Claims.(jwt.MapClaims); ok {
 					assert.Equal(t, "validuser", claims["username"])
+					assert.Equal(t, float64(7), claims["user_id"])
 					assert.NotEmpty(t, claims["exp"])
 				}
 			}
@@ -377,7 +379,7 @@ func TestAuthMiddleware_TableDriven(t *testing.T) {
 				c.JSON(http.StatusOK, gin.H{"message": "Authorized"})
 			}
 
-			middleware := services.AuthMiddleware(jwtKey, logger)
+			middleware := services.AuthMiddleware(services.NewHMACKeys([]byte(jwtKey)), logger)
 
 			middleware(c)
 
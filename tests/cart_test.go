@@ -0,0 +1,558 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/ports"
+	"CartoonBurgers/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryCartService_ConcurrentAdds(t *testing.T) {
+	carts := services.NewInMemoryCartService(services.CartLimits{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, carts.AddToCart(context.Background(), "session:1", models.CartItem{ProductID: 1 + i%2, Quantity: 1}))
+		}()
+	}
+	wg.Wait()
+
+	cart, err := carts.GetCart(context.Background(), "session:1")
+	require.NoError(t, err)
+	assert.Equal(t, []models.CartItem{{ProductID: 1, Quantity: 25}, {ProductID: 2, Quantity: 25}}, cart)
+
+	require.NoError(t, carts.RemoveFromCart(context.Background(), "session:1", 1))
+	cart, err = carts.GetCart(context.Background(), "session:1")
+	require.NoError(t, err)
+	assert.Equal(t, []models.CartItem{{ProductID: 2, Quantity: 25}}, cart)
+
+	assert.ErrorIs(t, carts.AddToCart(context.Background(), "session:1", models.CartItem{ProductID: 1, Quantity: 0}), services.ErrInvalidQuantity)
+}
+
+func newTestCartRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	repo := newTestAppRepository(t)
+	localizer := services.NewLocalizer("ru", []string{"ru", "en"})
+	menu := services.NewMenuService(repo.ProductRerository, repo.CategoryRepository, "ru", time.UTC)
+	limits := services.CartLimits{MaxItemQuantity: 10, MaxCartQuantity: 12}
+	pricer := services.NewCartPricer(menu, limits, services.DeliveryPricing{Fee: 19900, FreeFrom: 150000})
+	promos := services.NewPromoService(repo.PromoRepository, repo.OrderRepository, newTestTierService(repo))
+	cartHandler := handlers.NewCartHandler(false, localizer, menu, services.NewInMemoryCartService(limits), pricer, promos)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/cart", cartHandler.GetCartHandler)
+	r.POST("/api/cart/add", cartHandler.AddToCartHandler)
+	r.PUT("/api/cart", cartHandler.ReplaceCartHandler)
+	r.DELETE("/api/cart", cartHandler.ClearCartHandler)
+	r.PATCH("/api/cart/items/:productId", cartHandler.UpdateQuantityHandler)
+	r.POST("/api/cart/promo", cartHandler.ApplyPromoHandler)
+	r.DELETE("/api/cart/promo", cartHandler.RemovePromoHandler)
+	r.DELETE("/api/cart/:productId", cartHandler.RemoveFromCartHandler)
+	return r
+}
+
+func TestCartHandler_AddToCart(t *testing.T) {
+	r := newTestCartRouter(t)
+
+	add := func(cookie *http.Cookie, body map[string]interface{}) *httptest.ResponseRecorder {
+		req := createTestRequest(http.MethodPost, "/api/cart/add?lang=en", body)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := add(nil, map[string]interface{}{"productId": 1, "quantity": 2})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "cart_session", cookies[0].Name)
+	assert.Len(t, cookies[0].Value, 43, "guest session ids are 32 random bytes")
+	other := add(nil, map[string]interface{}{"productId": 1, "quantity": 1}).Result().Cookies()
+	require.Len(t, other, 1)
+	assert.NotEqual(t, cookies[0].Value, other[0].Value)
+
+	w = add(cookies[0], map[string]interface{}{"productId": 1, "quantity": 3})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Message string            `json:"message"`
+		Cart    models.PricedCart `json:"cart"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Item added to cart", response.Message)
+	require.Len(t, response.Cart.Items, 1)
+	assert.Equal(t, 5, response.Cart.Items[0].Quantity)
+
+	w = add(cookies[0], map[string]interface{}{"productId": 999, "quantity": 1})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = add(cookies[0], map[string]interface{}{"productId": 1, "quantity": -1})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = add(cookies[0], map[string]interface{}{"productId": 1, "quantity": 6})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/cart", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"items": [{"productId": 1, "name": "Cheese Burger", "category": 1, "quantity": 5, "unitPrice": 16000, "lineTotal": 80000}],
+		"subtotal": 80000,
+		"deliveryFee": 19900,
+		"discounts": [],
+		"discount": 0,
+		"total": 99900
+	}`, w.Body.String())
+}
+
+func TestInMemoryCartService_MergeCarts(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy models.CartMergeStrategy
+		expected []models.CartItem
+	}{
+		{
+			name:     "sum quantities",
+			strategy: models.CartMergeSum,
+			expected: []models.CartItem{{ProductID: 1, Quantity: 5}, {ProductID: 2, Quantity: 1}, {ProductID: 3, Quantity: 4}},
+		},
+		{
+			name:     "keep max",
+			strategy: models.CartMergeMax,
+			expected: []models.CartItem{{ProductID: 1, Quantity: 3}, {ProductID: 2, Quantity: 1}, {ProductID: 3, Quantity: 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			carts := services.NewInMemoryCartService(services.CartLimits{})
+			require.NoError(t, carts.AddToCart(ctx, "user:1", models.CartItem{ProductID: 1, Quantity: 2}))
+			require.NoError(t, carts.AddToCart(ctx, "user:1", models.CartItem{ProductID: 2, Quantity: 1}))
+			require.NoError(t, carts.AddToCart(ctx, "session:a", models.CartItem{ProductID: 1, Quantity: 3}))
+			require.NoError(t, carts.AddToCart(ctx, "session:a", models.CartItem{ProductID: 3, Quantity: 4}))
+
+			require.NoError(t, carts.MergeCarts(ctx, "session:a", "user:1", tt.strategy))
+
+			cart, err := carts.GetCart(ctx, "user:1")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cart)
+
+			guest, err := carts.GetCart(ctx, "session:a")
+			require.NoError(t, err)
+			assert.Empty(t, guest)
+		})
+	}
+}
+
+func newTestRedisCartService(t *testing.T, limits services.CartLimits) (*services.RedisCartService, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return services.NewRedisCartService(client, limits), server
+}
+
+func TestRedisCartService_ConcurrentAdds(t *testing.T) {
+	ctx := context.Background()
+	carts, server := newTestRedisCartService(t, services.CartLimits{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, carts.AddToCart(ctx, "user:1", models.CartItem{ProductID: 1 + i%2, Quantity: 1}))
+		}()
+	}
+	wg.Wait()
+
+	cart, err := carts.GetCart(ctx, "user:1")
+	require.NoError(t, err)
+	assert.Equal(t, []models.CartItem{{ProductID: 1, Quantity: 25}, {ProductID: 2, Quantity: 25}}, cart)
+	assert.Equal(t, services.CartTTL, server.TTL("cart:items:user:1"))
+
+	assert.ErrorIs(t, carts.AddToCart(ctx, "user:1", models.CartItem{ProductID: 1, Quantity: 0}), services.ErrInvalidQuantity)
+}
+
+func TestCartService_ConcurrentAddsKeepLimits(t *testing.T) {
+	limits := services.CartLimits{MaxItemQuantity: 10, MaxCartQuantity: 15}
+	tests := []struct {
+		name  string
+		carts func(t *testing.T) ports.CartService
+	}{
+		{name: "memory", carts: func(t *testing.T) ports.CartService { return services.NewInMemoryCartService(limits) }},
+		{name: "redis", carts: func(t *testing.T) ports.CartService {
+			carts, _ := newTestRedisCartService(t, limits)
+			return carts
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			carts := tt.carts(t)
+
+			var mu sync.Mutex
+			limited := 0
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := carts.AddToCart(ctx, "user:1", models.CartItem{ProductID: 1 + i%2, Quantity: 1})
+					if errors.Is(err, services.ErrItemQuantityLimit) || errors.Is(err, services.ErrCartQuantityLimit) {
+						mu.Lock()
+						limited++
+						mu.Unlock()
+						return
+					}
+					assert.NoError(t, err)
+				}()
+			}
+			wg.Wait()
+
+			cart, err := carts.GetCart(ctx, "user:1")
+			require.NoError(t, err)
+			total := 0
+			for _, item := range cart {
+				assert.LessOrEqual(t, item.Quantity, limits.MaxItemQuantity)
+				total += item.Quantity
+			}
+			assert.Equal(t, limits.MaxCartQuantity, total)
+			assert.Equal(t, 50-limits.MaxCartQuantity, limited)
+
+			assert.ErrorIs(t, carts.SetQuantity(ctx, "user:2", 1, 11), services.ErrItemQuantityLimit)
+			require.NoError(t, carts.SetQuantity(ctx, "user:2", 1, 10))
+			require.NoError(t, carts.SetQuantity(ctx, "user:2", 2, 5))
+			assert.ErrorIs(t, carts.SetQuantity(ctx, "user:2", 2, 6), services.ErrCartQuantityLimit)
+			require.NoError(t, carts.SetQuantity(ctx, "user:2", 1, 9), "lowering a quantity is within the limits")
+			cart, err = carts.GetCart(ctx, "user:2")
+			require.NoError(t, err)
+			assert.Equal(t, []models.CartItem{{ProductID: 1, Quantity: 9}, {ProductID: 2, Quantity: 5}}, cart)
+
+			require.NoError(t, carts.AddToCart(ctx, "session:guest", models.CartItem{ProductID: 1, Quantity: 4}))
+			require.NoError(t, carts.AddToCart(ctx, "session:guest", models.CartItem{ProductID: 3, Quantity: 3}))
+			require.NoError(t, carts.MergeCarts(ctx, "session:guest", "user:2", models.CartMergeSum))
+			cart, err = carts.GetCart(ctx, "user:2")
+			require.NoError(t, err)
+			assert.Equal(t, []models.CartItem{{ProductID: 1, Quantity: 10}, {ProductID: 2, Quantity: 5}}, cart,
+				"merged quantities are cut down to the limits")
+		})
+	}
+}
+
+func TestCartService_RemoveOrdered(t *testing.T) {
+	tests := []struct {
+		name  string
+		carts func(t *testing.T) ports.CartService
+	}{
+		{name: "memory", carts: func(t *testing.T) ports.CartService { return services.NewInMemoryCartService(services.CartLimits{}) }},
+		{name: "redis", carts: func(t *testing.T) ports.CartService {
+			carts, _ := newTestRedisCartService(t, services.CartLimits{})
+			return carts
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			carts := tt.carts(t)
+			cartID := services.UserCartID(1)
+
+			require.NoError(t, carts.AddToCart(ctx, cartID, models.CartItem{ProductID: 1, Quantity: 3}))
+			require.NoError(t, carts.AddToCart(ctx, cartID, models.CartItem{ProductID: 2, Quantity: 1}))
+			require.NoError(t, carts.SetPromoCode(ctx, cartID, "BURGER20"))
+			ordered, err := carts.GetCart(ctx, cartID)
+			require.NoError(t, err)
+
+			// Added while the order was being placed.
+			require.NoError(t, carts.AddToCart(ctx, cartID, models.CartItem{ProductID: 1, Quantity: 2}))
+			require.NoError(t, carts.AddToCart(ctx, cartID, models.CartItem{ProductID: 3, Quantity: 1}))
+
+			require.NoError(t, carts.RemoveOrdered(ctx, cartID, ordered, "BURGER20"))
+			cart, err := carts.GetCart(ctx, cartID)
+			require.NoError(t, err)
+			assert.Equal(t, []models.CartItem{{ProductID: 1, Quantity: 2}, {ProductID: 3, Quantity: 1}}, cart)
+			promo, err := carts.GetPromoCode(ctx, cartID)
+			require.NoError(t, err)
+			assert.Empty(t, promo, "the used promo code is removed")
+
+			require.NoError(t, carts.SetPromoCode(ctx, cartID, "FREEDELIVERY"))
+			require.NoError(t, carts.RemoveOrdered(ctx, cartID, cart, "BURGER20"))
+			cart, err = carts.GetCart(ctx, cartID)
+			require.NoError(t, err)
+			assert.Empty(t, cart)
+			promo, err = carts.GetPromoCode(ctx, cartID)
+			require.NoError(t, err)
+			assert.Equal(t, "FREEDELIVERY", promo, "a promo code set since stays")
+
+			idle, err := carts.IdleCarts(ctx, time.Now().Add(time.Hour))
+			require.NoError(t, err)
+			assert.Empty(t, idle, "an emptied cart is not tracked")
+		})
+	}
+}
+
+func TestRedisCartService_CartOperations(t *testing.T) {
+	ctx := context.Background()
+	carts, server := newTestRedisCartService(t, services.CartLimits{})
+
+	require.NoError(t, carts.AddToCart(ctx, "user:1", models.CartItem{ProductID: 1, Quantity: 2}))
+	require.NoError(t, carts.SetQuantity(ctx, "user:1", 1, 5))
+	require.NoError(t, carts.SetQuantity(ctx, "user:1", 2, 1))
+	cart, err := carts.GetCart(ctx, "user:1")
+	require.NoError(t, err)
+	assert.Equal(t, []models.CartItem{{ProductID: 1, Quantity: 5}, {ProductID: 2, Quantity: 1}}, cart)
+
+	require.NoError(t, carts.SetQuantity(ctx, "user:1", 1, 0))
+	assert.ErrorIs(t, carts.SetQuantity(ctx, "user:1", 2, -1), services.ErrInvalidQuantity)
+	cart, err = carts.GetCart(ctx, "user:1")
+	require.NoError(t, err)
+	assert.Equal(t, []models.CartItem{{ProductID: 2, Quantity: 1}}, cart)
+
+	require.NoError(t, carts.ReplaceCart(ctx, "user:1", []models.CartItem{{ProductID: 3, Quantity: 2}, {ProductID: 4, Quantity: 1}}))
+	assert.ErrorIs(t, carts.ReplaceCart(ctx, "user:1", []models.CartItem{{ProductID: 5, Quantity: 0}}), services.ErrInvalidQuantity)
+	cart, err = carts.GetCart(ctx, "user:1")
+	require.NoError(t, err)
+	assert.Equal(t, []models.CartItem{{ProductID: 3, Quantity: 2}, {ProductID: 4, Quantity: 1}}, cart, "a failed replace keeps the cart")
+	assert.Equal(t, services.CartTTL, server.TTL("cart:items:user:1"))
+
+	require.NoError(t, carts.SetPromoCode(ctx, "user:1", "BURGER20"))
+	require.NoError(t, carts.ClearCart(ctx, "user:1"))
+	cart, err = carts.GetCart(ctx, "user:1")
+	require.NoError(t, err)
+	assert.Empty(t, cart)
+	promo, err := carts.GetPromoCode(ctx, "user:1")
+	require.NoError(t, err)
+	assert.Empty(t, promo)
+
+	require.NoError(t, carts.ReplaceCart(ctx, "user:1", nil))
+	assert.False(t, server.Exists("cart:items:user:1"), "replacing with nothing empties the cart")
+}
+
+func TestRedisCartService_MergeCarts(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  models.CartMergeStrategy
+		userPromo string
+		expected  []models.CartItem
+		promo     string
+	}{
+		{
+			name:     "sum quantities",
+			strategy: models.CartMergeSum,
+			expected: []models.CartItem{{ProductID: 1, Quantity: 5}, {ProductID: 2, Quantity: 1}, {ProductID: 3, Quantity: 4}},
+			promo:    "GUEST",
+		},
+		{
+			name:      "keep max",
+			strategy:  models.CartMergeMax,
+			userPromo: "USER",
+			expected:  []models.CartItem{{ProductID: 1, Quantity: 3}, {ProductID: 2, Quantity: 1}, {ProductID: 3, Quantity: 4}},
+			promo:     "USER",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			carts, server := newTestRedisCartService(t, services.CartLimits{})
+			require.NoError(t, carts.AddToCart(ctx, "user:1", models.CartItem{ProductID: 1, Quantity: 2}))
+			require.NoError(t, carts.AddToCart(ctx, "user:1", models.CartItem{ProductID: 2, Quantity: 1}))
+			require.NoError(t, carts.AddToCart(ctx, "session:a", models.CartItem{ProductID: 1, Quantity: 3}))
+			require.NoError(t, carts.AddToCart(ctx, "session:a", models.CartItem{ProductID: 3, Quantity: 4}))
+			require.NoError(t, carts.SetPromoCode(ctx, "session:a", "GUEST"))
+			if tt.userPromo != "" {
+				require.NoError(t, carts.SetPromoCode(ctx, "user:1", tt.userPromo))
+			}
+
+			require.NoError(t, carts.MergeCarts(ctx, "session:a", "user:1", tt.strategy))
+
+			cart, err := carts.GetCart(ctx, "user:1")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cart)
+			assert.Equal(t, services.CartTTL, server.TTL("cart:items:user:1"))
+
+			promo, err := carts.GetPromoCode(ctx, "user:1")
+			require.NoError(t, err)
+			assert.Equal(t, tt.promo, promo)
+
+			assert.False(t, server.Exists("cart:items:session:a"), "the guest cart is deleted")
+			assert.False(t, server.Exists("cart:promo:session:a"))
+		})
+	}
+}
+
+func TestLoginHandler_MergesGuestCart(t *testing.T) {
+	ctx := context.Background()
+	carts := services.NewInMemoryCartService(services.CartLimits{})
+	require.NoError(t, carts.AddToCart(ctx, services.SessionCartID("guest"), models.CartItem{ProductID: 1, Quantity: 2}))
+	require.NoError(t, carts.AddToCart(ctx, services.UserCartID(7), models.CartItem{ProductID: 1, Quantity: 1}))
+
+	mockRepository := new(MockUserRepository)
+	mockRepository.On("GetUserByUsername", mock.Anything, "validuser").Return("hash", nil)
+	mockRepository.On("GetUserID", mock.Anything, "validuser").Return(7, nil)
+	mockHasher := new(MockPasswordHasher)
+	mockHasher.On("CompareHashAndPassword", mock.Anything, mock.Anything).Return(nil)
+
+	handler := services.LoginHandler{
+		Repository: mockRepository,
+		Hasher:     mockHasher,
+		Keys:       services.NewHMACKeys([]byte("test-secret-key")),
+		Logger:     slog.Default(),
+		Carts:      carts,
+		CartMerge:  models.CartMergeSum,
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = createTestRequest(http.MethodPost, "/login", map[string]interface{}{"username": "validuser", "password": "secret"})
+	c.Request.AddCookie(&http.Cookie{Name: "cart_session", Value: "guest"})
+
+	handler.Login(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	cart, err := carts.GetCart(ctx, services.UserCartID(7))
+	require.NoError(t, err)
+	assert.Equal(t, []models.CartItem{{ProductID: 1, Quantity: 3}}, cart)
+
+	guest, err := carts.GetCart(ctx, services.SessionCartID("guest"))
+	require.NoError(t, err)
+	assert.Empty(t, guest)
+}
+
+func TestCartPricer_CheckAdd(t *testing.T) {
+	pricer := services.NewCartPricer(nil, services.CartLimits{MaxItemQuantity: 5, MaxCartQuantity: 8}, services.DeliveryPricing{})
+	cart := []models.CartItem{{ProductID: 1, Quantity: 3}, {ProductID: 2, Quantity: 4}}
+
+	tests := []struct {
+		name     string
+		item     models.CartItem
+		expected error
+	}{
+		{name: "within limits", item: models.CartItem{ProductID: 3, Quantity: 1}},
+		{name: "zero quantity", item: models.CartItem{ProductID: 3, Quantity: 0}, expected: services.ErrInvalidQuantity},
+		{name: "negative quantity", item: models.CartItem{ProductID: 1, Quantity: -2}, expected: services.ErrInvalidQuantity},
+		{name: "item limit", item: models.CartItem{ProductID: 1, Quantity: 3}, expected: services.ErrItemQuantityLimit},
+		{name: "cart limit", item: models.CartItem{ProductID: 3, Quantity: 2}, expected: services.ErrCartQuantityLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pricer.CheckAdd(cart, tt.item)
+			if tt.expected == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCartPricer_PriceMarksUnavailable(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	desserts := 4
+	require.NoError(t, repo.SaveAvailabilityWindow(ctx, &models.AvailabilityWindow{CategoryID: &desserts, Days: []string{"sat", "sun"}}))
+
+	menu := services.NewMenuService(repo.ProductRerository, repo.CategoryRepository, "ru", time.UTC)
+	menu.Now = func() time.Time { return time.Date(2025, 9, 22, 12, 0, 0, 0, time.UTC) }
+	pricer := services.NewCartPricer(menu, services.CartLimits{}, services.DeliveryPricing{Fee: 19900})
+
+	priced, err := pricer.Price(ctx, []models.CartItem{{ProductID: 1, Quantity: 2}, {ProductID: 7, Quantity: 1}, {ProductID: 999, Quantity: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, []models.PricedCartLine{
+		{ProductID: 1, Name: "Cheese Burger", CategoryID: 1, Quantity: 2, UnitPrice: 16000, LineTotal: 32000},
+		{ProductID: 7, Name: "Efilio Cake", CategoryID: 4, Quantity: 1, UnitPrice: 19900, LineTotal: 19900, Unavailable: true},
+		{ProductID: 999, Quantity: 1, Unavailable: true},
+	}, priced.Items)
+	assert.Equal(t, int64(32000), priced.Subtotal, "unavailable lines are not charged")
+	assert.Equal(t, int64(32000+19900), priced.Total)
+}
+
+func TestCartHandler_CartOperations(t *testing.T) {
+	r := newTestCartRouter(t)
+	cookie := &http.Cookie{Name: "cart_session", Value: "operations"}
+
+	do := func(method, url string, body interface{}) (int, models.PricedCart) {
+		req := createTestRequest(method, url, body)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var response struct {
+			Cart models.PricedCart `json:"cart"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Cart
+	}
+	quantities := func(cart models.PricedCart) map[int]int {
+		result := map[int]int{}
+		for _, item := range cart.Items {
+			result[item.ProductID] = item.Quantity
+		}
+		return result
+	}
+
+	code, cart := do(http.MethodPut, "/api/cart", map[string]interface{}{
+		"items": []map[string]int{{"productId": 1, "quantity": 2}, {"productId": 2, "quantity": 3}},
+	})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[int]int{1: 2, 2: 3}, quantities(cart))
+
+	code, _ = do(http.MethodPut, "/api/cart", map[string]interface{}{
+		"items": []map[string]int{{"productId": 1, "quantity": 2}, {"productId": 1, "quantity": 3}},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, cart = do(http.MethodPatch, "/api/cart/items/1", map[string]int{"quantity": 7})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[int]int{1: 7, 2: 3}, quantities(cart))
+
+	code, _ = do(http.MethodPatch, "/api/cart/items/1", map[string]int{"quantity": 11})
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	code, _ = do(http.MethodPatch, "/api/cart/items/1", map[string]int{"quantity": -1})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, cart = do(http.MethodDelete, "/api/cart/2", nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[int]int{1: 7}, quantities(cart))
+
+	code, _ = do(http.MethodDelete, "/api/cart/abc", nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, cart = do(http.MethodDelete, "/api/cart", nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, cart.Items)
+	assert.Equal(t, int64(0), cart.Total)
+}
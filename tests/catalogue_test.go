@@ -0,0 +1,244 @@
+package tests
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalogueService_CSVRoundTrip(t *testing.T) {
+	repo := newTestAppRepository(t)
+	service := services.NewCatalogueService(repo.ProductRerository, repo.CategoryRepository, "ru")
+	ctx := context.Background()
+
+	desserts := 4
+	require.NoError(t, repo.SaveAvailabilityWindow(ctx, &models.AvailabilityWindow{CategoryID: &desserts, Days: []string{"sat", "sun"}}))
+
+	exported, err := service.Export(ctx)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, services.WriteCatalogueCSV(&buf, exported))
+
+	parsed, parseErrors, err := services.ReadCatalogueCSV(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Empty(t, parseErrors)
+
+	report, err := service.Import(ctx, parsed, parseErrors, true)
+	require.NoError(t, err)
+	assert.Empty(t, report.Errors)
+	assert.Empty(t, report.Created)
+	assert.Empty(t, report.Updated)
+	assert.Empty(t, report.Deleted)
+	assert.Equal(t, 8, report.Unchanged)
+	assert.Equal(t, 4, report.CategoriesUnchanged)
+	assert.False(t, report.Applied)
+	require.Len(t, parsed.Categories, 4)
+	require.Len(t, parsed.Categories[3].Availability, 1)
+	assert.Equal(t, "sat,sun", parsed.Categories[3].Availability[0].String())
+}
+
+func TestCatalogueService_Import(t *testing.T) {
+	repo := newTestAppRepository(t)
+	service := services.NewCatalogueService(repo.ProductRerository, repo.CategoryRepository, "ru")
+	ctx := context.Background()
+
+	exported, err := service.Export(ctx)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, services.WriteCatalogueCSV(&buf, exported))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 13)
+
+	// Change the price of the first product, drop the last one and add a
+	// salads category with a salad available only for lunch.
+	lines[5] = strings.Replace(lines[5], ",160,", ",175,", 1)
+	lines = lines[:len(lines)-1]
+	lines = append(lines,
+		"category,5,Салаты,salads,50,🥗,true"+strings.Repeat(",", 14),
+		"product,,Caesar Salad,,,,,250,1,0,5,\"milk,eggs\",,200,310,12,20,14,3,1.2,mon-fri 12:00-16:00")
+
+	edited := strings.Join(lines, "\n")
+
+	parsed, parseErrors, err := services.ReadCatalogueCSV(strings.NewReader(edited))
+	require.NoError(t, err)
+	require.Len(t, parseErrors, 1, "the day range is not a valid day list")
+	assert.Equal(t, 14, parseErrors[0].Row)
+	assert.Equal(t, "availability", parseErrors[0].Field)
+
+	report, err := service.Import(ctx, parsed, parseErrors, false)
+	require.NoError(t, err)
+	assert.False(t, report.Applied)
+
+	edited = strings.Replace(edited, "mon-fri 12:00-16:00", `"mon,tue,wed,thu,fri 12:00-16:00"`, 1)
+	parsed, parseErrors, err = services.ReadCatalogueCSV(strings.NewReader(edited))
+	require.NoError(t, err)
+	require.Empty(t, parseErrors)
+
+	report, err = service.Import(ctx, parsed, parseErrors, true)
+	require.NoError(t, err)
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, []string{"Caesar Salad"}, report.Created)
+	assert.Equal(t, []string{"Cheese Burger"}, report.Updated)
+	assert.Equal(t, []string{"Purple Cake"}, report.Deleted)
+	assert.Equal(t, 6, report.Unchanged)
+	assert.Equal(t, []string{"Салаты"}, report.CategoriesCreated)
+	assert.Equal(t, 4, report.CategoriesUnchanged)
+	assert.False(t, report.Applied)
+
+	unchanged, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, unchanged, 8)
+
+	report, err = service.Import(ctx, parsed, parseErrors, false)
+	require.NoError(t, err)
+	assert.True(t, report.Applied)
+
+	products, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, products, 8)
+
+	byName := make(map[string]models.Product)
+	for _, p := range products {
+		byName[p.Name] = p
+	}
+	assert.Equal(t, 175, byName["Cheese Burger"].Price)
+	assert.NotContains(t, byName, "Purple Cake")
+
+	salad := byName["Caesar Salad"]
+	assert.Equal(t, 5, salad.CategoryID)
+	assert.ElementsMatch(t, []models.Allergen{models.Milk, models.Eggs}, salad.Allergens)
+	require.NotNil(t, salad.Nutrition)
+	assert.Equal(t, 310, salad.Nutrition.Calories)
+	require.Len(t, salad.Availability, 1)
+	assert.Equal(t, "12:00", salad.Availability[0].StartTime)
+}
+
+func TestCatalogueService_ImportRowErrors(t *testing.T) {
+	repo := newTestAppRepository(t)
+	service := services.NewCatalogueService(repo.ProductRerository, repo.CategoryRepository, "ru")
+	ctx := context.Background()
+
+	catalogue := &models.Catalogue{
+		Categories: []models.Category{
+			{ID: 1, Name: "Бургеры", Slug: "burgers", Visible: true},
+			{ID: 2, Name: "Закуски", Slug: "burgers", Visible: true},
+			{Name: "Bad slug", Slug: "Bad Slug"},
+		},
+		Products: []models.Product{
+			{Name: "", Price: 100, Count: 1, CategoryID: 1},
+			{ID: 1, Name: "Cheese Burger", Price: 160, Count: 1, CategoryID: 1},
+			{ID: 1, Name: "Cheese Burger", Price: 160, Count: 1, CategoryID: 1},
+			{ID: 404, Name: "Ghost", Price: 100, Count: 1, CategoryID: 1},
+			{Name: "Salt", Price: 10, Count: 1, CategoryID: 1, Allergens: []models.Allergen{"plastic"}},
+			{Name: "Cake", Price: 10, Count: 1, CategoryID: 4},
+		},
+	}
+
+	report, err := service.Import(ctx, catalogue, nil, false)
+	require.NoError(t, err)
+	assert.False(t, report.Applied)
+
+	type location struct {
+		row   int
+		field string
+	}
+	locations := make([]location, 0, len(report.Errors))
+	for _, e := range report.Errors {
+		locations = append(locations, location{e.Row, e.Field})
+	}
+	assert.Equal(t, []location{
+		{2, "slug"},
+		{3, "categories"},
+		{1, ""},
+		{3, "id"},
+		{4, "id"},
+		{5, ""},
+		{6, "category"},
+	}, locations)
+
+	products, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, products, 8)
+}
+
+func TestCatalogueService_ImportInvalidRowIsNotDeleted(t *testing.T) {
+	repo := newTestAppRepository(t)
+	service := services.NewCatalogueService(repo.ProductRerository, repo.CategoryRepository, "ru")
+	ctx := context.Background()
+
+	catalogue, err := service.Export(ctx)
+	require.NoError(t, err)
+	catalogue.Products[0].Name = ""
+	catalogue.Products[1].CategoryID = 404
+
+	report, err := service.Import(ctx, catalogue, nil, true)
+	require.NoError(t, err)
+	assert.Len(t, report.Errors, 2)
+	assert.Empty(t, report.Deleted, "products in invalid rows are kept")
+}
+
+func TestCatalogueService_ImportUnparsedRowIsNotDeleted(t *testing.T) {
+	repo := newTestAppRepository(t)
+	service := services.NewCatalogueService(repo.ProductRerository, repo.CategoryRepository, "ru")
+	ctx := context.Background()
+
+	exported, err := service.Export(ctx)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, services.WriteCatalogueCSV(&buf, exported))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	lines[4] = strings.Replace(lines[4], ",true,", ",maybe,", 1)
+	lines[5] = strings.Replace(lines[5], ",160,", ",abc,", 1)
+
+	parsed, parseErrors, err := services.ReadCatalogueCSV(strings.NewReader(strings.Join(lines, "\n")))
+	require.NoError(t, err)
+	require.Len(t, parseErrors, 2)
+
+	report, err := service.Import(ctx, parsed, parseErrors, true)
+	require.NoError(t, err)
+	assert.Empty(t, report.Deleted, "the product whose price did not parse is kept")
+	assert.Empty(t, report.CategoriesDeleted, "the category whose row did not parse is kept")
+}
+
+func TestCatalogueService_ImportRenameUpdatesTranslations(t *testing.T) {
+	repo := newTestAppRepository(t)
+	service := services.NewCatalogueService(repo.ProductRerository, repo.CategoryRepository, "ru")
+	menu := services.NewMenuService(repo.ProductRerository, repo.CategoryRepository, "ru", time.UTC)
+	ctx := context.Background()
+
+	catalogue, err := service.Export(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "Cheese Burger", catalogue.Products[0].Name)
+	require.Equal(t, "burgers", catalogue.Categories[0].Slug)
+	catalogue.Products[0].Name = "Чизбургер Делюкс"
+	catalogue.Categories[0].Name = "Бургеры и роллы"
+
+	report, err := service.Import(ctx, catalogue, nil, false)
+	require.NoError(t, err)
+	require.True(t, report.Applied)
+
+	for _, locale := range []string{"ru", "en"} {
+		sections, err := menu.GetSections(ctx, services.MenuFilter{Locale: locale, IncludeUnavailable: true})
+		require.NoError(t, err)
+		require.NotEmpty(t, sections)
+
+		burgers := sections[0]
+		assert.Equal(t, "Бургеры и роллы", burgers.Name, locale)
+		assert.Equal(t, "Чизбургер Делюкс", burgers.Products[0].Name, locale)
+	}
+
+	products, err := menu.GetMenu(ctx, services.MenuFilter{Locale: "en", IncludeUnavailable: true})
+	require.NoError(t, err)
+	assert.Equal(t, "Classic Carton", products[1].Name, "products that were not renamed keep their translations")
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var verifyLinkToken = regexp.MustCompile(`verify-email\?token=([A-Za-z0-9_-]+)`)
+
+func TestValidateEmail_TableDriven(t *testing.T) {
+	tests := []struct {
+		email string
+		valid bool
+	}{
+		{"alice@example.com", true},
+		{"alice.smith+burgers@mail.example.co", true},
+		{"", false},
+		{"alice", false},
+		{"alice@", false},
+		{"@example.com", false},
+		{"alice@localhost", false},
+		{"alice@example.", false},
+		{"Alice <alice@example.com>", false},
+		{" alice@example.com", false},
+		{"alice@@example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			err := models.ValidateEmail(tt.email)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, models.ErrInvalidEmail)
+			}
+		})
+	}
+}
+
+func TestEmailVerification_RegisterVerifyAndResend(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	mailer := services.NewInMemoryMailer()
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	verification := services.NewEmailVerificationService(repo.UserRepository, repo.OneTimeTokenRepository, mailer,
+		"http://localhost:8080/verify-email", 48*time.Hour, time.Minute, slog.Default())
+	verification.Now = func() time.Time { return now }
+
+	auth := handlers.NewAuthHandlers(services.NewHMACKeys([]byte("test-secret-key")), repo.UserRepository, slog.Default(), nil, models.CartMergeSum, nil, verification, nil, nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/auth/register", auth.GetRegisterHandler)
+
+	register := func(email string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, createTestRequest(http.MethodPost, "/api/auth/register", map[string]string{
+			"username": "alice", "password": "secret-password", "email": email,
+		}))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusBadRequest, register("not-an-email"))
+	require.Equal(t, http.StatusOK, register("alice@example.com"))
+
+	alice, err := repo.GetUserID(ctx, "alice")
+	require.NoError(t, err)
+	verified, err := verification.IsVerified(ctx, alice)
+	require.NoError(t, err)
+	assert.False(t, verified, "new accounts start unverified")
+
+	lastToken := func() string {
+		sent := mailer.Sent()
+		require.NotEmpty(t, sent)
+		match := verifyLinkToken.FindStringSubmatch(sent[len(sent)-1].Body)
+		require.NotNil(t, match, "verification link in mail")
+		return match[1]
+	}
+	require.Len(t, mailer.Sent(), 1)
+	first := lastToken()
+
+	wait, err := verification.Resend(ctx, alice)
+	assert.ErrorIs(t, err, services.ErrVerificationThrottled)
+	assert.Equal(t, time.Minute, wait)
+
+	now = now.Add(time.Minute)
+	_, err = verification.Resend(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, mailer.Sent(), 2)
+
+	assert.ErrorIs(t, verification.Verify(ctx, first), services.ErrVerificationTokenInvalid, "resending replaces the link")
+	require.NoError(t, verification.Verify(ctx, lastToken()))
+
+	verified, err = verification.IsVerified(ctx, alice)
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	now = now.Add(time.Hour)
+	_, err = verification.Resend(ctx, alice)
+	assert.ErrorIs(t, err, services.ErrEmailAlreadyVerified)
+}
+
+func TestEmailHandler_RequireVerified(t *testing.T) {
+	repo := newTestAppRepository(t)
+	verification := services.NewEmailVerificationService(repo.UserRepository, repo.OneTimeTokenRepository, services.NewInMemoryMailer(),
+		"http://localhost:8080/verify-email", 0, 0, slog.Default())
+	alice := createTestUser(t, repo, "alice")
+
+	order := func(required bool) int {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(func(c *gin.Context) { c.Set("user_id", alice) })
+		r.POST("/api/orders", handlers.NewEmailHandler(verification, required, slog.Default()).RequireVerified(), func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/orders", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, order(true))
+	assert.Equal(t, http.StatusCreated, order(false), "policy off")
+
+	require.NoError(t, repo.SetEmailVerified(context.Background(), alice, time.Now()))
+	assert.Equal(t, http.StatusCreated, order(true))
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFavoritesService_Suggestions(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	menu := services.NewMenuService(repo.ProductRerository, repo.CategoryRepository, "ru", time.UTC)
+	// Monday noon.
+	menu.Now = func() time.Time { return time.Date(2025, 9, 22, 12, 0, 0, 0, time.UTC) }
+	favorites := services.NewFavoritesService(repo.FavoriteRepository, repo.OrderRepository, menu, 3)
+
+	alice := createTestUser(t, repo, "alice")
+	bob := createTestUser(t, repo, "bob")
+
+	weekendOnly := 6
+	require.NoError(t, repo.SaveAvailabilityWindow(ctx, &models.AvailabilityWindow{ProductID: &weekendOnly, Days: []string{"sat", "sun"}}))
+
+	order := func(userID int, productIDs ...int) {
+		o := &models.Order{UserID: userID}
+		for _, id := range productIDs {
+			o.Items = append(o.Items, models.OrderItem{ProductID: id, Quantity: 1})
+		}
+		require.NoError(t, repo.CreateOrder(ctx, o, nil))
+	}
+	order(alice, 1, 2)
+	order(alice, 1)
+	order(bob, 4, 5)
+
+	require.NoError(t, favorites.Add(ctx, alice, 3))
+	require.NoError(t, favorites.Add(ctx, alice, weekendOnly))
+	require.NoError(t, favorites.Add(ctx, alice, 3), "starring twice is a no-op")
+	assert.ErrorIs(t, favorites.Add(ctx, alice, 999), services.ErrProductNotFound)
+
+	suggestions, err := favorites.Suggestions(ctx, alice, services.MenuFilter{})
+	require.NoError(t, err)
+	var ids []int
+	for _, p := range suggestions {
+		ids = append(ids, p.ID)
+	}
+	assert.Equal(t, []int{3, 1, 2}, ids, "stars outweigh orders and unavailable products are left out")
+
+	list, err := favorites.List(ctx, alice, "ru")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	available := map[int]bool{}
+	for _, f := range list {
+		available[f.ID] = f.Available
+	}
+	assert.Equal(t, map[int]bool{3: true, weekendOnly: false}, available)
+
+	require.NoError(t, favorites.Remove(ctx, alice, 3))
+	suggestions, err = favorites.Suggestions(ctx, alice, services.MenuFilter{})
+	require.NoError(t, err)
+	require.Len(t, suggestions, 2)
+	assert.Equal(t, 1, suggestions[0].ID)
+
+	none, err := favorites.Suggestions(ctx, createTestUser(t, repo, "carol"), services.MenuFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
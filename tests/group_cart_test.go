@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGroupCartService(env testOrderEnv) *services.GroupCartService {
+	menu := services.NewMenuService(env.repo.ProductRerository, env.repo.CategoryRepository, "ru", time.UTC)
+	pricer := services.NewCartPricer(menu, services.CartLimits{MaxItemQuantity: 5}, services.DeliveryPricing{Fee: 19900})
+	return services.NewGroupCartService(env.repo.GroupCartRepository, menu, pricer, env.orders)
+}
+
+func TestGroupCartService_OrderFlow(t *testing.T) {
+	ctx := context.Background()
+	env := newTestOrderService(t)
+	groups := newTestGroupCartService(env)
+
+	owner := createTestUser(t, env.repo, "owner")
+	colleague := createTestUser(t, env.repo, "colleague")
+	stranger := createTestUser(t, env.repo, "stranger")
+
+	group, err := groups.Create(ctx, owner)
+	require.NoError(t, err)
+	assert.Equal(t, models.GroupCartOpen, group.Status)
+	assert.NotEmpty(t, group.InviteToken)
+
+	_, err = groups.Get(ctx, group.ID, stranger)
+	assert.ErrorIs(t, err, services.ErrGroupCartForbidden)
+	_, err = groups.Join(ctx, "wrong", colleague)
+	assert.ErrorIs(t, err, services.ErrGroupCartNotFound)
+
+	_, err = groups.Join(ctx, group.InviteToken, colleague)
+	require.NoError(t, err)
+
+	_, err = groups.SetItem(ctx, group.ID, owner, 1, 1)
+	require.NoError(t, err)
+	_, err = groups.SetItem(ctx, group.ID, colleague, 1, 2)
+	require.NoError(t, err)
+	_, err = groups.SetItem(ctx, group.ID, colleague, 1, 6)
+	assert.ErrorIs(t, err, services.ErrItemQuantityLimit, "limits apply to the participant's own items")
+
+	priced, err := groups.Get(ctx, group.ID, owner)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3*16000), priced.Cart.Subtotal)
+	require.Len(t, priced.Participants, 2)
+	assert.Equal(t, "owner", priced.Participants[0].Username)
+	assert.Equal(t, int64(16000), priced.Participants[0].Subtotal)
+	assert.Equal(t, int64(32000), priced.Participants[1].Subtotal)
+
+	_, err = groups.PlaceOrder(ctx, group.ID, owner, 0)
+	assert.ErrorIs(t, err, services.ErrGroupCartNotLocked)
+	_, err = groups.Lock(ctx, group.ID, colleague)
+	assert.ErrorIs(t, err, services.ErrGroupCartForbidden, "only the owner locks")
+
+	_, err = groups.Lock(ctx, group.ID, owner)
+	require.NoError(t, err)
+	_, err = groups.SetItem(ctx, group.ID, colleague, 1, 1)
+	assert.ErrorIs(t, err, services.ErrGroupCartClosed)
+	_, err = groups.Join(ctx, group.InviteToken, stranger)
+	assert.ErrorIs(t, err, services.ErrGroupCartClosed)
+
+	order, err := groups.PlaceOrder(ctx, group.ID, owner, 0)
+	require.NoError(t, err)
+	assert.Equal(t, owner, order.UserID)
+	assert.Equal(t, int64(48000), order.Subtotal)
+	assert.Equal(t, group.ID, order.GroupCartID)
+
+	stored, err := env.repo.GetOrder(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []models.OrderParticipant{
+		{UserID: owner, Username: "owner", Subtotal: 16000},
+		{UserID: colleague, Username: "colleague", Subtotal: 32000},
+	}, stored.Participants)
+
+	_, err = groups.PlaceOrder(ctx, group.ID, owner, 0)
+	assert.ErrorIs(t, err, services.ErrGroupCartNotLocked, "a group cart is ordered once")
+	closed, err := groups.Get(ctx, group.ID, owner)
+	require.NoError(t, err)
+	assert.Equal(t, models.GroupCartOrdered, closed.Status)
+	require.NotNil(t, closed.OrderID)
+	assert.Equal(t, order.ID, *closed.OrderID)
+}
+
+func TestGroupCartHandler_Routes(t *testing.T) {
+	env := newTestOrderService(t)
+	h := handlers.NewGroupCartHandler(newTestGroupCartService(env))
+	owner := createTestUser(t, env.repo, "owner")
+	colleague := createTestUser(t, env.repo, "colleague")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if id := c.GetHeader("X-User"); id == "owner" {
+			c.Set("user_id", owner)
+		} else if id == "colleague" {
+			c.Set("user_id", colleague)
+		}
+	})
+	r.POST("/api/group-carts", h.CreateHandler)
+	r.POST("/api/group-carts/join/:token", h.JoinHandler)
+	r.GET("/api/group-carts/:id", h.GetHandler)
+	r.PUT("/api/group-carts/:id/items/:productId", h.SetItemHandler)
+	r.POST("/api/group-carts/:id/lock", h.LockHandler)
+	r.POST("/api/group-carts/:id/order", h.PlaceOrderHandler)
+
+	do := func(user, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-User", user)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do("", http.MethodPost, "/api/group-carts", "").Code)
+
+	w := do("owner", http.MethodPost, "/api/group-carts", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var group models.PricedGroupCart
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &group))
+	base := "/api/group-carts/" + strconv.Itoa(group.ID)
+
+	assert.Equal(t, http.StatusForbidden, do("colleague", http.MethodGet, base, "").Code)
+	assert.Equal(t, http.StatusOK, do("colleague", http.MethodPost, "/api/group-carts/join/"+group.InviteToken, "").Code)
+	assert.Equal(t, http.StatusOK, do("colleague", http.MethodPut, base+"/items/1", `{"quantity": 2}`).Code)
+	assert.Equal(t, http.StatusNotFound, do("colleague", http.MethodPut, base+"/items/999", `{"quantity": 1}`).Code)
+	assert.Equal(t, http.StatusConflict, do("owner", http.MethodPost, base+"/order", "").Code)
+	assert.Equal(t, http.StatusOK, do("owner", http.MethodPost, base+"/lock", "").Code)
+	assert.Equal(t, http.StatusConflict, do("colleague", http.MethodPut, base+"/items/1", `{"quantity": 1}`).Code)
+
+	w = do("owner", http.MethodPost, base+"/order", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var order models.Order
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+	assert.Equal(t, []models.OrderParticipant{{UserID: colleague, Username: "colleague", Subtotal: 32000}}, order.Participants)
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type recordingSecurityEvents struct {
+	mu     sync.Mutex
+	events []models.SecurityEvent
+}
+
+func (r *recordingSecurityEvents) Record(ctx context.Context, event models.SecurityEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func newTestLoginThrottle(policy services.LockoutPolicy) (*services.LoginThrottle, *recordingSecurityEvents, func(time.Duration)) {
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	attempts := services.NewInMemoryAttemptCounter()
+	attempts.Now = func() time.Time { return now }
+	events := &recordingSecurityEvents{}
+	throttle := services.NewLoginThrottle(attempts, events, policy, slog.Default())
+	throttle.Now = attempts.Now
+	return throttle, events, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLoginThrottle_BackoffPerUsername(t *testing.T) {
+	ctx := context.Background()
+	throttle, events, advance := newTestLoginThrottle(services.LockoutPolicy{
+		UserFailures: 3, IPFailures: 100, Lockout: time.Minute, MaxLockout: 4 * time.Minute,
+	})
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, throttle.Failed(ctx, "alice", "10.0.0.1"))
+	}
+	_, err := throttle.Check(ctx, "alice", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Empty(t, events.events)
+
+	require.NoError(t, throttle.Failed(ctx, "Alice", "10.0.0.2"))
+	wait, err := throttle.Check(ctx, "alice", "10.0.0.3")
+	assert.ErrorIs(t, err, services.ErrLoginLocked, "usernames are case insensitive, the IP does not matter")
+	assert.Equal(t, time.Minute, wait)
+	require.Len(t, events.events, 1)
+	assert.Equal(t, models.SecurityLoginLockout, events.events[0].Type)
+	assert.Equal(t, "Alice", events.events[0].Username)
+	assert.Equal(t, 3, events.events[0].Failures)
+
+	_, err = throttle.Check(ctx, "bob", "10.0.0.3")
+	assert.NoError(t, err, "other accounts are not locked")
+
+	advance(time.Minute)
+	_, err = throttle.Check(ctx, "alice", "10.0.0.1")
+	require.NoError(t, err)
+
+	expected := []time.Duration{2 * time.Minute, 4 * time.Minute, 4 * time.Minute}
+	for _, want := range expected {
+		require.NoError(t, throttle.Failed(ctx, "alice", "10.0.0.1"))
+		wait, err = throttle.Check(ctx, "alice", "10.0.0.1")
+		assert.ErrorIs(t, err, services.ErrLoginLocked)
+		assert.Equal(t, want, wait)
+	}
+
+	require.NoError(t, throttle.Unlock(ctx, "alice"))
+	_, err = throttle.Check(ctx, "alice", "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.SecurityLoginUnlock, events.events[len(events.events)-1].Type)
+
+	require.NoError(t, throttle.Failed(ctx, "alice", "10.0.0.1"))
+	_, err = throttle.Check(ctx, "alice", "10.0.0.1")
+	assert.NoError(t, err, "unlocking forgets the failures")
+}
+
+func TestLoginThrottle_LocksOutIP(t *testing.T) {
+	ctx := context.Background()
+	throttle, events, _ := newTestLoginThrottle(services.LockoutPolicy{UserFailures: 100, IPFailures: 3, Lockout: time.Minute})
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		require.NoError(t, throttle.Failed(ctx, username, "10.0.0.1"))
+	}
+	require.NoError(t, throttle.Succeeded(ctx, "alice"))
+
+	_, err := throttle.Check(ctx, "dave", "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrLoginLocked, "a successful login does not reset the IP")
+	_, err = throttle.Check(ctx, "dave", "10.0.0.2")
+	assert.NoError(t, err)
+	require.Len(t, events.events, 1)
+	assert.Equal(t, "10.0.0.1", events.events[0].IP)
+}
+
+func TestLoginHandler_LockoutAfterFailedLogins(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	throttle, _, _ := newTestLoginThrottle(services.LockoutPolicy{UserFailures: 3, IPFailures: 100, Lockout: time.Minute})
+	auth := handlers.NewAuthHandlers(services.NewHMACKeys([]byte("test-secret-key")), repo.UserRepository, slog.Default(), nil, models.CartMergeSum, nil, nil, nil, throttle)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateUser(ctx, models.User{Username: "alice", Email: "alice@example.com"}, string(hash)))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/auth/login", auth.GetLoginHandler)
+	login := func(username, password string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, createTestRequest(http.MethodPost, "/api/auth/login", map[string]string{"username": username, "password": password}))
+		return w
+	}
+
+	require.Equal(t, http.StatusUnauthorized, login("alice", "wrong").Code)
+	require.Equal(t, http.StatusOK, login("alice", "secret-password").Code)
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusUnauthorized, login("alice", "wrong").Code, "success resets the count")
+	}
+
+	w := login("alice", "secret-password")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "locked out even with the right password")
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusUnauthorized, login("nobody", "wrong").Code)
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderService_EarnsBonusWithCategoryMultiplier(t *testing.T) {
+	ctx := context.Background()
+	env := newTestOrderService(t)
+	repo, carts, loyalty, orders := env.repo, env.carts, env.loyalty, env.orders
+	alice := createTestUser(t, repo, "alice")
+
+	cartID := services.UserCartID(alice)
+	require.NoError(t, carts.AddToCart(ctx, cartID, models.CartItem{ProductID: 1, Quantity: 2}))
+	require.NoError(t, carts.AddToCart(ctx, cartID, models.CartItem{ProductID: 7, Quantity: 1}))
+
+	order, err := orders.PlaceOrder(ctx, alice, 0)
+	require.NoError(t, err)
+
+	// 5% of 320.00 for burgers plus 5% of 199.00 doubled for the dessert.
+	assert.Equal(t, int64(16+19), order.BonusEarned)
+
+	balance, err := loyalty.Balance(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, int64(35), balance)
+}
+
+func TestOrderService_SpendsAndExpiresBonusOldestFirst(t *testing.T) {
+	ctx := context.Background()
+	env := newTestOrderService(t)
+	repo, carts, loyalty, orders := env.repo, env.carts, env.loyalty, env.orders
+	alice := createTestUser(t, repo, "alice")
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	loyalty.Now = func() time.Time { return now }
+
+	order := func(points int64) (*models.Order, error) {
+		require.NoError(t, carts.AddToCart(ctx, services.UserCartID(alice), models.CartItem{ProductID: 5, Quantity: 10}))
+		placed, err := orders.PlaceOrder(ctx, alice, points)
+		if err != nil {
+			require.NoError(t, carts.ClearCart(ctx, services.UserCartID(alice)))
+		}
+		return placed, err
+	}
+
+	first, err := order(0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(195), first.BonusEarned)
+
+	now = now.Add(20 * 24 * time.Hour)
+	_, err = order(1000)
+	assert.ErrorIs(t, err, services.ErrInsufficientBonus)
+	_, err = order(195 * 20)
+	assert.ErrorIs(t, err, services.ErrBonusSpendLimit)
+
+	second, err := order(100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), second.BonusSpent)
+	assert.Equal(t, int64(3900*100-100*100), second.Total-second.DeliveryFee)
+	assert.Equal(t, int64(190), second.BonusEarned)
+
+	balance, err := loyalty.Balance(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, int64(95+190), balance)
+
+	// The rest of the first earning expires, the second one is still valid.
+	now = now.Add(15 * 24 * time.Hour)
+	require.NoError(t, loyalty.ExpirePoints(ctx))
+
+	balance, err = loyalty.Balance(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, int64(190), balance)
+
+	history, err := loyalty.History(ctx, alice)
+	require.NoError(t, err)
+	var kinds []models.BonusKind
+	var sum int64
+	for _, e := range history {
+		kinds = append(kinds, e.Kind)
+		sum += e.Amount
+	}
+	assert.Equal(t, []models.BonusKind{models.BonusExpire, models.BonusEarn, models.BonusSpend, models.BonusEarn}, kinds)
+	assert.Equal(t, balance, sum)
+}
+
+func TestOrderService_FreeDeliveryKeepsBonusForProducts(t *testing.T) {
+	ctx := context.Background()
+	env := newTestOrderService(t)
+	repo, carts, orders := env.repo, env.carts, env.orders
+	alice := createTestUser(t, repo, "alice")
+	cartID := services.UserCartID(alice)
+
+	require.NoError(t, carts.AddToCart(ctx, cartID, models.CartItem{ProductID: 5, Quantity: 10}))
+	require.NoError(t, carts.SetPromoCode(ctx, cartID, "FREEDELIVERY"))
+	first, err := orders.PlaceOrder(ctx, alice, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(19900), first.Discount)
+	assert.Equal(t, int64(195), first.BonusEarned, "the waived delivery fee is not a discount on the products")
+
+	// Half of the 320.00 burgers may be paid with points.
+	require.NoError(t, carts.AddToCart(ctx, cartID, models.CartItem{ProductID: 1, Quantity: 2}))
+	require.NoError(t, carts.SetPromoCode(ctx, cartID, "FREEDELIVERY"))
+	second, err := orders.PlaceOrder(ctx, alice, 160)
+	require.NoError(t, err)
+	assert.Equal(t, int64(160), second.BonusSpent)
+	assert.Equal(t, int64(32000-16000), second.Total)
+	assert.Equal(t, int64(8), second.BonusEarned)
+}
+
+func TestBonusRepository_CarriesOverLegacyBalance(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	alice := createTestUser(t, repo, "alice")
+
+	_, err := repo.DB.ExecContext(ctx, "UPDATE users SET bonus = 120 WHERE id = ?", alice)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.BonusRepository.Init(ctx, repo.DB))
+	require.NoError(t, repo.BonusRepository.Init(ctx, repo.DB))
+
+	balance, err := repo.GetBonusBalance(ctx, alice, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(120), balance)
+
+	profile, err := repo.GetUserProfile(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 120, profile.Bonus)
+}
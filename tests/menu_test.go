@@ -0,0 +1,330 @@
+package tests
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"CartoonBurgers/services"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAppRepository(t *testing.T) *repositories.AppRepository {
+	t.Helper()
+
+	repo, err := repositories.NewAppRepository(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.DB.Close() })
+
+	return repo
+}
+
+func TestParseAllergens_TableDriven(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		expected  []models.Allergen
+		expectErr bool
+	}{
+		{name: "Empty", raw: "", expected: nil},
+		{name: "Single", raw: "gluten", expected: []models.Allergen{models.Gluten}},
+		{name: "Mixed case and spaces", raw: " Gluten , MILK ", expected: []models.Allergen{models.Gluten, models.Milk}},
+		{name: "Unknown allergen", raw: "gluten,plastic", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allergens, err := services.ParseAllergens(tt.raw)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, allergens)
+		})
+	}
+}
+
+func TestMenuService_ExcludeAllergens(t *testing.T) {
+	repo := newTestAppRepository(t)
+	service := services.NewMenuService(repo.ProductRerository, repo.CategoryRepository, "ru", time.UTC)
+
+	all, err := service.GetMenu(context.Background(), services.MenuFilter{})
+	require.NoError(t, err)
+	require.Len(t, all, 8)
+
+	for _, p := range all {
+		assert.NotNil(t, p.Nutrition, p.Name)
+		assert.NotEmpty(t, p.Allergens, p.Name)
+	}
+
+	noMilk, err := service.GetMenu(context.Background(), services.MenuFilter{
+		ExcludeAllergens: []models.Allergen{models.Milk},
+		Locale:           "en",
+	})
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(noMilk))
+	for _, p := range noMilk {
+		assert.NotContains(t, p.Allergens, models.Milk)
+		names = append(names, p.Name)
+	}
+	assert.ElementsMatch(t, []string{"Classic Carton", "Purple Burger", "Chicken Nuggets"}, names)
+}
+
+func TestLocalizer_Resolve(t *testing.T) {
+	localizer := services.NewLocalizer("ru", []string{"ru", "en"})
+
+	tests := []struct {
+		name           string
+		lang           string
+		acceptLanguage string
+		expected       string
+	}{
+		{name: "Default", expected: "ru"},
+		{name: "Query param", lang: "en", expected: "en"},
+		{name: "Query param wins over header", lang: "ru", acceptLanguage: "en-US", expected: "ru"},
+		{name: "Unsupported query param", lang: "de", acceptLanguage: "en", expected: "en"},
+		{name: "Header with region", acceptLanguage: "en-GB,en;q=0.9", expected: "en"},
+		{name: "Header quality order", acceptLanguage: "de;q=1.0, ru;q=0.5, en;q=0.8", expected: "en"},
+		{name: "Nothing supported", acceptLanguage: "de, fr", expected: "ru"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, localizer.Resolve(tt.lang, tt.acceptLanguage))
+		})
+	}
+}
+
+func TestMenuService_Translations(t *testing.T) {
+	repo := newTestAppRepository(t)
+	service := services.NewMenuService(repo.ProductRerository, repo.CategoryRepository, "ru", time.UTC)
+
+	byName := func(products []models.Product) map[int]string {
+		names := make(map[int]string)
+		for _, p := range products {
+			names[p.ID] = p.Name
+		}
+		return names
+	}
+
+	ru, err := service.GetMenu(context.Background(), services.MenuFilter{Locale: "ru"})
+	require.NoError(t, err)
+	en, err := service.GetMenu(context.Background(), services.MenuFilter{Locale: "en"})
+	require.NoError(t, err)
+
+	nuggetsID := 0
+	for id, name := range byName(en) {
+		if name == "Chicken Nuggets" {
+			nuggetsID = id
+		}
+	}
+	require.NotZero(t, nuggetsID)
+	assert.Equal(t, "Куриные наггетсы", byName(ru)[nuggetsID])
+
+	_, err = repo.DB.Exec("DELETE FROM product_translations WHERE product_id = ? AND locale = 'en'", nuggetsID)
+	require.NoError(t, err)
+
+	en, err = service.GetMenu(context.Background(), services.MenuFilter{Locale: "en"})
+	require.NoError(t, err)
+	assert.Equal(t, "Куриные наггетсы", byName(en)[nuggetsID])
+}
+
+func TestAvailabilityWindow_Contains(t *testing.T) {
+	// 2025-09-22 is a Monday.
+	at := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", value)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	tests := []struct {
+		name     string
+		window   models.AvailabilityWindow
+		at       time.Time
+		expected bool
+	}{
+		{name: "Unrestricted", window: models.AvailabilityWindow{}, at: at("2025-09-22 03:00"), expected: true},
+		{name: "Breakfast morning", window: models.AvailabilityWindow{StartTime: "07:00", EndTime: "11:00"}, at: at("2025-09-22 08:30"), expected: true},
+		{name: "Breakfast end is exclusive", window: models.AvailabilityWindow{StartTime: "07:00", EndTime: "11:00"}, at: at("2025-09-22 11:00"), expected: false},
+		{name: "Over midnight late", window: models.AvailabilityWindow{StartTime: "22:00", EndTime: "02:00"}, at: at("2025-09-22 23:15"), expected: true},
+		{name: "Over midnight early", window: models.AvailabilityWindow{StartTime: "22:00", EndTime: "02:00"}, at: at("2025-09-22 01:15"), expected: true},
+		{name: "Over midnight day", window: models.AvailabilityWindow{StartTime: "22:00", EndTime: "02:00"}, at: at("2025-09-22 12:00"), expected: false},
+		{name: "Weekday match", window: models.AvailabilityWindow{Days: []string{"mon", "tue"}}, at: at("2025-09-22 12:00"), expected: true},
+		{name: "Weekday mismatch", window: models.AvailabilityWindow{Days: []string{"sat", "sun"}}, at: at("2025-09-22 12:00"), expected: false},
+		{name: "Launch window inside", window: models.AvailabilityWindow{StartDate: "2025-09-01", EndDate: "2025-09-30"}, at: at("2025-09-30 23:59"), expected: true},
+		{name: "Breakfast without leading zero", window: models.AvailabilityWindow{StartTime: "7:00", EndTime: "11:00"}, at: at("2025-09-22 09:00"), expected: true},
+		{name: "Breakfast without leading zero at night", window: models.AvailabilityWindow{StartTime: "7:00", EndTime: "11:00"}, at: at("2025-09-22 00:30"), expected: false},
+		{name: "Friday night after midnight", window: models.AvailabilityWindow{Days: []string{"fri"}, StartTime: "22:00", EndTime: "02:00"}, at: at("2025-09-27 01:30"), expected: true},
+		{name: "Friday night on Friday morning", window: models.AvailabilityWindow{Days: []string{"fri"}, StartTime: "22:00", EndTime: "02:00"}, at: at("2025-09-26 01:30"), expected: false},
+		{name: "Launch window after", window: models.AvailabilityWindow{StartDate: "2025-09-01", EndDate: "2025-09-30"}, at: at("2025-10-01 00:00"), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tt.window.Validate())
+			assert.Equal(t, tt.expected, tt.window.Contains(tt.at))
+		})
+	}
+}
+
+func TestParseAvailabilityWindow_PadsTimes(t *testing.T) {
+	w, err := models.ParseAvailabilityWindow("mon,tue 7:00-11:00")
+	require.NoError(t, err)
+	assert.Equal(t, "07:00", w.StartTime)
+	assert.Equal(t, "mon,tue 07:00-11:00", w.String())
+
+	_, err = models.ParseAvailabilityWindow("7-11:00")
+	assert.Error(t, err)
+}
+
+func TestMenuService_Availability(t *testing.T) {
+	repo := newTestAppRepository(t)
+	moscow := time.FixedZone("MSK", 3*60*60)
+	service := services.NewMenuService(repo.ProductRerository, repo.CategoryRepository, "en", moscow)
+
+	products, err := service.GetMenu(context.Background(), services.MenuFilter{})
+	require.NoError(t, err)
+	var cheeseBurger models.Product
+	for _, p := range products {
+		if p.Name == "Cheese Burger" {
+			cheeseBurger = p
+		}
+	}
+	require.NotZero(t, cheeseBurger.ID)
+
+	breakfast := &models.AvailabilityWindow{ProductID: &cheeseBurger.ID, StartTime: "07:00", EndTime: "11:00"}
+	require.NoError(t, repo.SaveAvailabilityWindow(context.Background(), breakfast))
+
+	desserts := 4
+	weekend := &models.AvailabilityWindow{CategoryID: &desserts, Days: []string{"sat", "sun"}}
+	require.NoError(t, repo.SaveAvailabilityWindow(context.Background(), weekend))
+
+	// 05:00 UTC on Monday is 08:00 in the store timezone.
+	service.Now = func() time.Time { return time.Date(2025, 9, 22, 5, 0, 0, 0, time.UTC) }
+
+	_, err = service.CheckAvailable(context.Background(), cheeseBurger.ID)
+	assert.NoError(t, err)
+
+	products, err = service.GetMenu(context.Background(), services.MenuFilter{})
+	require.NoError(t, err)
+	for _, p := range products {
+		assert.NotEqual(t, desserts, p.CategoryID, p.Name)
+	}
+	assert.Len(t, products, 6)
+
+	service.Now = func() time.Time { return time.Date(2025, 9, 22, 9, 0, 0, 0, time.UTC) }
+
+	_, err = service.CheckAvailable(context.Background(), cheeseBurger.ID)
+	assert.ErrorIs(t, err, services.ErrProductUnavailable)
+
+	_, err = service.CheckAvailable(context.Background(), 999)
+	assert.ErrorIs(t, err, services.ErrProductNotFound)
+
+	all, err := service.GetMenu(context.Background(), services.MenuFilter{IncludeUnavailable: true})
+	require.NoError(t, err)
+	assert.Len(t, all, 8)
+}
+
+func TestMenuService_Sections(t *testing.T) {
+	repo := newTestAppRepository(t)
+	service := services.NewMenuService(repo.ProductRerository, repo.CategoryRepository, "en", time.UTC)
+
+	_, err := repo.DB.Exec("UPDATE categories SET sort_order = 5 WHERE slug = 'desserts'")
+	require.NoError(t, err)
+
+	sections, err := service.GetSections(context.Background(), services.MenuFilter{})
+	require.NoError(t, err)
+
+	slugs := make([]string, 0, len(sections))
+	for _, s := range sections {
+		slugs = append(slugs, s.Slug)
+		for _, p := range s.Products {
+			assert.Equal(t, s.ID, p.CategoryID)
+		}
+	}
+	assert.Equal(t, []string{"desserts", "burgers", "snacks"}, slugs, "drinks has no products")
+	assert.Equal(t, "Desserts", sections[0].Name)
+
+	sections, err = service.GetSections(context.Background(), services.MenuFilter{Locale: "ru"})
+	require.NoError(t, err)
+	assert.Equal(t, "Десерты", sections[0].Name)
+
+	burgers := 1
+	require.NoError(t, repo.SaveAvailabilityWindow(context.Background(), &models.AvailabilityWindow{
+		CategoryID: &burgers,
+		Days:       []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"},
+	}))
+
+	sections, err = service.GetSections(context.Background(), services.MenuFilter{})
+	require.NoError(t, err)
+	require.Equal(t, "burgers", sections[1].Slug)
+	assert.Len(t, sections[1].Availability, 1, "sections keep the category availability")
+
+	_, err = repo.DB.Exec("UPDATE categories SET visible = 0 WHERE slug = 'snacks'")
+	require.NoError(t, err)
+
+	sections, err = service.GetSections(context.Background(), services.MenuFilter{})
+	require.NoError(t, err)
+	assert.Len(t, sections, 2)
+
+	products, err := service.GetMenu(context.Background(), services.MenuFilter{})
+	require.NoError(t, err)
+	for _, p := range products {
+		assert.NotEqual(t, "Chicken Nuggets", p.Name)
+	}
+}
+
+func TestCategoryRepository_MigratesLegacyCategories(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	schema, err := os.ReadFile(filepath.Join("..", "repositories", "migrations", "001_create_products_table_up.sql"))
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO products (pName, pPrice, pCount, pType, pCategory) VALUES
+		('Old Burger', 100, 1, 0, 0), ('Old Cola', 90, 1, 0, 2), ('Old Cake', 150, 1, 0, 3)`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	repo, err := repositories.NewAppRepository(context.Background(), path)
+	require.NoError(t, err)
+
+	categories, err := repo.GetCategories(context.Background())
+	require.NoError(t, err)
+	slugByID := make(map[int]string)
+	for _, c := range categories {
+		slugByID[c.ID] = c.Slug
+	}
+
+	products, err := repo.ProductRerository.GetAll(context.Background())
+	require.NoError(t, err)
+	require.Len(t, products, 3)
+
+	expected := map[string]string{"Old Burger": "burgers", "Old Cola": "drinks", "Old Cake": "desserts"}
+	for _, p := range products {
+		assert.Equal(t, expected[p.Name], slugByID[p.CategoryID], p.Name)
+	}
+
+	// Opening the database again must not shift the categories twice.
+	require.NoError(t, repo.DB.Close())
+	repo, err = repositories.NewAppRepository(context.Background(), path)
+	require.NoError(t, err)
+	defer repo.DB.Close()
+
+	again, err := repo.ProductRerository.GetAll(context.Background())
+	require.NoError(t, err)
+	for i := range again {
+		assert.Equal(t, products[i].CategoryID, again[i].CategoryID)
+	}
+}
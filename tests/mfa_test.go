@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// The SHA1 seed of RFC 6238 appendix B, "12345678901234567890".
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := services.TOTPCode(secret, services.TOTPStep(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.code, code, "T=%d", tt.unix)
+	}
+
+	step, ok := services.MatchTOTP(secret, "287082", time.Unix(59+30, 0))
+	assert.True(t, ok, "previous step is accepted")
+	assert.Equal(t, int64(1), step)
+	_, ok = services.MatchTOTP(secret, "287082", time.Unix(59+90, 0))
+	assert.False(t, ok)
+
+	uri := services.TOTPURI("Cartoon Burgers", "alice", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Cartoon%20Burgers:alice?"), uri)
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=Cartoon+Burgers")
+}
+
+func TestMFA_EnrolAndTwoStepLogin(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	logger := slog.Default()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	roles := services.NewRoleService(repo.RoleRepository, repo.UserRepository, logger)
+	tokens := services.NewTokenService(services.NewHMACKeys([]byte("test-secret-key")), repo.RefreshTokenRepository, repo.SessionRepository, roles, 0, 0, logger)
+	mfa := services.NewMFAService(repo.MFARepository, repo.OneTimeTokenRepository, repo.UserRepository, "Cartoon Burgers", logger)
+	mfa.Now = func() time.Time { return now }
+	auth := handlers.NewAuthHandlers(services.NewHMACKeys([]byte("test-secret-key")), repo.UserRepository, logger, nil, models.CartMergeSum, tokens, nil, mfa, nil)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateUser(ctx, models.User{Username: "admin", Email: "admin@example.com"}, string(hash)))
+	admin, err := repo.GetUserID(ctx, "admin")
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/auth/login", auth.GetLoginHandler)
+	r.POST("/api/auth/mfa/verify", auth.MFAVerifyHandler)
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, createTestRequest(http.MethodPost, path, body))
+		return w
+	}
+	login := func() string {
+		w := post("/api/auth/login", map[string]string{"username": "admin", "password": "secret-password"})
+		require.Equal(t, http.StatusOK, w.Code)
+		var challenge models.MFAChallenge
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &challenge))
+		require.True(t, challenge.MFARequired)
+		require.NotEmpty(t, challenge.ChallengeToken)
+		return challenge.ChallengeToken
+	}
+	verify := func(challenge, code string) *httptest.ResponseRecorder {
+		return post("/api/auth/mfa/verify", map[string]string{"challengeToken": challenge, "code": code})
+	}
+
+	w := post("/api/auth/login", map[string]string{"username": "admin", "password": "secret-password"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"token"`, "no second step before enrolment")
+
+	enrolment, err := mfa.Enroll(ctx, admin)
+	require.NoError(t, err)
+	assert.Contains(t, enrolment.URI, "Cartoon%20Burgers:admin")
+	code := func() string {
+		c, err := services.TOTPCode(enrolment.Secret, services.TOTPStep(now))
+		require.NoError(t, err)
+		return c
+	}
+
+	_, err = mfa.Confirm(ctx, admin, "000000")
+	assert.ErrorIs(t, err, services.ErrMFACodeInvalid)
+	recovery, err := mfa.Confirm(ctx, admin, code())
+	require.NoError(t, err)
+	assert.Len(t, recovery, services.RecoveryCodeCount)
+	_, err = mfa.Enroll(ctx, admin)
+	assert.ErrorIs(t, err, services.ErrMFAAlreadyEnabled)
+
+	challenge := login()
+	assert.Equal(t, http.StatusUnauthorized, verify(challenge, code()).Code, "the confirmation code works once")
+
+	now = now.Add(services.TOTPPeriod)
+	w = verify(challenge, code())
+	require.Equal(t, http.StatusOK, w.Code)
+	var pair models.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pair))
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(pair.AccessToken, claims, func(*jwt.Token) (interface{}, error) { return []byte("test-secret-key"), nil })
+	require.NoError(t, err)
+	assert.Equal(t, true, claims["mfa"])
+
+	refreshed, err := tokens.Refresh(ctx, newMemoryRedis(), pair.RefreshToken, models.SessionClient{})
+	require.NoError(t, err)
+	claims = jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(refreshed.AccessToken, claims, func(*jwt.Token) (interface{}, error) { return []byte("test-secret-key"), nil })
+	require.NoError(t, err)
+	assert.Equal(t, true, claims["mfa"], "kept on refresh")
+
+	assert.Equal(t, http.StatusUnauthorized, verify(challenge, code()).Code, "challenges work once")
+
+	challenge = login()
+	assert.Equal(t, http.StatusOK, verify(challenge, strings.ToLower(recovery[0])).Code)
+	assert.Equal(t, http.StatusUnauthorized, verify(login(), recovery[0]).Code, "recovery codes work once")
+	status, err := mfa.Status(ctx, admin)
+	require.NoError(t, err)
+	assert.Equal(t, models.MFAStatus{Enabled: true, RecoveryCodesLeft: services.RecoveryCodeCount - 1}, *status)
+
+	challenge = login()
+	now = now.Add(services.TOTPPeriod)
+	for i := 0; i < services.MFAChallengeAttempts; i++ {
+		assert.Equal(t, http.StatusUnauthorized, verify(challenge, "123456").Code)
+	}
+	assert.Equal(t, http.StatusUnauthorized, verify(challenge, code()).Code, "too many wrong codes")
+}
+
+func TestRequireMFA(t *testing.T) {
+	check := func(roles []models.Role, mfa bool) int {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set("roles", roles)
+			c.Set("mfa", mfa)
+		})
+		r.GET("/api/admin/menu", services.RequireMFA(slog.Default()), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/admin/menu", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, check([]models.Role{models.RoleAdmin, models.RoleCustomer}, false))
+	assert.Equal(t, http.StatusForbidden, check([]models.Role{models.RoleStaff, models.RoleCustomer}, false))
+	assert.Equal(t, http.StatusNoContent, check([]models.Role{models.RoleStaff, models.RoleCustomer}, true))
+	assert.Equal(t, http.StatusNoContent, check([]models.Role{models.RoleCourier, models.RoleCustomer}, false))
+}
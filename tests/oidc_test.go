@@ -0,0 +1,415 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"CartoonBurgers/services"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	fakeOIDCClientID     = "burgers"
+	fakeOIDCClientSecret = "burgers-secret"
+	fakeOIDCRedirectURL  = "https://shop.example.com/oidc/fake/callback"
+)
+
+// fakeOIDCProvider is an OpenID Connect provider serving discovery, the
+// token endpoint and its JWKS. Authorize stands in for the browser visiting
+// the authorization endpoint and the user logging in.
+type fakeOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeOIDCCode
+	// Tamper changes the ID token claims before they are signed.
+	Tamper func(claims jwt.MapClaims)
+	// SignWith replaces the published key the ID token is signed with.
+	SignWith *rsa.PrivateKey
+}
+
+type fakeOIDCCode struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &fakeOIDCProvider{key: key, codes: make(map[string]fakeOIDCCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models.JWKS{Keys: []models.JWK{{
+			Kty: "RSA",
+			Kid: "fake-key",
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakeOIDCProvider) config() services.OIDCProviderConfig {
+	return services.OIDCProviderConfig{
+		Name:         "fake",
+		DisplayName:  "Fake ID",
+		Issuer:       p.server.URL,
+		ClientID:     fakeOIDCClientID,
+		ClientSecret: fakeOIDCClientSecret,
+	}
+}
+
+// Authorize checks the authorization URL like the provider would and
+// returns the code and state it redirects back with for the user.
+func (p *fakeOIDCProvider) Authorize(t *testing.T, authURL string, user jwt.MapClaims) (code, state string) {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	require.Equal(t, p.server.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	query := parsed.Query()
+	require.Equal(t, "code", query.Get("response_type"))
+	require.Equal(t, fakeOIDCClientID, query.Get("client_id"))
+	require.Equal(t, fakeOIDCRedirectURL, query.Get("redirect_uri"))
+	require.Equal(t, "openid email profile", query.Get("scope"))
+	require.Equal(t, "S256", query.Get("code_challenge_method"))
+	require.NotEmpty(t, query.Get("state"))
+	require.NotEmpty(t, query.Get("nonce"))
+
+	code = rand.Text()
+	p.mu.Lock()
+	p.codes[code] = fakeOIDCCode{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), claims: user}
+	p.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (p *fakeOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(description string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": description})
+	}
+
+	p.mu.Lock()
+	issued, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	tamper, signWith := p.Tamper, p.SignWith
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	switch {
+	case r.PostFormValue("grant_type") != "authorization_code":
+		fail("grant type")
+	case !ok:
+		fail("unknown code")
+	case r.PostFormValue("client_id") != fakeOIDCClientID || r.PostFormValue("client_secret") != fakeOIDCClientSecret:
+		fail("client")
+	case r.PostFormValue("redirect_uri") != fakeOIDCRedirectURL:
+		fail("redirect uri")
+	case base64.RawURLEncoding.EncodeToString(verifier[:]) != issued.challenge:
+		fail("code verifier")
+	default:
+		now := time.Now()
+		claims := jwt.MapClaims{
+			"iss":   p.server.URL,
+			"aud":   fakeOIDCClientID,
+			"nonce": issued.nonce,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}
+		for name, value := range issued.claims {
+			claims[name] = value
+		}
+		if tamper != nil {
+			tamper(claims)
+		}
+		if signWith == nil {
+			signWith = p.key
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "fake-key"
+		signed, err := token.SignedString(signWith)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": signed})
+	}
+}
+
+func newTestOIDCService(t *testing.T) (*services.OIDCService, *fakeOIDCProvider, *repositories.AppRepository) {
+	t.Helper()
+
+	repo := newTestAppRepository(t)
+	fake := newFakeOIDCProvider(t)
+	provider := services.NewOIDCProvider(fake.config(), fakeOIDCRedirectURL, fake.server.Client())
+	return services.NewOIDCService([]*services.OIDCProvider{provider}, repo.OIDCRepository, repo.UserRepository, slog.Default()), fake, repo
+}
+
+// loginWith runs a provider login of the user, linking the account to
+// linkUserID when it is not zero. linkUserID also finishes the login.
+func loginWith(t *testing.T, oidc *services.OIDCService, fake *fakeOIDCProvider, linkUserID int, user jwt.MapClaims) (int, string, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	authURL, _, err := oidc.Start(ctx, "fake", linkUserID)
+	require.NoError(t, err)
+	code, state := fake.Authorize(t, authURL, user)
+	return oidc.Callback(ctx, "fake", code, state, linkUserID)
+}
+
+func TestOIDCService_RegistersNewUser(t *testing.T) {
+	ctx := context.Background()
+	oidc, fake, repo := newTestOIDCService(t)
+	user := jwt.MapClaims{"sub": "1001", "email": "carol@mail.example", "email_verified": true, "preferred_username": "carol k"}
+
+	assert.Equal(t, []models.OIDCProvider{{Name: "fake", DisplayName: "Fake ID"}}, oidc.Providers())
+
+	userID, username, err := loginWith(t, oidc, fake, 0, user)
+	require.NoError(t, err)
+	assert.Equal(t, "carolk", username)
+
+	registered, err := repo.FindUserByEmail(ctx, "carol@mail.example")
+	require.NoError(t, err)
+	assert.Equal(t, userID, registered.Id)
+	assert.True(t, registered.EmailVerified, "the provider verified the email")
+
+	identities, err := oidc.Identities(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	assert.Equal(t, "fake", identities[0].Provider)
+	assert.Equal(t, "carol@mail.example", identities[0].Email)
+
+	user["email"] = "carol@new.example"
+	again, _, err := loginWith(t, oidc, fake, 0, user)
+	require.NoError(t, err)
+	assert.Equal(t, userID, again, "the linked account is found by subject, not email")
+
+	// Another provider account asking for the same username gets a suffix.
+	other, otherName, err := loginWith(t, oidc, fake, 0, jwt.MapClaims{"sub": "1002", "email": "carol@other.example", "email_verified": "true", "preferred_username": "carolk"})
+	require.NoError(t, err)
+	assert.NotEqual(t, userID, other)
+	assert.Regexp(t, `^carolk_\d{4}$`, otherName)
+}
+
+func TestOIDCService_LinksVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	oidc, fake, repo := newTestOIDCService(t)
+	alice := createTestUser(t, repo, "alice")
+	user := jwt.MapClaims{"sub": "2001", "email": "alice@example.com", "email_verified": true}
+
+	_, _, err := loginWith(t, oidc, fake, 0, user)
+	assert.ErrorIs(t, err, services.ErrOIDCAccountExists, "an unverified local email may belong to someone else")
+
+	// Accounts older than email verification count as verified without
+	// ever having proved the email.
+	_, err = repo.DB.ExecContext(ctx, "UPDATE users SET email_verified = 1 WHERE id = ?", alice)
+	require.NoError(t, err)
+	_, _, err = loginWith(t, oidc, fake, 0, user)
+	assert.ErrorIs(t, err, services.ErrOIDCAccountExists, "a grandfathered email was never checked")
+
+	require.NoError(t, repo.SetEmailVerified(ctx, alice, time.Now()))
+	userID, username, err := loginWith(t, oidc, fake, 0, user)
+	require.NoError(t, err)
+	assert.Equal(t, alice, userID)
+	assert.Equal(t, "alice", username)
+
+	_, _, err = loginWith(t, oidc, fake, 0, jwt.MapClaims{"sub": "2002", "email": "alice@example.com", "email_verified": false})
+	assert.ErrorIs(t, err, services.ErrOIDCEmailRequired)
+	_, _, err = loginWith(t, oidc, fake, 0, jwt.MapClaims{"sub": "2003"})
+	assert.ErrorIs(t, err, services.ErrOIDCEmailRequired)
+}
+
+func TestOIDCService_LinksToProfile(t *testing.T) {
+	ctx := context.Background()
+	oidc, fake, repo := newTestOIDCService(t)
+	alice := createTestUser(t, repo, "alice")
+	bob := createTestUser(t, repo, "bob")
+	user := jwt.MapClaims{"sub": "3001", "email": "someone@mail.example", "email_verified": false}
+
+	userID, _, err := loginWith(t, oidc, fake, alice, user)
+	require.NoError(t, err)
+	assert.Equal(t, alice, userID, "linking needs no verified email")
+	userID, _, err = loginWith(t, oidc, fake, alice, user)
+	require.NoError(t, err)
+	assert.Equal(t, alice, userID, "linking again is fine")
+
+	_, _, err = loginWith(t, oidc, fake, bob, user)
+	assert.ErrorIs(t, err, services.ErrIdentityTaken)
+
+	userID, _, err = loginWith(t, oidc, fake, 0, user)
+	require.NoError(t, err)
+	assert.Equal(t, alice, userID)
+
+	identities, err := oidc.Identities(ctx, bob)
+	require.NoError(t, err)
+	assert.Empty(t, identities)
+
+	for _, finishedBy := range []int{0, bob} {
+		authURL, _, err := oidc.Start(ctx, "fake", alice)
+		require.NoError(t, err)
+		code, state := fake.Authorize(t, authURL, jwt.MapClaims{"sub": "3002"})
+		_, _, err = oidc.Callback(ctx, "fake", code, state, finishedBy)
+		assert.ErrorIs(t, err, services.ErrOIDCStateInvalid, "only alice finishes her link")
+	}
+	identities, err = oidc.Identities(ctx, alice)
+	require.NoError(t, err)
+	assert.Len(t, identities, 1)
+}
+
+func TestOIDCService_RejectsInvalidLogins(t *testing.T) {
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		tamper   func(claims jwt.MapClaims)
+		signWith *rsa.PrivateKey
+	}{
+		{name: "nonce", tamper: func(claims jwt.MapClaims) { claims["nonce"] = "replayed" }},
+		{name: "missing nonce", tamper: func(claims jwt.MapClaims) { delete(claims, "nonce") }},
+		{name: "audience", tamper: func(claims jwt.MapClaims) { claims["aud"] = "another-client" }},
+		{name: "authorized party", tamper: func(claims jwt.MapClaims) {
+			claims["aud"] = []string{fakeOIDCClientID, "another-client"}
+			claims["azp"] = "another-client"
+		}},
+		{name: "issuer", tamper: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" }},
+		{name: "expired", tamper: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "signature", signWith: other},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oidc, fake, _ := newTestOIDCService(t)
+			fake.Tamper, fake.SignWith = tt.tamper, tt.signWith
+
+			_, _, err := loginWith(t, oidc, fake, 0, jwt.MapClaims{"sub": "4001", "email": "dave@mail.example", "email_verified": true})
+			assert.ErrorIs(t, err, services.ErrOIDCLoginFailed)
+		})
+	}
+}
+
+func TestOIDCService_StateWorksOnce(t *testing.T) {
+	ctx := context.Background()
+	oidc, fake, _ := newTestOIDCService(t)
+	user := jwt.MapClaims{"sub": "5001", "email": "erin@mail.example", "email_verified": true}
+
+	_, _, err := oidc.Start(ctx, "unknown", 0)
+	assert.ErrorIs(t, err, services.ErrOIDCProviderUnknown)
+
+	authURL, _, err := oidc.Start(ctx, "fake", 0)
+	require.NoError(t, err)
+	code, state := fake.Authorize(t, authURL, user)
+
+	_, _, err = oidc.Callback(ctx, "fake", code, "forged", 0)
+	assert.ErrorIs(t, err, services.ErrOIDCStateInvalid)
+	_, _, err = oidc.Callback(ctx, "fake", code, state, 0)
+	require.NoError(t, err)
+	_, _, err = oidc.Callback(ctx, "fake", code, state, 0)
+	assert.ErrorIs(t, err, services.ErrOIDCStateInvalid)
+
+	oidc.Now = func() time.Time { return time.Now().Add(-services.OIDCLoginTTL - time.Minute) }
+	authURL, _, err = oidc.Start(ctx, "fake", 0)
+	require.NoError(t, err)
+	code, state = fake.Authorize(t, authURL, user)
+	oidc.Now = time.Now
+	_, _, err = oidc.Callback(ctx, "fake", code, state, 0)
+	assert.ErrorIs(t, err, services.ErrOIDCStateInvalid, "logins expire")
+}
+
+func TestOIDCHandler_Login(t *testing.T) {
+	oidc, fake, repo := newTestOIDCService(t)
+	keys := services.NewHMACKeys([]byte("test-secret-key"))
+	tokens := services.NewTokenService(keys, repo.RefreshTokenRepository, repo.SessionRepository, services.NewRoleService(repo.RoleRepository, repo.UserRepository, slog.Default()), 0, 0, slog.Default())
+	auth := handlers.NewAuthHandlers(keys, repo.UserRepository, slog.Default(), nil, models.CartMergeSum, tokens, nil, nil, nil)
+	oidcHandler := handlers.NewOIDCHandler(false, oidc, auth, slog.Default())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("redis", newMemoryRedis()) })
+	r.GET("/api/auth/oidc/providers", oidcHandler.GetProvidersHandler)
+	r.POST("/api/auth/oidc/:provider/start", oidcHandler.StartHandler)
+	r.POST("/api/auth/oidc/:provider/callback", oidcHandler.CallbackHandler)
+	protected := r.Group("/api", auth.AuthRequired())
+	protected.GET("/profile/identities", oidcHandler.GetIdentitiesHandler)
+
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, do(createTestRequest(http.MethodPost, "/api/auth/oidc/unknown/start", nil)).Code)
+
+	w := do(createTestRequest(http.MethodPost, "/api/auth/oidc/fake/start", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var authorization models.OIDCAuthorization
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &authorization))
+	code, state := fake.Authorize(t, authorization.AuthorizationURL, jwt.MapClaims{"sub": "6001", "email": "frank@mail.example", "email_verified": true})
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+	callback := func(body gin.H) *http.Request {
+		req := createTestRequest(http.MethodPost, "/api/auth/oidc/fake/callback", body)
+		req.AddCookie(cookies[0])
+		return req
+	}
+
+	assert.Equal(t, http.StatusBadRequest, do(callback(gin.H{"code": code})).Code)
+	w = do(createTestRequest(http.MethodPost, "/api/auth/oidc/fake/callback", gin.H{"code": code, "state": state}))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the state is bound to the browser that started the login")
+
+	w = do(callback(gin.H{"code": code, "state": state}))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var pair models.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pair))
+	assert.NotEmpty(t, pair.RefreshToken)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/profile/identities", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	w = do(req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var identities []models.Identity
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &identities))
+	require.Len(t, identities, 1)
+	assert.Equal(t, "fake", identities[0].Provider)
+
+	w = do(callback(gin.H{"code": code, "state": state}))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the state works once")
+}
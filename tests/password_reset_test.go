@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"CartoonBurgers/services"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var resetLinkToken = regexp.MustCompile(`reset-password\?token=([A-Za-z0-9_-]+)`)
+
+type testPasswordResetEnv struct {
+	repo    *repositories.AppRepository
+	tokens  *services.TokenService
+	redis   *MockRedisClient
+	mailer  *services.InMemoryMailer
+	resets  *services.PasswordResetService
+	current time.Time
+}
+
+func newTestPasswordResetService(t *testing.T) *testPasswordResetEnv {
+	t.Helper()
+
+	env := &testPasswordResetEnv{
+		repo:    newTestAppRepository(t),
+		redis:   &MockRedisClient{},
+		mailer:  services.NewInMemoryMailer(),
+		current: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	now := func() time.Time { return env.current }
+
+	env.tokens = services.NewTokenService(services.NewHMACKeys([]byte("test-secret-key")), env.repo.RefreshTokenRepository, env.repo.SessionRepository, services.NewRoleService(env.repo.RoleRepository, env.repo.UserRepository, slog.Default()), 0, 0, slog.Default())
+	env.tokens.Now = now
+	env.resets = services.NewPasswordResetService(env.repo.UserRepository, env.repo.OneTimeTokenRepository, env.tokens, env.redis, nil, env.mailer,
+		"http://localhost:8080/reset-password", time.Hour, time.Minute, slog.Default())
+	env.resets.Now = now
+	return env
+}
+
+func (env *testPasswordResetEnv) lastResetToken(t *testing.T) string {
+	t.Helper()
+
+	sent := env.mailer.Sent()
+	require.NotEmpty(t, sent)
+	match := resetLinkToken.FindStringSubmatch(sent[len(sent)-1].Body)
+	require.NotNil(t, match, "reset link in mail")
+	return match[1]
+}
+
+// forgot asks for a reset link and waits for it to be sent.
+func (env *testPasswordResetEnv) forgot(ctx context.Context, email string) {
+	env.resets.Forgot(ctx, email)
+	env.resets.Wait()
+}
+
+func TestPasswordResetService_Reset(t *testing.T) {
+	ctx := context.Background()
+	env := newTestPasswordResetService(t)
+	alice := createTestUser(t, env.repo, "alice")
+
+	login, err := env.tokens.Issue(ctx, "alice", alice, models.SessionClient{})
+	require.NoError(t, err)
+
+	env.forgot(ctx, "nobody@example.com")
+	assert.Empty(t, env.mailer.Sent(), "unknown emails get no mail")
+
+	env.forgot(ctx, " Alice@Example.com ")
+	sent := env.mailer.Sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "alice@example.com", sent[0].To)
+	first := env.lastResetToken(t)
+
+	env.forgot(ctx, "alice@example.com")
+	assert.Len(t, env.mailer.Sent(), 1, "one link per cooldown")
+
+	env.current = env.current.Add(time.Minute)
+	env.forgot(ctx, "alice@example.com")
+	require.Len(t, env.mailer.Sent(), 2)
+	token := env.lastResetToken(t)
+	assert.ErrorIs(t, env.resets.Reset(ctx, first, "new-password"), services.ErrResetTokenInvalid, "older links stop working")
+
+	assert.ErrorIs(t, env.resets.Reset(ctx, token, "short"), models.ErrPasswordTooShort)
+
+	env.redis.On("Set", "sessions_revoked:"+strconv.Itoa(alice), env.current.Unix(), services.DefaultAccessTokenTTL).Return("OK", nil)
+	require.NoError(t, env.resets.Reset(ctx, token, "new-password"))
+	env.redis.AssertExpectations(t)
+
+	hash, err := env.repo.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("new-password")))
+
+	_, err = env.tokens.Refresh(ctx, newMemoryRedis(), login.RefreshToken, models.SessionClient{})
+	assert.ErrorIs(t, err, services.ErrRefreshTokenInvalid, "logins are revoked")
+
+	assert.ErrorIs(t, env.resets.Reset(ctx, token, "other-password"), services.ErrResetTokenInvalid, "tokens work once")
+}
+
+func TestPasswordResetService_TokenExpires(t *testing.T) {
+	ctx := context.Background()
+	env := newTestPasswordResetService(t)
+	createTestUser(t, env.repo, "alice")
+
+	env.forgot(ctx, "alice@example.com")
+	token := env.lastResetToken(t)
+
+	env.current = env.current.Add(time.Hour)
+	assert.ErrorIs(t, env.resets.Reset(ctx, token, "new-password"), services.ErrResetTokenInvalid)
+}
+
+func TestPasswordHandler_ForgotDoesNotRevealAccounts(t *testing.T) {
+	env := newTestPasswordResetService(t)
+	createTestUser(t, env.repo, "alice")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	passwords := handlers.NewPasswordHandler(env.resets)
+	r.POST("/api/auth/password/forgot", passwords.ForgotHandler)
+	r.POST("/api/auth/password/reset", passwords.ResetHandler)
+
+	do := func(path string, body interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, createTestRequest(http.MethodPost, path, body))
+		return w
+	}
+
+	known := do("/api/auth/password/forgot", map[string]string{"email": "alice@example.com"})
+	unknown := do("/api/auth/password/forgot", map[string]string{"email": "nobody@example.com"})
+	assert.Equal(t, http.StatusAccepted, known.Code)
+	assert.Equal(t, known.Code, unknown.Code)
+	assert.Equal(t, known.Body.String(), unknown.Body.String())
+	env.resets.Wait()
+	assert.Len(t, env.mailer.Sent(), 1)
+
+	w := do("/api/auth/password/reset", map[string]string{"token": "bogus", "password": "new-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired token")
+}
+
+func TestAuthMiddleware_RejectsRevokedSessions(t *testing.T) {
+	issuedAt := time.Now().Add(-time.Minute)
+	token, err := services.NewAccessToken(services.NewHMACKeys([]byte("test-secret-key")), services.AccessClaims{
+		Username: "alice", UserID: 7, IssuedAt: issuedAt, ExpiresAt: issuedAt.Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	check := func(revokedAt string) int {
+		redisClient := &MockRedisClient{}
+		redisClient.On("Exists", mock.AnythingOfType("string")).Return(int64(0), nil)
+		redisClient.On("Get", "sessions_revoked:7").Return(revokedAt, nil)
+
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(func(c *gin.Context) { c.Set("redis", redisClient) })
+		r.GET("/", services.AuthMiddleware(services.NewHMACKeys([]byte("test-secret-key")), slog.Default()), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, check(strconv.FormatInt(time.Now().Unix(), 10)))
+	assert.Equal(t, http.StatusNoContent, check(strconv.FormatInt(issuedAt.Add(-time.Hour).Unix(), 10)))
+}
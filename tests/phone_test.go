@@ -0,0 +1,229 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"CartoonBurgers/services"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPhoneRegion = models.PhoneRegion{CountryCode: "7", TrunkPrefix: "8"}
+
+func TestNormalizePhone_TableDriven(t *testing.T) {
+	tests := []struct {
+		raw       string
+		expected  string
+		expectErr bool
+	}{
+		{raw: "+7 (912) 123-45-67", expected: "+79121234567"},
+		{raw: "8 912 123 45 67", expected: "+79121234567"},
+		{raw: "912.123.45.67", expected: "+79121234567"},
+		{raw: "0049 30 1234567", expected: "+49301234567"},
+		{raw: "+44 20 7946 0958", expected: "+442079460958"},
+		{raw: "+7 912 abc", expectErr: true},
+		{raw: "+0 912 123 45 67", expectErr: true},
+		{raw: "12345", expectErr: true},
+		{raw: "+1234567890123456", expectErr: true},
+		{raw: "", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			phone, err := models.NormalizePhone(tt.raw, testPhoneRegion)
+			if tt.expectErr {
+				assert.ErrorIs(t, err, models.ErrInvalidPhone)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, phone)
+		})
+	}
+}
+
+type phoneEnv struct {
+	repo   *repositories.AppRepository
+	sms    *services.InMemorySMSSender
+	phones *services.PhoneService
+	now    *time.Time
+}
+
+func newTestPhoneService(t *testing.T) *phoneEnv {
+	t.Helper()
+
+	repo := newTestAppRepository(t)
+	sms := services.NewInMemorySMSSender()
+	phones := services.NewPhoneService(repo.UserRepository, repo.PhoneRepository, sms, testPhoneRegion, 0, 0, slog.Default())
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	phones.Now = func() time.Time { return now }
+	return &phoneEnv{repo: repo, sms: sms, phones: phones, now: &now}
+}
+
+var smsCode = regexp.MustCompile(`\b\d{6}\b`)
+
+// lastCode returns the code texted last to the phone.
+func (e *phoneEnv) lastCode(t *testing.T, phone string) string {
+	t.Helper()
+
+	sent := e.sms.Sent()
+	require.NotEmpty(t, sent)
+	last := sent[len(sent)-1]
+	require.Equal(t, phone, last.To)
+	code := smsCode.FindString(last.Body)
+	require.NotEmpty(t, code)
+	return code
+}
+
+func (e *phoneEnv) advance(d time.Duration) {
+	*e.now = e.now.Add(d)
+}
+
+func TestPhoneService_LinkAndLogin(t *testing.T) {
+	ctx := context.Background()
+	env := newTestPhoneService(t)
+	alice := createTestUser(t, env.repo, "alice")
+	bob := createTestUser(t, env.repo, "bob")
+
+	_, err := env.phones.SendLinkCode(ctx, alice, "not a phone")
+	assert.ErrorIs(t, err, services.ErrInvalidPhone)
+
+	_, err = env.phones.SendLinkCode(ctx, alice, "8 (912) 123-45-67")
+	require.NoError(t, err)
+	code := env.lastCode(t, "+79121234567")
+
+	assert.ErrorIs(t, env.phones.Link(ctx, bob, "+79121234567", code), services.ErrPhoneCodeInvalid, "the code was sent to alice")
+	require.NoError(t, env.phones.Link(ctx, alice, "+7 912 123 45 67", code))
+	user, err := env.repo.GetUser(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, "+79121234567", user.Phone)
+
+	_, err = env.phones.SendLinkCode(ctx, alice, "+79121234567")
+	assert.ErrorIs(t, err, services.ErrPhoneAlreadyLinked)
+	_, err = env.phones.SendLinkCode(ctx, bob, "+79121234567")
+	assert.ErrorIs(t, err, services.ErrPhoneTaken)
+
+	env.advance(time.Minute)
+	_, err = env.phones.SendLoginCode(ctx, "89121234567")
+	require.NoError(t, err)
+	code = env.lastCode(t, "+79121234567")
+
+	userID, username, err := env.phones.Login(ctx, "+79121234567", code)
+	require.NoError(t, err)
+	assert.Equal(t, alice, userID)
+	assert.Equal(t, "alice", username)
+	_, _, err = env.phones.Login(ctx, "+79121234567", code)
+	assert.ErrorIs(t, err, services.ErrPhoneCodeInvalid, "a code works once")
+
+	env.advance(time.Minute)
+	_, err = env.phones.SendLoginCode(ctx, "+79121234567")
+	require.NoError(t, err)
+	code = env.lastCode(t, "+79121234567")
+	require.NoError(t, env.phones.Unlink(ctx, alice))
+	_, _, err = env.phones.Login(ctx, "+79121234567", code)
+	assert.ErrorIs(t, err, services.ErrPhoneCodeInvalid, "unlinking stops phone login")
+
+	env.advance(time.Minute)
+	_, err = env.phones.SendLinkCode(ctx, bob, "+79121234567")
+	require.NoError(t, err, "an unlinked phone can be linked again")
+}
+
+func TestPhoneService_LoginCodeLimits(t *testing.T) {
+	ctx := context.Background()
+	env := newTestPhoneService(t)
+	alice := createTestUser(t, env.repo, "alice")
+	require.NoError(t, env.repo.SetPhone(ctx, alice, "+79121234567"))
+
+	_, err := env.phones.SendLoginCode(ctx, "+79990000000")
+	require.NoError(t, err)
+	assert.Empty(t, env.sms.Sent(), "unlinked phones get no SMS")
+	wait, err := env.phones.SendLoginCode(ctx, "+79990000000")
+	assert.ErrorIs(t, err, services.ErrPhoneCodeThrottled, "unlinked phones are throttled like linked ones")
+	assert.Equal(t, time.Minute, wait)
+
+	_, err = env.phones.SendLoginCode(ctx, "+79121234567")
+	require.NoError(t, err)
+	code := env.lastCode(t, "+79121234567")
+	for i := 0; i < services.PhoneCodeAttempts; i++ {
+		_, _, err = env.phones.Login(ctx, "+79121234567", "000000")
+		assert.ErrorIs(t, err, services.ErrPhoneCodeInvalid)
+	}
+	_, _, err = env.phones.Login(ctx, "+79121234567", code)
+	assert.ErrorIs(t, err, services.ErrPhoneCodeInvalid, "the code stops working after too many guesses")
+
+	env.advance(30 * time.Second)
+	wait, err = env.phones.SendLoginCode(ctx, "+79121234567")
+	assert.ErrorIs(t, err, services.ErrPhoneCodeThrottled)
+	assert.Equal(t, 30*time.Second, wait)
+
+	for i := 1; i < services.PhoneCodesPerHour; i++ {
+		env.advance(time.Minute)
+		_, err = env.phones.SendLoginCode(ctx, "+79121234567")
+		require.NoError(t, err)
+	}
+	env.advance(time.Minute)
+	wait, err = env.phones.SendLoginCode(ctx, "+79121234567")
+	assert.ErrorIs(t, err, services.ErrPhoneCodeThrottled, "at most PhoneCodesPerHour codes an hour")
+	assert.Equal(t, time.Hour-5*time.Minute-30*time.Second, wait)
+
+	env.advance(services.DefaultPhoneCodeTTL)
+	_, _, err = env.phones.Login(ctx, "+79121234567", env.lastCode(t, "+79121234567"))
+	assert.ErrorIs(t, err, services.ErrPhoneCodeInvalid, "codes expire")
+
+	env.advance(time.Hour)
+	require.NoError(t, env.phones.PurgeExpired(ctx))
+	var left int
+	require.NoError(t, env.repo.DB.QueryRow("SELECT COUNT(*) FROM phone_codes").Scan(&left))
+	assert.Equal(t, 0, left)
+}
+
+func TestPhoneHandler_Login(t *testing.T) {
+	ctx := context.Background()
+	env := newTestPhoneService(t)
+	alice := createTestUser(t, env.repo, "alice")
+	require.NoError(t, env.repo.SetPhone(ctx, alice, "+79121234567"))
+	env.phones.Now = time.Now
+
+	keys := services.NewHMACKeys([]byte("test-secret-key"))
+	tokens := services.NewTokenService(keys, env.repo.RefreshTokenRepository, env.repo.SessionRepository, services.NewRoleService(env.repo.RoleRepository, env.repo.UserRepository, slog.Default()), 0, 0, slog.Default())
+	auth := handlers.NewAuthHandlers(keys, env.repo.UserRepository, slog.Default(), nil, models.CartMergeSum, tokens, nil, nil, nil)
+	phoneHandler := handlers.NewPhoneHandler(env.phones, auth, slog.Default())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/auth/phone/code", phoneHandler.SendLoginCodeHandler)
+	r.POST("/api/auth/phone/login", phoneHandler.LoginHandler)
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, do(createTestRequest(http.MethodPost, "/api/auth/phone/code", gin.H{"phone": "call me"})).Code)
+
+	w := do(createTestRequest(http.MethodPost, "/api/auth/phone/code", gin.H{"phone": "8 912 123-45-67"}))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	w = do(createTestRequest(http.MethodPost, "/api/auth/phone/code", gin.H{"phone": "8 912 123-45-67"}))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	w = do(createTestRequest(http.MethodPost, "/api/auth/phone/login", gin.H{"phone": "+79121234567", "code": "000000"}))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = do(createTestRequest(http.MethodPost, "/api/auth/phone/login", gin.H{"phone": "+79121234567", "code": env.lastCode(t, "+79121234567")}))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var pair models.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pair))
+	assert.NotEmpty(t, pair.AccessToken)
+	assert.NotEmpty(t, pair.RefreshToken)
+}
@@ -0,0 +1,244 @@
+package tests
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"CartoonBurgers/services"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pricedTestCart() *models.PricedCart {
+	return &models.PricedCart{
+		Items: []models.PricedCartLine{
+			{ProductID: 1, CategoryID: 1, Quantity: 2, UnitPrice: 16000, LineTotal: 32000},
+			{ProductID: 6, CategoryID: 2, Quantity: 5, UnitPrice: 12900, LineTotal: 64500},
+		},
+		Subtotal:    96500,
+		DeliveryFee: 19900,
+		Discounts:   []models.CartDiscount{},
+		Total:       116400,
+	}
+}
+
+func TestPromoService_Apply(t *testing.T) {
+	repo := newTestAppRepository(t)
+	promos := services.NewPromoService(repo.PromoRepository, repo.OrderRepository, newTestTierService(repo))
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	promos.Now = func() time.Time { return now }
+
+	product := 6
+	snacks := 2
+	tomorrow := now.Add(24 * time.Hour)
+	yesterday := now.Add(-24 * time.Hour)
+
+	tests := []struct {
+		name     string
+		promo    models.PromoCode
+		userID   int
+		discount int64
+		err      error
+	}{
+		{name: "percent", promo: models.PromoCode{Kind: models.PromoPercent, Value: 20}, discount: 19300},
+		{name: "percent of category", promo: models.PromoCode{Kind: models.PromoPercent, Value: 10, CategoryID: &snacks}, discount: 6450},
+		{name: "fixed", promo: models.PromoCode{Kind: models.PromoFixed, Value: 50000}, discount: 50000},
+		{name: "free item", promo: models.PromoCode{Kind: models.PromoFreeItem, ProductID: &product, FreeEvery: 2}, discount: 25800},
+		{name: "free delivery", promo: models.PromoCode{Kind: models.PromoFreeDelivery}, discount: 19900},
+		{name: "free item without freeEvery", promo: models.PromoCode{Kind: models.PromoFreeItem, ProductID: &product}, err: services.ErrPromoNotApplicable},
+		{name: "minimum subtotal", promo: models.PromoCode{Kind: models.PromoFixed, Value: 100, MinSubtotal: 100000}, err: services.ErrPromoNotApplicable},
+		{name: "not started", promo: models.PromoCode{Kind: models.PromoFixed, Value: 100, StartsAt: &tomorrow}, err: services.ErrPromoInactive},
+		{name: "ended", promo: models.PromoCode{Kind: models.PromoFixed, Value: 100, EndsAt: &yesterday}, err: services.ErrPromoInactive},
+		{name: "first order needs login", promo: models.PromoCode{Kind: models.PromoFixed, Value: 100, FirstOrderOnly: true}, err: services.ErrPromoLoginRequired},
+		{name: "global limit", promo: models.PromoCode{Kind: models.PromoFixed, Value: 100, UsageLimit: 3, UsedCount: 3}, err: services.ErrPromoUsageLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cart := pricedTestCart()
+			tt.promo.Code = "TEST"
+			tt.promo.Active = true
+
+			err := promos.Apply(context.Background(), &tt.promo, tt.userID, cart)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Empty(t, cart.Discounts)
+				assert.Equal(t, int64(116400), cart.Total)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.discount, cart.Discount)
+			assert.Equal(t, 96500+19900-tt.discount, cart.Total)
+			assert.Equal(t, "TEST", cart.PromoCode)
+		})
+	}
+}
+
+func TestCartHandler_ApplyPromo(t *testing.T) {
+	r := newTestCartRouter(t)
+	cookie := &http.Cookie{Name: "cart_session", Value: "promo"}
+
+	do := func(method, url string, body interface{}) *httptest.ResponseRecorder {
+		req := createTestRequest(method, url, body)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/api/cart/add", map[string]int{"productId": 1, "quantity": 5}).Code)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/cart/promo", map[string]string{"code": "NOPE"}).Code)
+
+	w := do(http.MethodPost, "/api/cart/promo", map[string]string{"code": " burger20 "})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Cart models.PricedCart `json:"cart"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "BURGER20", response.Cart.PromoCode)
+	assert.Equal(t, int64(16000), response.Cart.Discount)
+	assert.Equal(t, int64(80000-16000+19900), response.Cart.Total)
+
+	w = do(http.MethodGet, "/api/cart", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var cart models.PricedCart
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cart))
+	assert.Equal(t, int64(16000), cart.Discount)
+
+	require.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/cart/promo", nil).Code)
+	w = do(http.MethodGet, "/api/cart", nil)
+	var cleared models.PricedCart
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cleared))
+	assert.Empty(t, cleared.PromoCode)
+	assert.Equal(t, int64(0), cleared.Discount)
+}
+
+type testOrderEnv struct {
+	repo    *repositories.AppRepository
+	carts   *services.InMemoryCartService
+	tiers   *services.TierService
+	loyalty *services.LoyaltyService
+	orders  *services.OrderService
+}
+
+func newTestOrderService(t *testing.T) testOrderEnv {
+	t.Helper()
+
+	env := testOrderEnv{repo: newTestAppRepository(t), carts: services.NewInMemoryCartService(services.CartLimits{})}
+	repo := env.repo
+
+	menu := services.NewMenuService(repo.ProductRerository, repo.CategoryRepository, "ru", time.UTC)
+	pricer := services.NewCartPricer(menu, services.CartLimits{}, services.DeliveryPricing{Fee: 19900})
+	env.tiers = newTestTierService(repo)
+	promos := services.NewPromoService(repo.PromoRepository, repo.OrderRepository, env.tiers)
+	env.loyalty = services.NewLoyaltyService(repo.BonusRepository, repo.CategoryRepository, env.tiers, services.LoyaltyRules{
+		EarnPercent:         5,
+		CategoryMultipliers: map[string]float64{"desserts": 2},
+		Lifetime:            30 * 24 * time.Hour,
+		MaxSpendPercent:     50,
+	}, slog.Default())
+	env.orders = services.NewOrderService(repo.OrderRepository, env.carts, pricer, promos, env.loyalty, slog.Default())
+
+	return env
+}
+
+func createTestUser(t *testing.T, repo *repositories.AppRepository, username string) int {
+	t.Helper()
+
+	ctx := context.Background()
+	require.NoError(t, repo.CreateUser(ctx, models.User{Username: username, Email: username + "@example.com"}, "hash"))
+	id, err := repo.GetUserID(ctx, username)
+	require.NoError(t, err)
+	return id
+}
+
+func TestOrderService_PlaceOrderRedeemsPromo(t *testing.T) {
+	ctx := context.Background()
+	env := newTestOrderService(t)
+	repo, carts, orders := env.repo, env.carts, env.orders
+
+	require.NoError(t, repo.CreatePromo(ctx, models.PromoCode{
+		Code: "ONCE", Kind: models.PromoFixed, Value: 5000, UsageLimit: 1, Active: true,
+	}))
+	require.NoError(t, repo.CreatePromo(ctx, models.PromoCode{
+		Code: "WELCOME", Kind: models.PromoPercent, Value: 10, FirstOrderOnly: true, Active: true,
+	}))
+	nuggets := 6
+	assert.Error(t, repo.CreatePromo(ctx, models.PromoCode{
+		Code: "EVERYNONE", Kind: models.PromoFreeItem, ProductID: &nuggets, Active: true,
+	}), "a free item code needs FreeEvery")
+
+	alice := createTestUser(t, repo, "alice")
+	bob := createTestUser(t, repo, "bob")
+
+	fill := func(userID int, code string) {
+		cartID := services.UserCartID(userID)
+		require.NoError(t, carts.AddToCart(ctx, cartID, models.CartItem{ProductID: 1, Quantity: 2}))
+		require.NoError(t, carts.SetPromoCode(ctx, cartID, code))
+	}
+
+	_, err := orders.PlaceOrder(ctx, alice, 0)
+	assert.ErrorIs(t, err, services.ErrCartEmpty)
+
+	fill(alice, "ONCE")
+	order, err := orders.PlaceOrder(ctx, alice, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(32000), order.Subtotal)
+	assert.Equal(t, int64(5000), order.Discount)
+	assert.Equal(t, int64(32000-5000+19900), order.Total)
+	assert.Equal(t, "ONCE", order.PromoCode)
+
+	stored, err := repo.GetOrder(ctx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, order.Total, stored.Total)
+	assert.Len(t, stored.Items, 1)
+
+	cart, err := carts.GetCart(ctx, services.UserCartID(alice))
+	require.NoError(t, err)
+	assert.Empty(t, cart)
+
+	fill(bob, "ONCE")
+	_, err = orders.PlaceOrder(ctx, bob, 0)
+	assert.ErrorIs(t, err, services.ErrPromoUsageLimit)
+
+	require.NoError(t, carts.SetPromoCode(ctx, services.UserCartID(bob), "WELCOME"))
+	_, err = orders.PlaceOrder(ctx, bob, 0)
+	require.NoError(t, err)
+
+	fill(bob, "WELCOME")
+	_, err = orders.PlaceOrder(ctx, bob, 0)
+	assert.ErrorIs(t, err, services.ErrPromoFirstOrder)
+}
+
+func TestOrderRepository_CreateOrderChecksLimitsAtomically(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	alice := createTestUser(t, repo, "alice")
+
+	require.NoError(t, repo.CreatePromo(ctx, models.PromoCode{
+		Code: "TWICE", Kind: models.PromoFixed, Value: 100, PerUserLimit: 1, Active: true,
+	}))
+	promo, err := repo.FindPromoByCode(ctx, "TWICE")
+	require.NoError(t, err)
+
+	// Both orders were priced with the same, stale, view of the code.
+	first := &models.Order{UserID: alice, Subtotal: 1000, Total: 900, PromoCode: "TWICE"}
+	second := &models.Order{UserID: alice, Subtotal: 1000, Total: 900, PromoCode: "TWICE"}
+
+	require.NoError(t, repo.CreateOrder(ctx, first, promo))
+	assert.ErrorIs(t, repo.CreateOrder(ctx, second, promo), repositories.ErrPromoUserLimit)
+
+	count, err := repo.CountUserOrders(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasPermission(t *testing.T) {
+	assert.True(t, models.HasPermission([]models.Role{models.RoleStaff}, models.PermissionManageMenu))
+	assert.False(t, models.HasPermission([]models.Role{models.RoleStaff}, models.PermissionManageRoles))
+	assert.True(t, models.HasPermission([]models.Role{models.RoleCourier, models.RoleCustomer}, models.PermissionDeliverOrders))
+	assert.False(t, models.HasPermission([]models.Role{models.RoleCustomer}, models.PermissionViewOrders))
+	assert.False(t, models.HasPermission(nil, models.PermissionPlaceOrders))
+}
+
+func TestRoleService_GrantAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	roles := services.NewRoleService(repo.RoleRepository, repo.UserRepository, slog.Default())
+
+	alice := createTestUser(t, repo, "alice")
+	bob := createTestUser(t, repo, "bob")
+
+	require.NoError(t, roles.Bootstrap(ctx, []string{"alice", "nobody"}))
+	aliceRoles, err := roles.UserRoles(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Role{models.RoleAdmin, models.RoleCustomer}, aliceRoles)
+
+	assert.ErrorIs(t, roles.Grant(ctx, bob, "pilot", alice), services.ErrUnknownRole)
+	assert.ErrorIs(t, roles.Grant(ctx, bob, models.RoleCustomer, alice), services.ErrImpliedRole)
+	assert.ErrorIs(t, roles.Grant(ctx, 999, models.RoleStaff, alice), services.ErrUserNotFound)
+
+	require.NoError(t, roles.Grant(ctx, bob, models.RoleCourier, alice))
+	require.NoError(t, roles.Grant(ctx, bob, models.RoleCourier, alice), "granting twice is a no-op")
+	bobRoles, err := roles.UserRoles(ctx, bob)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Role{models.RoleCourier, models.RoleCustomer}, bobRoles)
+
+	assert.ErrorIs(t, roles.Revoke(ctx, alice, models.RoleAdmin, alice), services.ErrLastAdmin)
+	require.NoError(t, roles.Grant(ctx, bob, models.RoleAdmin, alice))
+	require.NoError(t, roles.Revoke(ctx, alice, models.RoleAdmin, bob))
+	assert.ErrorIs(t, roles.Revoke(ctx, bob, models.RoleAdmin, bob), services.ErrLastAdmin)
+	require.NoError(t, roles.Revoke(ctx, alice, models.RoleStaff, bob), "revoking a missing role is a no-op")
+
+	require.NoError(t, roles.Bootstrap(ctx, []string{"alice"}))
+	aliceRoles, err = roles.UserRoles(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Role{models.RoleCustomer}, aliceRoles, "bootstrap only runs while there is no admin")
+}
+
+func TestRoleHandler_AdminAPI(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	logger := slog.Default()
+	roles := services.NewRoleService(repo.RoleRepository, repo.UserRepository, logger)
+	tokens := services.NewTokenService(services.NewHMACKeys([]byte("test-secret-key")), repo.RefreshTokenRepository, repo.SessionRepository, roles, 0, 0, logger)
+	auth := handlers.NewAuthHandlers(services.NewHMACKeys([]byte("test-secret-key")), repo.UserRepository, logger, nil, models.CartMergeSum, tokens, nil, nil, nil)
+	roleHandler := handlers.NewRoleHandler(roles)
+
+	admin := createTestUser(t, repo, "admin")
+	staff := createTestUser(t, repo, "staff")
+	require.NoError(t, roles.Bootstrap(ctx, []string{"admin"}))
+
+	redisClient := &MockRedisClient{}
+	redisClient.On("Exists", mock.AnythingOfType("string")).Return(int64(0), nil)
+	redisClient.On("Get", mock.AnythingOfType("string")).Return("", redis.Nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("redis", redisClient) })
+	adminGroup := r.Group("/api/admin", auth.AuthRequired())
+	manageRoles := auth.RequirePermission(models.PermissionManageRoles)
+	adminGroup.GET("/users/:id/roles", manageRoles, roleHandler.GetRolesHandler)
+	adminGroup.PUT("/users/:id/roles/:role", manageRoles, roleHandler.GrantRoleHandler)
+	adminGroup.DELETE("/users/:id/roles/:role", manageRoles, roleHandler.RevokeRoleHandler)
+	adminGroup.GET("/menu", auth.RequireRole(models.RoleStaff, models.RoleAdmin), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	tokenOf := func(username string, userID int) string {
+		pair, err := tokens.Issue(ctx, username, userID, models.SessionClient{})
+		require.NoError(t, err)
+		return pair.AccessToken
+	}
+	do := func(token, method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	adminToken := tokenOf("admin", admin)
+	staffPath := "/api/admin/users/" + strconv.Itoa(staff) + "/roles"
+
+	assert.Equal(t, http.StatusForbidden, do(tokenOf("staff", staff), http.MethodGet, staffPath).Code)
+	assert.Equal(t, http.StatusForbidden, do(tokenOf("staff", staff), http.MethodGet, "/api/admin/menu").Code)
+
+	w := do(adminToken, http.MethodPut, staffPath+"/staff")
+	require.Equal(t, http.StatusOK, w.Code)
+	var granted struct {
+		Roles       []models.Role       `json:"roles"`
+		Permissions []models.Permission `json:"permissions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &granted))
+	assert.Equal(t, []models.Role{models.RoleStaff, models.RoleCustomer}, granted.Roles)
+	assert.Contains(t, granted.Permissions, models.PermissionManageMenu)
+
+	staffToken := tokenOf("staff", staff)
+	assert.Equal(t, http.StatusNoContent, do(staffToken, http.MethodGet, "/api/admin/menu").Code, "new tokens carry the granted role")
+	assert.Equal(t, http.StatusForbidden, do(staffToken, http.MethodGet, staffPath).Code, "staff can not manage roles")
+
+	assert.Equal(t, http.StatusBadRequest, do(adminToken, http.MethodPut, staffPath+"/pilot").Code)
+	assert.Equal(t, http.StatusNotFound, do(adminToken, http.MethodPut, "/api/admin/users/999/roles/staff").Code)
+	assert.Equal(t, http.StatusConflict, do(adminToken, http.MethodDelete, "/api/admin/users/"+strconv.Itoa(admin)+"/roles/admin").Code)
+	assert.Equal(t, http.StatusOK, do(adminToken, http.MethodDelete, staffPath+"/staff").Code)
+}
@@ -0,0 +1,233 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRedis stores the keys the auth middleware and session revocation
+// use, expirations are ignored.
+type memoryRedis struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+func newMemoryRedis() *memoryRedis {
+	return &memoryRedis{keys: make(map[string]string)}
+}
+
+func (r *memoryRedis) Get(key string) *redis.StringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, ok := r.keys[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+func (r *memoryRedis) Exists(key string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[key]; ok {
+		return redis.NewIntResult(1, nil)
+	}
+	return redis.NewIntResult(0, nil)
+}
+
+func (r *memoryRedis) Set(key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[key] = fmt.Sprint(value)
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (r *memoryRedis) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[key]; ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	r.keys[key] = fmt.Sprint(value)
+	return redis.NewBoolResult(true, nil)
+}
+
+const (
+	chromeOnWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+	safariOnIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+)
+
+func TestDescribeDevice(t *testing.T) {
+	assert.Equal(t, "Chrome on Windows", services.DescribeDevice(chromeOnWindows))
+	assert.Equal(t, "Safari on iOS", services.DescribeDevice(safariOnIPhone))
+	assert.Equal(t, "Firefox on Linux", services.DescribeDevice("Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0"))
+	assert.Equal(t, "Unknown device", services.DescribeDevice(""))
+}
+
+func TestTokenService_Sessions(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	alice := createTestUser(t, repo, "alice")
+	bob := createTestUser(t, repo, "bob")
+	tokens := services.NewTokenService(services.NewHMACKeys([]byte("test-secret-key")), repo.RefreshTokenRepository, repo.SessionRepository, services.NewRoleService(repo.RoleRepository, repo.UserRepository, slog.Default()), 0, 0, slog.Default())
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	tokens.Now = func() time.Time { return now }
+
+	desktop, err := tokens.Issue(ctx, "alice", alice, models.SessionClient{IP: "10.0.0.1", UserAgent: chromeOnWindows})
+	require.NoError(t, err)
+	now = now.Add(time.Minute)
+	phone, err := tokens.Issue(ctx, "alice", alice, models.SessionClient{IP: "10.0.0.2", UserAgent: safariOnIPhone})
+	require.NoError(t, err)
+
+	now = now.Add(time.Hour)
+	_, err = tokens.Refresh(ctx, newMemoryRedis(), desktop.RefreshToken, models.SessionClient{IP: "10.0.0.3", UserAgent: chromeOnWindows})
+	require.NoError(t, err)
+
+	sessions, err := tokens.Sessions(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "Chrome on Windows", sessions[0].Device, "the most recently seen first")
+	assert.Equal(t, "10.0.0.3", sessions[0].IP)
+	assert.True(t, sessions[0].LastSeenAt.Equal(now))
+	assert.True(t, sessions[0].CreatedAt.Equal(now.Add(-time.Hour-time.Minute)))
+	assert.Equal(t, "Safari on iOS", sessions[1].Device)
+
+	redisClient := newMemoryRedis()
+	assert.ErrorIs(t, tokens.RevokeSession(ctx, redisClient, bob, sessions[1].ID), services.ErrSessionNotFound, "other users can not end the session")
+	require.NoError(t, tokens.RevokeSession(ctx, redisClient, alice, sessions[1].ID))
+	assert.ErrorIs(t, tokens.RevokeSession(ctx, redisClient, alice, sessions[1].ID), services.ErrSessionNotFound)
+
+	_, err = tokens.Refresh(ctx, newMemoryRedis(), phone.RefreshToken, models.SessionClient{})
+	assert.ErrorIs(t, err, services.ErrRefreshTokenInvalid)
+
+	sessions, err = tokens.Sessions(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "Chrome on Windows", sessions[0].Device)
+
+	now = now.Add(services.DefaultRefreshTokenTTL + time.Second)
+	sessions, err = tokens.Sessions(ctx, alice)
+	require.NoError(t, err)
+	assert.Empty(t, sessions, "sessions end with their refresh token")
+
+	require.NoError(t, tokens.PurgeExpired(ctx))
+	var left int
+	require.NoError(t, repo.DB.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&left))
+	assert.Equal(t, 0, left)
+}
+
+func TestSessionHandler_ListAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	alice := createTestUser(t, repo, "alice")
+	tokens := services.NewTokenService(services.NewHMACKeys([]byte("test-secret-key")), repo.RefreshTokenRepository, repo.SessionRepository, services.NewRoleService(repo.RoleRepository, repo.UserRepository, slog.Default()), 0, 0, slog.Default())
+	auth := handlers.NewAuthHandlers(services.NewHMACKeys([]byte("test-secret-key")), repo.UserRepository, slog.Default(), nil, models.CartMergeSum, tokens, nil, nil, nil)
+	sessionHandler := handlers.NewSessionHandler(tokens, slog.Default())
+	now := time.Now().Add(-time.Minute)
+	tokens.Now = func() time.Time { return now }
+
+	redisClient := newMemoryRedis()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("redis", redisClient) })
+	protected := r.Group("/api", auth.AuthRequired())
+	protected.GET("/profile/sessions", sessionHandler.GetSessionsHandler)
+	protected.DELETE("/profile/sessions", sessionHandler.RevokeAllSessionsHandler)
+	protected.DELETE("/profile/sessions/:id", sessionHandler.RevokeSessionHandler)
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	desktop, err := tokens.Issue(ctx, "alice", alice, models.SessionClient{IP: "10.0.0.1", UserAgent: chromeOnWindows})
+	require.NoError(t, err)
+	phone, err := tokens.Issue(ctx, "alice", alice, models.SessionClient{IP: "10.0.0.2", UserAgent: safariOnIPhone})
+	require.NoError(t, err)
+
+	w := do(http.MethodGet, "/api/profile/sessions", desktop.AccessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var sessions []models.Session
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	require.Len(t, sessions, 2)
+	var phoneID string
+	for _, s := range sessions {
+		assert.Equal(t, s.Device == "Chrome on Windows", s.Current)
+		if !s.Current {
+			phoneID = s.ID
+		}
+	}
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/profile/sessions/unknown", desktop.AccessToken).Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/profile/sessions/"+phoneID, desktop.AccessToken).Code)
+
+	w = do(http.MethodGet, "/api/profile/sessions", phone.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "the access token of the ended session stops working at once")
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/profile/sessions", desktop.AccessToken).Code)
+
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/profile/sessions", desktop.AccessToken).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/profile/sessions", desktop.AccessToken).Code)
+	_, err = tokens.Refresh(ctx, newMemoryRedis(), desktop.RefreshToken, models.SessionClient{})
+	assert.ErrorIs(t, err, services.ErrRefreshTokenInvalid)
+}
+
+func TestOptionalAuth_RevokedTokenIsGuest(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	alice := createTestUser(t, repo, "alice")
+	keys := services.NewHMACKeys([]byte("test-secret-key"))
+	tokens := services.NewTokenService(keys, repo.RefreshTokenRepository, repo.SessionRepository, services.NewRoleService(repo.RoleRepository, repo.UserRepository, slog.Default()), 0, 0, slog.Default())
+	auth := handlers.NewAuthHandlers(keys, repo.UserRepository, slog.Default(), nil, models.CartMergeSum, tokens, nil, nil, nil)
+	menu := services.NewMenuService(repo.ProductRerository, repo.CategoryRepository, "ru", time.UTC)
+	pricer := services.NewCartPricer(menu, services.CartLimits{}, services.DeliveryPricing{})
+	carts := services.NewInMemoryCartService(services.CartLimits{})
+	cartHandler := handlers.NewCartHandler(false, services.NewLocalizer("ru", []string{"ru"}), menu, carts,
+		pricer, services.NewPromoService(repo.PromoRepository, repo.OrderRepository, newTestTierService(repo)))
+	require.NoError(t, carts.AddToCart(ctx, services.UserCartID(alice), models.CartItem{ProductID: 1, Quantity: 2}))
+
+	redisClient := newMemoryRedis()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("redis", redisClient) })
+	r.GET("/api/cart", auth.OptionalAuth(), cartHandler.GetCartHandler)
+
+	cartItems := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/cart", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var cart models.PricedCart
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cart))
+		return len(cart.Items)
+	}
+
+	pair, err := tokens.Issue(ctx, "alice", alice, models.SessionClient{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, cartItems(pair.AccessToken))
+
+	sessions, err := tokens.Sessions(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.NoError(t, tokens.RevokeSession(ctx, redisClient, alice, sessions[0].ID))
+	assert.Equal(t, 0, cartItems(pair.AccessToken), "the ended session gets the guest cart")
+}
@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signTestToken(t *testing.T, keys services.JWTKeys) string {
+	t.Helper()
+	token, err := keys.Sign(jwt.MapClaims{"username": "alice", "user_id": 1, "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	return token
+}
+
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// jwkPublicKey rebuilds the public key the way another service reading the
+// JWKS would.
+func jwkPublicKey(t *testing.T, jwk models.JWK) interface{} {
+	t.Helper()
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		require.NoError(t, err)
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		require.NoError(t, err)
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		require.NoError(t, err)
+		return ed25519.PublicKey(x)
+	}
+	t.Fatalf("unexpected key type %q", jwk.Kty)
+	return nil
+}
+
+func TestRotatingKeys_RotateAndVerify(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	keys, err := services.NewRotatingKeys(repo.SigningKeyRepository, services.AlgorithmRS256, 24*time.Hour, time.Minute, 15*time.Minute, slog.Default())
+	require.NoError(t, err)
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	keys.Now = func() time.Time { return now }
+
+	_, err = keys.Sign(jwt.MapClaims{})
+	assert.ErrorIs(t, err, services.ErrNoSigningKey, "no key before the first rotation")
+
+	require.NoError(t, keys.Rotate(ctx))
+	first := signTestToken(t, keys)
+	firstKid := tokenKid(t, first)
+	require.NotEmpty(t, firstKid)
+
+	jwks := keys.JWKS()
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, models.JWK{Kty: "RSA", Kid: firstKid, Use: "sig", Alg: "RS256", N: jwks.Keys[0].N, E: "AQAB"}, jwks.Keys[0])
+	_, err = jwt.Parse(first, func(*jwt.Token) (interface{}, error) { return jwkPublicKey(t, jwks.Keys[0]), nil })
+	require.NoError(t, err, "the published key verifies the token")
+
+	other, err := services.NewRotatingKeys(repo.SigningKeyRepository, services.AlgorithmRS256, 24*time.Hour, time.Minute, 15*time.Minute, slog.Default())
+	require.NoError(t, err)
+	other.Now = keys.Now
+	require.NoError(t, other.Rotate(ctx))
+	assert.Equal(t, firstKid, tokenKid(t, signTestToken(t, other)), "instances share the keys")
+	_, err = jwt.Parse(first, other.Keyfunc)
+	require.NoError(t, err)
+
+	now = now.Add(24 * time.Hour)
+	require.NoError(t, keys.Rotate(ctx))
+	require.Len(t, keys.JWKS().Keys, 2, "the new key is published before it signs")
+	assert.Equal(t, firstKid, tokenKid(t, signTestToken(t, keys)))
+
+	require.NoError(t, other.Reload(ctx))
+	now = now.Add(10 * time.Minute)
+	second := signTestToken(t, other)
+	secondKid := tokenKid(t, second)
+	assert.NotEqual(t, firstKid, secondKid)
+	_, err = jwt.Parse(second, keys.Keyfunc)
+	require.NoError(t, err)
+	_, err = jwt.Parse(first, keys.Keyfunc)
+	require.NoError(t, err, "the old key verifies until its tokens expired")
+
+	now = now.Add(15 * time.Minute)
+	_, err = jwt.Parse(first, keys.Keyfunc)
+	assert.Error(t, err)
+	require.NoError(t, keys.Rotate(ctx))
+	jwks = keys.JWKS()
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, secondKid, jwks.Keys[0].Kid)
+}
+
+func TestRotatingKeys_RejectsOtherAlgorithms(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	keys, err := services.NewRotatingKeys(repo.SigningKeyRepository, services.AlgorithmEdDSA, 0, 0, 0, slog.Default())
+	require.NoError(t, err)
+	require.NoError(t, keys.Rotate(ctx))
+
+	token := signTestToken(t, keys)
+	jwks := keys.JWKS()
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+	assert.Equal(t, "Ed25519", jwks.Keys[0].Crv)
+	_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return jwkPublicKey(t, jwks.Keys[0]), nil })
+	require.NoError(t, err)
+
+	// An HS256 token keyed with the public key must not pass as signed
+	// with the private one.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "mallory"})
+	forged.Header["kid"] = jwks.Keys[0].Kid
+	forgedStr, err := forged.SignedString([]byte(jwkPublicKey(t, jwks.Keys[0]).(ed25519.PublicKey)))
+	require.NoError(t, err)
+	_, err = jwt.Parse(forgedStr, keys.Keyfunc)
+	assert.Error(t, err)
+
+	_, err = jwt.Parse(signTestToken(t, services.NewHMACKeys([]byte("test-secret-key"))), keys.Keyfunc)
+	assert.Error(t, err, "tokens without a known kid are rejected")
+	_, err = jwt.Parse(token, services.NewHMACKeys([]byte("test-secret-key")).Keyfunc)
+	assert.Error(t, err)
+
+	_, err = services.NewRotatingKeys(repo.SigningKeyRepository, services.AlgorithmHS256, 0, 0, 0, slog.Default())
+	assert.Error(t, err)
+}
+
+func TestRotatingKeys_AlgorithmChange(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	rsaKeys, err := services.NewRotatingKeys(repo.SigningKeyRepository, services.AlgorithmRS256, 0, 0, 0, slog.Default())
+	require.NoError(t, err)
+	require.NoError(t, rsaKeys.Rotate(ctx))
+	old := signTestToken(t, rsaKeys)
+
+	edKeys, err := services.NewRotatingKeys(repo.SigningKeyRepository, services.AlgorithmEdDSA, 0, 0, 0, slog.Default())
+	require.NoError(t, err)
+	require.NoError(t, edKeys.Rotate(ctx))
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(signTestToken(t, edKeys), jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "EdDSA", parsed.Method.Alg(), "a new algorithm signs at once")
+	_, err = jwt.Parse(old, edKeys.Keyfunc)
+	assert.NoError(t, err, "tokens of the old algorithm verify until they expire")
+}
+
+func TestJWKSHandlerAndMiddleware(t *testing.T) {
+	repo := newTestAppRepository(t)
+	keys, err := services.NewRotatingKeys(repo.SigningKeyRepository, services.AlgorithmRS256, 0, 0, 0, slog.Default())
+	require.NoError(t, err)
+	require.NoError(t, keys.Rotate(context.Background()))
+
+	redisClient := newMemoryRedis()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("redis", redisClient) })
+	r.GET("/.well-known/jwks.json", handlers.NewJWKSHandler(keys).GetJWKSHandler)
+	r.GET("/api/profile", services.AuthMiddleware(keys, slog.Default()), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+	var jwks models.JWKS
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	assert.Len(t, jwks.Keys, 1)
+
+	access, err := services.NewAccessToken(keys, services.AccessClaims{Username: "alice", UserID: 1, IssuedAt: time.Now(), ExpiresAt: time.Now().Add(time.Minute)})
+	require.NoError(t, err)
+	for token, want := range map[string]int{
+		access: http.StatusNoContent,
+		signTestToken(t, services.NewHMACKeys([]byte("test-secret-key"))): http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code)
+	}
+
+	r = gin.New()
+	r.GET("/.well-known/jwks.json", handlers.NewJWKSHandler(services.NewHMACKeys([]byte("test-secret-key"))).GetJWKSHandler)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	assert.JSONEq(t, `{"keys": []}`, w.Body.String(), "the HS256 secret is never published")
+}
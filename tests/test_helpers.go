@@ -25,6 +25,11 @@ func (mock *MockUserRepository) GetUserByUsername(ctx context.Context, name stri
 	return args.String(0), args.Error(1)
 }
 
+func (mock *MockUserRepository) GetUserID(ctx context.Context, name string) (int, error) {
+	args := mock.Called(ctx, name)
+	return args.Int(0), args.Error(1)
+}
+
 type MockPasswordHasher struct {
 	mock.Mock
 }
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"CartoonBurgers/models"
+	"CartoonBurgers/repositories"
+	"CartoonBurgers/services"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTierService(repo *repositories.AppRepository) *services.TierService {
+	return services.NewTierService(repo.TierRepository, repo.BonusRepository, nil, time.UTC, 0, slog.Default())
+}
+
+func TestTierService_RecalculateAndPerks(t *testing.T) {
+	ctx := context.Background()
+	env := newTestOrderService(t)
+	alice := createTestUser(t, env.repo, "alice")
+	bob := createTestUser(t, env.repo, "bob")
+
+	now := time.Now()
+	env.tiers.Now = func() time.Time { return now }
+
+	orderAt := func(userID int, total int64, at time.Time) {
+		require.NoError(t, env.repo.CreateOrder(ctx, &models.Order{UserID: userID, Subtotal: total, Total: total, CreatedAt: at}, nil))
+	}
+	orderAt(alice, 3000000, now.Add(-24*time.Hour))
+	orderAt(alice, 2500000, now.Add(-200*24*time.Hour))
+	// Too old to count.
+	orderAt(bob, 9000000, now.Add(-400*24*time.Hour))
+	orderAt(bob, 1600000, now.Add(-time.Hour))
+
+	info, err := env.tiers.Info(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, models.TierBronze, info.Tier)
+
+	require.NoError(t, env.tiers.Recalculate(ctx))
+
+	info, err = env.tiers.Info(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, models.TierGold, info.Tier)
+	assert.Equal(t, int64(5500000), info.Spend)
+	assert.Empty(t, info.NextTier)
+
+	info, err = env.tiers.Info(ctx, bob)
+	require.NoError(t, err)
+	assert.Equal(t, models.TierSilver, info.Tier)
+	assert.Equal(t, models.TierGold, info.NextTier)
+	assert.Equal(t, int64(5000000), info.NextTierSpend)
+
+	// Gold gets free delivery and earns twice the points.
+	cartID := services.UserCartID(alice)
+	require.NoError(t, env.carts.AddToCart(ctx, cartID, models.CartItem{ProductID: 5, Quantity: 10}))
+	order, err := env.orders.PlaceOrder(ctx, alice, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), order.DeliveryFee)
+	assert.Equal(t, int64(390000), order.Total)
+	assert.Equal(t, int64(390), order.BonusEarned)
+
+	// Gold only codes are refused to silver users.
+	require.NoError(t, env.repo.CreatePromo(ctx, models.PromoCode{
+		Code: "GOLDONLY", Kind: models.PromoFixed, Value: 1000, MinTier: models.TierGold, Active: true,
+	}))
+	promos := services.NewPromoService(env.repo.PromoRepository, env.repo.OrderRepository, env.tiers)
+
+	cart := pricedTestCart()
+	_, err = promos.ApplyCode(ctx, "GOLDONLY", bob, cart)
+	assert.ErrorIs(t, err, services.ErrPromoNotApplicable)
+
+	cart = pricedTestCart()
+	_, err = promos.ApplyCode(ctx, "GOLDONLY", alice, cart)
+	assert.NoError(t, err)
+}
+
+func TestTierService_BirthdayBonusOncePerYear(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	tiers := newTestTierService(repo)
+
+	require.NoError(t, repo.CreateUser(ctx, models.User{Username: "leap", Email: "leap@example.com", Birthday: "2000-02-29"}, "hash"))
+	require.NoError(t, repo.CreateUser(ctx, models.User{Username: "other", Email: "other@example.com", Birthday: "2000-03-01"}, "hash"))
+	leap, err := repo.GetUserID(ctx, "leap")
+	require.NoError(t, err)
+	other, err := repo.GetUserID(ctx, "other")
+	require.NoError(t, err)
+
+	now := time.Date(2025, 2, 28, 3, 0, 0, 0, time.UTC)
+	tiers.Now = func() time.Time { return now }
+
+	require.NoError(t, tiers.Recalculate(ctx))
+	require.NoError(t, tiers.Recalculate(ctx))
+
+	balance, err := repo.GetBonusBalance(ctx, leap, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), balance)
+
+	balance, err = repo.GetBonusBalance(ctx, other, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), balance)
+
+	saved, err := repo.SetBirthday(ctx, leap, "2001-01-01")
+	require.NoError(t, err)
+	assert.False(t, saved)
+}
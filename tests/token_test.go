@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"CartoonBurgers/handlers"
+	"CartoonBurgers/models"
+	"CartoonBurgers/services"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenService_RefreshRotation(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	alice := createTestUser(t, repo, "alice")
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	tokens := services.NewTokenService(services.NewHMACKeys([]byte("test-secret-key")), repo.RefreshTokenRepository, repo.SessionRepository, services.NewRoleService(repo.RoleRepository, repo.UserRepository, slog.Default()), 10*time.Minute, 24*time.Hour, slog.Default())
+	tokens.Now = func() time.Time { return now }
+
+	first, err := tokens.Issue(ctx, "alice", alice, models.SessionClient{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.AccessToken)
+	assert.NotEmpty(t, first.RefreshToken)
+
+	second, err := tokens.Refresh(ctx, newMemoryRedis(), first.RefreshToken, models.SessionClient{})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(second.AccessToken, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("test-secret-key"), nil
+	}, jwt.WithTimeFunc(func() time.Time { return now }))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims["username"])
+	assert.Equal(t, float64(alice), claims["user_id"])
+	assert.Equal(t, float64(now.Add(10*time.Minute).Unix()), claims["exp"])
+
+	marks := newMemoryRedis()
+	_, err = tokens.Refresh(ctx, marks, first.RefreshToken, models.SessionClient{})
+	assert.ErrorIs(t, err, services.ErrRefreshTokenReused)
+	revoked, err := marks.Exists("session_revoked:" + claims["sid"].(string)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), revoked, "reuse ends the access tokens of the session too")
+	_, err = tokens.Refresh(ctx, newMemoryRedis(), second.RefreshToken, models.SessionClient{})
+	assert.ErrorIs(t, err, services.ErrRefreshTokenInvalid, "reuse revokes the whole family")
+
+	_, err = tokens.Refresh(ctx, newMemoryRedis(), "unknown", models.SessionClient{})
+	assert.ErrorIs(t, err, services.ErrRefreshTokenInvalid)
+
+	other, err := tokens.Issue(ctx, "alice", alice, models.SessionClient{})
+	require.NoError(t, err)
+	now = now.Add(25 * time.Hour)
+	_, err = tokens.Refresh(ctx, newMemoryRedis(), other.RefreshToken, models.SessionClient{})
+	assert.ErrorIs(t, err, services.ErrRefreshTokenInvalid, "expired")
+
+	require.NoError(t, tokens.PurgeExpired(ctx))
+	_, err = tokens.Refresh(ctx, newMemoryRedis(), first.RefreshToken, models.SessionClient{})
+	assert.ErrorIs(t, err, services.ErrRefreshTokenInvalid, "purged tokens are unknown")
+}
+
+func TestTokenService_Revoke(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestAppRepository(t)
+	alice := createTestUser(t, repo, "alice")
+	tokens := services.NewTokenService(services.NewHMACKeys([]byte("test-secret-key")), repo.RefreshTokenRepository, repo.SessionRepository, services.NewRoleService(repo.RoleRepository, repo.UserRepository, slog.Default()), 0, 0, slog.Default())
+
+	pair, err := tokens.Issue(ctx, "alice", alice, models.SessionClient{})
+	require.NoError(t, err)
+	rotated, err := tokens.Refresh(ctx, newMemoryRedis(), pair.RefreshToken, models.SessionClient{})
+	require.NoError(t, err)
+
+	require.NoError(t, tokens.Revoke(ctx, pair.RefreshToken))
+	_, err = tokens.Refresh(ctx, newMemoryRedis(), rotated.RefreshToken, models.SessionClient{})
+	assert.ErrorIs(t, err, services.ErrRefreshTokenInvalid)
+}
+
+func TestAuthHandlers_RefreshAndLogout(t *testing.T) {
+	repo := newTestAppRepository(t)
+	alice := createTestUser(t, repo, "alice")
+	tokens := services.NewTokenService(services.NewHMACKeys([]byte("test-secret-key")), repo.RefreshTokenRepository, repo.SessionRepository, services.NewRoleService(repo.RoleRepository, repo.UserRepository, slog.Default()), 0, 0, slog.Default())
+	auth := handlers.NewAuthHandlers(services.NewHMACKeys([]byte("test-secret-key")), repo.UserRepository, slog.Default(), nil, models.CartMergeSum, tokens, nil, nil, nil)
+
+	redisClient := &MockRedisClient{}
+	redisClient.On("SetNX", mock.MatchedBy(func(key string) bool { return strings.HasPrefix(key, "blacklist:") }), "1", mock.Anything).Return(true, nil)
+	redisClient.On("Set", mock.MatchedBy(func(key string) bool { return strings.HasPrefix(key, "session_revoked:") }), 1, mock.Anything).Return("OK", nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("redis", redisClient) })
+	r.POST("/api/auth/refresh", auth.RefreshHandler)
+	r.POST("/api/auth/logout", auth.GetLogoutHandler)
+
+	post := func(path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	pair, err := tokens.Issue(context.Background(), "alice", alice, models.SessionClient{})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, post("/api/auth/refresh", `{}`, "").Code)
+
+	w := post("/api/auth/refresh", `{"refreshToken": "`+pair.RefreshToken+`"}`, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var refreshed models.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+	assert.NotEmpty(t, refreshed.AccessToken)
+	assert.NotEmpty(t, refreshed.RefreshToken)
+
+	assert.Equal(t, http.StatusUnauthorized, post("/api/auth/refresh", `{"refreshToken": "`+pair.RefreshToken+`"}`, "").Code)
+
+	second, err := tokens.Issue(context.Background(), "alice", alice, models.SessionClient{})
+	require.NoError(t, err)
+	w = post("/api/auth/logout", `{"refreshToken": "`+second.RefreshToken+`"}`, second.AccessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/api/auth/refresh", `{"refreshToken": "`+second.RefreshToken+`"}`, "").Code)
+	redisClient.AssertExpectations(t)
+}